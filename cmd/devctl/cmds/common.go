@@ -8,6 +8,8 @@ import (
 
 	"github.com/go-go-golems/devctl/pkg/config"
 	"github.com/go-go-golems/devctl/pkg/runtime"
+	"github.com/go-go-golems/devctl/pkg/state"
+	"github.com/go-go-golems/devctl/pkg/trust"
 	glazedlayers "github.com/go-go-golems/glazed/pkg/cmds/layers"
 	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
 	"github.com/pkg/errors"
@@ -22,6 +24,10 @@ type RepoSettings struct {
 	Strict   bool   `glazed.parameter:"strict"`
 	DryRun   bool   `glazed.parameter:"dry-run"`
 	Timeout  string `glazed.parameter:"timeout"` // duration string, e.g. "30s"
+	Profile  string `glazed.parameter:"profile"`
+	Instance string `glazed.parameter:"instance"`
+
+	AllowUntrusted bool `glazed.parameter:"allow-untrusted-plugins"`
 }
 
 type RepoContext struct {
@@ -31,6 +37,10 @@ type RepoContext struct {
 	Strict     bool
 	DryRun     bool
 	Timeout    time.Duration
+	Profile    string
+	Instance   string
+
+	AllowUntrusted bool
 }
 
 func (rc RepoContext) RequestMeta() runtime.RequestMeta {
@@ -38,6 +48,7 @@ func (rc RepoContext) RequestMeta() runtime.RequestMeta {
 		RepoRoot: rc.RepoRoot,
 		Cwd:      rc.Cwd,
 		DryRun:   rc.DryRun,
+		Instance: rc.Instance,
 	}
 }
 
@@ -59,6 +70,12 @@ func repoContextFromSettings(settings RepoSettings, cwd string) (RepoContext, er
 	}
 
 	timeoutStr := settings.Timeout
+	if timeoutStr == "" {
+		// Personal default from the layered config; load errors surface later.
+		if layers, err := config.LoadLayered(cfgPath); err == nil {
+			timeoutStr = layers.File.Timeout
+		}
+	}
 	if timeoutStr == "" {
 		timeoutStr = "30s"
 	}
@@ -69,6 +86,10 @@ func repoContextFromSettings(settings RepoSettings, cwd string) (RepoContext, er
 	if timeout <= 0 {
 		return RepoContext{}, errors.New("timeout must be > 0")
 	}
+	instance, err := state.ResolveInstance(repoRoot, settings.Instance)
+	if err != nil {
+		return RepoContext{}, err
+	}
 
 	return RepoContext{
 		RepoRoot:   repoRoot,
@@ -77,6 +98,10 @@ func repoContextFromSettings(settings RepoSettings, cwd string) (RepoContext, er
 		Strict:     settings.Strict,
 		DryRun:     settings.DryRun,
 		Timeout:    timeout,
+		Profile:    settings.Profile,
+		Instance:   instance,
+
+		AllowUntrusted: settings.AllowUntrusted || trust.AllowedByEnv(),
 	}, nil
 }
 
@@ -118,6 +143,18 @@ func RepoContextFromCobra(cmd *cobra.Command) (RepoContext, error) {
 	if err != nil {
 		return RepoContext{}, err
 	}
+	profile, err := cmd.Flags().GetString("profile")
+	if err != nil {
+		return RepoContext{}, err
+	}
+	instance, err := cmd.Flags().GetString("instance")
+	if err != nil {
+		return RepoContext{}, err
+	}
+	allowUntrusted, err := cmd.Flags().GetBool("allow-untrusted-plugins")
+	if err != nil {
+		return RepoContext{}, err
+	}
 
 	return repoContextFromSettings(RepoSettings{
 		RepoRoot: repoRoot,
@@ -125,6 +162,10 @@ func RepoContextFromCobra(cmd *cobra.Command) (RepoContext, error) {
 		Strict:   strict,
 		DryRun:   dryRun,
 		Timeout:  timeoutStr,
+		Profile:  profile,
+		Instance: instance,
+
+		AllowUntrusted: allowUntrusted,
 	}, cwd)
 }
 
@@ -170,8 +211,26 @@ func getRepoLayer() (*glazedlayers.ParameterLayerImpl, error) {
 			parameters.NewParameterDefinition(
 				"timeout",
 				parameters.ParameterTypeString,
-				parameters.WithDefault("30s"),
-				parameters.WithHelp("Default timeout for plugin operations (duration like 30s)"),
+				parameters.WithDefault(""),
+				parameters.WithHelp("Timeout for plugin operations (duration like 30s; defaults to `timeout` in config, then 30s)"),
+			),
+			parameters.NewParameterDefinition(
+				"profile",
+				parameters.ParameterTypeString,
+				parameters.WithDefault(""),
+				parameters.WithHelp("Profile from .devctl.yaml (defaults to $DEVCTL_PROFILE, then default_profile)"),
+			),
+			parameters.NewParameterDefinition(
+				"instance",
+				parameters.ParameterTypeString,
+				parameters.WithDefault(""),
+				parameters.WithHelp("Instance name for running several copies of the repo (defaults to $DEVCTL_INSTANCE, then the git worktree name)"),
+			),
+			parameters.NewParameterDefinition(
+				"allow-untrusted-plugins",
+				parameters.ParameterTypeBool,
+				parameters.WithDefault(false),
+				parameters.WithHelp("Run plugins you have not trusted without asking (also $DEVCTL_ALLOW_UNTRUSTED_PLUGINS)"),
 			),
 		)
 
@@ -192,6 +251,10 @@ type rootOptions struct {
 	Strict   bool
 	DryRun   bool
 	Timeout  time.Duration
+	Profile  string
+	Instance string
+
+	AllowUntrusted bool
 }
 
 func getRootOptions(cmd *cobra.Command) (rootOptions, error) {
@@ -205,6 +268,10 @@ func getRootOptions(cmd *cobra.Command) (rootOptions, error) {
 		Strict:   rc.Strict,
 		DryRun:   rc.DryRun,
 		Timeout:  rc.Timeout,
+		Profile:  rc.Profile,
+		Instance: rc.Instance,
+
+		AllowUntrusted: rc.AllowUntrusted,
 	}, nil
 }
 
@@ -217,5 +284,6 @@ func requestMetaFromRootOptions(opts rootOptions) (runtime.RequestMeta, error) {
 		RepoRoot: opts.RepoRoot,
 		Cwd:      cwd,
 		DryRun:   opts.DryRun,
+		Instance: opts.Instance,
 	}, nil
 }
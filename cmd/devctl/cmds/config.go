@@ -0,0 +1,196 @@
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/go-go-golems/devctl/pkg/config"
+	"github.com/go-go-golems/devctl/pkg/engine"
+	"github.com/go-go-golems/devctl/pkg/patch"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func newConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect devctl config files and the config produced by config.mutate",
+	}
+	cmd.AddCommand(newConfigShowCmd())
+	cmd.AddCommand(newConfigExplainCmd())
+	cmd.AddCommand(newConfigSourcesCmd())
+	return cmd
+}
+
+func newConfigShowCmd() *cobra.Command {
+	var withProvenance bool
+
+	cmd := &cobra.Command{
+		Use:   "show",
+		Short: "Print the final config after all plugins ran",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rc, err := RepoContextFromCobra(cmd)
+			if err != nil {
+				return err
+			}
+			return withPipeline(cmd.Context(), rc, func(p *engine.Pipeline, conf patch.Config) error {
+				var out any = conf
+				if withProvenance {
+					out = map[string]any{
+						"config":     conf,
+						"provenance": p.Provenance.Writes,
+					}
+				}
+				b, err := json.MarshalIndent(out, "", "  ")
+				if err != nil {
+					return errors.Wrap(err, "marshal config")
+				}
+				_, _ = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+				return nil
+			})
+		},
+	}
+	cmd.Flags().BoolVar(&withProvenance, "provenance", false, "Include the ordered list of writes")
+	AddRepoFlags(cmd)
+	return cmd
+}
+
+func newConfigExplainCmd() *cobra.Command {
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "explain <dotted.key>",
+		Short: "Show the final value of a config key and which plugins wrote it",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rc, err := RepoContextFromCobra(cmd)
+			if err != nil {
+				return err
+			}
+			key := args[0]
+			return withPipeline(cmd.Context(), rc, func(p *engine.Pipeline, conf patch.Config) error {
+				value, ok := patch.Lookup(conf, key)
+				chain := p.Provenance.Explain(key)
+				if asJSON {
+					b, err := json.MarshalIndent(map[string]any{
+						"key":     key,
+						"present": ok,
+						"value":   value,
+						"writes":  chain,
+					}, "", "  ")
+					if err != nil {
+						return errors.Wrap(err, "marshal explain")
+					}
+					_, _ = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+					return nil
+				}
+				printExplain(cmd.OutOrStdout(), key, value, ok, chain)
+				return nil
+			})
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print JSON instead of text")
+	AddRepoFlags(cmd)
+	return cmd
+}
+
+func newConfigSourcesCmd() *cobra.Command {
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "sources",
+		Short: "Show the user, repo and local config files and which one set each key",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rc, err := RepoContextFromCobra(cmd)
+			if err != nil {
+				return err
+			}
+			layers, err := config.LoadLayered(rc.ConfigPath)
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				b, err := json.MarshalIndent(map[string]any{
+					"layers":        layers.Layers,
+					"contributions": layers.Contributions,
+				}, "", "  ")
+				if err != nil {
+					return errors.Wrap(err, "marshal sources")
+				}
+				_, _ = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+				return nil
+			}
+			printSources(cmd.OutOrStdout(), layers)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print JSON instead of text")
+	AddRepoFlags(cmd)
+	return cmd
+}
+
+func printSources(w io.Writer, layers *config.Layered) {
+	_, _ = fmt.Fprintln(w, "Files (later wins):")
+	for _, l := range layers.Layers {
+		status := "missing"
+		if l.Exists {
+			status = "loaded"
+		}
+		_, _ = fmt.Fprintf(w, "  %-5s %-7s %s\n", l.Name, status, l.Path)
+	}
+
+	var keys []string
+	setBy := map[string][]string{}
+	for _, c := range layers.Contributions {
+		if _, ok := setBy[c.Key]; !ok {
+			keys = append(keys, c.Key)
+		}
+		setBy[c.Key] = append(setBy[c.Key], c.Layer)
+	}
+	if len(keys) == 0 {
+		return
+	}
+	sort.Strings(keys)
+	_, _ = fmt.Fprintln(w, "Keys:")
+	for _, k := range keys {
+		by := setBy[k]
+		line := fmt.Sprintf("  %-40s %s", k, by[len(by)-1])
+		if len(by) > 1 {
+			line += " (overrides " + strings.Join(by[:len(by)-1], ", ") + ")"
+		}
+		_, _ = fmt.Fprintln(w, line)
+	}
+}
+
+func printExplain(w io.Writer, key string, value any, present bool, chain []patch.Write) {
+	if present {
+		_, _ = fmt.Fprintf(w, "%s = %s\n", key, formatConfigValue(value))
+	} else {
+		_, _ = fmt.Fprintf(w, "%s is not set\n", key)
+	}
+	if len(chain) == 0 {
+		_, _ = fmt.Fprintln(w, "  (no plugin wrote this key)")
+		return
+	}
+	for i, wr := range chain {
+		line := fmt.Sprintf("  %d. %-5s %s by %s (%s)", i+1, wr.Action, wr.Key, wr.Source, wr.Op)
+		if wr.Action == "set" {
+			line += ": " + formatConfigValue(wr.Value)
+		}
+		if wr.Existed {
+			line += " (was " + formatConfigValue(wr.Previous) + ")"
+		}
+		_, _ = fmt.Fprintln(w, line)
+	}
+}
+
+func formatConfigValue(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
@@ -139,7 +139,7 @@ func newE2ECmd() *cobra.Command {
 			}
 			defer func() { _ = sup.Stop(context.Background(), st) }()
 
-			if err := state.Save(repoRoot, st); err != nil {
+			if err := state.Save(repoRoot, "", st); err != nil {
 				return err
 			}
 
@@ -163,7 +163,7 @@ func newE2ECmd() *cobra.Command {
 			if err := sup.Stop(ctx, st); err != nil {
 				return err
 			}
-			if err := state.Remove(repoRoot); err != nil {
+			if err := state.Remove(repoRoot, ""); err != nil {
 				return err
 			}
 
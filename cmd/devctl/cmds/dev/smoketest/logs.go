@@ -60,7 +60,7 @@ func newLogsCmd() *cobra.Command {
 			}
 			defer func() { _ = sup.Stop(context.Background(), st) }()
 
-			if err := state.Save(repoRoot, st); err != nil {
+			if err := state.Save(repoRoot, "", st); err != nil {
 				return err
 			}
 
@@ -100,7 +100,7 @@ func newLogsCmd() *cobra.Command {
 			if err := sup.Stop(ctx, st); err != nil {
 				return err
 			}
-			if err := state.Remove(repoRoot); err != nil {
+			if err := state.Remove(repoRoot, ""); err != nil {
 				return err
 			}
 
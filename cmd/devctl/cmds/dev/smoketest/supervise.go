@@ -94,7 +94,7 @@ func newSuperviseCmd() *cobra.Command {
 			}
 			defer func() { _ = sup.Stop(context.Background(), st) }()
 
-			if err := state.Save(repoRoot, st); err != nil {
+			if err := state.Save(repoRoot, "", st); err != nil {
 				return err
 			}
 
@@ -3,37 +3,159 @@ package cmds
 import (
 	"context"
 	"fmt"
+	"path/filepath"
+	"strings"
 
+	"github.com/go-go-golems/devctl/pkg/config"
+	"github.com/go-go-golems/devctl/pkg/engine"
+	"github.com/go-go-golems/devctl/pkg/patch"
+	"github.com/go-go-golems/devctl/pkg/registry"
+	"github.com/go-go-golems/devctl/pkg/repository"
 	"github.com/go-go-golems/devctl/pkg/state"
 	"github.com/go-go-golems/devctl/pkg/supervise"
+	"github.com/go-go-golems/devctl/pkg/workspace"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
 
 func newDownCmd() *cobra.Command {
+	var skipTeardown bool
+	var all bool
+	var repoFilter string
+
 	cmd := &cobra.Command{
 		Use:   "down",
-		Short: "Stop supervised services and remove state",
+		Short: "Stop supervised services, run plugin teardown.run and remove state",
+		Long: "Stops the current repo instance. With --all, stops every environment in the\n" +
+			"global registry (see `devctl ps --all`), including stale ones whose processes\n" +
+			"died; with --repo, every instance of one repo.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			opts, err := getRootOptions(cmd)
+			rc, err := RepoContextFromCobra(cmd)
 			if err != nil {
 				return err
 			}
-			st, err := state.Load(opts.RepoRoot)
-			if err != nil {
-				return err
+			if all && repoFilter != "" {
+				return errors.New("--all and --repo are mutually exclusive")
+			}
+			if !all && repoFilter == "" {
+				if err := downOne(cmd.Context(), rc, skipTeardown); err != nil {
+					return err
+				}
+				_, _ = fmt.Fprintln(cmd.OutOrStdout(), "ok")
+				return nil
 			}
 
-			sup := supervise.New(supervise.Options{RepoRoot: opts.RepoRoot, ShutdownTimeout: opts.Timeout})
-			stopCtx, cancel := context.WithTimeout(cmd.Context(), opts.Timeout)
-			defer cancel()
-			_ = sup.Stop(stopCtx, st)
-			if err := state.Remove(opts.RepoRoot); err != nil {
+			if repoFilter != "" {
+				if repoFilter, err = filepath.Abs(repoFilter); err != nil {
+					return err
+				}
+			}
+			envs, _, err := registry.Reconcile()
+			if err != nil {
 				return err
 			}
-			_, _ = fmt.Fprintln(cmd.OutOrStdout(), "ok")
+			var failed []string
+			stopped := 0
+			for _, env := range envs {
+				if repoFilter != "" && env.RepoRoot != repoFilter {
+					continue
+				}
+				envRC := rc
+				envRC.RepoRoot, envRC.Cwd, envRC.Instance = env.RepoRoot, env.RepoRoot, env.Instance
+				envRC.ConfigPath = env.ConfigPath
+				if envRC.ConfigPath == "" {
+					envRC.ConfigPath = config.DefaultPath(env.RepoRoot)
+				}
+				envRC.Profile = ""
+				label := env.RepoRoot + " (" + state.InstanceName(env.Instance) + ")"
+				if err := downOne(cmd.Context(), envRC, skipTeardown); err != nil {
+					log.Error().Err(err).Str("repo", env.RepoRoot).Str("instance", state.InstanceName(env.Instance)).Msg("down failed")
+					failed = append(failed, label)
+					continue
+				}
+				stopped++
+				verb := "stopped"
+				if env.Stale() {
+					verb = "cleaned up stale"
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s %s\n", verb, label)
+			}
+			if len(failed) > 0 {
+				return errors.Errorf("down failed for: %s", strings.Join(failed, ", "))
+			}
+			if stopped == 0 {
+				_, _ = fmt.Fprintln(cmd.OutOrStdout(), "nothing running")
+			}
 			return nil
 		},
 	}
+	cmd.Flags().BoolVar(&skipTeardown, "skip-teardown", false, "Skip teardown.run")
+	cmd.Flags().BoolVar(&all, "all", false, "Stop every registered environment")
+	cmd.Flags().StringVar(&repoFilter, "repo", "", "Stop every instance of the repo at this path")
 	AddRepoFlags(cmd)
 	return cmd
 }
+
+// downOne stops the services in rc's state, runs teardown and forgets the
+// environment.
+func downOne(ctx context.Context, rc RepoContext, skipTeardown bool) error {
+	st, err := state.Load(rc.RepoRoot, rc.Instance)
+	if err != nil {
+		return err
+	}
+
+	trusted := workspace.StopHooksTrusted(st, repository.Options{RepoRoot: rc.RepoRoot, ConfigPath: rc.ConfigPath, Cwd: rc.RepoRoot, Profile: st.Profile, Instance: rc.Instance, AllowUntrusted: rc.AllowUntrusted})
+	sup := supervise.New(supervise.Options{RepoRoot: rc.RepoRoot, Instance: rc.Instance, ShutdownTimeout: rc.Timeout, SkipStopHooks: !trusted})
+	// Each service is bounded by its own stop timeout.
+	_ = sup.Stop(ctx, st)
+
+	var teardownErr error
+	if !skipTeardown {
+		teardownErr = runTeardown(ctx, rc, st)
+	}
+
+	if err := state.Remove(rc.RepoRoot, rc.Instance); err != nil {
+		return err
+	}
+	if err := registry.Unregister(rc.RepoRoot, rc.Instance); err != nil {
+		log.Warn().Err(err).Msg("failed to unregister environment")
+	}
+	return teardownErr
+}
+
+func runTeardown(ctx context.Context, rc RepoContext, st *state.State) error {
+	if st.Workspace != "" {
+		ws, err := workspace.Load(rc.RepoRoot)
+		if err != nil {
+			return err
+		}
+		return workspace.Teardown(ctx, ws, st, workspace.UpOptions{Instance: rc.Instance, Strict: rc.Strict, Timeout: rc.Timeout, AllowUntrusted: rc.AllowUntrusted})
+	}
+	if rc.Profile == "" {
+		rc.Profile = st.Profile
+	}
+	services := make([]string, 0, len(st.Services))
+	for _, svc := range st.Services {
+		services = append(services, svc.Name)
+	}
+	return withPipelineFor(ctx, rc, "teardown.run", func(p *engine.Pipeline, conf patch.Config) error {
+		opCtx, cancel := context.WithTimeout(ctx, rc.Timeout)
+		defer cancel()
+		tr, err := p.Teardown(opCtx, conf, services)
+		if err != nil {
+			return errors.Wrap(err, "teardown")
+		}
+		var failed []string
+		for _, step := range tr.Steps {
+			log.Info().Str("step", step.Name).Bool("ok", step.Ok).Int64("duration_ms", step.DurationMs).Msg("teardown step")
+			if !step.Ok {
+				failed = append(failed, step.Name)
+			}
+		}
+		if len(failed) > 0 {
+			return errors.Errorf("teardown failed: %v", failed)
+		}
+		return nil
+	})
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/go-go-golems/devctl/pkg/protocol"
 	"github.com/go-go-golems/devctl/pkg/repository"
 	"github.com/go-go-golems/devctl/pkg/runtime"
+	"github.com/go-go-golems/devctl/pkg/trust"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
@@ -20,7 +21,7 @@ import (
 )
 
 func AddDynamicPluginCommands(root *cobra.Command, args []string) error {
-	repoRoot, cfgPath, positionals, err := parseRepoArgs(args)
+	repoRoot, cfgPath, allowUntrusted, positionals, err := parseRepoArgs(args)
 	if err != nil {
 		return err
 	}
@@ -34,7 +35,14 @@ func AddDynamicPluginCommands(root *cobra.Command, args []string) error {
 		return nil
 	}
 
-	repo, err := repository.Load(repository.Options{RepoRoot: repoRoot, ConfigPath: cfgPath, Cwd: repoRoot, DryRun: false})
+	loadOpts := repository.Options{RepoRoot: repoRoot, ConfigPath: cfgPath, Cwd: repoRoot, DryRun: false, AllowUntrusted: allowUntrusted || trust.AllowedByEnv()}
+	if positionals[0] == "completion" {
+		// Never prompt while a shell is generating completions.
+		loadOpts.SkipUntrusted = true
+	} else {
+		loadOpts.ConfirmTrust = trustPrompt(os.Stdin, os.Stderr)
+	}
+	repo, err := repository.Load(loadOpts)
 	if err != nil {
 		return err
 	}
@@ -90,10 +98,11 @@ func AddDynamicPluginCommands(root *cobra.Command, args []string) error {
 					return err
 				}
 
-				cfg, err := config.LoadOptional(opts.Config)
+				layers, err := config.LoadLayered(opts.Config)
 				if err != nil {
 					return err
 				}
+				cfg := layers.File
 				if !opts.Strict && cfg.Strictness == "error" {
 					opts.Strict = true
 				}
@@ -139,13 +148,14 @@ func AddDynamicPluginCommands(root *cobra.Command, args []string) error {
 	return nil
 }
 
-func parseRepoArgs(args []string) (string, string, []string, error) {
+func parseRepoArgs(args []string) (string, string, bool, []string, error) {
 	fs := pflag.NewFlagSet("devctl-bootstrap", pflag.ContinueOnError)
 	fs.ParseErrorsAllowlist.UnknownFlags = true
 	fs.SetInterspersed(true)
 	fs.SetOutput(io.Discard)
 	fs.String("repo-root", "", "")
 	fs.String("config", "", "")
+	fs.Bool("allow-untrusted-plugins", false, "")
 	_ = fs.Parse(args[1:])
 
 	repoRoot := ""
@@ -156,12 +166,12 @@ func parseRepoArgs(args []string) (string, string, []string, error) {
 	if repoRoot == "" {
 		repoRoot, err = os.Getwd()
 		if err != nil {
-			return "", "", nil, err
+			return "", "", false, nil, err
 		}
 	}
 	repoRoot, err = filepath.Abs(repoRoot)
 	if err != nil {
-		return "", "", nil, err
+		return "", "", false, nil, err
 	}
 
 	cfgPath, _ = fs.GetString("config")
@@ -170,7 +180,8 @@ func parseRepoArgs(args []string) (string, string, []string, error) {
 	} else if !filepath.IsAbs(cfgPath) {
 		cfgPath = filepath.Join(repoRoot, cfgPath)
 	}
-	return repoRoot, cfgPath, fs.Args(), nil
+	allowUntrusted, _ := fs.GetBool("allow-untrusted-plugins")
+	return repoRoot, cfgPath, allowUntrusted, fs.Args(), nil
 }
 
 func rootHasCommand(root *cobra.Command, name string) bool {
@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/go-go-golems/devctl/pkg/trust"
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/require"
 )
@@ -25,10 +26,16 @@ func TestDynamicCommands_RegisterAndRun(t *testing.T) {
 
 	root := &cobra.Command{Use: "devctl"}
 
+	// The plugin is not trusted yet.
+	err = AddDynamicPluginCommands(root, []string{"devctl", "--repo-root", repoRoot, "--config", cfgPath, "echo"})
+	var untrusted *trust.UntrustedError
+	require.ErrorAs(t, err, &untrusted)
+
 	err = AddDynamicPluginCommands(root, []string{
 		"devctl",
 		"--repo-root", repoRoot,
 		"--config", cfgPath,
+		"--allow-untrusted-plugins",
 		"echo",
 	})
 	require.NoError(t, err)
@@ -0,0 +1,108 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/go-go-golems/devctl/pkg/engine"
+	"github.com/go-go-golems/devctl/pkg/patch"
+	"github.com/go-go-golems/devctl/pkg/repository"
+	"github.com/go-go-golems/devctl/pkg/state"
+	"github.com/go-go-golems/devctl/pkg/supervise"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func newJobCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "job",
+		Short: "Run one-shot jobs (kind: job) from the launch plan",
+	}
+	cmd.AddCommand(newJobRunCmd())
+	return cmd
+}
+
+func newJobRunCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "run <job>",
+		Short: "Run a job again and wait for it to finish",
+		Long: "Re-evaluates the launch plan, runs the named job and waits for it. When the\n" +
+			"environment is up, the job's record in state is replaced, so status and the\n" +
+			"TUI show the new outcome and logs. Dependencies are not restarted.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rc, err := RepoContextFromCobra(cmd)
+			if err != nil {
+				return err
+			}
+			st, err := state.Load(rc.RepoRoot, rc.Instance)
+			if err != nil {
+				if !os.IsNotExist(errors.Cause(err)) {
+					return err
+				}
+				st = nil
+			}
+			if st != nil && st.Workspace != "" {
+				return errors.New("re-running jobs of a workspace is not supported; use devctl up --workspace --force")
+			}
+			if st != nil && rc.Profile == "" {
+				rc.Profile = st.Profile
+			}
+
+			rec, err := runJob(cmd.Context(), rc, args[0])
+			if rec.Name != "" && st != nil {
+				st.SetService(rec)
+				if serr := state.Save(rc.RepoRoot, rc.Instance, st); serr != nil {
+					return serr
+				}
+			}
+			if err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "job %s succeeded\n", args[0])
+			return nil
+		},
+	}
+	AddRepoFlags(cmd)
+	return cmd
+}
+
+// runJob evaluates the launch plan and runs the job called name.
+func runJob(ctx context.Context, rc RepoContext, name string) (state.ServiceRecord, error) {
+	var rec state.ServiceRecord
+	err := withRepoPipeline(ctx, rc, func(repo *repository.Repository, p *engine.Pipeline, conf patch.Config) error {
+		opCtx, cancel := context.WithTimeout(ctx, rc.Timeout)
+		plan, err := p.LaunchPlan(opCtx, conf)
+		cancel()
+		if err != nil {
+			return err
+		}
+		plan = repo.FilterPlan(plan)
+		var spec *engine.ServiceSpec
+		for i := range plan.Services {
+			if plan.Services[i].Name == name {
+				spec = &plan.Services[i]
+			}
+		}
+		if spec == nil {
+			return errors.Errorf("unknown job %q", name)
+		}
+		if !spec.IsJob() {
+			return errors.Errorf("%q is a service, not a job (kind: job)", name)
+		}
+
+		wrapperExe, _ := os.Executable()
+		sup := supervise.New(supervise.Options{
+			RepoRoot:     rc.RepoRoot,
+			Instance:     rc.Instance,
+			ReadyTimeout: rc.Timeout,
+			WrapperExe:   wrapperExe,
+			Secrets:      repo.Secrets(),
+			EnvPolicy:    repo.DefaultEnvPolicy(),
+		})
+		rec, err = sup.RunJob(ctx, *spec)
+		return err
+	})
+	return rec, err
+}
@@ -1,109 +1,626 @@
 package cmds
 
 import (
-	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
 	"time"
 
+	"github.com/go-go-golems/devctl/pkg/config"
+	"github.com/go-go-golems/devctl/pkg/limits"
+	"github.com/go-go-golems/devctl/pkg/logfiles"
+	"github.com/go-go-golems/devctl/pkg/repository"
 	"github.com/go-go-golems/devctl/pkg/state"
+	"github.com/go-go-golems/devctl/pkg/supervise"
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 func newLogsCmd() *cobra.Command {
-	var service string
+	var services []string
 	var stderr bool
+	var stream string
 	var follow bool
 	var tail int
+	var since, until, grep string
+	var level string
+	var fields []string
+	var run string
+	var timestamps bool
+	var asJSON bool
 
 	cmd := &cobra.Command{
 		Use:   "logs",
-		Short: "Show logs for a supervised service",
+		Short: "Show logs of supervised services",
+		Long: "With one --service, shows that service's stdout (or --stderr) as is.\n" +
+			"With none or several, interleaves stdout and stderr of all of them by time,\n" +
+			"each line prefixed with its service (\"api |\" for stdout, \"api!|\" for stderr).\n" +
+			"Lines take the time devctl received them with logs.combined, otherwise the\n" +
+			"timestamp they start with, or the one of the line before.\n" +
+			"Services with logs.parsers show the parsed level, message and fields;\n" +
+			"--level and --field filter on them.\n" +
+			"--run shows an earlier run (see devctl logs runs), also after down.",
+		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if service == "" {
-				return errors.New("--service is required")
-			}
 			opts, err := getRootOptions(cmd)
 			if err != nil {
 				return err
 			}
-			st, err := state.Load(opts.RepoRoot)
+			multi := len(services) != 1
+			if stderr {
+				stream = logfiles.Stderr
+			}
+			streams, err := logStreams(stream, multi)
 			if err != nil {
 				return err
 			}
-			var logPath string
-			for _, s := range st.Services {
-				if s.Name == service {
-					if stderr {
-						logPath = s.StderrLog
-					} else {
-						logPath = s.StdoutLog
-					}
-					break
+			st, err := state.Load(opts.RepoRoot, opts.Instance)
+			if err != nil {
+				if run == "" {
+					return err
 				}
+				st = &state.State{}
+			}
+			var names []string
+			var srcs []logfiles.Source
+			if run != "" {
+				names, srcs, err = runLogSources(state.LogsDir(opts.RepoRoot, opts.Instance), services, streams, run)
+			} else {
+				names, err = selectLogServices(st, services)
+				srcs = logSources(st, names, streams)
+			}
+			if err != nil {
+				return err
+			}
+			filter, err := parseLogFilter(since, until, grep, level, fields)
+			if err != nil {
+				return err
 			}
-			if logPath == "" {
-				return errors.Errorf("unknown service %q", service)
+			out := newLogPrinter(cmd.OutOrStdout(), names, multi, timestamps, asJSON)
+			parsers := newLogParsers(cmd.Context())
+			defer parsers.close()
+			if run != "" {
+				parsers.fromConfig(opts.Config, opts.RepoRoot)
 			}
 
-			if follow {
-				if tail != 0 {
-					if err := writeTail(cmd.OutOrStdout(), logPath, tail); err != nil {
+			srcs = parsers.attach(st, srcs)
+			if !follow || tail != 0 {
+				sets := make([][]logfiles.Line, 0, len(srcs))
+				for _, src := range srcs {
+					lines, err := logfiles.Read(src, filter, tail)
+					if err != nil {
 						return err
 					}
+					sets = append(sets, lines)
 				}
-				ctx, cancel := context.WithCancel(cmd.Context())
-				defer cancel()
-				return followFile(ctx, logPath, cmd.OutOrStdout())
-			}
-			if tail == 0 {
-				b, err := os.ReadFile(logPath)
-				if err != nil {
-					return err
+				lines := logfiles.Merge(sets...)
+				if tail > 0 && len(lines) > tail {
+					lines = lines[len(lines)-tail:]
 				}
-				_, _ = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+				for _, l := range lines {
+					out.print(l)
+				}
+			}
+			if !follow {
 				return nil
 			}
-			return writeTail(cmd.OutOrStdout(), logPath, tail)
+
+			ctx, cancel := context.WithCancel(cmd.Context())
+			defer cancel()
+			return logfiles.Follow(ctx, func() ([]logfiles.Source, error) {
+				// Picks up the new files of restarted services; after down,
+				// the last known files keep being followed. A --run stays put.
+				if run != "" {
+					return srcs, nil
+				}
+				if cur, err := state.Load(opts.RepoRoot, opts.Instance); err == nil {
+					srcs = parsers.attach(cur, logSources(cur, names, streams))
+				}
+				return srcs, nil
+			}, 200*time.Millisecond, func(l logfiles.Line) {
+				if filter.Match(l) {
+					out.print(l)
+				}
+			})
 		},
 	}
 
-	cmd.Flags().StringVar(&service, "service", "", "Service name")
-	cmd.Flags().BoolVar(&stderr, "stderr", false, "Show stderr log instead of stdout")
-	cmd.Flags().BoolVar(&follow, "follow", false, "Follow log output")
+	cmd.Flags().StringSliceVarP(&services, "service", "s", nil, "Service name (repeatable; default all services)")
+	cmd.Flags().BoolVar(&stderr, "stderr", false, "Show stderr only (same as --stream stderr)")
+	cmd.Flags().StringVar(&stream, "stream", "", "stdout, stderr or both (default stdout for one service, both otherwise)")
+	cmd.Flags().BoolVar(&follow, "follow", false, "Follow log output, including the new files of restarted services")
 	cmd.Flags().IntVar(&tail, "tail", 50, "Number of lines to show from the end (0 for all)")
+	cmd.Flags().StringVar(&since, "since", "", "Only lines at or after this time (RFC3339 or a duration ago, e.g. 10m)")
+	cmd.Flags().StringVar(&until, "until", "", "Only lines at or before this time (RFC3339 or a duration ago)")
+	cmd.Flags().StringVar(&grep, "grep", "", "Only lines matching this regular expression")
+	cmd.Flags().StringVar(&level, "level", "", "Only parsed lines at or above this level (trace, debug, info, warn, error, fatal)")
+	cmd.Flags().StringArrayVar(&fields, "field", nil, "Only parsed lines whose field has this value, as key=value (repeatable)")
+	cmd.Flags().StringVar(&run, "run", "", "Show this run: 0 the latest, -1 the one before, ..., or a run ID from logs runs")
+	cmd.Flags().BoolVar(&timestamps, "timestamps", false, "Prefix lines with their timestamp")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print NDJSON objects with service, stream, ts and line (and level, message, fields when parsed)")
 	AddRepoFlags(cmd)
+	cmd.AddCommand(newLogsGCCmd())
+	cmd.AddCommand(newLogsRunsCmd())
 	return cmd
 }
 
-func followFile(ctx context.Context, path string, w io.Writer) error {
-	f, err := os.Open(path)
-	if err != nil {
-		return err
+func selectLogServices(st *state.State, want []string) ([]string, error) {
+	if len(want) == 0 {
+		names := make([]string, 0, len(st.Services))
+		for _, s := range st.Services {
+			names = append(names, s.Name)
+		}
+		return names, nil
 	}
-	defer func() { _ = f.Close() }()
+	for _, name := range want {
+		found := false
+		for _, s := range st.Services {
+			found = found || s.Name == name
+		}
+		if !found {
+			return nil, errors.Errorf("unknown service %q", name)
+		}
+	}
+	return want, nil
+}
 
-	_, _ = f.Seek(0, io.SeekEnd)
-	r := bufio.NewReader(f)
+func logStreams(stream string, multi bool) ([]string, error) {
+	switch stream {
+	case "":
+		if multi {
+			return []string{logfiles.Stdout, logfiles.Stderr}, nil
+		}
+		return []string{logfiles.Stdout}, nil
+	case logfiles.Stdout, logfiles.Stderr:
+		return []string{stream}, nil
+	case "both":
+		return []string{logfiles.Stdout, logfiles.Stderr}, nil
+	}
+	return nil, errors.Errorf("invalid --stream %q (stdout, stderr or both)", stream)
+}
+
+func logSources(st *state.State, names, streams []string) []logfiles.Source {
+	var out []logfiles.Source
+	for _, name := range names {
+		for _, rec := range st.Services {
+			if rec.Name != name {
+				continue
+			}
+			if rec.CombinedLog != "" {
+				src := logfiles.Source{Service: name, Path: rec.CombinedLog, Combined: true}
+				if len(streams) == 1 {
+					src.Stream = streams[0]
+				}
+				out = append(out, src)
+				continue
+			}
+			for _, stream := range streams {
+				path := rec.StdoutLog
+				if stream == logfiles.Stderr {
+					path = rec.StderrLog
+				}
+				out = append(out, logfiles.Source{Service: name, Stream: stream, Path: path, Started: rec.StartedAt})
+			}
+		}
+	}
+	return out
+}
 
-	for {
-		line, err := r.ReadString('\n')
-		if err == nil {
-			_, _ = w.Write([]byte(line))
+// runLogSources selects run sel of each service (all that have logs if none
+// are given); services without it are left out unless asked for alone.
+func runLogSources(dir string, services, streams []string, sel string) ([]string, []logfiles.Source, error) {
+	runs, err := logfiles.Runs(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	names := services
+	if len(names) == 0 {
+		names = runServices(runs)
+	}
+	var picked []string
+	var srcs []logfiles.Source
+	for _, name := range names {
+		r, err := logfiles.SelectRun(logfiles.ServiceRuns(runs, name), sel)
+		if err != nil {
+			if len(services) == 1 {
+				return nil, nil, errors.Wrapf(err, "service %q", name)
+			}
+			continue
+		}
+		picked = append(picked, name)
+		if p := r.Path("ndjson"); p != "" {
+			src := logfiles.Source{Service: name, Path: p, Combined: true}
+			if len(streams) == 1 {
+				src.Stream = streams[0]
+			}
+			srcs = append(srcs, src)
 			continue
 		}
-		if errors.Is(err, io.EOF) {
-			select {
-			case <-ctx.Done():
+		for _, stream := range streams {
+			if p := r.Path(stream + ".log"); p != "" {
+				srcs = append(srcs, logfiles.Source{Service: name, Stream: stream, Path: p, Started: r.Started})
+			}
+		}
+	}
+	if len(picked) == 0 {
+		return nil, nil, errors.Errorf("no run %q of any service", sel)
+	}
+	return picked, srcs, nil
+}
+
+func runServices(runs []logfiles.Run) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, r := range runs {
+		if !seen[r.Service] {
+			seen[r.Service] = true
+			names = append(names, r.Service)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newLogsRunsCmd() *cobra.Command {
+	var services []string
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "runs",
+		Short: "List the runs of services whose logs are kept",
+		Long: "Lists every start of a service that still has logs, newest first, with\n" +
+			"when it started and how it exited (from its exit info). The # and RUN\n" +
+			"columns are what devctl logs --run takes; * marks the current runs.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts, err := getRootOptions(cmd)
+			if err != nil {
+				return err
+			}
+			runs, err := logfiles.Runs(state.LogsDir(opts.RepoRoot, opts.Instance))
+			if err != nil {
+				return err
+			}
+			// Runs of the current state: still going unless they left exit info.
+			current := map[string]int{}
+			if st, err := state.Load(opts.RepoRoot, opts.Instance); err == nil {
+				for _, rec := range st.Services {
+					if k, ok := logfiles.RunKey(rec.StdoutLog); ok {
+						current[k] = rec.PID
+					}
+				}
+			}
+
+			type runInfo struct {
+				Service  string     `json:"service"`
+				Index    int        `json:"index"`
+				ID       string     `json:"id"`
+				Started  time.Time  `json:"started_at"`
+				Exited   *time.Time `json:"exited_at,omitempty"`
+				ExitCode *int       `json:"exit_code,omitempty"`
+				Exit     string     `json:"exit"`
+				Current  bool       `json:"current"`
+				Size     int64      `json:"size"`
+				Files    []string   `json:"files"`
+			}
+			names := services
+			if len(names) == 0 {
+				names = runServices(runs)
+			}
+			infos := []runInfo{}
+			for _, name := range names {
+				for i, r := range logfiles.ServiceRuns(runs, name) {
+					info := runInfo{Service: name, Index: -i, ID: r.ID(), Started: r.Started, Size: r.Size, Files: r.Files}
+					pid, isCurrent := current[name+"-"+r.ID()]
+					info.Current = isCurrent
+					if p := r.Path("exit.json"); p != "" {
+						if ei, err := state.ReadExitInfo(p); err == nil {
+							if !ei.StartedAt.IsZero() {
+								info.Started = ei.StartedAt
+							}
+							info.Exited = &ei.ExitedAt
+							info.ExitCode = ei.ExitCode
+							info.Exit = supervise.DescribeExit(ei)
+						}
+					}
+					if info.Exit == "" {
+						info.Exit = "no exit info"
+						if isCurrent && state.ProcessAlive(pid) {
+							info.Exit = "running"
+						}
+					}
+					infos = append(infos, info)
+				}
+			}
+
+			out := cmd.OutOrStdout()
+			if asJSON {
+				b, err := json.MarshalIndent(map[string]any{"runs": infos}, "", "  ")
+				if err != nil {
+					return errors.Wrap(err, "marshal runs")
+				}
+				_, _ = fmt.Fprintln(out, string(b))
 				return nil
-			case <-time.After(200 * time.Millisecond):
-				continue
+			}
+			if len(infos) == 0 {
+				_, _ = fmt.Fprintln(out, "no logged runs")
+				return nil
+			}
+			tw := tabwriter.NewWriter(out, 0, 2, 2, ' ', 0)
+			_, _ = fmt.Fprintln(tw, "SERVICE\t#\tRUN\tSTARTED\tEXITED\tEXIT\tSIZE")
+			for _, info := range infos {
+				exited := "-"
+				if info.Exited != nil {
+					exited = info.Exited.Local().Format("2006-01-02 15:04:05")
+				}
+				id := info.ID
+				if info.Current {
+					id += " *"
+				}
+				_, _ = fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\n", info.Service, info.Index, id,
+					info.Started.Local().Format("2006-01-02 15:04:05"), exited, info.Exit, limits.FormatBytes(info.Size))
+			}
+			return tw.Flush()
+		},
+	}
+	cmd.Flags().StringSliceVarP(&services, "service", "s", nil, "Service name (repeatable; default all services)")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the runs as JSON")
+	AddRepoFlags(cmd)
+	return cmd
+}
+
+// logParsers loads each service's parsers once per log file.
+type logParsers struct {
+	ctx     context.Context
+	parsers map[string]*logfiles.Parser
+	// config holds the modules .devctl.yaml declares, for services that are
+	// not in the state (e.g. a --run after down).
+	config map[string][]string
+}
+
+func newLogParsers(ctx context.Context) *logParsers {
+	return &logParsers{ctx: ctx, parsers: map[string]*logfiles.Parser{}}
+}
+
+func (ps *logParsers) attach(st *state.State, srcs []logfiles.Source) []logfiles.Source {
+	for i, src := range srcs {
+		var modules []string
+		for _, rec := range st.Services {
+			if rec.Name == src.Service {
+				modules = rec.LogParsers
 			}
 		}
-		return err
+		if len(modules) == 0 {
+			modules = ps.config[src.Service]
+		}
+		if len(modules) == 0 {
+			continue
+		}
+		key := src.Stream + "\x00" + src.Path
+		p, ok := ps.parsers[key]
+		if !ok {
+			var err error
+			if p, err = logfiles.LoadParser(ps.ctx, modules); err != nil {
+				log.Warn().Err(err).Str("service", src.Service).Msg("showing unparsed logs")
+			}
+			ps.parsers[key] = p
+		}
+		srcs[i].Parser = p
+	}
+	return srcs
+}
+
+// fromConfig reads the services' logs.parsers from the config at path,
+// resolved against repoRoot as the supervisor does.
+func (ps *logParsers) fromConfig(path, repoRoot string) {
+	layers, err := config.LoadLayered(path)
+	if err != nil {
+		log.Debug().Err(err).Msg("no config for log parsers")
+		return
+	}
+	ps.config = map[string][]string{}
+	for _, svc := range layers.File.Services {
+		if svc.Logs == nil {
+			continue
+		}
+		for _, p := range svc.Logs.Parsers {
+			if !filepath.IsAbs(p) {
+				p = filepath.Join(repoRoot, p)
+			}
+			ps.config[svc.Name] = append(ps.config[svc.Name], p)
+		}
+	}
+}
+
+func (ps *logParsers) close() {
+	for _, p := range ps.parsers {
+		if p != nil {
+			p.Close()
+		}
+	}
+}
+
+func parseLogFilter(since, until, grep, level string, fields []string) (logfiles.Filter, error) {
+	var f logfiles.Filter
+	var err error
+	if f.Since, err = parseLogTime(since); err != nil {
+		return f, errors.Wrap(err, "--since")
+	}
+	if f.Until, err = parseLogTime(until); err != nil {
+		return f, errors.Wrap(err, "--until")
+	}
+	if grep != "" {
+		if f.Grep, err = regexp.Compile(grep); err != nil {
+			return f, errors.Wrap(err, "--grep")
+		}
+	}
+	if level != "" {
+		if logfiles.LevelRank(level) < 0 {
+			return f, errors.Errorf("invalid --level %q (%s)", level, strings.Join(logfiles.Levels, ", "))
+		}
+		f.MinLevel = level
+	}
+	for _, kv := range fields {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return f, errors.Errorf("invalid --field %q (key=value)", kv)
+		}
+		if f.Fields == nil {
+			f.Fields = map[string]string{}
+		}
+		f.Fields[k] = v
+	}
+	return f, nil
+}
+
+// parseLogTime accepts RFC3339, a local "2006-01-02T15:04:05", or a duration
+// before now.
+func parseLogTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02T15:04:05", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, errors.Errorf("invalid time %q (RFC3339 or a duration like 10m)", s)
+}
+
+var logColors = []string{"36", "33", "32", "35", "34", "96", "93", "92", "95", "94"}
+
+type logPrinter struct {
+	w          io.Writer
+	prefix     bool
+	timestamps bool
+	json       bool
+	width      int
+	colors     map[string]string
+}
+
+func newLogPrinter(w io.Writer, names []string, prefix, timestamps, asJSON bool) *logPrinter {
+	p := &logPrinter{w: w, prefix: prefix, timestamps: timestamps, json: asJSON}
+	for _, n := range names {
+		p.width = max(p.width, len(n))
+	}
+	if f, ok := w.(*os.File); ok && os.Getenv("NO_COLOR") == "" && term.IsTerminal(int(f.Fd())) {
+		p.colors = map[string]string{}
+		for i, n := range names {
+			p.colors[n] = logColors[i%len(logColors)]
+		}
+	}
+	return p
+}
+
+func (p *logPrinter) print(l logfiles.Line) {
+	if p.json {
+		b, _ := json.Marshal(l)
+		_, _ = fmt.Fprintln(p.w, string(b))
+		return
+	}
+	var sb strings.Builder
+	if p.timestamps {
+		sb.WriteString(l.Time.Local().Format("2006-01-02T15:04:05.000 "))
+	}
+	if p.prefix {
+		mark := " "
+		if l.Stream == logfiles.Stderr {
+			mark = "!"
+		}
+		prefix := fmt.Sprintf("%-*s%s|", p.width, l.Service, mark)
+		if c, ok := p.colors[l.Service]; ok {
+			prefix = "\x1b[" + c + "m" + prefix + "\x1b[0m"
+		}
+		sb.WriteString(prefix + " ")
+	}
+	if l.Level == "" {
+		sb.WriteString(l.Text)
+	} else {
+		lvl := fmt.Sprintf("%-5s", strings.ToUpper(l.Level))
+		if c, ok := levelColors[l.Level]; ok && p.colors != nil {
+			lvl = "\x1b[" + c + "m" + lvl + "\x1b[0m"
+		}
+		sb.WriteString(lvl + " " + l.Message)
+		keys := make([]string, 0, len(l.Fields))
+		for k := range l.Fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&sb, " %s=%v", k, l.Fields[k])
+		}
+	}
+	_, _ = fmt.Fprintln(p.w, sb.String())
+}
+
+var levelColors = map[string]string{"trace": "2", "debug": "2", "warn": "33", "error": "31", "fatal": "1;31"}
+
+func newLogsGCCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Remove old service logs according to the logs retention settings",
+		Long: "Removes whole runs (a service start's logs and exit info) beyond logs.keep_runs,\n" +
+			"older than logs.max_age, and then the oldest until logs.max_total_size fits.\n" +
+			"The logs of the current state are always kept. --dry-run only lists them.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts, err := getRootOptions(cmd)
+			if err != nil {
+				return err
+			}
+			layers, err := config.LoadLayered(opts.Config)
+			if err != nil {
+				return err
+			}
+			policy, err := repository.LogPolicy(layers.File)
+			if err != nil {
+				return err
+			}
+			var st *state.State
+			if s, err := state.Load(opts.RepoRoot, opts.Instance); err == nil {
+				st = s
+			}
+			res, err := logfiles.GC(state.LogsDir(opts.RepoRoot, opts.Instance), policy, st.LogPaths(), opts.DryRun)
+			if err != nil {
+				return err
+			}
+			verb := "removed"
+			if opts.DryRun {
+				verb = "would remove"
+			}
+			out := cmd.OutOrStdout()
+			for _, r := range res.Removed {
+				_, _ = fmt.Fprintf(out, "%s %s (%s, %s)\n", verb, r.Service, r.Started.Format("2006-01-02 15:04:05"), limits.FormatBytes(r.Size))
+			}
+			_, _ = fmt.Fprintf(out, "%s %d runs, %s; kept %d\n", verb, len(res.Removed), limits.FormatBytes(res.Freed), res.Kept)
+			return nil
+		},
+	}
+	AddRepoFlags(cmd)
+	return cmd
+}
+
+// collectLogs applies log retention after up; failures only warn.
+func collectLogs(repoRoot, instance string, policy logfiles.Policy, st *state.State) {
+	res, err := logfiles.GC(state.LogsDir(repoRoot, instance), policy, st.LogPaths(), false)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to remove old logs")
+		return
+	}
+	if len(res.Removed) > 0 {
+		log.Info().Int("runs", len(res.Removed)).Str("freed", limits.FormatBytes(res.Freed)).Msg("removed old logs")
 	}
 }
 
@@ -137,19 +654,16 @@ func readTailLines(path string, tail int) ([]string, error) {
 		return splitLines(text), nil
 	}
 
-	scanner := bufio.NewScanner(f)
-	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
 	lines := make([]string, 0, tail)
-	for scanner.Scan() {
-		line := scanner.Text()
+	err = logfiles.ReadLines(f, func(line string) {
 		if len(lines) < tail {
 			lines = append(lines, line)
-			continue
+			return
 		}
 		copy(lines, lines[1:])
 		lines[len(lines)-1] = line
-	}
-	if err := scanner.Err(); err != nil {
+	})
+	if err != nil {
 		return nil, err
 	}
 	return lines, nil
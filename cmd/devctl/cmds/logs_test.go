@@ -0,0 +1,46 @@
+package cmds
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-go-golems/devctl/pkg/config"
+	"github.com/go-go-golems/devctl/pkg/logfiles"
+	"github.com/go-go-golems/devctl/pkg/state"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogParsers_FallBackToConfigWithoutState(t *testing.T) {
+	repoRoot := t.TempDir()
+	t.Setenv(config.UserConfigEnvVar, filepath.Join(repoRoot, "missing.yaml"))
+	require.NoError(t, os.WriteFile(filepath.Join(repoRoot, "plain.js"), []byte(`
+register({ name: "plain", parse(line) { return { message: line, level: "info" }; } });
+`), 0o644))
+	cfgPath := filepath.Join(repoRoot, ".devctl.yaml")
+	require.NoError(t, os.WriteFile(cfgPath, []byte(`
+services:
+  - name: api
+    command: [serve]
+    logs: {parsers: [plain.js]}
+  - name: worker
+    command: [work]
+`), 0o644))
+
+	ps := newLogParsers(context.Background())
+	defer ps.close()
+	srcs := []logfiles.Source{
+		{Service: "api", Stream: logfiles.Stdout, Path: filepath.Join(repoRoot, "api.stdout.log")},
+		{Service: "worker", Stream: logfiles.Stdout, Path: filepath.Join(repoRoot, "worker.stdout.log")},
+	}
+
+	// After down there is no state to take the parsers from.
+	srcs = ps.attach(&state.State{}, srcs)
+	require.Nil(t, srcs[0].Parser)
+
+	ps.fromConfig(cfgPath, repoRoot)
+	srcs = ps.attach(&state.State{}, srcs)
+	require.NotNil(t, srcs[0].Parser)
+	require.Nil(t, srcs[1].Parser)
+}
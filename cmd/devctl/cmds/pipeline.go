@@ -0,0 +1,79 @@
+package cmds
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/go-go-golems/devctl/pkg/engine"
+	"github.com/go-go-golems/devctl/pkg/patch"
+	"github.com/go-go-golems/devctl/pkg/repository"
+	"github.com/go-go-golems/devctl/pkg/runtime"
+)
+
+// withPipeline loads the repo, starts its plugins, folds config.mutate (tracking
+// provenance) and hands the resulting pipeline to fn. Plugins are closed once fn
+// returns.
+func withPipeline(ctx context.Context, rc RepoContext, fn func(p *engine.Pipeline, conf patch.Config) error) error {
+	return withRepoPipeline(ctx, rc, func(_ *repository.Repository, p *engine.Pipeline, conf patch.Config) error {
+		return fn(p, conf)
+	})
+}
+
+// withPipelineFor is withPipeline for a single op: when no plugin declares op
+// in its handshake, fn is skipped and config.mutate is never run.
+func withPipelineFor(ctx context.Context, rc RepoContext, op string, fn func(p *engine.Pipeline, conf patch.Config) error) error {
+	return runPipeline(ctx, rc, op, func(_ *repository.Repository, p *engine.Pipeline, conf patch.Config) error {
+		return fn(p, conf)
+	})
+}
+
+// withRepoPipeline is withPipeline for callers that also need the repository
+// (profile filtering, secrets, env policy).
+func withRepoPipeline(ctx context.Context, rc RepoContext, fn func(repo *repository.Repository, p *engine.Pipeline, conf patch.Config) error) error {
+	return runPipeline(ctx, rc, "", fn)
+}
+
+func runPipeline(ctx context.Context, rc RepoContext, op string, fn func(repo *repository.Repository, p *engine.Pipeline, conf patch.Config) error) error {
+	repo, err := repository.Load(repository.Options{RepoRoot: rc.RepoRoot, ConfigPath: rc.ConfigPath, Cwd: rc.Cwd, DryRun: rc.DryRun, Profile: rc.Profile, Instance: rc.Instance, AllowUntrusted: rc.AllowUntrusted, ConfirmTrust: trustPrompt(os.Stdin, os.Stderr)})
+	if err != nil {
+		return err
+	}
+	strict := rc.Strict || repo.Config.Strictness == "error"
+
+	factory := runtime.NewFactory(runtime.FactoryOptions{
+		HandshakeTimeout: 2 * time.Second,
+		ShutdownTimeout:  2 * time.Second,
+	})
+	clients, err := repo.StartClients(ctx, factory)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_ = repository.CloseClients(closeCtx, clients)
+	}()
+
+	p := &engine.Pipeline{
+		Clients: clients,
+		Opts: engine.Options{
+			Strict:   strict,
+			DryRun:   rc.DryRun,
+			RepoRoot: repo.Root,
+			Instance: repo.Instance,
+		},
+		Provenance: &patch.Provenance{},
+	}
+	if op != "" && !p.Supports(op) {
+		return nil
+	}
+
+	opCtx, cancel := context.WithTimeout(ctx, rc.Timeout)
+	conf, err := repo.MutateConfig(opCtx, p)
+	cancel()
+	if err != nil {
+		return err
+	}
+	return fn(repo, p, conf)
+}
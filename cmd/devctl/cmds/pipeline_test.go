@@ -0,0 +1,52 @@
+package cmds
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-go-golems/devctl/pkg/engine"
+	"github.com/go-go-golems/devctl/pkg/patch"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithPipelineFor_SkipsConfigMutateWithoutOp(t *testing.T) {
+	repoRoot := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	marker := filepath.Join(repoRoot, "mutated")
+	plugin := filepath.Join(repoRoot, "plugin.py")
+	require.NoError(t, os.WriteFile(plugin, []byte(`import json, sys
+def emit(o):
+    sys.stdout.write(json.dumps(o) + "\n"); sys.stdout.flush()
+emit({"type": "handshake", "protocol_version": "v2", "plugin_name": "p", "capabilities": {"ops": ["config.mutate"]}})
+for line in sys.stdin:
+    req = json.loads(line)
+    if req.get("op") == "config.mutate":
+        open(`+"\""+marker+"\""+`, "w").close()
+    emit({"type": "response", "request_id": req.get("request_id", ""), "ok": True, "output": {}})
+`), 0o644))
+	cfgPath := filepath.Join(repoRoot, ".devctl.yaml")
+	require.NoError(t, os.WriteFile(cfgPath, []byte("plugins:\n  - id: p\n    path: python3\n    args: [\""+plugin+"\"]\n"), 0o644))
+
+	rc := RepoContext{RepoRoot: repoRoot, ConfigPath: cfgPath, Cwd: repoRoot, Timeout: 5 * time.Second, AllowUntrusted: true}
+	called := false
+	err := withPipelineFor(context.Background(), rc, "status.describe", func(p *engine.Pipeline, conf patch.Config) error {
+		called = true
+		return nil
+	})
+	require.NoError(t, err)
+	require.False(t, called)
+	_, err = os.Stat(marker)
+	require.True(t, os.IsNotExist(err), "config.mutate must not run")
+
+	err = withPipelineFor(context.Background(), rc, "config.mutate", func(p *engine.Pipeline, conf patch.Config) error {
+		called = true
+		return nil
+	})
+	require.NoError(t, err)
+	require.True(t, called)
+	_, err = os.Stat(marker)
+	require.NoError(t, err)
+}
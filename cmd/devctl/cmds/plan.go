@@ -7,7 +7,6 @@ import (
 	"time"
 
 	"github.com/go-go-golems/devctl/pkg/engine"
-	"github.com/go-go-golems/devctl/pkg/patch"
 	"github.com/go-go-golems/devctl/pkg/repository"
 	"github.com/go-go-golems/devctl/pkg/runtime"
 	"github.com/rs/zerolog/log"
@@ -28,15 +27,15 @@ func newPlanCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
-			repo, err := repository.Load(repository.Options{RepoRoot: opts.RepoRoot, ConfigPath: opts.Config, Cwd: meta.Cwd, DryRun: opts.DryRun})
+			repo, err := repository.Load(repository.Options{RepoRoot: opts.RepoRoot, ConfigPath: opts.Config, Cwd: meta.Cwd, DryRun: opts.DryRun, Profile: opts.Profile, Instance: opts.Instance, AllowUntrusted: opts.AllowUntrusted, ConfirmTrust: trustPrompt(cmd.InOrStdin(), cmd.ErrOrStderr())})
 			if err != nil {
 				return err
 			}
 			if !opts.Strict && repo.Config.Strictness == "error" {
 				opts.Strict = true
 			}
-			if len(repo.Specs) == 0 {
-				log.Warn().Msg("no plugins configured (add .devctl.yaml)")
+			if !repo.HasPlugins() {
+				log.Warn().Msg("no plugins or services configured (add .devctl.yaml)")
 				_, _ = fmt.Fprintln(cmd.OutOrStdout(), "{}")
 				return nil
 			}
@@ -60,14 +59,15 @@ func newPlanCmd() *cobra.Command {
 			p := &engine.Pipeline{
 				Clients: clients,
 				Opts: engine.Options{
-					Strict: opts.Strict,
-					DryRun: opts.DryRun,
+					Strict:   opts.Strict,
+					DryRun:   opts.DryRun,
+					RepoRoot: repo.Root,
+					Instance: repo.Instance,
 				},
 			}
 
-			conf := patch.Config{}
 			opCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
-			conf, err = p.MutateConfig(opCtx, conf)
+			conf, err := repo.MutateConfig(opCtx, p)
 			cancel()
 			if err != nil {
 				return err
@@ -79,6 +79,7 @@ func newPlanCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			plan = repo.FilterPlan(plan)
 
 			out := map[string]any{
 				"config": conf,
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"os"
 	"time"
 
 	"github.com/go-go-golems/devctl/pkg/protocol"
@@ -23,6 +24,8 @@ func newPluginsCmd() *cobra.Command {
 		Short: "Plugin discovery and inspection",
 	}
 	cmd.AddCommand(newPluginsListCmd())
+	cmd.AddCommand(newPluginsLogsCmd())
+	cmd.AddCommand(newPluginsTrustCmd())
 	return cmd
 }
 
@@ -59,6 +62,11 @@ func (c *PluginsListCommand) RunIntoWriter(ctx context.Context, parsedLayers *la
 		ConfigPath: rc.ConfigPath,
 		Cwd:        rc.Cwd,
 		DryRun:     rc.DryRun,
+		Profile:    rc.Profile,
+		Instance:   rc.Instance,
+
+		AllowUntrusted: rc.AllowUntrusted,
+		ConfirmTrust:   trustPrompt(os.Stdin, os.Stderr),
 	})
 	if err != nil {
 		return err
@@ -0,0 +1,127 @@
+package cmds
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-go-golems/devctl/pkg/runtime"
+	"github.com/go-go-golems/devctl/pkg/state"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func newPluginsLogsCmd() *cobra.Command {
+	var follow bool
+	var tail int
+
+	cmd := &cobra.Command{
+		Use:   "logs <plugin-id>",
+		Short: "Show captured stderr for a plugin",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts, err := getRootOptions(cmd)
+			if err != nil {
+				return err
+			}
+			pluginID := args[0]
+			dir := state.PluginLogsDir(opts.RepoRoot, opts.Instance)
+
+			files, err := runtime.PluginLogFiles(dir, pluginID)
+			if err != nil {
+				return err
+			}
+			if len(files) == 0 && !follow {
+				return errors.Errorf("no stderr logs for plugin %q in %s", pluginID, dir)
+			}
+
+			current := ""
+			if len(files) > 0 {
+				current = files[len(files)-1]
+				if err := writeTail(cmd.OutOrStdout(), current, tail); err != nil {
+					return err
+				}
+			}
+			if !follow {
+				return nil
+			}
+
+			ctx, cancel := context.WithCancel(cmd.Context())
+			defer cancel()
+			return followPluginLogs(ctx, dir, pluginID, current, cmd.OutOrStdout())
+		},
+	}
+
+	cmd.Flags().BoolVar(&follow, "follow", false, "Follow log output, switching to newer files as plugins restart")
+	cmd.Flags().IntVar(&tail, "tail", 50, "Number of lines to show from the end (0 for all)")
+	AddRepoFlags(cmd)
+	return cmd
+}
+
+// followPluginLogs tails the newest log file for pluginID and moves on to newer
+// files as they appear (each plugin process start or rotation creates one).
+func followPluginLogs(ctx context.Context, dir, pluginID, current string, w io.Writer) error {
+	var f *os.File
+	var r *bufio.Reader
+	defer func() {
+		if f != nil {
+			_ = f.Close()
+		}
+	}()
+
+	open := func(path string, fromEnd bool) error {
+		if f != nil {
+			_ = f.Close()
+		}
+		nf, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		if fromEnd {
+			_, _ = nf.Seek(0, io.SeekEnd)
+		}
+		f = nf
+		r = bufio.NewReader(nf)
+		current = path
+		return nil
+	}
+
+	if current != "" {
+		if err := open(current, true); err != nil {
+			return err
+		}
+	}
+
+	for {
+		if r != nil {
+			line, err := r.ReadString('\n')
+			if err == nil {
+				_, _ = w.Write([]byte(line))
+				continue
+			}
+			if !errors.Is(err, io.EOF) {
+				return err
+			}
+		}
+
+		files, err := runtime.PluginLogFiles(dir, pluginID)
+		if err != nil {
+			return err
+		}
+		if len(files) > 0 && filepath.Clean(files[len(files)-1]) != filepath.Clean(current) {
+			if err := open(files[len(files)-1], false); err != nil {
+				return err
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package cmds
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/go-go-golems/devctl/pkg/builtin"
+	"github.com/go-go-golems/devctl/pkg/repository"
+	"github.com/go-go-golems/devctl/pkg/trust"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func newPluginsTrustCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "trust [plugin-id...]",
+		Short: "Record the current plugin scripts, args and config commands as trusted",
+		Long: "Fingerprints every configured plugin (or only the given ids) and the commands\n" +
+			".devctl.yaml runs itself (id \"builtin\"), and records them in your trust lock\n" +
+			"under $XDG_STATE_HOME/devctl/trust. Anything that does not match the lock is not\n" +
+			"run until trusted, confirmed interactively, or --allow-untrusted-plugins is passed.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts, err := getRootOptions(cmd)
+			if err != nil {
+				return err
+			}
+			repo, err := repository.Load(repository.Options{RepoRoot: opts.RepoRoot, ConfigPath: opts.Config, Cwd: opts.RepoRoot, Profile: opts.Profile, Instance: opts.Instance, SkipUntrusted: true})
+			if err != nil {
+				return err
+			}
+
+			findings := repo.Untrusted
+			if len(args) > 0 {
+				byID := make(map[string]trust.Finding, len(findings))
+				for _, f := range findings {
+					byID[f.ID] = f
+				}
+				findings = findings[:0:0]
+				for _, id := range args {
+					if f, ok := byID[id]; ok {
+						findings = append(findings, f)
+					} else if _, ok := repo.SpecByID[id]; !ok && id != builtin.ID {
+						return errors.Errorf("unknown plugin %q", id)
+					}
+				}
+			}
+			sort.Slice(findings, func(i, j int) bool { return findings[i].ID < findings[j].ID })
+
+			out := cmd.OutOrStdout()
+			if len(findings) == 0 {
+				_, _ = fmt.Fprintln(out, "all plugins already trusted")
+				return nil
+			}
+
+			lock, err := trust.Load(repo.Root)
+			if err != nil {
+				return err
+			}
+			lock.Trust(findings)
+			if err := trust.Save(repo.Root, lock); err != nil {
+				return err
+			}
+			for _, f := range findings {
+				_, _ = fmt.Fprintf(out, "trusted %s\n", f.Describe())
+			}
+			return nil
+		},
+	}
+	AddRepoFlags(cmd)
+	return cmd
+}
+
+// trustPrompt asks on out whether to trust new or changed plugins. It returns
+// nil (refuse) when in is not a terminal.
+func trustPrompt(in io.Reader, out io.Writer) func([]trust.Finding) (bool, error) {
+	if !isInteractive(in) {
+		return nil
+	}
+	return func(findings []trust.Finding) (bool, error) {
+		_, _ = fmt.Fprintln(out, "These plugins are not trusted yet (or changed since) and run code from this repository:")
+		for _, f := range findings {
+			_, _ = fmt.Fprintf(out, "  %s\n", f.Describe())
+		}
+		return promptConfirm(out, in, "Trust them and continue? [y/N] ")
+	}
+}
@@ -0,0 +1,102 @@
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/go-go-golems/devctl/pkg/ports"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func newPortsCmd() *cobra.Command {
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "ports",
+		Short: "Show named port assignments and who is listening on them",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts, err := getRootOptions(cmd)
+			if err != nil {
+				return err
+			}
+			assigned, err := ports.Load(opts.RepoRoot, opts.Instance)
+			if err != nil {
+				return err
+			}
+			names := make([]string, 0, len(assigned))
+			claims := make([]ports.Claim, 0, len(assigned))
+			for name, p := range assigned {
+				names = append(names, name)
+				claims = append(claims, ports.Claim{Port: p, Owner: "ports." + name})
+			}
+			sort.Strings(names)
+			conflicts, err := ports.Conflicts(claims)
+			if err != nil {
+				return err
+			}
+			inUse := map[int]ports.Holder{}
+			for _, c := range conflicts {
+				inUse[c.Port] = c.Holder
+			}
+
+			type portInfo struct {
+				Name    string `json:"name"`
+				Port    int    `json:"port"`
+				InUse   bool   `json:"in_use"`
+				PID     int    `json:"pid,omitempty"`
+				Command string `json:"command,omitempty"`
+			}
+			infos := make([]portInfo, 0, len(names))
+			for _, name := range names {
+				info := portInfo{Name: name, Port: assigned[name]}
+				if h, ok := inUse[info.Port]; ok {
+					info.InUse, info.PID, info.Command = true, h.PID, h.Command
+				}
+				infos = append(infos, info)
+			}
+
+			out := cmd.OutOrStdout()
+			if asJSON {
+				b, err := json.MarshalIndent(map[string]any{"ports": infos}, "", "  ")
+				if err != nil {
+					return errors.Wrap(err, "marshal ports")
+				}
+				_, _ = fmt.Fprintln(out, string(b))
+				return nil
+			}
+			if len(infos) == 0 {
+				_, _ = fmt.Fprintln(out, "no ports assigned")
+				return nil
+			}
+			for _, info := range infos {
+				status := "free"
+				if info.InUse {
+					status = "in use by " + inUse[info.Port].String()
+				}
+				_, _ = fmt.Fprintf(out, "%-20s %5d  %s\n", info.Name, info.Port, status)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print JSON instead of text")
+	cmd.AddCommand(newPortsReleaseCmd())
+	AddRepoFlags(cmd)
+	return cmd
+}
+
+func newPortsReleaseCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "release [name...]",
+		Short: "Forget port assignments (all when no name is given) so the next run picks new ones",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts, err := getRootOptions(cmd)
+			if err != nil {
+				return err
+			}
+			return ports.Release(opts.RepoRoot, opts.Instance, args)
+		},
+	}
+	AddRepoFlags(cmd)
+	return cmd
+}
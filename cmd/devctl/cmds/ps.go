@@ -0,0 +1,138 @@
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/devctl/pkg/ports"
+	"github.com/go-go-golems/devctl/pkg/registry"
+	"github.com/go-go-golems/devctl/pkg/state"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func newPsCmd() *cobra.Command {
+	var all bool
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "ps",
+		Short: "List running devctl environments",
+		Long: "Lists the running instances of the current repo, or with --all every\n" +
+			"environment started on this machine. Environments whose processes are all\n" +
+			"gone are shown as stale until `devctl down` tears them down; entries whose\n" +
+			"state was removed are pruned from the registry.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts, err := getRootOptions(cmd)
+			if err != nil {
+				return err
+			}
+			envs, removed, err := registry.Reconcile()
+			if err != nil {
+				return err
+			}
+
+			type svcInfo struct {
+				Name  string `json:"name"`
+				Kind  string `json:"kind,omitempty"`
+				PID   int    `json:"pid"`
+				Alive bool   `json:"alive"`
+			}
+			type envInfo struct {
+				RepoRoot  string         `json:"repo_root"`
+				Instance  string         `json:"instance"`
+				Profile   string         `json:"profile,omitempty"`
+				StartedAt time.Time      `json:"started_at"`
+				Status    string         `json:"status"`
+				Services  []svcInfo      `json:"services"`
+				Ports     map[string]int `json:"ports,omitempty"`
+			}
+			infos := []envInfo{}
+			for _, env := range envs {
+				if !all && env.RepoRoot != opts.RepoRoot {
+					continue
+				}
+				info := envInfo{
+					RepoRoot:  env.RepoRoot,
+					Instance:  state.InstanceName(env.Instance),
+					StartedAt: env.StartedAt,
+					Status:    "running",
+				}
+				if env.Stale() {
+					info.Status = "stale"
+				}
+				if env.State != nil {
+					info.Profile = env.State.Profile
+					info.StartedAt = env.State.CreatedAt
+					for _, svc := range env.State.Services {
+						alive := state.ProcessAlive(svc.PID)
+						if !alive && !svc.IsJob() && !env.Stale() {
+							info.Status = "degraded"
+						}
+						info.Services = append(info.Services, svcInfo{Name: svc.Name, Kind: svc.Kind, PID: svc.PID, Alive: alive})
+					}
+				}
+				if assigned, err := ports.Load(env.RepoRoot, env.Instance); err == nil && len(assigned) > 0 {
+					info.Ports = assigned
+				}
+				infos = append(infos, info)
+			}
+
+			out := cmd.OutOrStdout()
+			if asJSON {
+				pruned := make([]string, 0, len(removed))
+				for _, e := range removed {
+					pruned = append(pruned, e.RepoRoot+" ("+state.InstanceName(e.Instance)+")")
+				}
+				b, err := json.MarshalIndent(map[string]any{"environments": infos, "pruned": pruned}, "", "  ")
+				if err != nil {
+					return errors.Wrap(err, "marshal environments")
+				}
+				_, _ = fmt.Fprintln(out, string(b))
+				return nil
+			}
+
+			for _, e := range removed {
+				_, _ = fmt.Fprintf(os.Stderr, "pruned stale entry %s (%s)\n", e.RepoRoot, state.InstanceName(e.Instance))
+			}
+			if len(infos) == 0 {
+				_, _ = fmt.Fprintln(out, "nothing running")
+				return nil
+			}
+			for _, info := range infos {
+				alive := 0
+				pids := make([]string, 0, len(info.Services))
+				for _, s := range info.Services {
+					if s.Alive {
+						alive++
+					}
+					pids = append(pids, s.Name+"="+strconv.Itoa(s.PID))
+				}
+				_, _ = fmt.Fprintf(out, "%s  instance=%s  %s  %d/%d services  up %s\n",
+					info.RepoRoot, info.Instance, info.Status, alive, len(info.Services),
+					time.Since(info.StartedAt).Round(time.Second))
+				_, _ = fmt.Fprintf(out, "  pids:  %s\n", strings.Join(pids, " "))
+				if len(info.Ports) > 0 {
+					names := make([]string, 0, len(info.Ports))
+					for name := range info.Ports {
+						names = append(names, name)
+					}
+					sort.Strings(names)
+					for i, name := range names {
+						names[i] = name + "=" + strconv.Itoa(info.Ports[name])
+					}
+					_, _ = fmt.Fprintf(out, "  ports: %s\n", strings.Join(names, " "))
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&all, "all", false, "List environments of every repo, not just this one")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Output JSON")
+	AddRepoFlags(cmd)
+	return cmd
+}
@@ -8,11 +8,15 @@ import (
 func AddCommands(root *cobra.Command) error {
 	root.AddCommand(dev.NewCmd())
 	root.AddCommand(newPlanCmd())
+	root.AddCommand(newConfigCmd())
 	root.AddCommand(newPluginsCmd())
+	root.AddCommand(newPortsCmd())
 
 	root.AddCommand(newUpCmd())
 	root.AddCommand(newDownCmd())
 	root.AddCommand(newStatusCmd())
+	root.AddCommand(newPsCmd())
+	root.AddCommand(newJobCmd())
 	root.AddCommand(newLogsCmd())
 	root.AddCommand(newStreamCmd())
 	root.AddCommand(newTuiCmd())
@@ -9,7 +9,10 @@ import (
 	"os"
 	"time"
 
+	"github.com/go-go-golems/devctl/pkg/engine"
+	"github.com/go-go-golems/devctl/pkg/patch"
 	"github.com/go-go-golems/devctl/pkg/state"
+	"github.com/go-go-golems/devctl/pkg/supervise"
 	"github.com/go-go-golems/glazed/pkg/cli"
 	glazedcmds "github.com/go-go-golems/glazed/pkg/cmds"
 	"github.com/go-go-golems/glazed/pkg/cmds/layers"
@@ -25,7 +28,9 @@ type StatusCommand struct {
 var _ glazedcmds.WriterCommand = (*StatusCommand)(nil)
 
 type StatusSettings struct {
-	TailLines int `glazed.parameter:"tail-lines"`
+	TailLines int  `glazed.parameter:"tail-lines"`
+	Describe  bool `glazed.parameter:"describe"`
+	Env       bool `glazed.parameter:"env"`
 }
 
 func NewStatusCommand() (*StatusCommand, error) {
@@ -45,6 +50,18 @@ func NewStatusCommand() (*StatusCommand, error) {
 					parameters.WithDefault(25),
 					parameters.WithHelp("How many stderr lines to include for dead services"),
 				),
+				parameters.NewParameterDefinition(
+					"describe",
+					parameters.ParameterTypeBool,
+					parameters.WithDefault(true),
+					parameters.WithHelp("Ask plugins for environment facts (status.describe)"),
+				),
+				parameters.NewParameterDefinition(
+					"env",
+					parameters.ParameterTypeBool,
+					parameters.WithDefault(false),
+					parameters.WithHelp("Include each service's effective environment (secrets redacted)"),
+				),
 			),
 			glazedcmds.WithLayersList(repoLayer),
 		),
@@ -62,14 +79,23 @@ func (c *StatusCommand) RunIntoWriter(ctx context.Context, parsedLayers *layers.
 	}
 
 	type svc struct {
-		Name   string          `json:"name"`
-		PID    int             `json:"pid"`
-		Alive  bool            `json:"alive"`
-		Stdout string          `json:"stdout_log"`
-		Stderr string          `json:"stderr_log"`
-		Exit   *state.ExitInfo `json:"exit,omitempty"`
+		Name  string `json:"name"`
+		Kind  string `json:"kind,omitempty"`
+		PID   int    `json:"pid"`
+		Alive bool   `json:"alive"`
+		// JobStatus is running, succeeded or failed for jobs.
+		JobStatus string          `json:"job_status,omitempty"`
+		Stdout    string          `json:"stdout_log"`
+		Stderr    string          `json:"stderr_log"`
+		Exit      *state.ExitInfo `json:"exit,omitempty"`
+		// ExitReason summarizes Exit, e.g. "killed: OOM (limit 2GiB)".
+		ExitReason string         `json:"exit_reason,omitempty"`
+		Facts      map[string]any `json:"facts,omitempty"`
+		// EnvPolicy and Env are filled with --env.
+		EnvPolicy string            `json:"env_policy,omitempty"`
+		Env       map[string]string `json:"env,omitempty"`
 	}
-	st, err := state.Load(rc.RepoRoot)
+	st, err := state.Load(rc.RepoRoot, rc.Instance)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) || errors.Is(err, fs.ErrNotExist) {
 			b, err := json.MarshalIndent(map[string]any{
@@ -89,7 +115,13 @@ func (c *StatusCommand) RunIntoWriter(ctx context.Context, parsedLayers *layers.
 	for _, svcState := range st.Services {
 		alive := state.ProcessAlive(svcState.PID)
 		var exitInfo *state.ExitInfo
-		if !alive && svcState.ExitInfo != "" {
+		var jobStatus string
+		if svcState.IsJob() {
+			jobStatus, exitInfo = svcState.JobStatus()
+			if exitInfo != nil && s.TailLines > 0 && len(exitInfo.StderrTail) > s.TailLines {
+				exitInfo.StderrTail = exitInfo.StderrTail[len(exitInfo.StderrTail)-s.TailLines:]
+			}
+		} else if !alive && svcState.ExitInfo != "" {
 			if _, err := os.Stat(svcState.ExitInfo); err == nil {
 				ei, err := state.ReadExitInfo(svcState.ExitInfo)
 				if err == nil {
@@ -108,7 +140,7 @@ func (c *StatusCommand) RunIntoWriter(ctx context.Context, parsedLayers *layers.
 				}
 			}
 		}
-		if !alive && exitInfo == nil && s.TailLines > 0 {
+		if !alive && exitInfo == nil && jobStatus == "" && s.TailLines > 0 {
 			lines, err := state.TailLines(svcState.StderrLog, s.TailLines, 2<<20)
 			if err == nil {
 				exitInfo = &state.ExitInfo{
@@ -122,20 +154,63 @@ func (c *StatusCommand) RunIntoWriter(ctx context.Context, parsedLayers *layers.
 			}
 		}
 
-		services = append(services, svc{
-			Name:   svcState.Name,
-			PID:    svcState.PID,
-			Alive:  alive,
-			Stdout: svcState.StdoutLog,
-			Stderr: svcState.StderrLog,
-			Exit:   exitInfo,
-		})
+		row := svc{
+			Name:      svcState.Name,
+			Kind:      svcState.Kind,
+			PID:       svcState.PID,
+			Alive:     alive,
+			JobStatus: jobStatus,
+			Stdout:    svcState.StdoutLog,
+			Stderr:    svcState.StderrLog,
+			Exit:      exitInfo,
+		}
+		if exitInfo != nil {
+			row.ExitReason = supervise.DescribeExit(exitInfo)
+		}
+		if s.Env {
+			row.EnvPolicy = svcState.EnvPolicy
+			row.Env = svcState.EffectiveEnv
+			if row.Env == nil {
+				row.Env = svcState.Env // state written before effective env was recorded
+			}
+		}
+		services = append(services, row)
 	}
 
-	b, err := json.MarshalIndent(map[string]any{
+	out := map[string]any{
 		"exists":   true,
 		"services": services,
-	}, "", "  ")
+	}
+	if st.Profile != "" {
+		out["profile"] = st.Profile
+	}
+	if st.Instance != "" {
+		out["instance"] = st.Instance
+	}
+	if st.Workspace != "" {
+		out["workspace"] = st.Workspace
+	}
+	if s.Describe && st.Workspace == "" {
+		names := make([]string, 0, len(services))
+		for _, sv := range services {
+			names = append(names, sv.Name)
+		}
+		if rc.Profile == "" {
+			rc.Profile = st.Profile
+		}
+		facts, err := describeStatus(ctx, rc, names)
+		if err != nil {
+			// Facts are advisory; a broken plugin must not hide process status.
+			out["facts_error"] = err.Error()
+		} else if facts != nil {
+			out["facts"] = facts.Environment
+			for i := range services {
+				services[i].Facts = facts.Services[services[i].Name]
+			}
+		}
+	}
+
+	b, err := json.MarshalIndent(out, "", "  ")
 	if err != nil {
 		return errors.Wrap(err, "marshal status")
 	}
@@ -151,3 +226,18 @@ func newStatusCmd() *cobra.Command {
 	cobra.CheckErr(err)
 	return cmd
 }
+
+func describeStatus(ctx context.Context, rc RepoContext, services []string) (*engine.StatusDescribeResult, error) {
+	var ret *engine.StatusDescribeResult
+	err := withPipelineFor(ctx, rc, "status.describe", func(p *engine.Pipeline, conf patch.Config) error {
+		opCtx, cancel := context.WithTimeout(ctx, rc.Timeout)
+		defer cancel()
+		res, err := p.StatusDescribe(opCtx, conf, services)
+		if err != nil {
+			return err
+		}
+		ret = &res
+		return nil
+	})
+	return ret, err
+}
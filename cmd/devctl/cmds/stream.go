@@ -50,7 +50,7 @@ func newStreamStartCmd() *cobra.Command {
 				return err
 			}
 
-			repo, err := repository.Load(repository.Options{RepoRoot: opts.RepoRoot, ConfigPath: opts.Config, Cwd: meta.Cwd, DryRun: opts.DryRun})
+			repo, err := repository.Load(repository.Options{RepoRoot: opts.RepoRoot, ConfigPath: opts.Config, Cwd: meta.Cwd, DryRun: opts.DryRun, Profile: opts.Profile, Instance: opts.Instance, AllowUntrusted: opts.AllowUntrusted, ConfirmTrust: trustPrompt(cmd.InOrStdin(), cmd.ErrOrStderr())})
 			if err != nil {
 				return err
 			}
@@ -7,6 +7,8 @@ import (
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/go-go-golems/devctl/pkg/repository"
+	"github.com/go-go-golems/devctl/pkg/trust"
 	"github.com/go-go-golems/devctl/pkg/tui"
 	"github.com/go-go-golems/devctl/pkg/tui/models"
 	"github.com/pkg/errors"
@@ -20,6 +22,7 @@ func newTuiCmd() *cobra.Command {
 	var refresh time.Duration
 	var altScreen bool
 	var debugLogs bool
+	var useWorkspace bool
 
 	cmd := &cobra.Command{
 		Use:   "tui",
@@ -30,6 +33,19 @@ func newTuiCmd() *cobra.Command {
 				return err
 			}
 
+			// Settle trust up front: the UI cannot prompt once bubbletea owns the terminal.
+			if useWorkspace {
+				if err := settleWorkspaceTrust(cmd, opts); err != nil {
+					return err
+				}
+			} else if _, err := repository.Load(repository.Options{RepoRoot: opts.RepoRoot, ConfigPath: opts.Config, Cwd: opts.RepoRoot, Profile: opts.Profile, Instance: opts.Instance, AllowUntrusted: opts.AllowUntrusted, ConfirmTrust: trustPrompt(cmd.InOrStdin(), cmd.ErrOrStderr())}); err != nil {
+				// Other load errors are reported inside the UI.
+				var untrusted *trust.UntrustedError
+				if stderrors.As(err, &untrusted) {
+					return err
+				}
+			}
+
 			if !debugLogs {
 				zerolog.SetGlobalLevel(zerolog.Disabled)
 				log.Logger = zerolog.New(io.Discard)
@@ -51,6 +67,11 @@ func newTuiCmd() *cobra.Command {
 				Strict:   opts.Strict,
 				DryRun:   opts.DryRun,
 				Timeout:  opts.Timeout,
+				Profile:  opts.Profile,
+				Instance: opts.Instance,
+
+				Workspace:      useWorkspace,
+				AllowUntrusted: opts.AllowUntrusted,
 			})
 			tui.RegisterUIStreamRunner(ctx, bus, tui.RootOptions{
 				RepoRoot: opts.RepoRoot,
@@ -58,10 +79,16 @@ func newTuiCmd() *cobra.Command {
 				Strict:   opts.Strict,
 				DryRun:   opts.DryRun,
 				Timeout:  opts.Timeout,
+				Profile:  opts.Profile,
+				Instance: opts.Instance,
+
+				AllowUntrusted: opts.AllowUntrusted,
 			})
 
 			watcher := &tui.StateWatcher{
 				RepoRoot: opts.RepoRoot,
+				Profile:  opts.Profile,
+				Instance: opts.Instance,
 				Interval: refresh,
 				Pub:      bus.Publisher,
 			}
@@ -125,6 +152,7 @@ func newTuiCmd() *cobra.Command {
 
 	cmd.Flags().DurationVar(&refresh, "refresh", 1*time.Second, "Refresh interval for state polling")
 	cmd.Flags().BoolVar(&altScreen, "alt-screen", true, "Use the terminal alternate screen buffer")
+	cmd.Flags().BoolVar(&useWorkspace, "workspace", false, "Manage the repos listed in devctl.workspace.yaml (u starts the whole workspace)")
 	cmd.Flags().BoolVar(&debugLogs, "debug-logs", false, "Allow zerolog output to stdout/stderr while the TUI runs (may corrupt the UI)")
 	AddRepoFlags(cmd)
 	return cmd
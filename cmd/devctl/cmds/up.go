@@ -11,14 +11,16 @@ import (
 	"time"
 
 	"github.com/go-go-golems/devctl/pkg/engine"
-	"github.com/go-go-golems/devctl/pkg/patch"
+	"github.com/go-go-golems/devctl/pkg/registry"
 	"github.com/go-go-golems/devctl/pkg/repository"
 	"github.com/go-go-golems/devctl/pkg/runtime"
 	"github.com/go-go-golems/devctl/pkg/state"
 	"github.com/go-go-golems/devctl/pkg/supervise"
+	"github.com/go-go-golems/devctl/pkg/workspace"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 func newUpCmd() *cobra.Command {
@@ -28,20 +30,26 @@ func newUpCmd() *cobra.Command {
 	var skipPrepare bool
 	var buildSteps []string
 	var prepareSteps []string
+	var useWorkspace bool
 
 	cmd := &cobra.Command{
 		Use:   "up",
-		Short: "Start the dev environment (config.mutate + validate.run + launch.plan + supervise)",
+		Short: "Start the dev environment (config.mutate + validate.run + launch.plan + supervise + health.check)",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			opts, err := getRootOptions(cmd)
 			if err != nil {
 				return err
 			}
 
+			// Step names belong to one repo's config.
+			if useWorkspace && (len(buildSteps) > 0 || len(prepareSteps) > 0) {
+				return errors.New("--build-step and --prepare-step cannot be used with --workspace")
+			}
+
 			if !opts.DryRun {
-				if _, err := os.Stat(state.StatePath(opts.RepoRoot)); err == nil {
+				if _, err := os.Stat(state.StatePath(opts.RepoRoot, opts.Instance)); err == nil {
 					if !force {
-						aliveCount, err := countAliveFromState(opts.RepoRoot)
+						aliveCount, err := countAliveFromState(opts.RepoRoot, opts.Instance)
 						if err != nil {
 							return err
 						}
@@ -77,19 +85,23 @@ func newUpCmd() *cobra.Command {
 				}
 			}
 
+			if useWorkspace {
+				return upWorkspace(cmd, opts, workspace.UpOptions{SkipBuild: skipBuild, SkipPrepare: skipPrepare, SkipValidate: skipValidate})
+			}
+
 			meta, err := requestMetaFromRootOptions(opts)
 			if err != nil {
 				return err
 			}
-			repo, err := repository.Load(repository.Options{RepoRoot: opts.RepoRoot, ConfigPath: opts.Config, Cwd: meta.Cwd, DryRun: opts.DryRun})
+			repo, err := repository.Load(repository.Options{RepoRoot: opts.RepoRoot, ConfigPath: opts.Config, Cwd: meta.Cwd, DryRun: opts.DryRun, Profile: opts.Profile, Instance: opts.Instance, AllocatePorts: !opts.DryRun, AllowUntrusted: opts.AllowUntrusted, ConfirmTrust: trustPrompt(cmd.InOrStdin(), cmd.ErrOrStderr())})
 			if err != nil {
 				return err
 			}
 			if !opts.Strict && repo.Config.Strictness == "error" {
 				opts.Strict = true
 			}
-			if len(repo.Specs) == 0 {
-				return errors.New("no plugins configured (add .devctl.yaml)")
+			if !repo.HasPlugins() {
+				return errors.New("no plugins or services configured (add .devctl.yaml)")
 			}
 
 			ctx := cmd.Context()
@@ -111,13 +123,15 @@ func newUpCmd() *cobra.Command {
 			p := &engine.Pipeline{
 				Clients: clients,
 				Opts: engine.Options{
-					Strict: opts.Strict,
-					DryRun: opts.DryRun,
+					Strict:   opts.Strict,
+					DryRun:   opts.DryRun,
+					RepoRoot: repo.Root,
+					Instance: repo.Instance,
 				},
 			}
 
 			opCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
-			conf, err := p.MutateConfig(opCtx, patch.Config{})
+			conf, err := repo.MutateConfig(opCtx, p)
 			cancel()
 			if err != nil {
 				return err
@@ -168,6 +182,7 @@ func newUpCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			plan = repo.FilterPlan(plan)
 			out["plan"] = plan
 
 			if opts.DryRun {
@@ -180,20 +195,50 @@ func newUpCmd() *cobra.Command {
 				return nil
 			}
 
+			logPolicy, err := repo.LogPolicy()
+			if err != nil {
+				return err
+			}
 			wrapperExe, _ := os.Executable()
 			sup := supervise.New(supervise.Options{
 				RepoRoot:     opts.RepoRoot,
+				Instance:     opts.Instance,
 				ReadyTimeout: opts.Timeout,
 				WrapperExe:   wrapperExe,
+				Secrets:      repo.Secrets(),
+				EnvPolicy:    repo.DefaultEnvPolicy(),
+				Ports:        repo.Ports,
+				Logs:         logPolicy,
 			})
 			st, err := sup.Start(ctx, plan)
 			if err != nil {
 				return err
 			}
-			if err := state.Save(opts.RepoRoot, st); err != nil {
+			st.Profile = repo.ProfileName
+			if err := state.Save(opts.RepoRoot, opts.Instance, st); err != nil {
 				_ = sup.Stop(context.Background(), st)
 				return err
 			}
+			if err := registry.Register(registry.Entry{RepoRoot: opts.RepoRoot, Instance: opts.Instance, ConfigPath: opts.Config, Profile: st.Profile, StartedAt: st.CreatedAt}); err != nil {
+				log.Warn().Err(err).Msg("failed to register environment")
+			}
+			collectLogs(opts.RepoRoot, opts.Instance, logPolicy, st)
+
+			if p.Supports("health.check") {
+				names := make([]string, 0, len(plan.Services))
+				for _, svc := range plan.Services {
+					names = append(names, svc.Name)
+				}
+				opCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+				_, err := p.WaitHealthy(opCtx, conf, names, 500*time.Millisecond)
+				cancel()
+				if err != nil {
+					_ = sup.Stop(context.Background(), st)
+					_ = state.Remove(opts.RepoRoot, opts.Instance)
+					_ = registry.Unregister(opts.RepoRoot, opts.Instance)
+					return err
+				}
+			}
 
 			log.Info().Int("services", len(st.Services)).Msg("up complete")
 			_, _ = fmt.Fprintln(cmd.OutOrStdout(), "ok")
@@ -207,25 +252,28 @@ func newUpCmd() *cobra.Command {
 	cmd.Flags().BoolVar(&skipPrepare, "skip-prepare", false, "Skip prepare.run")
 	cmd.Flags().StringSliceVar(&buildSteps, "build-step", nil, "Build step name (repeatable)")
 	cmd.Flags().StringSliceVar(&prepareSteps, "prepare-step", nil, "Prepare step name (repeatable)")
+	cmd.Flags().BoolVar(&useWorkspace, "workspace", false, "Start every repo listed in devctl.workspace.yaml in the repo root")
 	AddRepoFlags(cmd)
 	return cmd
 }
 
 func stopFromState(ctx context.Context, opts rootOptions) error {
-	st, err := state.Load(opts.RepoRoot)
+	st, err := state.Load(opts.RepoRoot, opts.Instance)
 	if err != nil {
 		return err
 	}
 	wrapperExe, _ := os.Executable()
+	trusted := workspace.StopHooksTrusted(st, repository.Options{RepoRoot: opts.RepoRoot, ConfigPath: opts.Config, Cwd: opts.RepoRoot, Profile: st.Profile, Instance: opts.Instance, AllowUntrusted: opts.AllowUntrusted})
 	sup := supervise.New(supervise.Options{
-		RepoRoot:     opts.RepoRoot,
-		ReadyTimeout: opts.Timeout,
-		WrapperExe:   wrapperExe,
+		RepoRoot:      opts.RepoRoot,
+		Instance:      opts.Instance,
+		ReadyTimeout:  opts.Timeout,
+		WrapperExe:    wrapperExe,
+		SkipStopHooks: !trusted,
 	})
-	stopCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
-	defer cancel()
-	_ = sup.Stop(stopCtx, st)
-	return state.Remove(opts.RepoRoot)
+	_ = sup.Stop(ctx, st)
+	_ = registry.Unregister(opts.RepoRoot, opts.Instance)
+	return state.Remove(opts.RepoRoot, opts.Instance)
 }
 
 func isInteractive(r io.Reader) bool {
@@ -233,11 +281,8 @@ func isInteractive(r io.Reader) bool {
 	if !ok {
 		return false
 	}
-	st, err := f.Stat()
-	if err != nil {
-		return false
-	}
-	return st.Mode()&os.ModeCharDevice != 0
+	// A char device is not enough: /dev/null is one too.
+	return term.IsTerminal(int(f.Fd()))
 }
 
 func promptConfirm(out io.Writer, in io.Reader, prompt string) (bool, error) {
@@ -258,8 +303,8 @@ func promptConfirm(out io.Writer, in io.Reader, prompt string) (bool, error) {
 	return false, nil
 }
 
-func countAliveFromState(repoRoot string) (int, error) {
-	st, err := state.Load(repoRoot)
+func countAliveFromState(repoRoot, instance string) (int, error) {
+	st, err := state.Load(repoRoot, instance)
 	if err != nil {
 		return 0, err
 	}
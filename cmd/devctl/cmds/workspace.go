@@ -0,0 +1,75 @@
+package cmds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/go-go-golems/devctl/pkg/logfiles"
+	"github.com/go-go-golems/devctl/pkg/registry"
+	"github.com/go-go-golems/devctl/pkg/repository"
+	"github.com/go-go-golems/devctl/pkg/state"
+	"github.com/go-go-golems/devctl/pkg/supervise"
+	"github.com/go-go-golems/devctl/pkg/workspace"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+// upWorkspace is `up --workspace`: opts.RepoRoot holds devctl.workspace.yaml
+// and receives the combined state.
+func upWorkspace(cmd *cobra.Command, opts rootOptions, wo workspace.UpOptions) error {
+	ws, err := workspace.Load(opts.RepoRoot)
+	if err != nil {
+		return err
+	}
+	wo.Instance = opts.Instance
+	wo.Strict = opts.Strict
+	wo.DryRun = opts.DryRun
+	wo.Timeout = opts.Timeout
+	wo.WrapperExe, _ = os.Executable()
+	wo.AllowUntrusted = opts.AllowUntrusted
+	wo.ConfirmTrust = trustPrompt(cmd.InOrStdin(), cmd.ErrOrStderr())
+
+	res, err := workspace.Up(cmd.Context(), ws, wo)
+	if err != nil {
+		return err
+	}
+	if opts.DryRun {
+		b, err := json.MarshalIndent(res, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+		log.Info().Int("repos", len(res.Repos)).Msg("dry-run complete")
+		return nil
+	}
+
+	st := res.State
+	if err := state.Save(opts.RepoRoot, opts.Instance, st); err != nil {
+		_ = supervise.New(supervise.Options{RepoRoot: opts.RepoRoot, Instance: opts.Instance}).Stop(context.Background(), st)
+		return err
+	}
+	if err := registry.Register(registry.Entry{RepoRoot: opts.RepoRoot, Instance: opts.Instance, ConfigPath: opts.Config, StartedAt: st.CreatedAt}); err != nil {
+		log.Warn().Err(err).Msg("failed to register environment")
+	}
+	collectLogs(opts.RepoRoot, opts.Instance, logfiles.DefaultPolicy(), st)
+	log.Info().Int("repos", len(res.Repos)).Int("services", len(st.Services)).Msg("workspace up complete")
+	_, _ = fmt.Fprintln(cmd.OutOrStdout(), "ok")
+	return nil
+}
+
+// settleWorkspaceTrust loads every member once so untrusted plugins are
+// confirmed (or refused) before the TUI takes over the terminal.
+func settleWorkspaceTrust(cmd *cobra.Command, opts rootOptions) error {
+	ws, err := workspace.Load(opts.RepoRoot)
+	if err != nil {
+		return err
+	}
+	for _, r := range ws.Repos {
+		if _, err := repository.Load(repository.Options{RepoRoot: r.Path, ConfigPath: r.Config, Cwd: r.Path, Profile: r.Profile, Instance: opts.Instance, AllowUntrusted: opts.AllowUntrusted, ConfirmTrust: trustPrompt(cmd.InOrStdin(), cmd.ErrOrStderr())}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -8,11 +8,16 @@ import (
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/go-go-golems/devctl/pkg/engine"
+	"github.com/go-go-golems/devctl/pkg/limits"
+	"github.com/go-go-golems/devctl/pkg/logfiles"
 	"github.com/go-go-golems/devctl/pkg/state"
+	"github.com/go-go-golems/devctl/pkg/supervise"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -28,6 +33,10 @@ func newWrapServiceCmd() *cobra.Command {
 	var readyFile string
 	var envPairs []string
 	var tailLines int
+	var lim engine.Limits
+	var logMaxSize int64
+	var logMaxFiles int
+	var combinedLog string
 
 	cmd := &cobra.Command{
 		Use:    "__wrap-service -- [cmd args...]",
@@ -61,44 +70,91 @@ func newWrapServiceCmd() *cobra.Command {
 				return errors.Wrap(err, "mkdir exit dir")
 			}
 
-			stdoutFile, err := os.OpenFile(stdoutLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+			stdoutFile, err := logfiles.Open(stdoutLog, logMaxSize, logMaxFiles)
 			if err != nil {
 				return errors.Wrap(err, "open stdout log")
 			}
 			defer func() { _ = stdoutFile.Close() }()
 
-			stderrFile, err := os.OpenFile(stderrLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+			stderrFile, err := logfiles.Open(stderrLog, logMaxSize, logMaxFiles)
 			if err != nil {
 				return errors.Wrap(err, "open stderr log")
 			}
 			defer func() { _ = stderrFile.Close() }()
 
+			// With a combined log, both streams go through captures that also
+			// write each line, timestamped, to it.
+			var stdoutW, stderrW io.Writer = stdoutFile, stderrFile
+			var captures []*logfiles.Capture
+			if combinedLog != "" {
+				combined, err := logfiles.Open(combinedLog, logMaxSize, logMaxFiles)
+				if err != nil {
+					return errors.Wrap(err, "open combined log")
+				}
+				defer func() { _ = combined.Close() }()
+				captures = []*logfiles.Capture{
+					logfiles.NewCapture(serviceName, logfiles.Stdout, stdoutFile, combined),
+					logfiles.NewCapture(serviceName, logfiles.Stderr, stderrFile, combined),
+				}
+				stdoutW, stderrW = captures[0], captures[1]
+			}
+
 			startedAt := time.Now()
 
 			if err := syscall.Setpgid(0, 0); err != nil {
 				return errors.Wrap(err, "setpgid")
 			}
 
+			// Linux keeps the nice level per thread; fork from the one that set it.
+			runtime.LockOSThread()
+			guard, warnings, err := limits.Apply(serviceName, lim)
+			if err != nil {
+				_ = state.WriteExitInfo(exitInfoPath, state.ExitInfo{
+					Service:   serviceName,
+					StartedAt: startedAt,
+					ExitedAt:  time.Now(),
+					Error:     errors.Wrap(err, "apply limits").Error(),
+				})
+				return errors.Wrap(err, "apply limits")
+			}
+			for _, w := range warnings {
+				_, _ = fmt.Fprintf(stderrW, "devctl: %s\n", w)
+			}
+
 			// #nosec G204 -- command comes from the supervised service spec.
 			child := exec.Command(args[0], args[1:]...)
 			child.Dir = cwd
 			child.Env = mergeEnv(os.Environ(), parseEnvPairs(envPairs))
-			child.Stdout = stdoutFile
-			child.Stderr = stderrFile
+			if logMaxSize > 0 || len(captures) > 0 {
+				// Output goes through pipes so the writers can rotate or
+				// capture it; don't wait forever for daemonized grandchildren
+				// holding them open.
+				child.Stdout = stdoutW
+				child.Stderr = stderrW
+				child.WaitDelay = 2 * time.Second
+			} else {
+				child.Stdout = stdoutFile.File()
+				child.Stderr = stderrFile.File()
+			}
 
 			pgid := os.Getpid()
 			child.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Pgid: pgid}
+			guard.Prepare(child)
 
 			sigCh := make(chan os.Signal, 8)
-			signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+			signal.Notify(sigCh, supervise.StopSignals()...)
 			defer signal.Stop(sigCh)
 			go func() {
 				for s := range sigCh {
+					// Ignore our own copy while relaying, or it comes back here.
+					signal.Ignore(s)
 					_ = syscall.Kill(-pgid, s.(syscall.Signal))
+					signal.Notify(sigCh, s)
 				}
 			}()
 
 			if err := child.Start(); err != nil {
+				guard.Close()
 				_ = state.WriteExitInfo(exitInfoPath, state.ExitInfo{
 					Service:    serviceName,
 					PID:        0,
@@ -110,6 +166,10 @@ func newWrapServiceCmd() *cobra.Command {
 				return errors.Wrap(err, "start child")
 			}
 
+			if err := guard.Started(child.Process.Pid); err != nil {
+				_, _ = fmt.Fprintf(stderrW, "devctl: %v\n", err)
+			}
+
 			if readyFile != "" {
 				_ = os.MkdirAll(filepath.Dir(readyFile), 0o755)
 				_ = os.WriteFile(readyFile, []byte(fmt.Sprintf("%d\n", child.Process.Pid)), 0o644)
@@ -117,12 +177,18 @@ func newWrapServiceCmd() *cobra.Command {
 
 			waitErr := child.Wait()
 			exitedAt := time.Now()
+			for _, c := range captures {
+				c.Flush()
+			}
 
 			exitInfo := state.ExitInfo{
 				Service:   serviceName,
 				PID:       child.Process.Pid,
 				StartedAt: startedAt,
 				ExitedAt:  exitedAt,
+
+				OOMKilled:   guard.Close(),
+				MemoryLimit: guard.MemoryLimit(),
 			}
 
 			if waitErr != nil {
@@ -174,6 +240,13 @@ func newWrapServiceCmd() *cobra.Command {
 	cmd.Flags().StringVar(&readyFile, "ready-file", "", "Write child PID to this file once started")
 	cmd.Flags().StringSliceVar(&envPairs, "env", nil, "Extra env (KEY=VAL), repeatable")
 	cmd.Flags().IntVar(&tailLines, "tail-lines", 25, "How many stderr lines to record on exit")
+	cmd.Flags().StringVar(&lim.Memory, "memory-limit", "", "Memory limit, e.g. 2GiB")
+	cmd.Flags().Float64Var(&lim.CPU, "cpu-limit", 0, "CPU quota in cores")
+	cmd.Flags().Uint64Var(&lim.OpenFiles, "open-files", 0, "Max open files")
+	cmd.Flags().IntVar(&lim.Nice, "nice", 0, "Nice level")
+	cmd.Flags().StringVar(&combinedLog, "combined-log", "", "Also write both streams as timestamped NDJSON to this path")
+	cmd.Flags().Int64Var(&logMaxSize, "log-max-size", 0, "Rotate logs at this many bytes (0 never rotates)")
+	cmd.Flags().IntVar(&logMaxFiles, "log-max-files", 3, "Rotated log files to keep")
 	return cmd
 }
 
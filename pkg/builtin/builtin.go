@@ -0,0 +1,254 @@
+// Package builtin serves the services, validate, build and prepare sections of
+// .devctl.yaml as an in-process plugin, so they merge with real plugins through
+// engine.Pipeline like any other launch plan or step list.
+package builtin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/devctl/pkg/config"
+	"github.com/go-go-golems/devctl/pkg/engine"
+	"github.com/go-go-golems/devctl/pkg/interpolate"
+	"github.com/go-go-golems/devctl/pkg/patch"
+	"github.com/go-go-golems/devctl/pkg/protocol"
+	"github.com/go-go-golems/devctl/pkg/runtime"
+	"github.com/pkg/errors"
+)
+
+// ID is the plugin id of the built-in plugin; profiles can disable it by id.
+const ID = "builtin"
+
+// failureTailLines is how much output a failed step's result carries.
+const failureTailLines = 20
+
+// Enabled reports whether cfg declares anything the built-in plugin serves.
+func Enabled(cfg *config.File) bool {
+	return cfg != nil && (len(cfg.Services) > 0 || cfg.Validate != nil || len(cfg.Build) > 0 || len(cfg.Prepare) > 0)
+}
+
+type client struct {
+	root string
+	cfg  *config.File
+	meta runtime.RequestMeta
+	ops  []string
+}
+
+var _ runtime.Client = (*client)(nil)
+
+// New returns the built-in plugin for cfg, rooted at repoRoot.
+func New(repoRoot string, cfg *config.File, meta runtime.RequestMeta) runtime.Client {
+	c := &client{root: repoRoot, cfg: cfg, meta: meta}
+	if len(cfg.Services) > 0 {
+		c.ops = append(c.ops, "launch.plan")
+	}
+	if cfg.Validate != nil {
+		c.ops = append(c.ops, "validate.run")
+	}
+	if len(cfg.Build) > 0 {
+		c.ops = append(c.ops, "build.run")
+	}
+	if len(cfg.Prepare) > 0 {
+		c.ops = append(c.ops, "prepare.run")
+	}
+	return c
+}
+
+func (c *client) Spec() runtime.PluginSpec {
+	return runtime.PluginSpec{ID: ID, Path: config.DefaultConfigFilename, WorkDir: c.root, Priority: c.cfg.BuiltinPriority}
+}
+
+func (c *client) Handshake() protocol.Handshake {
+	return protocol.Handshake{
+		Type:            protocol.FrameHandshake,
+		ProtocolVersion: protocol.ProtocolV2,
+		PluginName:      ID,
+		Capabilities:    protocol.Capabilities{Ops: c.ops},
+	}
+}
+
+func (c *client) SupportsOp(op string) bool {
+	for _, o := range c.ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *client) Call(ctx context.Context, op string, input any, output any) error {
+	var (
+		out any
+		err error
+	)
+	switch op {
+	case "launch.plan":
+		out = c.launchPlan()
+	case "validate.run":
+		out = c.validate()
+	case "build.run":
+		out, err = c.runSteps(ctx, c.cfg.Build, input)
+	case "prepare.run":
+		out, err = c.runSteps(ctx, c.cfg.Prepare, input)
+	default:
+		return errors.Errorf("builtin: unsupported op %q", op)
+	}
+	if err != nil {
+		return err
+	}
+	if output == nil {
+		return nil
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		return errors.Wrap(err, "marshal builtin output")
+	}
+	return errors.Wrap(json.Unmarshal(b, output), "unmarshal builtin output")
+}
+
+func (c *client) StartStream(ctx context.Context, op string, input any) (string, <-chan protocol.Event, error) {
+	return "", nil, errors.Errorf("builtin: streams are not supported (%s)", op)
+}
+
+func (c *client) Close(ctx context.Context) error { return nil }
+
+func (c *client) launchPlan() engine.LaunchPlan {
+	plan := engine.LaunchPlan{Services: make([]engine.ServiceSpec, 0, len(c.cfg.Services))}
+	for _, s := range c.cfg.Services {
+		svc := engine.ServiceSpec{Name: s.Name, Kind: s.Kind, DependsOn: s.DependsOn, Cwd: s.Cwd, Command: s.Command, Env: s.Env, EnvFile: s.EnvFile, Secrets: s.Secrets, StopSignal: s.StopSignal, StopTimeoutMs: s.StopTimeoutMs}
+		if s.EnvPolicy != nil {
+			svc.EnvPolicy = &engine.EnvPolicy{Inherit: s.EnvPolicy.Inherit, Allow: s.EnvPolicy.Allow}
+		}
+		if s.Health != nil {
+			svc.Health = &engine.HealthCheck{Type: s.Health.Type, Address: s.Health.Address, URL: s.Health.URL, TimeoutMs: s.Health.TimeoutMs}
+		}
+		svc.PreStart, svc.PostStart, svc.PostStop = hook(s.PreStart), hook(s.PostStart), hook(s.PostStop)
+		if s.PreStop != nil {
+			svc.PreStop = &engine.PreStop{Command: s.PreStop.Command, URL: s.PreStop.URL, Method: s.PreStop.Method, TimeoutMs: s.PreStop.TimeoutMs}
+		}
+		if s.Limits != nil {
+			svc.Limits = &engine.Limits{Memory: s.Limits.Memory, CPU: s.Limits.CPU, OpenFiles: s.Limits.OpenFiles, Nice: s.Limits.Nice}
+		}
+		if s.Logs != nil {
+			svc.Logs = &engine.ServiceLogs{Parsers: s.Logs.Parsers}
+		}
+		plan.Services = append(plan.Services, svc)
+	}
+	return plan
+}
+
+func hook(h *config.Hook) *engine.Hook {
+	if h == nil {
+		return nil
+	}
+	return &engine.Hook{Command: h.Command, TimeoutMs: h.TimeoutMs}
+}
+
+func (c *client) validate() engine.ValidateResult {
+	res := engine.ValidateResult{Valid: true}
+	for _, name := range c.cfg.Validate.Commands {
+		if _, err := exec.LookPath(name); err != nil {
+			res.Valid = false
+			res.Errors = append(res.Errors, protocol.Error{Code: "E_MISSING_COMMAND", Message: fmt.Sprintf("command %q not found on PATH", name)})
+		}
+	}
+	for _, f := range c.cfg.Validate.Files {
+		p := f
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(c.root, p)
+		}
+		if _, err := os.Stat(p); err != nil {
+			res.Valid = false
+			res.Errors = append(res.Errors, protocol.Error{Code: "E_MISSING_FILE", Message: fmt.Sprintf("file %q not found", f)})
+		}
+	}
+	return res
+}
+
+// runSteps runs steps in order and stops at the first failure, which is
+// reported as a step with Ok false and the tail of its output.
+func (c *client) runSteps(ctx context.Context, steps []config.Step, input any) (engine.BuildResult, error) {
+	var cfg patch.Config
+	var only []string
+	if in, ok := input.(map[string]any); ok {
+		cfg, _ = in["config"].(patch.Config)
+		only, _ = in["steps"].([]string)
+	}
+	vars := interpolate.Vars{RepoRoot: c.root, Instance: c.meta.Instance, Config: cfg}
+
+	var res engine.BuildResult
+	for _, step := range steps {
+		if len(only) > 0 && !contains(only, step.Name) {
+			continue
+		}
+		start := time.Now()
+		sr := engine.StepResult{Name: step.Name, Ok: true}
+		if !c.meta.DryRun {
+			if output, err := c.runStep(ctx, step, vars); err != nil {
+				sr.Ok = false
+				sr.Output = strings.TrimSpace(err.Error() + "\n" + tail(output, failureTailLines))
+			}
+		}
+		sr.DurationMs = time.Since(start).Milliseconds()
+		res.Steps = append(res.Steps, sr)
+		if !sr.Ok {
+			break
+		}
+	}
+	return res, nil
+}
+
+// runStep runs one step and returns its combined output.
+func (c *client) runStep(ctx context.Context, step config.Step, vars interpolate.Vars) (string, error) {
+	script, err := interpolate.String(step.Run, vars)
+	if err != nil {
+		return "", err
+	}
+	env, err := interpolate.Map(step.Env, vars)
+	if err != nil {
+		return "", errors.Wrap(err, "env")
+	}
+	dir := c.root
+	if step.Cwd != "" {
+		dir = step.Cwd
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(c.root, dir)
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", script)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	err = cmd.Run()
+	return buf.String(), errors.Wrap(err, script)
+}
+
+func tail(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package builtin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-go-golems/devctl/pkg/config"
+	"github.com/go-go-golems/devctl/pkg/engine"
+	"github.com/go-go-golems/devctl/pkg/patch"
+	"github.com/go-go-golems/devctl/pkg/runtime"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_DeclaresOpsForConfiguredSections(t *testing.T) {
+	require.False(t, Enabled(&config.File{}))
+	c := New(t.TempDir(), &config.File{
+		Services: []config.Service{{Name: "web", Command: []string{"serve"}}},
+		Build:    []config.Step{{Name: "b", Run: "true"}},
+	}, runtime.RequestMeta{})
+	require.True(t, c.SupportsOp("launch.plan"))
+	require.True(t, c.SupportsOp("build.run"))
+	require.False(t, c.SupportsOp("prepare.run"))
+	require.False(t, c.SupportsOp("validate.run"))
+	require.Equal(t, ID, c.Spec().ID)
+}
+
+func TestLaunchPlan_MapsServices(t *testing.T) {
+	c := New(t.TempDir(), &config.File{Services: []config.Service{{
+		Name:      "api",
+		DependsOn: []string{"db"},
+		Command:   []string{"serve", "--port", "${config.port}"},
+		Health:    &config.Health{Type: "http", URL: "http://127.0.0.1:8080/health"},
+		PreStart:  &config.Hook{Command: []string{"migrate"}},
+	}}}, runtime.RequestMeta{})
+	var plan engine.LaunchPlan
+	require.NoError(t, c.Call(context.Background(), "launch.plan", nil, &plan))
+	require.Len(t, plan.Services, 1)
+	svc := plan.Services[0]
+	require.Equal(t, []string{"db"}, svc.DependsOn)
+	// References are left for the pipeline to expand.
+	require.Equal(t, []string{"serve", "--port", "${config.port}"}, svc.Command)
+	require.Equal(t, "http", svc.Health.Type)
+	require.Equal(t, []string{"migrate"}, svc.PreStart.Command)
+}
+
+func TestValidate_ReportsMissingCommandsAndFiles(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "present"), nil, 0o644))
+	c := New(root, &config.File{Validate: &config.Validate{
+		Commands: []string{"sh", "devctl-no-such-command"},
+		Files:    []string{"present", "missing"},
+	}}, runtime.RequestMeta{})
+	var res engine.ValidateResult
+	require.NoError(t, c.Call(context.Background(), "validate.run", nil, &res))
+	require.False(t, res.Valid)
+	require.Len(t, res.Errors, 2)
+	require.Equal(t, "E_MISSING_COMMAND", res.Errors[0].Code)
+	require.Equal(t, "E_MISSING_FILE", res.Errors[1].Code)
+}
+
+func TestBuild_RunsStepsWithConfigAndCwd(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "sub"), 0o755))
+	c := New(root, &config.File{Build: []config.Step{
+		{Name: "write", Run: `echo "${config.port} $NAME" > out`, Cwd: "sub", Env: map[string]string{"NAME": "${instance}"}},
+		{Name: "skipped", Run: "touch skipped"},
+	}}, runtime.RequestMeta{Instance: "pr-1"})
+
+	in := map[string]any{"config": patch.Config{"port": 5433}, "steps": []string{"write"}}
+	var res engine.BuildResult
+	require.NoError(t, c.Call(context.Background(), "build.run", in, &res))
+	require.Len(t, res.Steps, 1)
+	require.True(t, res.Steps[0].Ok)
+
+	b, err := os.ReadFile(filepath.Join(root, "sub", "out"))
+	require.NoError(t, err)
+	require.Equal(t, "5433 pr-1\n", string(b))
+	require.NoFileExists(t, filepath.Join(root, "skipped"))
+}
+
+func TestBuild_FailedStepIsReportedAndStops(t *testing.T) {
+	root := t.TempDir()
+	c := New(root, &config.File{Prepare: []config.Step{
+		{Name: "ok", Run: "true"},
+		{Name: "broken", Run: "echo compiling; echo boom >&2; exit 3"},
+		{Name: "after", Run: "touch after"},
+	}}, runtime.RequestMeta{})
+
+	var res engine.PrepareResult
+	require.NoError(t, c.Call(context.Background(), "prepare.run", nil, &res))
+	require.Len(t, res.Steps, 2)
+	require.True(t, res.Steps[0].Ok)
+	require.Equal(t, "broken", res.Steps[1].Name)
+	require.False(t, res.Steps[1].Ok)
+	require.Contains(t, res.Steps[1].Output, "exit status 3")
+	require.Contains(t, res.Steps[1].Output, "compiling\nboom")
+	require.NoFileExists(t, filepath.Join(root, "after"))
+}
+
+func TestBuild_DryRunRunsNothing(t *testing.T) {
+	root := t.TempDir()
+	c := New(root, &config.File{Build: []config.Step{{Name: "touch", Run: "touch ran"}}}, runtime.RequestMeta{DryRun: true})
+	var res engine.BuildResult
+	require.NoError(t, c.Call(context.Background(), "build.run", nil, &res))
+	require.Len(t, res.Steps, 1)
+	require.True(t, res.Steps[0].Ok)
+	require.NoFileExists(t, filepath.Join(root, "ran"))
+}
@@ -11,8 +11,192 @@ import (
 const DefaultConfigFilename = ".devctl.yaml"
 
 type File struct {
-	Plugins    []Plugin `yaml:"plugins"`
-	Strictness string   `yaml:"strictness,omitempty"` // "warn" | "error"
+	Plugins        []Plugin           `yaml:"plugins"`
+	Strictness     string             `yaml:"strictness,omitempty"` // "warn" | "error"
+	Timeout        string             `yaml:"timeout,omitempty"`    // default --timeout, e.g. "60s"
+	Profiles       map[string]Profile `yaml:"profiles,omitempty"`
+	DefaultProfile string             `yaml:"default_profile,omitempty"`
+
+	// Services, Validate, Build and Prepare are served by the built-in plugin
+	// (see pkg/builtin) at BuiltinPriority, so simple repos need no plugin.
+	Services        []Service `yaml:"services,omitempty"`
+	Validate        *Validate `yaml:"validate,omitempty"`
+	Build           []Step    `yaml:"build,omitempty"`
+	Prepare         []Step    `yaml:"prepare,omitempty"`
+	BuiltinPriority int       `yaml:"builtin_priority,omitempty"`
+
+	// SecretProviders adds named secret providers: `sh -c <command>` with the
+	// reference as $1 (see pkg/secrets).
+	SecretProviders map[string]string `yaml:"secret_providers,omitempty"`
+
+	// EnvPolicy is the default for services that do not set one.
+	EnvPolicy *EnvPolicy `yaml:"env_policy,omitempty"`
+
+	// Ports requests named ports (name -> preferred port, 0 for any). devctl
+	// assigns them and exposes them as config ports.<name> (see pkg/ports).
+	Ports map[string]int `yaml:"ports,omitempty"`
+
+	// Logs configures rotation and retention of service logs.
+	Logs *Logs `yaml:"logs,omitempty"`
+}
+
+// Logs overrides logfiles.DefaultPolicy. Sizes take units ("100MiB"), ages
+// Go durations or days ("14d"); "0" disables a limit.
+type Logs struct {
+	MaxSize      string `yaml:"max_size,omitempty"`
+	MaxFiles     *int   `yaml:"max_files,omitempty"`
+	KeepRuns     *int   `yaml:"keep_runs,omitempty"`
+	MaxAge       string `yaml:"max_age,omitempty"`
+	MaxTotalSize string `yaml:"max_total_size,omitempty"`
+	// Combined also writes both streams, timestamped, to one NDJSON file.
+	Combined bool `yaml:"combined,omitempty"`
+}
+
+// Service mirrors engine.ServiceSpec.
+type Service struct {
+	Name      string            `yaml:"name"`
+	Kind      string            `yaml:"kind,omitempty"` // "service" | "job"
+	DependsOn []string          `yaml:"depends_on,omitempty"`
+	Cwd       string            `yaml:"cwd,omitempty"`
+	Command   []string          `yaml:"command"`
+	Env       map[string]string `yaml:"env,omitempty"`
+	EnvFile   []string          `yaml:"env_file,omitempty"`
+	Secrets   map[string]string `yaml:"secrets,omitempty"`
+	EnvPolicy *EnvPolicy        `yaml:"env_policy,omitempty"`
+	Health    *Health           `yaml:"health,omitempty"`
+	Limits    *Limits           `yaml:"limits,omitempty"`
+
+	StopSignal    string   `yaml:"stop_signal,omitempty"` // "SIGINT", "SIGQUIT", ...
+	StopTimeoutMs int64    `yaml:"stop_timeout_ms,omitempty"`
+	PreStop       *PreStop `yaml:"pre_stop,omitempty"`
+
+	PreStart  *Hook `yaml:"pre_start,omitempty"`
+	PostStart *Hook `yaml:"post_start,omitempty"`
+	PostStop  *Hook `yaml:"post_stop,omitempty"`
+
+	Logs *ServiceLogs `yaml:"logs,omitempty"`
+}
+
+// ServiceLogs mirrors engine.ServiceLogs.
+type ServiceLogs struct {
+	Parsers []string `yaml:"parsers,omitempty"`
+}
+
+// Hook mirrors engine.Hook.
+type Hook struct {
+	Command   []string `yaml:"command"`
+	TimeoutMs int64    `yaml:"timeout_ms,omitempty"`
+}
+
+// PreStop mirrors engine.PreStop.
+type PreStop struct {
+	Command   []string `yaml:"command,omitempty"`
+	URL       string   `yaml:"url,omitempty"`
+	Method    string   `yaml:"method,omitempty"`
+	TimeoutMs int64    `yaml:"timeout_ms,omitempty"`
+}
+
+// EnvPolicy mirrors engine.EnvPolicy.
+type EnvPolicy struct {
+	Inherit string   `yaml:"inherit,omitempty"` // "all" | "allowlist" | "clean"
+	Allow   []string `yaml:"allow,omitempty"`
+}
+
+// Health mirrors engine.HealthCheck.
+type Health struct {
+	Type      string `yaml:"type"` // "tcp"|"http"
+	Address   string `yaml:"address,omitempty"`
+	URL       string `yaml:"url,omitempty"`
+	TimeoutMs int64  `yaml:"timeout_ms,omitempty"`
+}
+
+// Limits mirrors engine.Limits.
+type Limits struct {
+	Memory    string  `yaml:"memory,omitempty"` // "512MiB", "2G"
+	CPU       float64 `yaml:"cpu,omitempty"`    // cores
+	OpenFiles uint64  `yaml:"open_files,omitempty"`
+	Nice      int     `yaml:"nice,omitempty"`
+}
+
+// Validate lists prerequisites checked by validate.run.
+type Validate struct {
+	Commands []string `yaml:"commands,omitempty"` // must be on PATH
+	Files    []string `yaml:"files,omitempty"`    // relative to the repo root
+}
+
+// Step is a shell step for build.run or prepare.run, run with `sh -c`.
+type Step struct {
+	Name string            `yaml:"name"`
+	Run  string            `yaml:"run"`
+	Cwd  string            `yaml:"cwd,omitempty"`
+	Env  map[string]string `yaml:"env,omitempty"`
+}
+
+// Profile narrows the environment to what a developer needs. Empty lists mean
+// "no restriction".
+type Profile struct {
+	Description     string         `yaml:"description,omitempty"`
+	Plugins         []string       `yaml:"plugins,omitempty"`          // only these plugin ids
+	DisablePlugins  []string       `yaml:"disable_plugins,omitempty"`  // never these plugin ids
+	Services        []string       `yaml:"services,omitempty"`         // only these services from launch.plan
+	DisableServices []string       `yaml:"disable_services,omitempty"` // never these services
+	Config          map[string]any `yaml:"config,omitempty"`           // dotted keys fed to config.mutate as the initial config
+}
+
+// PluginEnabled reports whether the profile keeps the plugin with this id.
+func (p *Profile) PluginEnabled(id string) bool {
+	if p == nil {
+		return true
+	}
+	return allowed(id, p.Plugins, p.DisablePlugins)
+}
+
+// ServiceEnabled reports whether the profile keeps the named service.
+func (p *Profile) ServiceEnabled(name string) bool {
+	if p == nil {
+		return true
+	}
+	return allowed(name, p.Services, p.DisableServices)
+}
+
+func allowed(name string, only, never []string) bool {
+	for _, n := range never {
+		if n == name {
+			return false
+		}
+	}
+	if len(only) == 0 {
+		return true
+	}
+	for _, n := range only {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ProfileEnvVar selects a profile when --profile is empty; it wins over default_profile.
+const ProfileEnvVar = "DEVCTL_PROFILE"
+
+// ResolveProfile picks the profile by precedence: the explicit name, then
+// $DEVCTL_PROFILE, then default_profile. It returns ("", nil, nil) when none is
+// selected, and an error when the selected name is not defined.
+func (f *File) ResolveProfile(name string) (string, *Profile, error) {
+	if name == "" {
+		name = os.Getenv(ProfileEnvVar)
+	}
+	if name == "" {
+		name = f.DefaultProfile
+	}
+	if name == "" {
+		return "", nil, nil
+	}
+	p, ok := f.Profiles[name]
+	if !ok {
+		return "", nil, errors.Errorf("unknown profile %q", name)
+	}
+	return name, &p, nil
 }
 
 type Plugin struct {
@@ -22,6 +206,7 @@ type Plugin struct {
 	Priority int               `yaml:"priority,omitempty"`
 	WorkDir  string            `yaml:"workdir,omitempty"`
 	Env      map[string]string `yaml:"env,omitempty"`
+	Disabled bool              `yaml:"disabled,omitempty"` // usually set from .devctl.local.yaml
 }
 
 func DefaultPath(repoRoot string) string {
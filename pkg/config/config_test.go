@@ -0,0 +1,106 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveProfile_Precedence(t *testing.T) {
+	f := &File{
+		DefaultProfile: "full",
+		Profiles:       map[string]Profile{"full": {}, "web": {}, "db": {}},
+	}
+	cases := []struct {
+		explicit, env, want string
+	}{
+		{"", "", "full"},
+		{"", "db", "db"},
+		{"web", "db", "web"},
+	}
+	for _, c := range cases {
+		t.Setenv(ProfileEnvVar, c.env)
+		name, p, err := f.ResolveProfile(c.explicit)
+		if err != nil {
+			t.Fatalf("explicit=%q env=%q: %v", c.explicit, c.env, err)
+		}
+		if name != c.want || p == nil {
+			t.Fatalf("explicit=%q env=%q: got %q, want %q", c.explicit, c.env, name, c.want)
+		}
+	}
+
+	t.Setenv(ProfileEnvVar, "")
+	if name, p, err := (&File{}).ResolveProfile(""); err != nil || name != "" || p != nil {
+		t.Fatalf("no profile: got %q %v %v", name, p, err)
+	}
+}
+
+func TestResolveProfile_Unknown(t *testing.T) {
+	f := &File{DefaultProfile: "gone", Profiles: map[string]Profile{"web": {}}}
+	for _, c := range []struct{ explicit, env string }{{"nope", ""}, {"", "nope"}, {"", ""}} {
+		t.Setenv(ProfileEnvVar, c.env)
+		if _, _, err := f.ResolveProfile(c.explicit); err == nil || !strings.Contains(err.Error(), "unknown profile") {
+			t.Fatalf("explicit=%q env=%q: want unknown profile error, got %v", c.explicit, c.env, err)
+		}
+	}
+}
+
+func TestProfile_Enabled(t *testing.T) {
+	p := &Profile{
+		Plugins:         []string{"app", "db"},
+		DisablePlugins:  []string{"db"},
+		DisableServices: []string{"worker"},
+	}
+	for id, want := range map[string]bool{"app": true, "db": false, "other": false} {
+		if got := p.PluginEnabled(id); got != want {
+			t.Fatalf("PluginEnabled(%q) = %v, want %v", id, got, want)
+		}
+	}
+	for name, want := range map[string]bool{"web": true, "worker": false} {
+		if got := p.ServiceEnabled(name); got != want {
+			t.Fatalf("ServiceEnabled(%q) = %v, want %v", name, got, want)
+		}
+	}
+	var none *Profile
+	if !none.PluginEnabled("x") || !none.ServiceEnabled("x") {
+		t.Fatal("nil profile must keep everything")
+	}
+}
+
+func TestLoadLayered_ProfileOverlay(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(UserConfigEnvVar, filepath.Join(dir, "missing.yaml"))
+	repoPath := filepath.Join(dir, ".devctl.yaml")
+	if err := os.WriteFile(repoPath, []byte(`
+profiles:
+  web:
+    services: [web]
+    config: {db.host: localhost, db.port: 5432}
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(LocalPath(repoPath), []byte(`
+profiles:
+  web:
+    config: {db.host: db.internal}
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := LoadLayered(repoPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(ProfileEnvVar, "")
+	_, p, err := l.File.ResolveProfile("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Services) != 1 || p.Services[0] != "web" {
+		t.Fatalf("services: %v", p.Services)
+	}
+	if p.Config["db.host"] != "db.internal" || p.Config["db.port"] != 5432 {
+		t.Fatalf("config: %v", p.Config)
+	}
+}
@@ -0,0 +1,271 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Layer names, lowest precedence first.
+const (
+	LayerUser  = "user"
+	LayerRepo  = "repo"
+	LayerLocal = "local"
+)
+
+// UserConfigEnvVar overrides the location of the user-global config file.
+const UserConfigEnvVar = "DEVCTL_USER_CONFIG"
+
+// Layer is one config file taking part in the merge.
+type Layer struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Exists bool   `json:"exists"`
+}
+
+// Contribution records that a layer set a key. Keys are dotted; plugins are
+// addressed by id ("plugins.app.env.FOO"), list values are leaves.
+type Contribution struct {
+	Key   string `json:"key"`
+	Layer string `json:"layer"`
+	Path  string `json:"path"`
+}
+
+// Layered is the merged config plus where each key came from.
+type Layered struct {
+	File          *File
+	Layers        []Layer
+	Contributions []Contribution
+}
+
+// UserConfigPath returns ~/.config/devctl/config.yaml (honoring
+// $XDG_CONFIG_HOME and $DEVCTL_USER_CONFIG), or "" if no home is known.
+func UserConfigPath() string {
+	if p := os.Getenv(UserConfigEnvVar); p != "" {
+		return p
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "devctl", "config.yaml")
+}
+
+// LocalPath returns the git-ignored override file next to the repo config:
+// .devctl.yaml -> .devctl.local.yaml.
+func LocalPath(repoConfigPath string) string {
+	ext := filepath.Ext(repoConfigPath)
+	return strings.TrimSuffix(repoConfigPath, ext) + ".local" + ext
+}
+
+// personalKeys are settings that belong to the developer rather than the
+// repo: for these the user layer wins over the repo layer.
+var personalKeys = map[string]bool{"default_profile": true, "timeout": true}
+
+// LoadLayered merges the user config, the repo config at repoConfigPath and its
+// local override, in that order. Missing files are skipped. Merge rules:
+//   - scalars (strictness, timeout, default_profile) are replaced by later layers,
+//     except that timeout and default_profile from the user layer beat the repo's;
+//   - plugins are matched by id: maps (env) merge key by key, other fields are
+//     replaced, unknown ids are appended, and `disabled: true` turns one off;
+//   - profiles are matched by name and merged the same way.
+func LoadLayered(repoConfigPath string) (*Layered, error) {
+	out := &Layered{}
+	paths := []struct{ name, path string }{
+		{LayerUser, UserConfigPath()},
+		{LayerRepo, repoConfigPath},
+		{LayerLocal, LocalPath(repoConfigPath)},
+	}
+
+	type loaded struct {
+		layer Layer
+		raw   map[string]any
+	}
+	var present []loaded
+	for _, lp := range paths {
+		if lp.path == "" {
+			continue
+		}
+		layer := Layer{Name: lp.name, Path: lp.path}
+		raw, err := readRaw(lp.path)
+		if err != nil {
+			return nil, err
+		}
+		if raw != nil {
+			layer.Exists = true
+			present = append(present, loaded{layer, raw})
+		}
+		out.Layers = append(out.Layers, layer)
+	}
+
+	// Personal keys merge with user and repo swapped.
+	personalOrder := append([]loaded(nil), present...)
+	if len(personalOrder) > 1 && personalOrder[0].layer.Name == LayerUser && personalOrder[1].layer.Name == LayerRepo {
+		personalOrder[0], personalOrder[1] = personalOrder[1], personalOrder[0]
+	}
+	merged := map[string]any{}
+	for _, pass := range []struct {
+		personal bool
+		order    []loaded
+	}{{false, present}, {true, personalOrder}} {
+		for _, l := range pass.order {
+			raw := map[string]any{}
+			for k, v := range l.raw {
+				if personalKeys[k] == pass.personal {
+					raw[k] = v
+				}
+			}
+			if err := mergeLayer(merged, raw, l.layer.Path); err != nil {
+				return nil, err
+			}
+			out.Contributions = append(out.Contributions, contributions(l.layer, raw)...)
+		}
+	}
+
+	b, err := yaml.Marshal(merged)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal merged config")
+	}
+	var cfg File
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		return nil, errors.Wrap(err, "parse merged config")
+	}
+	out.File = &cfg
+	return out, nil
+}
+
+func readRaw(path string) (map[string]any, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "read config")
+	}
+	raw := map[string]any{}
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return nil, errors.Wrapf(err, "parse config yaml %s", path)
+	}
+	return raw, nil
+}
+
+func mergeLayer(dst, src map[string]any, path string) error {
+	for k, v := range src {
+		switch k {
+		case "plugins":
+			list, ok := v.([]any)
+			if !ok && v != nil {
+				return errors.Errorf("%s: plugins must be a list", path)
+			}
+			merged, err := mergePlugins(asList(dst[k]), list, path)
+			if err != nil {
+				return err
+			}
+			dst[k] = merged
+		case "profiles":
+			m, ok := v.(map[string]any)
+			if !ok && v != nil {
+				return errors.Errorf("%s: profiles must be a map", path)
+			}
+			cur, _ := dst[k].(map[string]any)
+			if cur == nil {
+				cur = map[string]any{}
+			}
+			for name, p := range m {
+				cur[name] = mergeValue(cur[name], p)
+			}
+			dst[k] = cur
+		default:
+			dst[k] = v
+		}
+	}
+	return nil
+}
+
+func mergePlugins(dst, src []any, path string) ([]any, error) {
+	for _, item := range src {
+		p, ok := item.(map[string]any)
+		if !ok {
+			return nil, errors.Errorf("%s: plugin entry must be a map", path)
+		}
+		id, _ := p["id"].(string)
+		found := false
+		for i, existing := range dst {
+			if e, ok := existing.(map[string]any); ok && id != "" && e["id"] == id {
+				dst[i] = mergeValue(e, p)
+				found = true
+				break
+			}
+		}
+		if !found {
+			dst = append(dst, p)
+		}
+	}
+	return dst, nil
+}
+
+// mergeValue merges maps recursively; anything else is replaced.
+func mergeValue(dst, src any) any {
+	dm, ok1 := dst.(map[string]any)
+	sm, ok2 := src.(map[string]any)
+	if !ok1 || !ok2 {
+		return src
+	}
+	out := make(map[string]any, len(dm)+len(sm))
+	for k, v := range dm {
+		out[k] = v
+	}
+	for k, v := range sm {
+		out[k] = mergeValue(out[k], v)
+	}
+	return out
+}
+
+func asList(v any) []any {
+	l, _ := v.([]any)
+	return l
+}
+
+func contributions(layer Layer, raw map[string]any) []Contribution {
+	var keys []string
+	for k, v := range raw {
+		if k == "plugins" {
+			for i, item := range asList(v) {
+				p, _ := item.(map[string]any)
+				id, _ := p["id"].(string)
+				if id == "" {
+					id = "#" + strconv.Itoa(i)
+				}
+				for field, fv := range p {
+					if field == "id" {
+						continue
+					}
+					keys = flattenKeys("plugins."+id+"."+field, fv, keys)
+				}
+			}
+			continue
+		}
+		keys = flattenKeys(k, v, keys)
+	}
+	sort.Strings(keys)
+	out := make([]Contribution, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, Contribution{Key: k, Layer: layer.Name, Path: layer.Path})
+	}
+	return out
+}
+
+func flattenKeys(prefix string, v any, out []string) []string {
+	if m, ok := v.(map[string]any); ok && len(m) > 0 {
+		for k, child := range m {
+			out = flattenKeys(prefix+"."+k, child, out)
+		}
+		return out
+	}
+	return append(out, prefix)
+}
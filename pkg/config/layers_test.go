@@ -0,0 +1,118 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadLayered_MergesUserRepoLocal(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, body string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	t.Setenv(UserConfigEnvVar, write("user.yaml", "timeout: 45s\nstrictness: warn\n"))
+	repoPath := write(".devctl.yaml", `
+strictness: error
+plugins:
+  - id: app
+    path: ./app.py
+    env: {A: "1", B: "1"}
+  - id: data
+    path: ./data.py
+`)
+	write(".devctl.local.yaml", `
+plugins:
+  - id: app
+    env: {B: "2"}
+  - id: data
+    disabled: true
+`)
+
+	l, err := LoadLayered(repoPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := l.File
+	if f.Timeout != "45s" || f.Strictness != "error" {
+		t.Fatalf("scalars: timeout=%q strictness=%q", f.Timeout, f.Strictness)
+	}
+	if len(f.Plugins) != 2 {
+		t.Fatalf("expected 2 plugins, got %#v", f.Plugins)
+	}
+	app := f.Plugins[0]
+	if app.Path != "./app.py" || app.Env["A"] != "1" || app.Env["B"] != "2" {
+		t.Fatalf("app not merged: %#v", app)
+	}
+	if !f.Plugins[1].Disabled || f.Plugins[1].Path != "./data.py" {
+		t.Fatalf("data not disabled: %#v", f.Plugins[1])
+	}
+
+	var envB []string
+	for _, c := range l.Contributions {
+		if c.Key == "plugins.app.env.B" {
+			envB = append(envB, c.Layer)
+		}
+	}
+	if len(envB) != 2 || envB[0] != LayerRepo || envB[1] != LayerLocal {
+		t.Fatalf("unexpected contributions for env.B: %v", envB)
+	}
+}
+
+func TestLoadLayered_Precedence(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, body string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	// Each key is set by every layer that should lose to the expected winner.
+	t.Setenv(UserConfigEnvVar, write("user.yaml", `
+strictness: warn
+timeout: 45s
+default_profile: mine
+`))
+	repoPath := write(".devctl.yaml", `
+strictness: error
+timeout: 10s
+default_profile: full
+profiles: {full: {}, mine: {}, local: {}}
+`)
+	cases := []struct {
+		local                        string
+		strictness, timeout, profile string
+		timeoutBy                    string
+	}{
+		{"", "error", "45s", "mine", LayerUser},
+		{"timeout: 5m\ndefault_profile: local\nstrictness: off\n", "off", "5m", "local", LayerLocal},
+	}
+	for _, c := range cases {
+		_ = os.Remove(LocalPath(repoPath))
+		if c.local != "" {
+			write(".devctl.local.yaml", c.local)
+		}
+		l, err := LoadLayered(repoPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := l.File
+		if f.Strictness != c.strictness || f.Timeout != c.timeout || f.DefaultProfile != c.profile {
+			t.Fatalf("local=%q: strictness=%q timeout=%q default_profile=%q", c.local, f.Strictness, f.Timeout, f.DefaultProfile)
+		}
+		var last string
+		for _, con := range l.Contributions {
+			if con.Key == "timeout" {
+				last = con.Layer
+			}
+		}
+		if last != c.timeoutBy {
+			t.Fatalf("local=%q: timeout attributed to %q, want %q", c.local, last, c.timeoutBy)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/go-go-golems/devctl/pkg/config"
+	"github.com/go-go-golems/devctl/pkg/interpolate"
 	"github.com/go-go-golems/devctl/pkg/runtime"
 	"github.com/pkg/errors"
 )
@@ -33,6 +34,9 @@ func Discover(cfg *config.File, opts Options) ([]runtime.PluginSpec, error) {
 			return nil, errors.Errorf("duplicate plugin id %q", p.ID)
 		}
 		seen[p.ID] = struct{}{}
+		if p.Disabled {
+			continue
+		}
 		if p.Path == "" {
 			return nil, errors.Errorf("plugin %q missing path", p.ID)
 		}
@@ -81,11 +85,22 @@ func toSpec(repoRoot string, p config.Plugin) (runtime.PluginSpec, error) {
 		}
 	}
 
+	// Plugins start before config.mutate, so only ${repo_root} and ${env.*} resolve here.
+	vars := interpolate.Vars{RepoRoot: repoRoot}
+	args, err := interpolate.Strings(p.Args, vars)
+	if err != nil {
+		return runtime.PluginSpec{}, errors.Wrapf(err, "plugin %q args", p.ID)
+	}
+	env, err := interpolate.Map(p.Env, vars)
+	if err != nil {
+		return runtime.PluginSpec{}, errors.Wrapf(err, "plugin %q env", p.ID)
+	}
+
 	return runtime.PluginSpec{
 		ID:       p.ID,
 		Path:     path,
-		Args:     p.Args,
-		Env:      p.Env,
+		Args:     args,
+		Env:      env,
 		WorkDir:  workDir,
 		Priority: p.Priority,
 	}, nil
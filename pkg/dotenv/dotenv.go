@@ -0,0 +1,97 @@
+// Package dotenv reads .env files: KEY=VALUE lines with optional `export `,
+// # comments, and single- or double-quoted values. Double quotes understand
+// \n, \t, \" and \\; nothing is expanded.
+package dotenv
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Parse reads dotenv content. Later assignments of the same key win.
+func Parse(r io.Reader) (map[string]string, error) {
+	out := map[string]string{}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, raw, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, errors.Errorf("line %d: expected KEY=VALUE", lineNo)
+		}
+		val, err := parseValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", lineNo)
+		}
+		out[key] = val
+	}
+	if err := sc.Err(); err != nil {
+		return nil, errors.Wrap(err, "read dotenv")
+	}
+	return out, nil
+}
+
+// ReadFile parses one dotenv file.
+func ReadFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	env, err := Parse(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse %s", path)
+	}
+	return env, nil
+}
+
+func parseValue(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+	switch raw[0] {
+	case '\'':
+		end := strings.IndexByte(raw[1:], '\'')
+		if end < 0 {
+			return "", errors.New("unterminated single quote")
+		}
+		return raw[1 : end+1], nil
+	case '"':
+		var b strings.Builder
+		for i := 1; i < len(raw); i++ {
+			c := raw[i]
+			switch {
+			case c == '"':
+				return b.String(), nil
+			case c == '\\' && i+1 < len(raw):
+				i++
+				switch raw[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				default:
+					b.WriteByte(raw[i])
+				}
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return "", errors.New("unterminated double quote")
+	}
+	if i := strings.Index(raw, " #"); i >= 0 {
+		raw = raw[:i]
+	}
+	return strings.TrimSpace(raw), nil
+}
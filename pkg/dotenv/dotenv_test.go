@@ -0,0 +1,72 @@
+package dotenv
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	in := `
+# comment
+A=1
+export B = two
+C="line\nbreak # kept"
+D='raw \n $HOME'
+E=value # trailing comment
+F=
+A=override
+`
+	got, err := Parse(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"A": "override",
+		"B": "two",
+		"C": "line\nbreak # kept",
+		"D": `raw \n $HOME`,
+		"E": "value",
+		"F": "",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %#v", got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("%s: got %q, want %q", k, got[k], v)
+		}
+	}
+
+	if _, err := Parse(strings.NewReader("NOEQUALS\n")); err == nil {
+		t.Fatal("expected error for line without '='")
+	}
+}
+
+func TestParse_QuotesAndEscapes(t *testing.T) {
+	in := `export TOKEN='a#b "c"'
+ESC="tab\there \"quoted\" back\\slash"
+TRAIL="x" # comment after quotes
+SPACED =  padded
+`
+	got, err := Parse(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"TOKEN":  `a#b "c"`,
+		"ESC":    "tab\there \"quoted\" back\\slash",
+		"TRAIL":  "x",
+		"SPACED": "padded",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("%s: got %q, want %q", k, got[k], v)
+		}
+	}
+
+	for _, bad := range []string{`A="open`, `A='open`, `BAD KEY=1`, `=1`} {
+		if _, err := Parse(strings.NewReader(bad + "\n")); err == nil {
+			t.Fatalf("%q: expected error", bad)
+		}
+	}
+}
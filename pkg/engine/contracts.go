@@ -0,0 +1,187 @@
+package engine
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/go-go-golems/devctl/pkg/patch"
+	"github.com/go-go-golems/devctl/pkg/ports"
+	"github.com/go-go-golems/devctl/pkg/protocol"
+	"github.com/go-go-golems/devctl/pkg/runtime"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// ConfigContract is what a plugin declares about its config.mutate behavior in
+// the handshake:
+//
+//	"declares": {"config": {"provides": ["env.API_PORT"], "requires": ["services.db.port"]}}
+//
+// Keys are dotted paths; a key covers everything below it, so providing "env"
+// satisfies a requirement on "env.API_PORT".
+type ConfigContract struct {
+	Provides []string `json:"provides,omitempty"`
+	Requires []string `json:"requires,omitempty"`
+}
+
+// ConfigContractOf decodes declares.config from a handshake. A handshake without
+// declarations yields an empty contract.
+func ConfigContractOf(hs protocol.Handshake) (ConfigContract, error) {
+	raw, ok := hs.Declares["config"]
+	if !ok || raw == nil {
+		return ConfigContract{}, nil
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return ConfigContract{}, errors.Wrap(err, "marshal declares.config")
+	}
+	var cc ConfigContract
+	if err := json.Unmarshal(b, &cc); err != nil {
+		return ConfigContract{}, errors.Wrap(err, "decode declares.config")
+	}
+	return cc, nil
+}
+
+// PortRequestsOf decodes declares.ports from a handshake, either a list of
+// names or a map of name to preferred port:
+//
+//	"declares": {"ports": ["api", "db"]}
+//	"declares": {"ports": {"api": 8080, "db": 0}}
+func PortRequestsOf(hs protocol.Handshake) (ports.Requests, error) {
+	raw, ok := hs.Declares["ports"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal declares.ports")
+	}
+	var reqs ports.Requests
+	if err := json.Unmarshal(b, &reqs); err == nil {
+		return reqs, nil
+	}
+	var names []string
+	if err := json.Unmarshal(b, &names); err != nil {
+		return nil, errors.New("decode declares.ports: expected a list of names or a map of name to port")
+	}
+	reqs = ports.Requests{}
+	for _, n := range names {
+		reqs[n] = 0
+	}
+	return reqs, nil
+}
+
+func overlapsAny(key string, keys []string) bool {
+	for _, k := range keys {
+		if patch.KeysOverlap(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// providerOf returns the id of a plugin (other than self) declaring key.
+func providerOf(key, self string, order []runtime.Client, contracts map[string]ConfigContract) string {
+	for _, c := range order {
+		id := c.Spec().ID
+		if id != self && overlapsAny(key, contracts[id].Provides) {
+			return id
+		}
+	}
+	return ""
+}
+
+// conflictingProviders reports the first key declared by two plugins.
+func conflictingProviders(order []runtime.Client, contracts map[string]ConfigContract) error {
+	for i, a := range order {
+		for _, b := range order[i+1:] {
+			for _, ka := range contracts[a.Spec().ID].Provides {
+				if overlapsAny(ka, contracts[b.Spec().ID].Provides) {
+					return errors.Errorf("config key %q is provided by both %q and %q", ka, a.Spec().ID, b.Spec().ID)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// orderByContracts sorts clients so that providers run before the plugins that
+// require their keys. The incoming (priority, id) order breaks ties. A cycle is
+// an error in strict mode; otherwise the remaining plugins keep priority order.
+func orderByContracts(order []runtime.Client, contracts map[string]ConfigContract, strict bool) ([]runtime.Client, error) {
+	n := len(order)
+	deps := make([]map[int]struct{}, n)
+	for i, c := range order {
+		deps[i] = map[int]struct{}{}
+		for _, key := range contracts[c.Spec().ID].Requires {
+			for j, d := range order {
+				if i != j && overlapsAny(key, contracts[d.Spec().ID].Provides) {
+					deps[i][j] = struct{}{}
+				}
+			}
+		}
+	}
+
+	out := make([]runtime.Client, 0, n)
+	done := make([]bool, n)
+	for len(out) < n {
+		next := -1
+		for i := 0; i < n && next < 0; i++ {
+			if done[i] {
+				continue
+			}
+			ready := true
+			for j := range deps[i] {
+				if !done[j] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				next = i
+			}
+		}
+		if next < 0 {
+			var ids []string
+			for i, c := range order {
+				if !done[i] {
+					ids = append(ids, c.Spec().ID)
+				}
+			}
+			if strict {
+				return nil, errors.Errorf("config dependency cycle between plugins %v", ids)
+			}
+			log.Warn().Strs("plugins", ids).Msg("config dependency cycle; falling back to priority order")
+			for i, c := range order {
+				if !done[i] {
+					out = append(out, c)
+				}
+			}
+			break
+		}
+		done[next] = true
+		out = append(out, order[next])
+	}
+	return out, nil
+}
+
+// checkWrites validates the writes one plugin made against the contracts and the
+// earlier history. Only "set" counts as a silent overwrite; replace, merge,
+// append, set_default and unset state their intent.
+func checkWrites(id string, earlier, writes []patch.Write, order []runtime.Client, contracts map[string]ConfigContract) error {
+	for _, w := range writes {
+		if owner := providerOf(w.Key, id, order, contracts); owner != "" && !overlapsAny(w.Key, contracts[id].Provides) {
+			return errors.Errorf("plugin %q wrote config key %q, which %q declares it provides", id, w.Key, owner)
+		}
+		if w.Action != patch.ActionSet || !w.Existed || reflect.DeepEqual(w.Previous, w.Value) {
+			continue
+		}
+		for i := len(earlier) - 1; i >= 0; i-- {
+			e := earlier[i]
+			if e.Source != "" && e.Source != id && e.Action != patch.ActionUnset && patch.KeysOverlap(e.Key, w.Key) {
+				return errors.Errorf("plugin %q overwrote config key %q set by %q (use replace to overwrite on purpose)", id, w.Key, e.Source)
+			}
+		}
+	}
+	return nil
+}
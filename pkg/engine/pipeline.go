@@ -2,43 +2,114 @@ package engine
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"sort"
+	"strings"
+	"time"
 
+	"github.com/go-go-golems/devctl/pkg/interpolate"
 	"github.com/go-go-golems/devctl/pkg/patch"
 	"github.com/go-go-golems/devctl/pkg/protocol"
 	"github.com/go-go-golems/devctl/pkg/runtime"
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
 )
 
 type Options struct {
 	Strict  bool
 	DryRun  bool
 	Timeout int64 // reserved
+	// RepoRoot backs ${repo_root} in launch plans.
+	RepoRoot string
+	// Instance backs ${instance}.
+	Instance string
 }
 
 type Pipeline struct {
 	Clients []runtime.Client
 	Opts    Options
+
+	// Provenance, when set, records which plugin wrote each config key during
+	// MutateConfig.
+	Provenance *patch.Provenance
 }
 
+// MutateConfig folds config.mutate patches from all plugins. Plugins that declare
+// a config contract (see ConfigContract) run after the providers of the keys they
+// require. In strict mode missing requirements, duplicate providers, writes to
+// keys another plugin provides and plain "set" overwrites of another plugin's
+// value are errors.
 func (p *Pipeline) MutateConfig(ctx context.Context, cfg patch.Config) (patch.Config, error) {
-	ordered := clientsInOrder(p.Clients)
+	var mutators []runtime.Client
+	for _, c := range clientsInOrder(p.Clients) {
+		if c.SupportsOp("config.mutate") {
+			mutators = append(mutators, c)
+		}
+	}
+
+	contracts := make(map[string]ConfigContract, len(mutators))
+	for _, c := range mutators {
+		cc, err := ConfigContractOf(c.Handshake())
+		if err != nil {
+			if p.Opts.Strict {
+				return nil, errors.Wrapf(err, "plugin %q", c.Spec().ID)
+			}
+			log.Warn().Err(err).Str("plugin", c.Spec().ID).Msg("ignoring config contract")
+		}
+		contracts[c.Spec().ID] = cc
+	}
+	if err := conflictingProviders(mutators, contracts); err != nil {
+		if p.Opts.Strict {
+			return nil, err
+		}
+		log.Warn().Err(err).Msg("config contract conflict")
+	}
+	ordered, err := orderByContracts(mutators, contracts, p.Opts.Strict)
+	if err != nil {
+		return nil, err
+	}
+
+	// Strict checks need the write history even when the caller did not ask for it.
+	prov := p.Provenance
+	if prov == nil {
+		prov = &patch.Provenance{}
+	}
 
 	current := cfg
 	for _, c := range ordered {
-		if !c.SupportsOp("config.mutate") {
-			continue
+		id := c.Spec().ID
+		for _, key := range contracts[id].Requires {
+			if _, ok := patch.Lookup(current, key); ok {
+				continue
+			}
+			var err error
+			if provider := providerOf(key, id, ordered, contracts); provider != "" {
+				err = errors.Errorf("plugin %q requires config key %q, but provider %q did not set it", id, key, provider)
+			} else {
+				err = errors.Errorf("plugin %q requires config key %q, which no plugin provides", id, key)
+			}
+			if p.Opts.Strict {
+				return nil, err
+			}
+			log.Warn().Err(err).Msg("missing config requirement")
 		}
+
 		var out struct {
 			ConfigPatch patch.ConfigPatch `json:"config_patch"`
 		}
 		if err := c.Call(ctx, "config.mutate", map[string]any{"config": current}, &out); err != nil {
 			return nil, err
 		}
-		var err error
-		current, err = patch.Apply(current, out.ConfigPatch)
+		before := len(prov.Writes)
+		current, err = patch.ApplyTracked(current, out.ConfigPatch, id, "config.mutate", prov)
 		if err != nil {
-			return nil, err
+			return nil, errors.Wrapf(err, "plugin %q config patch", id)
+		}
+		if p.Opts.Strict {
+			if err := checkWrites(id, prov.Writes[:before], prov.Writes[before:], ordered, contracts); err != nil {
+				return nil, err
+			}
 		}
 	}
 	return current, nil
@@ -75,7 +146,86 @@ func (p *Pipeline) LaunchPlan(ctx context.Context, cfg patch.Config) (LaunchPlan
 	if merged.Services == nil {
 		merged.Services = []ServiceSpec{}
 	}
-	return merged, nil
+	return p.interpolatePlan(merged, cfg)
+}
+
+// interpolatePlan expands ${...} references in Command, Cwd, Env and Health.
+func (p *Pipeline) interpolatePlan(plan LaunchPlan, cfg patch.Config) (LaunchPlan, error) {
+	services := make(map[string]any, len(plan.Services))
+	for _, svc := range plan.Services {
+		b, err := json.Marshal(svc)
+		if err != nil {
+			return LaunchPlan{}, errors.Wrap(err, "marshal service")
+		}
+		var m map[string]any
+		if err := json.Unmarshal(b, &m); err != nil {
+			return LaunchPlan{}, errors.Wrap(err, "unmarshal service")
+		}
+		services[svc.Name] = m
+	}
+	vars := interpolate.Vars{RepoRoot: p.Opts.RepoRoot, Instance: p.Opts.Instance, Config: cfg, Services: services}
+
+	out := LaunchPlan{Services: make([]ServiceSpec, 0, len(plan.Services))}
+	for _, svc := range plan.Services {
+		var err error
+		wrap := func(field string, e error) error {
+			return errors.Wrapf(e, "service %q %s", svc.Name, field)
+		}
+		if svc.Cwd, err = interpolate.String(svc.Cwd, vars); err != nil {
+			return LaunchPlan{}, wrap("cwd", err)
+		}
+		if svc.Command, err = interpolate.Strings(svc.Command, vars); err != nil {
+			return LaunchPlan{}, wrap("command", err)
+		}
+		if svc.Env, err = interpolate.Map(svc.Env, vars); err != nil {
+			return LaunchPlan{}, wrap("env", err)
+		}
+		if svc.EnvFile, err = interpolate.Strings(svc.EnvFile, vars); err != nil {
+			return LaunchPlan{}, wrap("env_file", err)
+		}
+		if svc.Health != nil {
+			h := *svc.Health
+			if h.Address, err = interpolate.String(h.Address, vars); err != nil {
+				return LaunchPlan{}, wrap("health.address", err)
+			}
+			if h.URL, err = interpolate.String(h.URL, vars); err != nil {
+				return LaunchPlan{}, wrap("health.url", err)
+			}
+			svc.Health = &h
+		}
+		for _, h := range []struct {
+			field string
+			hook  **Hook
+		}{{"pre_start", &svc.PreStart}, {"post_start", &svc.PostStart}, {"post_stop", &svc.PostStop}} {
+			if *h.hook == nil {
+				continue
+			}
+			hk := **h.hook
+			if hk.Command, err = interpolate.Strings(hk.Command, vars); err != nil {
+				return LaunchPlan{}, wrap(h.field, err)
+			}
+			*h.hook = &hk
+		}
+		if svc.PreStop != nil {
+			ps := *svc.PreStop
+			if ps.Command, err = interpolate.Strings(ps.Command, vars); err != nil {
+				return LaunchPlan{}, wrap("pre_stop.command", err)
+			}
+			if ps.URL, err = interpolate.String(ps.URL, vars); err != nil {
+				return LaunchPlan{}, wrap("pre_stop.url", err)
+			}
+			svc.PreStop = &ps
+		}
+		if svc.Limits != nil {
+			l := *svc.Limits
+			if l.Memory, err = interpolate.String(l.Memory, vars); err != nil {
+				return LaunchPlan{}, wrap("limits.memory", err)
+			}
+			svc.Limits = &l
+		}
+		out.Services = append(out.Services, svc)
+	}
+	return out, nil
 }
 
 func (p *Pipeline) Validate(ctx context.Context, cfg patch.Config) (ValidateResult, error) {
@@ -131,7 +281,7 @@ func (p *Pipeline) Build(ctx context.Context, cfg patch.Config, steps []string)
 			merged.Steps = append(merged.Steps, sr)
 		}
 	}
-	return merged, nil
+	return merged, failedSteps("build", merged.Steps)
 }
 
 func (p *Pipeline) Prepare(ctx context.Context, cfg patch.Config, steps []string) (PrepareResult, error) {
@@ -166,6 +316,171 @@ func (p *Pipeline) Prepare(ctx context.Context, cfg patch.Config, steps []string
 			merged.Steps = append(merged.Steps, sr)
 		}
 	}
+	return merged, failedSteps("prepare", merged.Steps)
+}
+
+// failedSteps returns an error naming the steps that did not succeed, with
+// their output; the caller still gets the full result.
+func failedSteps(phase string, steps []StepResult) error {
+	var msgs []string
+	for _, sr := range steps {
+		if sr.Ok {
+			continue
+		}
+		msg := fmt.Sprintf("%s step %q failed", phase, sr.Name)
+		if sr.Output != "" {
+			msg += ":\n" + sr.Output
+		}
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(msgs, "\n"))
+}
+
+// Supports reports whether any client declares op.
+func (p *Pipeline) Supports(op string) bool {
+	for _, c := range p.Clients {
+		if c.SupportsOp(op) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Pipeline) StatusDescribe(ctx context.Context, cfg patch.Config, services []string) (StatusDescribeResult, error) {
+	ordered := clientsInOrder(p.Clients)
+
+	merged := StatusDescribeResult{Environment: map[string]any{}, Services: map[string]map[string]any{}}
+	for _, c := range ordered {
+		if !c.SupportsOp("status.describe") {
+			continue
+		}
+		var out StatusDescribeResult
+		if err := c.Call(ctx, "status.describe", map[string]any{"config": cfg, "services": services}, &out); err != nil {
+			return StatusDescribeResult{}, err
+		}
+		for k, v := range out.Environment {
+			if _, ok := merged.Environment[k]; ok && p.Opts.Strict {
+				return StatusDescribeResult{}, errors.Errorf("status fact collision: %s", k)
+			}
+			merged.Environment[k] = v
+		}
+		for svc, facts := range out.Services {
+			if merged.Services[svc] == nil {
+				merged.Services[svc] = map[string]any{}
+			}
+			for k, v := range facts {
+				if _, ok := merged.Services[svc][k]; ok && p.Opts.Strict {
+					return StatusDescribeResult{}, errors.Errorf("status fact collision: %s.%s", svc, k)
+				}
+				merged.Services[svc][k] = v
+			}
+		}
+	}
+	return merged, nil
+}
+
+// HealthCheck asks plugins to evaluate custom readiness. A service is ready only
+// if every plugin that reports on it says so.
+func (p *Pipeline) HealthCheck(ctx context.Context, cfg patch.Config, services []string) (HealthCheckResult, error) {
+	ordered := clientsInOrder(p.Clients)
+
+	var merged HealthCheckResult
+	index := map[string]int{}
+	for _, c := range ordered {
+		if !c.SupportsOp("health.check") {
+			continue
+		}
+		var out HealthCheckResult
+		if err := c.Call(ctx, "health.check", map[string]any{"config": cfg, "services": services}, &out); err != nil {
+			return HealthCheckResult{}, err
+		}
+		for _, sh := range out.Services {
+			if sh.Name == "" {
+				return HealthCheckResult{}, errors.New("health.check returned service with empty name")
+			}
+			idx, ok := index[sh.Name]
+			if !ok {
+				index[sh.Name] = len(merged.Services)
+				merged.Services = append(merged.Services, sh)
+				continue
+			}
+			prev := &merged.Services[idx]
+			prev.Ready = prev.Ready && sh.Ready
+			if sh.Message != "" {
+				if prev.Message != "" {
+					prev.Message += "; "
+				}
+				prev.Message += sh.Message
+			}
+		}
+	}
+	return merged, nil
+}
+
+// WaitHealthy polls HealthCheck until no service is reported unready or ctx ends.
+// It returns immediately when no plugin implements health.check.
+func (p *Pipeline) WaitHealthy(ctx context.Context, cfg patch.Config, services []string, interval time.Duration) (HealthCheckResult, error) {
+	if !p.Supports("health.check") {
+		return HealthCheckResult{}, nil
+	}
+	if interval <= 0 {
+		interval = 500 * time.Millisecond
+	}
+	for {
+		hr, err := p.HealthCheck(ctx, cfg, services)
+		if err != nil {
+			return hr, err
+		}
+		unready := hr.Unready()
+		if len(unready) == 0 {
+			return hr, nil
+		}
+		select {
+		case <-ctx.Done():
+			names := make([]string, 0, len(unready))
+			for _, s := range unready {
+				names = append(names, s.Name)
+			}
+			return hr, errors.Wrapf(ctx.Err(), "plugin health check: not ready: %v", names)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Teardown runs teardown.run in reverse plugin order so that plugins which set
+// things up first clean up last.
+func (p *Pipeline) Teardown(ctx context.Context, cfg patch.Config, services []string) (TeardownResult, error) {
+	ordered := clientsInOrder(p.Clients)
+
+	var merged TeardownResult
+	stepIndex := map[string]int{}
+	for i := len(ordered) - 1; i >= 0; i-- {
+		c := ordered[i]
+		if !c.SupportsOp("teardown.run") {
+			continue
+		}
+		var out TeardownResult
+		if err := c.Call(ctx, "teardown.run", map[string]any{"config": cfg, "services": services}, &out); err != nil {
+			return TeardownResult{}, err
+		}
+		for _, sr := range out.Steps {
+			if sr.Name == "" {
+				return TeardownResult{}, errors.New("teardown.run returned step with empty name")
+			}
+			if idx, ok := stepIndex[sr.Name]; ok {
+				if p.Opts.Strict {
+					return TeardownResult{}, errors.Errorf("teardown step collision: %s", sr.Name)
+				}
+				merged.Steps[idx] = sr
+				continue
+			}
+			stepIndex[sr.Name] = len(merged.Steps)
+			merged.Steps = append(merged.Steps, sr)
+		}
+	}
 	return merged, nil
 }
 
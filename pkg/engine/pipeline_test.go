@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/go-go-golems/devctl/pkg/patch"
+	"github.com/go-go-golems/devctl/pkg/ports"
 	"github.com/go-go-golems/devctl/pkg/protocol"
 	"github.com/go-go-golems/devctl/pkg/runtime"
 	"github.com/pkg/errors"
@@ -14,13 +15,14 @@ import (
 
 type fakeClient struct {
 	spec runtime.PluginSpec
+	hs   protocol.Handshake
 	ops  map[string]func(input any) (any, error)
 }
 
 var _ runtime.Client = (*fakeClient)(nil)
 
 func (f *fakeClient) Spec() runtime.PluginSpec        { return f.spec }
-func (f *fakeClient) Handshake() protocol.Handshake   { return protocol.Handshake{} }
+func (f *fakeClient) Handshake() protocol.Handshake   { return f.hs }
 func (f *fakeClient) SupportsOp(op string) bool       { _, ok := f.ops[op]; return ok }
 func (f *fakeClient) Close(ctx context.Context) error { return nil }
 func (f *fakeClient) StartStream(ctx context.Context, op string, input any) (string, <-chan protocol.Event, error) {
@@ -186,3 +188,205 @@ func TestPipeline_Build_StepCollisionStrict(t *testing.T) {
 	_, err := p.Build(context.Background(), patch.Config{}, []string{"backend"})
 	require.Error(t, err)
 }
+
+func TestPipeline_Build_FailedStepKeepsResults(t *testing.T) {
+	p := &Pipeline{
+		Clients: []runtime.Client{
+			&fakeClient{
+				spec: runtime.PluginSpec{ID: "b"},
+				ops: map[string]func(input any) (any, error){
+					"build.run": func(input any) (any, error) {
+						return BuildResult{Steps: []StepResult{{Name: "gen", Ok: true}, {Name: "backend", Output: "make: *** [all] Error 2"}}}, nil
+					},
+				},
+			},
+		},
+	}
+	br, err := p.Build(context.Background(), patch.Config{}, nil)
+	require.ErrorContains(t, err, "build step \"backend\" failed:\nmake: *** [all] Error 2")
+	require.Len(t, br.Steps, 2)
+	require.False(t, br.Steps[1].Ok)
+}
+
+func TestPipeline_HealthCheck_AllPluginsMustAgree(t *testing.T) {
+	p := &Pipeline{
+		Clients: []runtime.Client{
+			&fakeClient{
+				spec: runtime.PluginSpec{ID: "h1", Priority: 1},
+				ops: map[string]func(input any) (any, error){
+					"health.check": func(input any) (any, error) {
+						return HealthCheckResult{Services: []ServiceHealth{{Name: "api", Ready: true}}}, nil
+					},
+				},
+			},
+			&fakeClient{
+				spec: runtime.PluginSpec{ID: "h2", Priority: 2},
+				ops: map[string]func(input any) (any, error){
+					"health.check": func(input any) (any, error) {
+						return HealthCheckResult{Services: []ServiceHealth{{Name: "api", Ready: false, Message: "migrations pending"}}}, nil
+					},
+				},
+			},
+		},
+	}
+	out, err := p.HealthCheck(context.Background(), patch.Config{}, []string{"api"})
+	require.NoError(t, err)
+	require.Len(t, out.Services, 1)
+	require.False(t, out.Services[0].Ready)
+	require.Equal(t, "migrations pending", out.Services[0].Message)
+	require.Len(t, out.Unready(), 1)
+}
+
+func TestPipeline_Teardown_RunsInReverseOrder(t *testing.T) {
+	var calls []string
+	teardown := func(id string) func(input any) (any, error) {
+		return func(input any) (any, error) {
+			calls = append(calls, id)
+			return TeardownResult{Steps: []StepResult{{Name: id, Ok: true}}}, nil
+		}
+	}
+	p := &Pipeline{
+		Clients: []runtime.Client{
+			&fakeClient{spec: runtime.PluginSpec{ID: "db", Priority: 1}, ops: map[string]func(input any) (any, error){"teardown.run": teardown("db")}},
+			&fakeClient{spec: runtime.PluginSpec{ID: "app", Priority: 5}, ops: map[string]func(input any) (any, error){"teardown.run": teardown("app")}},
+		},
+	}
+	out, err := p.Teardown(context.Background(), patch.Config{}, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"app", "db"}, calls)
+	require.Len(t, out.Steps, 2)
+}
+
+func TestPipeline_MutateConfig_OrdersByDeclaredContracts(t *testing.T) {
+	var calls []string
+	declares := func(provides, requires []string) protocol.Handshake {
+		return protocol.Handshake{Declares: map[string]any{
+			"config": map[string]any{"provides": provides, "requires": requires},
+		}}
+	}
+	p := &Pipeline{
+		Opts: Options{Strict: true},
+		Clients: []runtime.Client{
+			&fakeClient{
+				spec: runtime.PluginSpec{ID: "app", Priority: 1},
+				hs:   declares([]string{"env.DATABASE_URL"}, []string{"services.db.port"}),
+				ops: map[string]func(input any) (any, error){
+					"config.mutate": func(input any) (any, error) {
+						calls = append(calls, "app")
+						return map[string]any{
+							"config_patch": patch.ConfigPatch{Set: map[string]any{"env.DATABASE_URL": "postgres://localhost:5432"}},
+						}, nil
+					},
+				},
+			},
+			&fakeClient{
+				spec: runtime.PluginSpec{ID: "db", Priority: 10},
+				hs:   declares([]string{"services.db"}, nil),
+				ops: map[string]func(input any) (any, error){
+					"config.mutate": func(input any) (any, error) {
+						calls = append(calls, "db")
+						return map[string]any{
+							"config_patch": patch.ConfigPatch{Set: map[string]any{"services.db.port": 5432}},
+						}, nil
+					},
+				},
+			},
+		},
+	}
+
+	_, err := p.MutateConfig(context.Background(), patch.Config{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"db", "app"}, calls)
+
+	// Without a provider for the required key, strict mode refuses to call app.
+	p.Clients = p.Clients[:1]
+	_, err = p.MutateConfig(context.Background(), patch.Config{})
+	require.ErrorContains(t, err, "no plugin provides")
+}
+
+func TestPipeline_MutateConfig_StrictRejectsSilentOverwrite(t *testing.T) {
+	setter := func(id string, p patch.ConfigPatch) *fakeClient {
+		return &fakeClient{
+			spec: runtime.PluginSpec{ID: id, Priority: len(id)},
+			ops: map[string]func(input any) (any, error){
+				"config.mutate": func(input any) (any, error) {
+					return map[string]any{"config_patch": p}, nil
+				},
+			},
+		}
+	}
+	p := &Pipeline{
+		Opts: Options{Strict: true},
+		Clients: []runtime.Client{
+			setter("a", patch.ConfigPatch{Set: map[string]any{"services.api.port": 8080}}),
+			setter("bb", patch.ConfigPatch{Set: map[string]any{"services.api.port": 8081}}),
+		},
+	}
+	_, err := p.MutateConfig(context.Background(), patch.Config{})
+	require.ErrorContains(t, err, "overwrote")
+
+	// replace states the intent and is allowed.
+	p.Clients[1] = setter("bb", patch.ConfigPatch{Replace: map[string]any{"services.api.port": 8081}})
+	cfg, err := p.MutateConfig(context.Background(), patch.Config{})
+	require.NoError(t, err)
+	v, _ := patch.Lookup(cfg, "services.api.port")
+	require.EqualValues(t, 8081, v)
+}
+
+func TestPipeline_LaunchPlan_InterpolatesReferences(t *testing.T) {
+	t.Setenv("DEVCTL_TEST_USER", "alice")
+	plan := LaunchPlan{Services: []ServiceSpec{
+		{
+			Name:    "db",
+			Command: []string{"postgres", "-p", "${config.services.db.port}", "-c", "cluster_name=db-${instance}"},
+			Health:  &HealthCheck{Type: "tcp", Address: "127.0.0.1:${config.services.db.port}"},
+		},
+		{
+			Name:    "api",
+			Cwd:     "${repo_root}/api",
+			Command: []string{"serve", "--db", "${service.db.health.address}", "$${literal}"},
+			Env:     map[string]string{"USER_NAME": "${env.DEVCTL_TEST_USER}", "MODE": "${env.DEVCTL_TEST_UNSET:-dev}"},
+		},
+	}}
+	p := &Pipeline{
+		Opts: Options{RepoRoot: "/repo", Instance: "pr-1"},
+		Clients: []runtime.Client{
+			&fakeClient{
+				spec: runtime.PluginSpec{ID: "p"},
+				ops: map[string]func(input any) (any, error){
+					"launch.plan": func(input any) (any, error) { return plan, nil },
+				},
+			},
+		},
+	}
+	cfg := patch.Config{"services": map[string]any{"db": map[string]any{"port": 5433}}}
+
+	out, err := p.LaunchPlan(context.Background(), cfg)
+	require.NoError(t, err)
+	require.Equal(t, []string{"postgres", "-p", "5433", "-c", "cluster_name=db-pr-1"}, out.Services[0].Command)
+	require.Equal(t, "/repo/api", out.Services[1].Cwd)
+	require.Equal(t, []string{"serve", "--db", "127.0.0.1:5433", "${literal}"}, out.Services[1].Command)
+	require.Equal(t, map[string]string{"USER_NAME": "alice", "MODE": "dev"}, out.Services[1].Env)
+
+	plan.Services[1].Command = []string{"sh", "-c", `exec serve --port ${PORT:-8080} --home "${HOME}"`}
+	out, err = p.LaunchPlan(context.Background(), cfg)
+	require.NoError(t, err)
+	require.Equal(t, plan.Services[1].Command, out.Services[1].Command)
+
+	plan.Services[1].Command = []string{"${config.missing.key}"}
+	_, err = p.LaunchPlan(context.Background(), cfg)
+	require.ErrorContains(t, err, `service "api" command: unresolved reference ${config.missing.key}`)
+}
+
+func TestPortRequestsOf(t *testing.T) {
+	reqs, err := PortRequestsOf(protocol.Handshake{Declares: map[string]any{"ports": []any{"api", "db"}}})
+	require.NoError(t, err)
+	require.Equal(t, ports.Requests{"api": 0, "db": 0}, reqs)
+
+	reqs, err = PortRequestsOf(protocol.Handshake{Declares: map[string]any{"ports": map[string]any{"api": 8080}}})
+	require.NoError(t, err)
+	require.Equal(t, ports.Requests{"api": 8080}, reqs)
+
+	_, err = PortRequestsOf(protocol.Handshake{Declares: map[string]any{"ports": "api"}})
+	require.Error(t, err)
+}
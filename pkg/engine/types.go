@@ -3,11 +3,99 @@ package engine
 import "github.com/go-go-golems/devctl/pkg/protocol"
 
 type ServiceSpec struct {
-	Name    string            `json:"name"`
-	Cwd     string            `json:"cwd,omitempty"`
-	Command []string          `json:"command"`
-	Env     map[string]string `json:"env,omitempty"`
-	Health  *HealthCheck      `json:"health,omitempty"`
+	Name string `json:"name"`
+	// Kind is KindService (default, long-running) or KindJob (runs to
+	// completion; a non-zero exit fails up).
+	Kind string `json:"kind,omitempty"`
+	// DependsOn names services that must be ready, or jobs that must have
+	// succeeded, before this one starts.
+	DependsOn []string          `json:"depends_on,omitempty"`
+	Cwd       string            `json:"cwd,omitempty"`
+	Command   []string          `json:"command"`
+	Env       map[string]string `json:"env,omitempty"`
+	// EnvFile lists dotenv files (relative to the repo root), later files win;
+	// Env wins over all of them. Missing files are skipped.
+	EnvFile []string `json:"env_file,omitempty"`
+	// Secrets maps env var names to secret references ("pass:dev/db"),
+	// resolved at launch and never written to state.
+	Secrets map[string]string `json:"secrets,omitempty"`
+	// EnvPolicy overrides the repo-wide policy for what the service inherits
+	// from devctl's own environment.
+	EnvPolicy *EnvPolicy   `json:"env_policy,omitempty"`
+	Health    *HealthCheck `json:"health,omitempty"`
+	// Limits bounds the service's resources; applied by the service wrapper.
+	Limits *Limits `json:"limits,omitempty"`
+	// StopSignal is sent to stop the service (default SIGTERM); after
+	// StopTimeoutMs (default: the supervisor's shutdown timeout) it is killed.
+	StopSignal    string `json:"stop_signal,omitempty"`
+	StopTimeoutMs int64  `json:"stop_timeout_ms,omitempty"`
+	// PreStop runs before the stop signal is sent.
+	PreStop *PreStop `json:"pre_stop,omitempty"`
+	// PreStart runs before the process starts, PostStart once it is ready (a
+	// job: has succeeded), PostStop after it has been stopped. A failing
+	// pre_start or post_start fails the start.
+	PreStart  *Hook `json:"pre_start,omitempty"`
+	PostStart *Hook `json:"post_start,omitempty"`
+	PostStop  *Hook `json:"post_stop,omitempty"`
+	// Logs configures how devctl reads the service's logs.
+	Logs *ServiceLogs `json:"logs,omitempty"`
+}
+
+// ServiceLogs configures how the service's logs are shown.
+type ServiceLogs struct {
+	// Parsers are logjs modules (relative to the repo root) that turn lines
+	// into events with a level, message and fields.
+	Parsers []string `json:"parsers,omitempty"`
+}
+
+// Hook is a lifecycle command run in the service's cwd and environment, with
+// its output appended to the service's logs.
+type Hook struct {
+	Command   []string `json:"command"`
+	TimeoutMs int64    `json:"timeout_ms,omitempty"` // default 60s
+}
+
+// Service kinds.
+const (
+	KindService = "service"
+	KindJob     = "job"
+)
+
+func (s ServiceSpec) IsJob() bool { return s.Kind == KindJob }
+
+// Env inheritance modes.
+const (
+	EnvInheritAll       = "all"       // the whole environment (default)
+	EnvInheritAllowlist = "allowlist" // base variables plus Allow
+	EnvInheritClean     = "clean"     // base variables only (PATH, HOME, ...)
+)
+
+// EnvPolicy controls which of devctl's environment a service inherits.
+type EnvPolicy struct {
+	Inherit string `json:"inherit,omitempty"`
+	// Allow lists variable names for "allowlist"; a trailing * matches a prefix.
+	Allow []string `json:"allow,omitempty"`
+}
+
+// Limits are per-service resource limits. Zero values mean unlimited.
+type Limits struct {
+	// Memory is a size such as "512MiB" or "2G".
+	Memory string `json:"memory,omitempty"`
+	// CPU is a quota in cores, e.g. 1.5.
+	CPU       float64 `json:"cpu,omitempty"`
+	OpenFiles uint64  `json:"open_files,omitempty"`
+	// Nice is the scheduling priority, -20 (highest) to 19.
+	Nice int `json:"nice,omitempty"`
+}
+
+// PreStop is a command or an HTTP request that prepares a service for
+// shutdown, e.g. tells a queue consumer to drain. Set Command or URL.
+type PreStop struct {
+	Command []string `json:"command,omitempty"` // runs in the service's cwd
+	URL     string   `json:"url,omitempty"`
+	Method  string   `json:"method,omitempty"` // default GET
+	// TimeoutMs bounds the hook (default 10s); the stop signal follows either way.
+	TimeoutMs int64 `json:"timeout_ms,omitempty"`
 }
 
 type HealthCheck struct {
@@ -31,6 +119,7 @@ type StepResult struct {
 	Name       string `json:"name"`
 	Ok         bool   `json:"ok"`
 	DurationMs int64  `json:"duration_ms,omitempty"`
+	Output     string `json:"output,omitempty"` // tail of a failed step's output
 }
 
 type BuildResult struct {
@@ -42,3 +131,35 @@ type PrepareResult struct {
 	Steps     []StepResult      `json:"steps,omitempty"`
 	Artifacts map[string]string `json:"artifacts,omitempty"`
 }
+
+// StatusDescribeResult carries plugin-provided facts (migration version, seeded
+// tenant, ...) for the environment as a whole and for individual services.
+type StatusDescribeResult struct {
+	Environment map[string]any            `json:"environment,omitempty"`
+	Services    map[string]map[string]any `json:"services,omitempty"`
+}
+
+type ServiceHealth struct {
+	Name    string `json:"name"`
+	Ready   bool   `json:"ready"`
+	Message string `json:"message,omitempty"`
+}
+
+type HealthCheckResult struct {
+	Services []ServiceHealth `json:"services,omitempty"`
+}
+
+// Unready returns the services that at least one plugin reported as not ready.
+func (r HealthCheckResult) Unready() []ServiceHealth {
+	var out []ServiceHealth
+	for _, s := range r.Services {
+		if !s.Ready {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+type TeardownResult struct {
+	Steps []StepResult `json:"steps,omitempty"`
+}
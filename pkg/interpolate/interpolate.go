@@ -0,0 +1,238 @@
+// Package interpolate expands ${...} references in service specs and plugin
+// settings.
+//
+// Supported references:
+//
+//	${repo_root}                 absolute repo root
+//	${instance}                  instance name ("default" for the main one)
+//	${env.NAME}                  environment variable of the devctl process
+//	${config.dotted.key}         key in the merged config (after config.mutate)
+//	${service.NAME.dotted.key}   field of another service in the launch plan
+//
+// ${ref:-fallback} uses fallback when ref is not set, and the fallback may hold
+// references itself; $${ is a literal "${".
+// Any other ${...}, such as a shell's ${HOME} or ${PORT:-8080}, is left as is.
+package interpolate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-go-golems/devctl/pkg/patch"
+	"github.com/go-go-golems/devctl/pkg/state"
+	"github.com/pkg/errors"
+)
+
+// maxDepth bounds service-to-service references, which are expanded
+// recursively.
+const maxDepth = 8
+
+// errNotSet marks a well-formed reference whose value does not exist; only
+// those fall back to the ":-" default.
+var errNotSet = errors.New("not set")
+
+// Vars is what references resolve against. Nil Config or Services make the
+// corresponding references fail with a clear error.
+type Vars struct {
+	RepoRoot string
+	Instance string
+	Config   patch.Config
+	// Services maps a service name to its JSON-shaped spec.
+	Services map[string]any
+	// LookupEnv defaults to os.LookupEnv.
+	LookupEnv func(string) (string, bool)
+
+	depth int
+}
+
+// String expands every reference in s.
+func String(s string, v Vars) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i-1])
+			b.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+		end := closingBrace(s[i:])
+		if end < 0 {
+			return "", errors.Errorf("unterminated reference in %q", s)
+		}
+		b.WriteString(s[:i])
+		ref := s[i+2 : i+end]
+		if !isOwnRef(ref) {
+			b.WriteString(s[i : i+end+1])
+			s = s[i+end+1:]
+			continue
+		}
+		val, err := v.resolve(ref)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(val)
+		s = s[i+end+1:]
+	}
+}
+
+// closingBrace returns the index of the "}" closing the reference s starts
+// with, skipping references nested in its fallback, or -1.
+func closingBrace(s string) int {
+	depth := 0
+	for j := 0; j < len(s); j++ {
+		switch {
+		case s[j] == '$' && j+1 < len(s) && s[j+1] == '{':
+			depth++
+			j++
+		case s[j] == '}':
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// Strings expands each element of in, returning a new slice.
+func Strings(in []string, v Vars) ([]string, error) {
+	if in == nil {
+		return nil, nil
+	}
+	out := make([]string, len(in))
+	for i, s := range in {
+		r, err := String(s, v)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = r
+	}
+	return out, nil
+}
+
+// Map expands each value of in, returning a new map.
+func Map(in map[string]string, v Vars) (map[string]string, error) {
+	if in == nil {
+		return nil, nil
+	}
+	out := make(map[string]string, len(in))
+	for k, s := range in {
+		r, err := String(s, v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s", k)
+		}
+		out[k] = r
+	}
+	return out, nil
+}
+
+// isOwnRef reports whether ref names one of the namespaces above.
+func isOwnRef(ref string) bool {
+	name, _, _ := strings.Cut(ref, ":-")
+	name = strings.TrimSpace(name)
+	if name == "repo_root" || name == "instance" {
+		return true
+	}
+	for _, ns := range []string{"env.", "config.", "service."} {
+		if strings.HasPrefix(name, ns) {
+			return true
+		}
+	}
+	return false
+}
+
+func (v Vars) resolve(ref string) (string, error) {
+	name, fallback, hasFallback := strings.Cut(ref, ":-")
+	val, err := v.lookup(strings.TrimSpace(name))
+	if err != nil {
+		if hasFallback && errors.Is(err, errNotSet) {
+			return String(fallback, v)
+		}
+		return "", errors.Wrapf(err, "unresolved reference ${%s}", name)
+	}
+	return val, nil
+}
+
+func (v Vars) lookup(name string) (string, error) {
+	switch {
+	case name == "repo_root":
+		if v.RepoRoot == "" {
+			return "", errors.New("repo root is not known here")
+		}
+		return v.RepoRoot, nil
+	case name == "instance":
+		return state.InstanceName(v.Instance), nil
+	case strings.HasPrefix(name, "env."):
+		lookup := v.LookupEnv
+		if lookup == nil {
+			lookup = os.LookupEnv
+		}
+		if val, ok := lookup(strings.TrimPrefix(name, "env.")); ok {
+			return val, nil
+		}
+		return "", errNotSet
+	case strings.HasPrefix(name, "config."):
+		if v.Config == nil {
+			return "", errors.New("config is not available here")
+		}
+		val, ok := patch.Lookup(v.Config, strings.TrimPrefix(name, "config."))
+		if !ok {
+			return "", errNotSet
+		}
+		return format(val), nil
+	case strings.HasPrefix(name, "service."):
+		if v.Services == nil {
+			return "", errors.New("services are not available here")
+		}
+		svcName, path, ok := strings.Cut(strings.TrimPrefix(name, "service."), ".")
+		if !ok {
+			return "", errors.New("expected service.NAME.field")
+		}
+		svc, ok := v.Services[svcName]
+		if !ok {
+			return "", errors.Errorf("unknown service %q", svcName)
+		}
+		m, _ := svc.(map[string]any)
+		val, ok := patch.Lookup(m, path)
+		if !ok {
+			return "", errNotSet
+		}
+		if v.depth >= maxDepth {
+			return "", errors.New("reference cycle between services")
+		}
+		next := v
+		next.depth++
+		return String(format(val), next)
+	default:
+		return "", errors.New("unknown reference (expected repo_root, instance, env.*, config.* or service.*)")
+	}
+}
+
+func format(val any) string {
+	switch x := val.(type) {
+	case string:
+		return x
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case int, int64, bool, json.Number:
+		return fmt.Sprintf("%v", x)
+	}
+	b, err := json.Marshal(val)
+	if err != nil {
+		return fmt.Sprintf("%v", val)
+	}
+	return string(b)
+}
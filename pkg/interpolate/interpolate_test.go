@@ -0,0 +1,59 @@
+package interpolate
+
+import (
+	"testing"
+
+	"github.com/go-go-golems/devctl/pkg/patch"
+)
+
+func TestString_LeavesShellReferences(t *testing.T) {
+	v := Vars{RepoRoot: "/repo", Config: patch.Config{"port": 5433}}
+	cases := map[string]string{
+		`echo ${HOME}`:                          `echo ${HOME}`,
+		`serve --port ${PORT:-8080}`:            `serve --port ${PORT:-8080}`,
+		`cd ${repo_root} && run ${ARGS}`:        `cd /repo && run ${ARGS}`,
+		`db=${config.port} fallback=${X:-${Y}}`: `db=5433 fallback=${X:-${Y}}`,
+		`$${config.port}`:                       `${config.port}`,
+	}
+	for in, want := range cases {
+		got, err := String(in, v)
+		if err != nil {
+			t.Fatalf("%q: %v", in, err)
+		}
+		if got != want {
+			t.Fatalf("%q: got %q, want %q", in, got, want)
+		}
+	}
+
+	if _, err := String(`${config.missing}`, v); err == nil {
+		t.Fatal("expected unresolved config reference to fail")
+	}
+}
+
+func TestString_NestedFallback(t *testing.T) {
+	env := map[string]string{"B": "b"}
+	v := Vars{
+		Config:    patch.Config{"x": "cfg"},
+		LookupEnv: func(k string) (string, bool) { s, ok := env[k]; return s, ok },
+	}
+	cases := map[string]string{
+		`${config.x:-${env.B}}`:                      `cfg`,
+		`${config.y:-${env.B}}`:                      `b`,
+		`${config.y:-${env.C:-${env.B}}}-tail`:       `b-tail`,
+		`${config.y:-pre-${env.B}-post} ${HOME}`:     `pre-b-post ${HOME}`,
+		`${config.y:-${env.C:-none}} ${X:-${env.B}}`: `none ${X:-${env.B}}`,
+	}
+	for in, want := range cases {
+		got, err := String(in, v)
+		if err != nil {
+			t.Fatalf("%q: %v", in, err)
+		}
+		if got != want {
+			t.Fatalf("%q: got %q, want %q", in, got, want)
+		}
+	}
+
+	if _, err := String(`${config.y:-${env.B}`, v); err == nil {
+		t.Fatal("expected unterminated nested reference to fail")
+	}
+}
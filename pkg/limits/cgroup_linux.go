@@ -0,0 +1,180 @@
+package limits
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// Variables so tests can point them at a fake hierarchy.
+var (
+	cgroupRoot     = "/sys/fs/cgroup"
+	selfCgroupPath = "/proc/self/cgroup"
+)
+
+const prlimitSupported = true
+
+type cgroup struct {
+	dir string
+	fd  *os.File
+}
+
+// newCgroup creates a cgroup for one service next to the caller's own cgroup
+// (under a systemd user session, in the delegated app.slice) or, failing
+// that, below it.
+func newCgroup(name string, memory int64, cpu float64) (*cgroup, error) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return nil, errors.New("cgroup v2 is not mounted")
+	}
+	own, err := ownCgroup()
+	if err != nil {
+		return nil, err
+	}
+	var want []string
+	if memory > 0 {
+		want = append(want, "memory")
+	}
+	if cpu > 0 {
+		want = append(want, "cpu")
+	}
+
+	parents := []string{filepath.Dir(own), own}
+	if own == "/" {
+		parents = []string{own}
+	}
+	var lastErr error
+	for _, p := range parents {
+		base := filepath.Join(cgroupRoot, p)
+		if err := enableControllers(base, want); err != nil {
+			lastErr = err
+			continue
+		}
+		dir := filepath.Join(base, fmt.Sprintf("devctl-%s-%d.scope", name, os.Getpid()))
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			lastErr = errors.Wrap(err, "create cgroup")
+			continue
+		}
+		cg := &cgroup{dir: dir}
+		if err := cg.configure(memory, cpu); err != nil {
+			_ = os.Remove(dir)
+			lastErr = err
+			continue
+		}
+		fd, err := os.Open(dir)
+		if err != nil {
+			_ = os.Remove(dir)
+			lastErr = errors.Wrap(err, "open cgroup")
+			continue
+		}
+		cg.fd = fd
+		return cg, nil
+	}
+	return nil, lastErr
+}
+
+func ownCgroup() (string, error) {
+	b, err := os.ReadFile(selfCgroupPath)
+	if err != nil {
+		return "", errors.Wrap(err, "read own cgroup")
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if p, ok := strings.CutPrefix(line, "0::"); ok {
+			return p, nil
+		}
+	}
+	return "", errors.New("no cgroup v2 entry in /proc/self/cgroup")
+}
+
+// enableControllers makes want available to base's children.
+func enableControllers(base string, want []string) error {
+	avail, err := os.ReadFile(filepath.Join(base, "cgroup.controllers"))
+	if err != nil {
+		return errors.Wrap(err, "read cgroup controllers")
+	}
+	enabled, err := os.ReadFile(filepath.Join(base, "cgroup.subtree_control"))
+	if err != nil {
+		return errors.Wrap(err, "read cgroup subtree_control")
+	}
+	var missing []string
+	for _, c := range want {
+		if !hasField(string(avail), c) {
+			return errors.Errorf("cgroup controller %q is not delegated to %s", c, base)
+		}
+		if !hasField(string(enabled), c) {
+			missing = append(missing, "+"+c)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return errors.Wrap(os.WriteFile(filepath.Join(base, "cgroup.subtree_control"), []byte(strings.Join(missing, " ")), 0o644), "enable cgroup controllers")
+}
+
+func hasField(s, f string) bool {
+	for _, x := range strings.Fields(s) {
+		if x == f {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *cgroup) configure(memory int64, cpu float64) error {
+	if memory > 0 {
+		if err := os.WriteFile(filepath.Join(c.dir, "memory.max"), []byte(strconv.FormatInt(memory, 10)), 0o644); err != nil {
+			return errors.Wrap(err, "set memory.max")
+		}
+	}
+	if cpu > 0 {
+		const period = 100000
+		quota := fmt.Sprintf("%d %d", int64(cpu*period), period)
+		if err := os.WriteFile(filepath.Join(c.dir, "cpu.max"), []byte(quota), 0o644); err != nil {
+			return errors.Wrap(err, "set cpu.max")
+		}
+	}
+	return nil
+}
+
+func (c *cgroup) prepare(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(c.fd.Fd())
+}
+
+func (c *cgroup) close() bool {
+	oom := false
+	if f, err := os.Open(filepath.Join(c.dir, "memory.events")); err == nil {
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			if n, ok := strings.CutPrefix(sc.Text(), "oom_kill "); ok && n != "0" {
+				oom = true
+			}
+		}
+		_ = f.Close()
+	}
+	_ = c.fd.Close()
+	// The kernel releases the cgroup shortly after its last process exits;
+	// leftovers (daemonized grandchildren) keep it alive and it stays.
+	for i := 0; i < 10; i++ {
+		if err := os.Remove(c.dir); err == nil || os.IsNotExist(err) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return oom
+}
+
+func setDataLimit(pid int, n uint64) error {
+	return unix.Prlimit(pid, unix.RLIMIT_DATA, &unix.Rlimit{Cur: n, Max: n}, nil)
+}
@@ -0,0 +1,145 @@
+package limits
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/go-go-golems/devctl/pkg/engine"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCgroup builds a cgroup v2 tree under a temp dir: the caller lives in
+// user.slice/app.slice/term.scope, and parent holds the controllers that
+// app.slice may hand out.
+func fakeCgroup(t *testing.T, parent string) (root, appSlice string) {
+	root = t.TempDir()
+	appSlice = filepath.Join(root, "user.slice", "app.slice")
+	require.NoError(t, os.MkdirAll(filepath.Join(appSlice, "term.scope"), 0o755))
+	write := func(path, content string) {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	write(filepath.Join(root, "cgroup.controllers"), "cpu io memory pids\n")
+	write(filepath.Join(appSlice, "cgroup.controllers"), parent)
+	write(filepath.Join(appSlice, "cgroup.subtree_control"), "memory\n")
+	write(filepath.Join(appSlice, "term.scope", "cgroup.controllers"), "")
+	write(filepath.Join(appSlice, "term.scope", "cgroup.subtree_control"), "")
+
+	self := filepath.Join(root, "self")
+	write(self, "0::/user.slice/app.slice/term.scope\n")
+	oldRoot, oldSelf := cgroupRoot, selfCgroupPath
+	cgroupRoot, selfCgroupPath = root, self
+	t.Cleanup(func() { cgroupRoot, selfCgroupPath = oldRoot, oldSelf })
+	return root, appSlice
+}
+
+func readFile(t *testing.T, path string) string {
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return strings.TrimSpace(string(b))
+}
+
+func TestNewCgroup_CreatesScopeNextToOwnCgroup(t *testing.T) {
+	_, appSlice := fakeCgroup(t, "cpu memory pids\n")
+
+	cg, err := newCgroup("web", 256<<20, 1.5)
+	require.NoError(t, err)
+	defer func() { _ = cg.fd.Close() }()
+
+	require.Equal(t, filepath.Join(appSlice, fmt.Sprintf("devctl-web-%d.scope", os.Getpid())), cg.dir)
+	require.Equal(t, "+cpu", readFile(t, filepath.Join(appSlice, "cgroup.subtree_control")), "only the missing controller is enabled")
+	require.Equal(t, "268435456", readFile(t, filepath.Join(cg.dir, "memory.max")))
+	require.Equal(t, "150000 100000", readFile(t, filepath.Join(cg.dir, "cpu.max")))
+
+	cmd := exec.Command("true")
+	cg.prepare(cmd)
+	require.True(t, cmd.SysProcAttr.UseCgroupFD)
+	require.Equal(t, int(cg.fd.Fd()), cmd.SysProcAttr.CgroupFD)
+}
+
+func TestNewCgroup_ErrorsWithoutDelegationOrV2(t *testing.T) {
+	fakeCgroup(t, "memory\n")
+	_, err := newCgroup("web", 0, 1)
+	require.ErrorContains(t, err, `"cpu" is not delegated`)
+
+	root, _ := fakeCgroup(t, "cpu memory\n")
+	require.NoError(t, os.Remove(filepath.Join(root, "cgroup.controllers")))
+	_, err = newCgroup("web", 1<<20, 0)
+	require.ErrorContains(t, err, "cgroup v2 is not mounted")
+}
+
+func TestCgroupClose_DetectsOOMKill(t *testing.T) {
+	for events, want := range map[string]bool{
+		"low 0\nhigh 0\nmax 3\noom 1\noom_kill 1\n": true,
+		"low 0\nhigh 0\nmax 0\noom 0\noom_kill 0\n": false,
+		"": false,
+	} {
+		dir := t.TempDir()
+		if events != "" {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "memory.events"), []byte(events), 0o644))
+		}
+		fd, err := os.Open(dir)
+		require.NoError(t, err)
+		g := &Guard{cg: &cgroup{dir: dir, fd: fd}}
+		require.Equal(t, want, g.Close(), events)
+	}
+}
+
+func TestApply_FallsBackToRlimitWithoutCgroup(t *testing.T) {
+	root, _ := fakeCgroup(t, "cpu memory\n")
+	require.NoError(t, os.Remove(filepath.Join(root, "cgroup.controllers")))
+
+	g, warnings, err := Apply("web", engine.Limits{Memory: "64MiB", CPU: 1})
+	require.NoError(t, err)
+	require.Len(t, warnings, 2)
+	require.Contains(t, warnings[0], "RLIMIT_DATA")
+	require.Contains(t, warnings[1], "cpu limit not applied")
+	require.Equal(t, int64(64<<20), g.MemoryLimit())
+
+	cmd := exec.Command("sleep", "5")
+	g.Prepare(cmd)
+	require.Nil(t, cmd.SysProcAttr)
+	require.NoError(t, cmd.Start())
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+	require.NoError(t, g.Started(cmd.Process.Pid))
+
+	limits := readFile(t, fmt.Sprintf("/proc/%d/limits", cmd.Process.Pid))
+	var data string
+	for _, line := range strings.Split(limits, "\n") {
+		if strings.HasPrefix(line, "Max data size") {
+			data = line
+		}
+	}
+	require.Equal(t, []string{"Max", "data", "size", "67108864", "67108864", "bytes"}, strings.Fields(data))
+	require.False(t, g.Close())
+}
+
+// TestApply_SetsInheritedLimits runs Apply in a child test process, since open
+// files and nice cannot be raised again once lowered.
+func TestApply_SetsInheritedLimits(t *testing.T) {
+	if os.Getenv("DEVCTL_LIMITS_HELPER") == "1" {
+		_, _, err := Apply("web", engine.Limits{OpenFiles: 64, Nice: 5})
+		if err != nil {
+			fmt.Println("error:", err)
+			os.Exit(1)
+		}
+		var lim syscall.Rlimit
+		_ = syscall.Getrlimit(syscall.RLIMIT_NOFILE, &lim)
+		prio, _ := syscall.Getpriority(syscall.PRIO_PROCESS, 0)
+		// The raw syscall returns 20 - nice.
+		fmt.Printf("nofile=%d/%d nice=%d\n", lim.Cur, lim.Max, 20-prio)
+		os.Exit(0)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestApply_SetsInheritedLimits$")
+	cmd.Env = append(os.Environ(), "DEVCTL_LIMITS_HELPER=1")
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	require.Contains(t, string(out), "nofile=64/64 nice=5")
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package limits
+
+import (
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+const prlimitSupported = false
+
+type cgroup struct{}
+
+func newCgroup(name string, memory int64, cpu float64) (*cgroup, error) {
+	return nil, errors.New("cgroups are only available on Linux")
+}
+
+func (c *cgroup) prepare(cmd *exec.Cmd) {}
+
+func (c *cgroup) close() bool { return false }
+
+func setDataLimit(pid int, n uint64) error {
+	return errors.New("not supported on this platform")
+}
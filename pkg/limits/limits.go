@@ -0,0 +1,162 @@
+// Package limits applies per-service resource limits in the service wrapper.
+// Open files and the nice level are set with setrlimit/setpriority and
+// inherited by the child; memory and CPU go to a cgroup v2 sub-tree of the
+// wrapper's own cgroup when the user's delegation allows it. Without one,
+// memory falls back to RLIMIT_DATA and CPU is not limited.
+package limits
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/go-go-golems/devctl/pkg/engine"
+	"github.com/pkg/errors"
+)
+
+var units = []struct {
+	suffix string
+	mult   int64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+	{"KB", 1000}, {"MB", 1000 * 1000}, {"GB", 1000 * 1000 * 1000},
+	{"B", 1},
+}
+
+// ParseBytes parses sizes like "512MiB", "2G" (binary) or "1GB" (decimal).
+// A bare number is bytes.
+func ParseBytes(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	num, mult := s, int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(strings.ToUpper(s), strings.ToUpper(u.suffix)) && len(s) > len(u.suffix) {
+			// Two- and three-letter suffixes precede "B", so "MiB" wins over it.
+			num, mult = strings.TrimSpace(s[:len(s)-len(u.suffix)]), u.mult
+			break
+		}
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil || f <= 0 {
+		return 0, errors.Errorf("invalid size %q (e.g. 512MiB, 2G)", s)
+	}
+	return int64(f * float64(mult)), nil
+}
+
+// FormatBytes renders n in the largest binary unit it reaches, e.g. "2GiB"
+// or "1.5GiB".
+func FormatBytes(n int64) string {
+	for _, u := range []struct {
+		suffix string
+		mult   int64
+	}{{"TiB", 1 << 40}, {"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10}} {
+		if n >= u.mult {
+			v := strconv.FormatFloat(float64(n)/float64(u.mult), 'f', 1, 64)
+			return strings.TrimSuffix(v, ".0") + u.suffix
+		}
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+// Check validates l without applying it.
+func Check(l engine.Limits) error {
+	if l.Memory != "" {
+		if _, err := ParseBytes(l.Memory); err != nil {
+			return errors.Wrap(err, "limits.memory")
+		}
+	}
+	if l.CPU < 0 {
+		return errors.Errorf("limits.cpu: must be positive, got %v", l.CPU)
+	}
+	if l.Nice < -20 || l.Nice > 19 {
+		return errors.Errorf("limits.nice: must be between -20 and 19, got %d", l.Nice)
+	}
+	return nil
+}
+
+// IsZero reports whether l limits nothing.
+func IsZero(l engine.Limits) bool {
+	return l == engine.Limits{}
+}
+
+// Guard holds the limits applied for one child process.
+type Guard struct {
+	memory   int64
+	fallback bool // memory must be set as RLIMIT_DATA on the child
+	cg       *cgroup
+}
+
+// Apply prepares l for a child the calling process is about to start. Open
+// files and nice are set on the caller, so the child inherits them. Warnings
+// describe limits that could only be approximated or not applied at all.
+func Apply(name string, l engine.Limits) (*Guard, []string, error) {
+	if err := Check(l); err != nil {
+		return nil, nil, err
+	}
+	g := &Guard{}
+	var warnings []string
+	if l.Memory != "" {
+		g.memory, _ = ParseBytes(l.Memory)
+	}
+	if l.OpenFiles > 0 {
+		lim := syscall.Rlimit{Cur: l.OpenFiles, Max: l.OpenFiles}
+		if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+			return nil, nil, errors.Wrap(err, "set open files limit")
+		}
+	}
+	if l.Nice != 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, 0, l.Nice); err != nil {
+			return nil, nil, errors.Wrapf(err, "set nice level %d", l.Nice)
+		}
+	}
+	if g.memory == 0 && l.CPU == 0 {
+		return g, nil, nil
+	}
+
+	cg, err := newCgroup(name, g.memory, l.CPU)
+	if err == nil {
+		g.cg = cg
+		return g, nil, nil
+	}
+	if g.memory > 0 {
+		if prlimitSupported {
+			g.fallback = true
+			warnings = append(warnings, fmt.Sprintf("no writable cgroup v2 (%v); memory limited with RLIMIT_DATA instead, OOM kills will not be detected", err))
+		} else {
+			warnings = append(warnings, fmt.Sprintf("no writable cgroup v2 (%v); memory limit not applied", err))
+		}
+	}
+	if l.CPU > 0 {
+		warnings = append(warnings, fmt.Sprintf("no writable cgroup v2 (%v); cpu limit not applied", err))
+	}
+	return g, warnings, nil
+}
+
+// Prepare makes cmd start inside the guard's cgroup.
+func (g *Guard) Prepare(cmd *exec.Cmd) {
+	if g.cg != nil {
+		g.cg.prepare(cmd)
+	}
+}
+
+// Started applies what can only be set once the child exists.
+func (g *Guard) Started(pid int) error {
+	if !g.fallback {
+		return nil
+	}
+	return errors.Wrap(setDataLimit(pid, uint64(g.memory)), "set memory rlimit")
+}
+
+// MemoryLimit is the memory limit in bytes, 0 if none.
+func (g *Guard) MemoryLimit() int64 { return g.memory }
+
+// Close removes the cgroup and reports whether the kernel OOM-killed a
+// process in it.
+func (g *Guard) Close() (oomKilled bool) {
+	if g.cg == nil {
+		return false
+	}
+	return g.cg.close()
+}
@@ -0,0 +1,36 @@
+package limits
+
+import (
+	"testing"
+
+	"github.com/go-go-golems/devctl/pkg/engine"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAndFormatBytes(t *testing.T) {
+	for in, want := range map[string]int64{
+		"2GiB":   2 << 30,
+		"512M":   512 << 20,
+		"1.5g":   3 << 29,
+		"1GB":    1000 * 1000 * 1000,
+		"4096":   4096,
+		"64 KiB": 64 << 10,
+	} {
+		got, err := ParseBytes(in)
+		require.NoError(t, err, in)
+		require.Equal(t, want, got, in)
+	}
+	for _, bad := range []string{"", "lots", "-1G", "GiB"} {
+		_, err := ParseBytes(bad)
+		require.Error(t, err, bad)
+	}
+
+	require.Equal(t, "2GiB", FormatBytes(2<<30))
+	require.Equal(t, "1.5GiB", FormatBytes(3<<29))
+	require.Equal(t, "512MiB", FormatBytes(512<<20))
+	require.Equal(t, "100B", FormatBytes(100))
+
+	require.Error(t, Check(engine.Limits{Nice: 20}))
+	require.Error(t, Check(engine.Limits{CPU: -1}))
+	require.NoError(t, Check(engine.Limits{Memory: "2GiB", CPU: 1.5, OpenFiles: 1024, Nice: 10}))
+}
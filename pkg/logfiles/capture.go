@@ -0,0 +1,70 @@
+package logfiles
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// captureLine caps a line in the combined log; longer output is split into
+// lines of this size. Even fully JSON-escaped it stays below MaxLine.
+const captureLine = 64 * 1024
+
+// Capture receives one stream of a service. Output goes to the stream's
+// plain log unchanged; each complete line is also written to the combined
+// log as a Line stamped with the time it arrived. Both streams share one
+// combined writer, so its lines are in arrival order.
+type Capture struct {
+	service  string
+	stream   string
+	plain    io.Writer
+	combined io.Writer
+	buf      []byte
+}
+
+func NewCapture(service, stream string, plain, combined io.Writer) *Capture {
+	return &Capture{service: service, stream: stream, plain: plain, combined: combined}
+}
+
+func (c *Capture) Write(p []byte) (int, error) {
+	n, err := c.plain.Write(p)
+	c.buf = append(c.buf, p...)
+	for {
+		i := bytes.IndexByte(c.buf, '\n')
+		if i < 0 {
+			break
+		}
+		c.emit(string(c.buf[:i]))
+		c.buf = c.buf[i+1:]
+	}
+	for len(c.buf) > captureLine {
+		// Split at a rune boundary so the JSON text stays valid UTF-8.
+		i := captureLine
+		for i > captureLine-utf8.UTFMax && !utf8.RuneStart(c.buf[i]) {
+			i--
+		}
+		c.emit(string(c.buf[:i]))
+		c.buf = c.buf[i:]
+	}
+	return n, err
+}
+
+// Flush writes out an unterminated last line.
+func (c *Capture) Flush() {
+	if len(c.buf) > 0 {
+		c.emit(string(c.buf))
+		c.buf = nil
+	}
+}
+
+func (c *Capture) emit(text string) {
+	b, err := json.Marshal(Line{Service: c.service, Stream: c.stream, Time: time.Now(), Text: strings.TrimSuffix(text, "\r")})
+	if err != nil {
+		return
+	}
+	// One Write per line keeps lines of the two streams from mixing.
+	_, _ = c.combined.Write(append(b, '\n'))
+}
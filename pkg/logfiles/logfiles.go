@@ -0,0 +1,337 @@
+// Package logfiles rotates service logs by size and prunes old runs.
+//
+// Every start of a service writes <service>-<YYYYMMDD-HHMMSS>.{stdout.log,
+// stderr.log,ndjson,exit.json,ready} into the logs dir; together these files (and
+// rotated copies such as .stdout.log.1) are one run. GC removes whole runs.
+package logfiles
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Policy configures rotation (applied by the service wrapper) and retention
+// (applied by GC). Zero values disable the respective limit.
+type Policy struct {
+	// MaxSize rotates a log file once it reaches this many bytes, keeping
+	// MaxFiles rotated copies (.1 is the newest).
+	MaxSize  int64
+	MaxFiles int
+	// KeepRuns is how many runs per service are kept.
+	KeepRuns int
+	// MaxAge removes runs not written to for longer than this.
+	MaxAge time.Duration
+	// MaxTotalSize removes the oldest runs until the logs dir fits.
+	MaxTotalSize int64
+	// Combined has the wrapper also write <service>-<ts>.ndjson: both
+	// streams as Lines stamped when they were received.
+	Combined bool
+}
+
+// DefaultPolicy is used for whatever .devctl.yaml's logs section leaves out.
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxSize:      100 << 20,
+		MaxFiles:     3,
+		KeepRuns:     5,
+		MaxAge:       7 * 24 * time.Hour,
+		MaxTotalSize: 1 << 30,
+	}
+}
+
+// Writer appends to a file and rotates it once it reaches maxSize: path.1
+// becomes path.2 and so on, path becomes path.1 and a new path is started.
+// The writer does the rotation itself, so nothing is copied or truncated.
+type Writer struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	keep    int
+	f       *os.File
+	size    int64
+}
+
+// Open opens path for appending. maxSize <= 0 never rotates.
+func Open(path string, maxSize int64, keep int) (*Writer, error) {
+	w := &Writer{path: path, maxSize: maxSize, keep: keep}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Writer) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return errors.Wrap(err, "open log")
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "stat log")
+	}
+	w.f, w.size = f, fi.Size()
+	return nil
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *Writer) rotate() error {
+	if err := w.f.Close(); err != nil {
+		return errors.Wrap(err, "close log")
+	}
+	if w.keep <= 0 {
+		_ = os.Remove(w.path)
+	} else {
+		_ = os.Remove(w.path + "." + strconv.Itoa(w.keep))
+		for i := w.keep - 1; i >= 1; i-- {
+			_ = os.Rename(w.path+"."+strconv.Itoa(i), w.path+"."+strconv.Itoa(i+1))
+		}
+		if err := os.Rename(w.path, w.path+".1"); err != nil {
+			return errors.Wrap(err, "rotate log")
+		}
+	}
+	return w.open()
+}
+
+// File is the current file; writes to it directly bypass rotation.
+func (w *Writer) File() *os.File {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f
+}
+
+func (w *Writer) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Sync()
+}
+
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Close()
+}
+
+// RunStampLayout is the start time in a run's file names. Milliseconds keep
+// quick restarts apart; files of older versions have whole seconds.
+const RunStampLayout = "20060102-150405.000"
+
+// RunStamp formats t for a run's file names.
+func RunStamp(t time.Time) string { return t.Format(RunStampLayout) }
+
+var runFile = regexp.MustCompile(`^(.+)-(\d{8}-\d{6}(?:\.\d{3})?)\.(stdout\.log|stderr\.log|ndjson|exit\.json|ready)(\.\d+)?$`)
+
+// Run is one start of a service and its files.
+type Run struct {
+	Service string
+	Started time.Time
+	Files   []string
+	Size    int64
+	// Modified is the newest modification time of its files.
+	Modified time.Time
+
+	stamp string // as in the file names
+}
+
+func (r Run) key() string { return r.Service + "-" + r.ID() }
+
+// ID tells the run apart from the service's other runs.
+func (r Run) ID() string {
+	if r.stamp != "" {
+		return r.stamp
+	}
+	return RunStamp(r.Started)
+}
+
+// Path is the run's file of the given kind ("stdout.log", "stderr.log",
+// "ndjson", "exit.json"), or "" if it has none.
+func (r Run) Path(kind string) string {
+	for _, f := range r.Files {
+		if strings.HasSuffix(f, "."+kind) {
+			return f
+		}
+	}
+	return ""
+}
+
+// RunKey identifies the run a log or exit info path belongs to.
+func RunKey(path string) (string, bool) {
+	m := runFile.FindStringSubmatch(filepath.Base(path))
+	if m == nil {
+		return "", false
+	}
+	return m[1] + "-" + m[2], true
+}
+
+// Runs lists the runs in dir, newest first.
+func Runs(dir string) ([]Run, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "read logs dir")
+	}
+	byKey := map[string]*Run{}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		m := runFile.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		key := m[1] + "-" + m[2]
+		r := byKey[key]
+		if r == nil {
+			// Parsing accepts the milliseconds without a layout for them.
+			started, err := time.ParseInLocation("20060102-150405", m[2], time.Local)
+			if err != nil {
+				continue
+			}
+			r = &Run{Service: m[1], Started: started, stamp: m[2]}
+			byKey[key] = r
+		}
+		r.Files = append(r.Files, filepath.Join(dir, e.Name()))
+		r.Size += info.Size()
+		if info.ModTime().After(r.Modified) {
+			r.Modified = info.ModTime()
+		}
+	}
+	out := make([]Run, 0, len(byKey))
+	for _, r := range byKey {
+		sort.Strings(r.Files)
+		out = append(out, *r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].Started.Equal(out[j].Started) {
+			return out[i].Started.After(out[j].Started)
+		}
+		return out[i].Service < out[j].Service
+	})
+	return out, nil
+}
+
+// ServiceRuns keeps the runs of service.
+func ServiceRuns(runs []Run, service string) []Run {
+	var out []Run
+	for _, r := range runs {
+		if r.Service == service {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// SelectRun picks one of a service's runs, newest first as Runs lists them:
+// "" or "0" is the newest, "-1" the one before and so on; anything else is a
+// run ID.
+func SelectRun(runs []Run, sel string) (Run, error) {
+	if sel == "" {
+		sel = "0"
+	}
+	if n, err := strconv.Atoi(sel); err == nil && n <= 0 {
+		if -n >= len(runs) {
+			return Run{}, errors.Errorf("no run %s (%d runs)", sel, len(runs))
+		}
+		return runs[-n], nil
+	}
+	for _, r := range runs {
+		if r.ID() == sel {
+			return r, nil
+		}
+	}
+	return Run{}, errors.Errorf("no run %q", sel)
+}
+
+// GCResult lists what GC removed (or would remove, with dryRun).
+type GCResult struct {
+	Removed []Run
+	Freed   int64
+	Kept    int
+}
+
+// GC removes runs in dir beyond p's retention. Runs that own any of the live
+// paths (the current state's logs) are always kept.
+func GC(dir string, p Policy, live []string, dryRun bool) (GCResult, error) {
+	var res GCResult
+	runs, err := Runs(dir)
+	if err != nil {
+		return res, err
+	}
+	liveKeys := map[string]bool{}
+	for _, path := range live {
+		if k, ok := RunKey(path); ok {
+			liveKeys[k] = true
+		}
+	}
+
+	now := time.Now()
+	perService := map[string]int{}
+	remove := make([]bool, len(runs))
+	var total int64
+	for i, r := range runs {
+		perService[r.Service]++
+		if liveKeys[r.key()] {
+			total += r.Size
+			continue
+		}
+		switch {
+		case p.KeepRuns > 0 && perService[r.Service] > p.KeepRuns:
+			remove[i] = true
+		case p.MaxAge > 0 && now.Sub(r.Modified) > p.MaxAge:
+			remove[i] = true
+		default:
+			total += r.Size
+		}
+	}
+	// Oldest first until the rest fits.
+	for i := len(runs) - 1; i >= 0 && p.MaxTotalSize > 0 && total > p.MaxTotalSize; i-- {
+		if remove[i] || liveKeys[runs[i].key()] {
+			continue
+		}
+		remove[i] = true
+		total -= runs[i].Size
+	}
+
+	for i, r := range runs {
+		if !remove[i] {
+			res.Kept++
+			continue
+		}
+		if !dryRun {
+			for _, f := range r.Files {
+				if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+					return res, errors.Wrap(err, "remove log")
+				}
+			}
+		}
+		res.Removed = append(res.Removed, r)
+		res.Freed += r.Size
+	}
+	return res, nil
+}
@@ -0,0 +1,325 @@
+package logfiles
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriter_RotatesBySize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "api-20260101-120000.stdout.log")
+	w, err := Open(path, 10, 2)
+	require.NoError(t, err)
+	for _, line := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"} {
+		_, err := w.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+
+	read := func(p string) string {
+		b, err := os.ReadFile(p)
+		require.NoError(t, err)
+		return string(b)
+	}
+	require.Equal(t, "dddddddd\n", read(path))
+	require.Equal(t, "cccccccc\n", read(path+".1"))
+	require.Equal(t, "bbbbbbbb\n", read(path+".2"))
+	_, err = os.Stat(path + ".3")
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestGC_KeepsLiveAndNewestRuns(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, size int, age time.Duration) string {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(p, []byte(strings.Repeat("x", size)), 0o600))
+		mt := time.Now().Add(-age)
+		require.NoError(t, os.Chtimes(p, mt, mt))
+		return p
+	}
+	// The live run is the oldest and must survive everything.
+	live := write("api-20260101-100000.stdout.log", 10, 30*24*time.Hour)
+	write("api-20260101-100000.stdout.log.1", 10, 30*24*time.Hour)
+	write("api-20260102-100000.stdout.log", 10, time.Hour)
+	write("api-20260102-100000.exit.json", 1, time.Hour)
+	write("api-20260103-100000.stdout.log", 10, time.Hour)
+	write("api-20260104-100000.stdout.log", 10, time.Hour)
+	write("worker-20260101-100000.stderr.log", 10, 30*24*time.Hour)
+	write("worker-20260104-100000.stderr.log", 10, time.Hour)
+	write("notes.txt", 10, 30*24*time.Hour)
+
+	p := Policy{KeepRuns: 2, MaxAge: 7 * 24 * time.Hour}
+	res, err := GC(dir, p, []string{live}, true)
+	require.NoError(t, err)
+	var removed []string
+	for _, r := range res.Removed {
+		removed = append(removed, r.key())
+	}
+	require.ElementsMatch(t, []string{"api-20260102-100000", "worker-20260101-100000"}, removed)
+	_, err = os.Stat(filepath.Join(dir, "api-20260102-100000.exit.json"))
+	require.NoError(t, err, "dry run removes nothing")
+
+	p.MaxTotalSize = 45
+	res, err = GC(dir, p, []string{live}, false)
+	require.NoError(t, err)
+	require.Len(t, res.Removed, 3) // plus api-20260103, the oldest run that is not live
+	runs, err := Runs(dir)
+	require.NoError(t, err)
+	var kept []string
+	for _, r := range runs {
+		kept = append(kept, r.key())
+	}
+	require.Equal(t, []string{"api-20260104-100000", "worker-20260104-100000", "api-20260101-100000"}, kept)
+	_, err = os.Stat(filepath.Join(dir, "notes.txt"))
+	require.NoError(t, err)
+}
+
+func TestRead_MergesByLeadingTime(t *testing.T) {
+	// Worker lines have no zone and are read as local time.
+	defer func(loc *time.Location) { time.Local = loc }(time.Local)
+	time.Local = time.UTC
+
+	dir := t.TempDir()
+	api := filepath.Join(dir, "api-20260101-120000.stdout.log")
+	require.NoError(t, os.WriteFile(api+".1", []byte("2026-01-01T12:00:01Z api one\n"), 0o600))
+	require.NoError(t, os.WriteFile(api, []byte("2026-01-01T12:00:03Z api three\ncontinued\n"), 0o600))
+	worker := filepath.Join(dir, "worker-20260101-120000.stderr.log")
+	require.NoError(t, os.WriteFile(worker, []byte("2026/01/01 12:00:02 worker two\n2026-01-01 12:00:04,5 worker four\n"), 0o600))
+
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	a, err := Read(Source{Service: "api", Stream: Stdout, Path: api, Started: start}, Filter{}, 0)
+	require.NoError(t, err)
+	w, err := Read(Source{Service: "worker", Stream: Stderr, Path: worker, Started: start}, Filter{}, 0)
+	require.NoError(t, err)
+	var got []string
+	for _, l := range Merge(a, w) {
+		got = append(got, l.Text)
+	}
+	require.Equal(t, []string{
+		"2026-01-01T12:00:01Z api one",
+		"2026/01/01 12:00:02 worker two",
+		"2026-01-01T12:00:03Z api three",
+		"continued",
+		"2026-01-01 12:00:04,5 worker four",
+	}, got)
+
+	a, err = Read(Source{Service: "api", Stream: Stdout, Path: api, Started: start}, Filter{Grep: regexp.MustCompile("one|cont")}, 1)
+	require.NoError(t, err)
+	require.Len(t, a, 1)
+	require.Equal(t, "continued", a[0].Text)
+	require.Equal(t, time.Date(2026, 1, 1, 12, 0, 3, 0, time.UTC), a[0].Time.UTC())
+}
+
+func TestFollow_UntimedLinesKeepLastTimestamp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api-20260101-120000.stdout.log")
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	src := Source{Service: "api", Stream: Stdout, Path: path, Started: start}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lines := make(chan Line, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- Follow(ctx, func() ([]Source, error) { return []Source{src}, nil }, 10*time.Millisecond, func(l Line) { lines <- l })
+	}()
+
+	// The file appears after Follow started, so it is read whole.
+	time.Sleep(30 * time.Millisecond)
+	require.NoError(t, os.WriteFile(path, []byte("booting\n2026-01-01T12:00:03Z api ready\ncontinued\n"), 0o600))
+
+	var got []Line
+	for len(got) < 3 {
+		select {
+		case l := <-lines:
+			got = append(got, l)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("got %d lines", len(got))
+		}
+	}
+	cancel()
+	require.NoError(t, <-done)
+	require.Equal(t, start, got[0].Time, "first line gets the start time")
+	require.Equal(t, time.Date(2026, 1, 1, 12, 0, 3, 0, time.UTC), got[2].Time.UTC(), "untimed line gets the previous time")
+}
+
+func TestCapture_WritesPlainAndCombined(t *testing.T) {
+	dir := t.TempDir()
+	combined := filepath.Join(dir, "api-20260101-120000.ndjson")
+	cw, err := Open(combined, 0, 0)
+	require.NoError(t, err)
+	var stdout, stderr strings.Builder
+	out := NewCapture("api", Stdout, &stdout, cw)
+	errc := NewCapture("api", Stderr, &stderr, cw)
+
+	_, _ = out.Write([]byte("hel"))
+	_, _ = errc.Write([]byte("boom\n"))
+	_, _ = out.Write([]byte("lo\nbye"))
+	out.Flush()
+	require.NoError(t, cw.Close())
+	require.Equal(t, "hello\nbye", stdout.String())
+	require.Equal(t, "boom\n", stderr.String())
+
+	lines, err := Read(Source{Service: "api", Path: combined, Combined: true}, Filter{}, 0)
+	require.NoError(t, err)
+	var got []string
+	for _, l := range lines {
+		got = append(got, l.Stream+":"+l.Text)
+	}
+	require.Equal(t, []string{"stderr:boom", "stdout:hello", "stdout:bye"}, got)
+
+	lines, err = Read(Source{Service: "api", Stream: Stderr, Path: combined, Combined: true}, Filter{}, 0)
+	require.NoError(t, err)
+	require.Len(t, lines, 1)
+}
+
+func TestCapture_SplitsOverlongLines(t *testing.T) {
+	var plain, combined strings.Builder
+	c := NewCapture("api", Stdout, &plain, &combined)
+	long := strings.Repeat("é", captureLine) // two bytes per rune
+	for i := 0; i < len(long); i += 1000 {
+		_, _ = c.Write([]byte(long[i:min(i+1000, len(long))]))
+		require.LessOrEqual(t, len(c.buf), captureLine+1000)
+	}
+	_, _ = c.Write([]byte("\n"))
+	require.Equal(t, long+"\n", plain.String())
+
+	path := filepath.Join(t.TempDir(), "api.ndjson")
+	require.NoError(t, os.WriteFile(path, []byte(combined.String()), 0o600))
+	lines, err := Read(Source{Service: "api", Path: path, Combined: true}, Filter{}, 0)
+	require.NoError(t, err)
+	require.Len(t, lines, 2)
+	var joined string
+	for _, l := range lines {
+		require.LessOrEqual(t, len(l.Text), captureLine)
+		require.True(t, utf8.ValidString(l.Text))
+		joined += l.Text
+	}
+	require.Equal(t, long, joined)
+}
+
+func TestRead_TruncatesOverlongLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.stdout.log")
+	long := strings.Repeat("x", 2*MaxLine+10)
+	require.NoError(t, os.WriteFile(path, []byte("before\n"+long+"\r\nafter\r\n"), 0o600))
+	lines, err := Read(Source{Service: "api", Stream: Stdout, Path: path}, Filter{}, 0)
+	require.NoError(t, err)
+	require.Len(t, lines, 3)
+	require.Equal(t, "before", lines[0].Text)
+	require.Equal(t, long[:MaxLine], lines[1].Text)
+	require.Equal(t, "after", lines[2].Text)
+}
+
+func TestRead_AppliesParsers(t *testing.T) {
+	dir := t.TempDir()
+	module := filepath.Join(dir, "zerolog.js")
+	require.NoError(t, os.WriteFile(module, []byte(`
+register({
+  name: "zerolog",
+  parse(line) {
+    const obj = log.parseJSON(line);
+    if (!obj) return null;
+    return { timestamp: obj.time, level: obj.level, message: obj.message, fields: { req: obj.req } };
+  },
+});
+`), 0o600))
+	path := filepath.Join(dir, "api-20260101-120000.stdout.log")
+	require.NoError(t, os.WriteFile(path, []byte(
+		`{"time":"2026-01-01T12:00:01Z","level":"debug","message":"tick","req":"a"}`+"\n"+
+			"plain text\n"+
+			`{"time":"2026-01-01T12:00:02Z","level":"WARNING","message":"slow","req":"b"}`+"\n",
+	), 0o600))
+
+	p, err := LoadParser(context.Background(), []string{module})
+	require.NoError(t, err)
+	defer p.Close()
+	src := Source{Service: "api", Stream: Stdout, Path: path, Parser: p}
+
+	lines, err := Read(src, Filter{}, 0)
+	require.NoError(t, err)
+	require.Len(t, lines, 3)
+	require.Equal(t, "debug", lines[0].Level)
+	require.Equal(t, time.Date(2026, 1, 1, 12, 0, 1, 0, time.UTC), lines[0].Time.UTC())
+	require.Equal(t, "", lines[1].Level)
+	require.Equal(t, lines[0].Time, lines[1].Time)
+	require.Equal(t, "slow", lines[2].Message)
+	require.Equal(t, map[string]any{"req": "b"}, lines[2].Fields)
+
+	lines, err = Read(src, Filter{MinLevel: "info"}, 0)
+	require.NoError(t, err)
+	require.Len(t, lines, 1)
+	require.Equal(t, "warn", lines[0].Level)
+
+	lines, err = Read(src, Filter{Fields: map[string]string{"req": "a"}}, 0)
+	require.NoError(t, err)
+	require.Len(t, lines, 1)
+	require.Equal(t, "tick", lines[0].Message)
+}
+
+func TestSelectRun(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"api-20260101-100000.stdout.log", "api-20260101-100000.exit.json",
+		"api-20260102-100000.stdout.log", "api-20260102-100000.stdout.log.1",
+		"worker-20260103-100000.stdout.log",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o600))
+	}
+	runs, err := Runs(dir)
+	require.NoError(t, err)
+	api := ServiceRuns(runs, "api")
+	require.Len(t, api, 2)
+
+	r, err := SelectRun(api, "")
+	require.NoError(t, err)
+	require.Equal(t, "20260102-100000", r.ID())
+	require.Equal(t, filepath.Join(dir, "api-20260102-100000.stdout.log"), r.Path("stdout.log"))
+	require.Equal(t, "", r.Path("exit.json"))
+
+	r, err = SelectRun(api, "-1")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "api-20260101-100000.exit.json"), r.Path("exit.json"))
+	r, err = SelectRun(api, "20260102-100000")
+	require.NoError(t, err)
+	require.Equal(t, "20260102-100000", r.ID())
+
+	_, err = SelectRun(api, "-2")
+	require.Error(t, err)
+	_, err = SelectRun(api, "1")
+	require.Error(t, err)
+}
+
+func TestRuns_SubSecondStampsKeepRestartsApart(t *testing.T) {
+	dir := t.TempDir()
+	first := time.Date(2026, 1, 2, 10, 0, 0, 250e6, time.Local)
+	second := first.Add(500 * time.Millisecond)
+	for _, name := range []string{
+		"api-20260102-095959.stdout.log", // written before run stamps had milliseconds
+		"api-" + RunStamp(first) + ".stdout.log", "api-" + RunStamp(first) + ".exit.json",
+		"api-" + RunStamp(second) + ".stdout.log",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o600))
+	}
+	runs, err := Runs(dir)
+	require.NoError(t, err)
+	require.Len(t, runs, 3)
+	require.Equal(t, "20260102-100000.750", runs[0].ID())
+	require.True(t, runs[0].Started.Equal(second))
+	require.Equal(t, "20260102-100000.250", runs[1].ID())
+	require.Len(t, runs[1].Files, 2)
+	require.Equal(t, "20260102-095959", runs[2].ID())
+
+	r, err := SelectRun(runs, "20260102-100000.250")
+	require.NoError(t, err)
+	require.True(t, r.Started.Equal(first))
+	key, ok := RunKey(r.Path("exit.json"))
+	require.True(t, ok)
+	require.Equal(t, r.key(), key)
+}
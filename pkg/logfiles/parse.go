@@ -0,0 +1,93 @@
+package logfiles
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-go-golems/devctl/pkg/logjs"
+	"github.com/pkg/errors"
+)
+
+// Parser runs a service's logjs modules over the lines of one source; the
+// modules may keep state between lines, so sources don't share a Parser.
+type Parser struct {
+	fanout *logjs.Fanout
+	n      int64
+}
+
+func LoadParser(ctx context.Context, modules []string) (*Parser, error) {
+	f, err := logjs.LoadFanoutFromFiles(ctx, modules, logjs.Options{HookTimeout: "200ms"})
+	if err != nil {
+		return nil, errors.Wrap(err, "load log parsers")
+	}
+	return &Parser{fanout: f}, nil
+}
+
+func (p *Parser) Close() {
+	_ = p.fanout.Close(context.Background())
+}
+
+// Parse returns a Line with Level, Message and Fields for every event the
+// modules make of l, taking the event's timestamp if it has one. A line no
+// module parses is returned as is.
+func (p *Parser) Parse(l Line) []Line {
+	p.n++
+	events, _, err := p.fanout.ProcessLine(context.Background(), l.Text, l.Service, p.n)
+	if err != nil || len(events) == 0 {
+		return []Line{l}
+	}
+	out := make([]Line, 0, len(events))
+	for _, ev := range events {
+		pl := l
+		pl.Level = NormalizeLevel(ev.Level)
+		pl.Message = ev.Message
+		pl.Fields = ev.Fields
+		delete(pl.Fields, "_tag")
+		delete(pl.Fields, "_module")
+		if len(pl.Fields) == 0 {
+			pl.Fields = nil
+		}
+		if ev.Timestamp != nil {
+			if t, ok := LeadingTime(*ev.Timestamp); ok {
+				pl.Time = t
+			}
+		}
+		out = append(out, pl)
+	}
+	return out
+}
+
+// Levels from least to most severe.
+var Levels = []string{"trace", "debug", "info", "warn", "error", "fatal"}
+
+// NormalizeLevel maps the usual spellings ("WARNING", "err", pino's 40, ...)
+// onto Levels; anything else is lowercased.
+func NormalizeLevel(level string) string {
+	l := strings.ToLower(strings.TrimSpace(level))
+	switch l {
+	case "10", "trc":
+		return "trace"
+	case "20", "dbg":
+		return "debug"
+	case "30", "information", "notice":
+		return "info"
+	case "40", "warning", "wrn":
+		return "warn"
+	case "50", "err", "erro":
+		return "error"
+	case "60", "crit", "critical", "panic", "ftl":
+		return "fatal"
+	}
+	return l
+}
+
+// LevelRank is the index of level in Levels, -1 for unknown levels.
+func LevelRank(level string) int {
+	level = NormalizeLevel(level)
+	for i, l := range Levels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
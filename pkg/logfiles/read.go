@@ -0,0 +1,385 @@
+package logfiles
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Streams of a service's output.
+const (
+	Stdout = "stdout"
+	Stderr = "stderr"
+)
+
+// Line is one line of service output.
+type Line struct {
+	Service string    `json:"service"`
+	Stream  string    `json:"stream"`
+	Time    time.Time `json:"ts"`
+	Text    string    `json:"line"`
+	// Set by a Parser.
+	Level   string         `json:"level,omitempty"`
+	Message string         `json:"message,omitempty"`
+	Fields  map[string]any `json:"fields,omitempty"`
+}
+
+// Source is one stream of one run of a service.
+type Source struct {
+	Service string
+	Stream  string
+	Path    string
+	// Combined marks Path as the run's NDJSON log, which has exact times;
+	// Stream "" then reads both streams from it.
+	Combined bool
+	// Started is the time given to lines before the first one that starts
+	// with a timestamp.
+	Started time.Time
+	// Parser, if set, parses every line read.
+	Parser *Parser
+}
+
+// Filter selects lines; the zero value keeps everything.
+type Filter struct {
+	Since, Until time.Time
+	Grep         *regexp.Regexp
+	// MinLevel drops lines below this level, and lines without one.
+	MinLevel string
+	// Fields keeps lines whose fields have these values.
+	Fields map[string]string
+}
+
+func (f Filter) Match(l Line) bool {
+	if !f.Since.IsZero() && l.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && l.Time.After(f.Until) {
+		return false
+	}
+	if f.Grep != nil && !f.Grep.MatchString(l.Text) {
+		return false
+	}
+	if f.MinLevel != "" && LevelRank(l.Level) < LevelRank(f.MinLevel) {
+		return false
+	}
+	for k, v := range f.Fields {
+		fv, ok := l.Fields[k]
+		if !ok || fmt.Sprint(fv) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Segments lists path's rotated files oldest first, then path itself.
+func Segments(path string) []string {
+	var rotated []string
+	for i := 1; ; i++ {
+		p := path + "." + strconv.Itoa(i)
+		if _, err := os.Stat(p); err != nil {
+			break
+		}
+		rotated = append(rotated, p)
+	}
+	out := make([]string, 0, len(rotated)+1)
+	for i := len(rotated) - 1; i >= 0; i-- {
+		out = append(out, rotated[i])
+	}
+	return append(out, path)
+}
+
+// Read returns the lines of src (including rotated files) that match f; with
+// tail > 0 only the last tail of them.
+//
+// Plain log files have no per-line times: a line that starts with a
+// timestamp gets it, any other line the time of the line before it.
+func Read(src Source, f Filter, tail int) ([]Line, error) {
+	var out []Line
+	ts := src.Started
+	for _, path := range Segments(src.Path) {
+		file, err := os.Open(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, errors.Wrap(err, "open log")
+		}
+		err = ReadLines(file, func(text string) {
+			var l Line
+			if src.Combined {
+				var ok bool
+				if l, ok = src.decode(text); !ok {
+					return
+				}
+			} else {
+				if t, ok := LeadingTime(text); ok {
+					ts = t
+				}
+				l = Line{Service: src.Service, Stream: src.Stream, Time: ts, Text: text}
+			}
+			for _, l := range src.parse(l) {
+				if !src.Combined {
+					ts = l.Time
+				}
+				if !f.Match(l) {
+					continue
+				}
+				out = append(out, l)
+				if tail > 0 && len(out) > 2*tail {
+					out = append(out[:0], out[len(out)-tail:]...)
+				}
+			}
+		})
+		_ = file.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "read %s", path)
+		}
+	}
+	if tail > 0 && len(out) > tail {
+		out = out[len(out)-tail:]
+	}
+	return out, nil
+}
+
+// MaxLine is the longest line kept when reading logs; longer lines are
+// truncated to it.
+const MaxLine = 1024 * 1024
+
+// ReadLines calls fn with every line of r, without its line ending. Lines
+// longer than MaxLine are truncated instead of failing the read.
+func ReadLines(r io.Reader, fn func(string)) error {
+	br := bufio.NewReaderSize(r, 64*1024)
+	var line []byte
+	for {
+		chunk, isPrefix, err := br.ReadLine()
+		if err != nil {
+			if len(line) > 0 {
+				fn(string(line))
+			}
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if room := MaxLine - len(line); room > 0 {
+			line = append(line, chunk[:min(len(chunk), room)]...)
+		}
+		if !isPrefix {
+			fn(string(line))
+			line = line[:0]
+		}
+	}
+}
+
+// decode parses a line of a combined log; ok is false for lines of other
+// streams and garbage.
+func (src Source) decode(s string) (Line, bool) {
+	var l Line
+	if err := json.Unmarshal([]byte(s), &l); err != nil {
+		return l, false
+	}
+	l.Service = src.Service
+	return l, src.Stream == "" || l.Stream == src.Stream
+}
+
+func (src Source) parse(l Line) []Line {
+	if src.Parser == nil {
+		return []Line{l}
+	}
+	return src.Parser.Parse(l)
+}
+
+// Merge interleaves lines from several sources by time; lines with equal
+// times keep their order.
+func Merge(sets ...[]Line) []Line {
+	var out []Line
+	for _, s := range sets {
+		out = append(out, s...)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+	return out
+}
+
+var leadingTime = regexp.MustCompile(`^\[?(\d{4}[-/]\d{2}[-/]\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?)`)
+
+// LeadingTime parses a timestamp at the start of a log line, as written by
+// most loggers ("2024-05-01T12:00:00.123Z", "2024/05/01 12:00:00", ...).
+func LeadingTime(text string) (time.Time, bool) {
+	m := leadingTime.FindStringSubmatch(text)
+	if m == nil {
+		return time.Time{}, false
+	}
+	s := strings.NewReplacer("/", "-", ",", ".").Replace(m[1])
+	s = s[:10] + "T" + s[11:]
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999-0700"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	if t, err := time.ParseInLocation("2006-01-02T15:04:05.999999999", s, time.Local); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// Follow emits lines appended to the sources from now on, polling every
+// interval until ctx ends. sources is called on every poll: a source whose
+// path changed (the service restarted) is read from the start of its new
+// file, and a rotated file is followed into its successor. As in Read, a line
+// without a leading timestamp gets the time of the line before it; the first
+// one gets the source's Started time, or the time it was read when following
+// from the end of a file.
+func Follow(ctx context.Context, sources func() ([]Source, error), interval time.Duration, emit func(Line)) error {
+	type key struct{ service, stream string }
+	tails := map[key]*tailer{}
+	defer func() {
+		for _, t := range tails {
+			t.close()
+		}
+	}()
+
+	first := true
+	for {
+		srcs, err := sources()
+		if err != nil {
+			return err
+		}
+		for _, src := range srcs {
+			k := key{src.Service, src.Stream}
+			t := tails[k]
+			if t != nil && t.src.Path != src.Path {
+				t.drain(emit)
+				t.flush(emit)
+				t.close()
+				t = nil
+			}
+			if t == nil {
+				// Files present at the start were already shown; new ones are read whole.
+				_, err := os.Stat(src.Path)
+				t = &tailer{src: src, fromEnd: first && err == nil, last: src.Started}
+				tails[k] = t
+			}
+			t.poll(emit)
+		}
+		first = false
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+type tailer struct {
+	src     Source
+	fromEnd bool
+	f       *os.File
+	r       *bufio.Reader
+	partial string
+	last    time.Time // of the last line, for lines without a timestamp
+}
+
+func (t *tailer) open() bool {
+	f, err := os.Open(t.src.Path)
+	if err != nil {
+		return false
+	}
+	if t.fromEnd {
+		_, _ = f.Seek(0, io.SeekEnd)
+		t.fromEnd = false
+		t.last = time.Now()
+	}
+	t.f, t.r = f, bufio.NewReader(f)
+	return true
+}
+
+func (t *tailer) poll(emit func(Line)) {
+	if t.f == nil && !t.open() {
+		return
+	}
+	t.drain(emit)
+	if rotated(t.f, t.src.Path) {
+		t.flush(emit)
+		t.close()
+		if t.open() {
+			t.drain(emit)
+		}
+	}
+}
+
+// drain emits the complete lines available; a partial last line is kept
+// until the rest arrives.
+func (t *tailer) drain(emit func(Line)) {
+	if t.r == nil {
+		return
+	}
+	for {
+		s, err := t.r.ReadString('\n')
+		if err != nil {
+			t.partial += s
+			return
+		}
+		t.line(t.partial+s, emit)
+		t.partial = ""
+	}
+}
+
+// flush emits a partial last line as is, once its file is done.
+func (t *tailer) flush(emit func(Line)) {
+	if t.partial != "" {
+		t.line(t.partial, emit)
+		t.partial = ""
+	}
+}
+
+func (t *tailer) line(s string, emit func(Line)) {
+	if t.src.Combined {
+		if l, ok := t.src.decode(s); ok {
+			t.emit(l, emit)
+		}
+		return
+	}
+	text := strings.TrimRight(s, "\r\n")
+	if ts, ok := LeadingTime(text); ok {
+		t.last = ts
+	} else if t.last.IsZero() {
+		t.last = time.Now()
+	}
+	t.emit(Line{Service: t.src.Service, Stream: t.src.Stream, Time: t.last, Text: text}, emit)
+}
+
+func (t *tailer) emit(l Line, emit func(Line)) {
+	for _, l := range t.src.parse(l) {
+		if !t.src.Combined {
+			t.last = l.Time
+		}
+		emit(l)
+	}
+}
+
+func (t *tailer) close() {
+	if t.f != nil {
+		_ = t.f.Close()
+		t.f, t.r = nil, nil
+	}
+}
+
+// rotated reports whether path now names a different file than f.
+func rotated(f *os.File, path string) bool {
+	cur, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	fi, err := os.Stat(path)
+	return err == nil && !os.SameFile(cur, fi)
+}
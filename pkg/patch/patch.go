@@ -1,6 +1,9 @@
 package patch
 
 import (
+	"encoding/json"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -8,38 +11,266 @@ import (
 
 type Config = map[string]any
 
+// ConfigPatch is a set of operations on dotted keys. Segments address object
+// keys, or list elements when the container is a list ("services.0.name");
+// "\." escapes a literal dot. Operations are applied in field order:
+// test, unset, set, replace, merge, append, set_default.
 type ConfigPatch struct {
-	Set   map[string]any `json:"set,omitempty"`
+	// Test holds preconditions: each key must exist and equal the value
+	// (RFC 6902 "test"); otherwise the whole patch fails.
+	Test  map[string]any `json:"test,omitempty"`
 	Unset []string       `json:"unset,omitempty"`
+	Set   map[string]any `json:"set,omitempty"`
+	// Replace is Set for keys that must already exist (RFC 6902 "replace").
+	Replace map[string]any `json:"replace,omitempty"`
+	// Merge deep-merges an object into the object at the key.
+	Merge map[string]any `json:"merge,omitempty"`
+	// Append adds to the list at the key; a list value appends each element.
+	Append map[string]any `json:"append,omitempty"`
+	// SetDefault sets keys that are absent and leaves existing values alone.
+	SetDefault map[string]any `json:"set_default,omitempty"`
 }
 
+// Write actions recorded in Provenance.
+const (
+	ActionSet        = "set"
+	ActionUnset      = "unset"
+	ActionReplace    = "replace"
+	ActionMerge      = "merge"
+	ActionAppend     = "append"
+	ActionSetDefault = "set_default"
+)
+
 func Apply(cfg Config, p ConfigPatch) (Config, error) {
+	return ApplyTracked(cfg, p, "", "", nil)
+}
+
+// Write records one dotted-key change made while applying a ConfigPatch. Value
+// is the value at Key after the write.
+type Write struct {
+	Key      string `json:"key"`
+	Action   string `json:"action"`
+	Source   string `json:"source,omitempty"`
+	Op       string `json:"op,omitempty"`
+	Value    any    `json:"value,omitempty"`
+	Previous any    `json:"previous,omitempty"`
+	Existed  bool   `json:"existed"`
+}
+
+// Provenance is the ordered list of writes that produced a config.
+type Provenance struct {
+	Writes []Write `json:"writes"`
+}
+
+// Explain returns the writes that touched key, either directly or through a
+// parent or child path, oldest first.
+func (p *Provenance) Explain(key string) []Write {
+	if p == nil {
+		return nil
+	}
+	key = joinDotted(splitDotted(key))
+	var out []Write
+	for _, w := range p.Writes {
+		if KeysOverlap(w.Key, key) {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// KeysOverlap reports whether two normalized dotted keys are equal or one is a
+// parent path of the other.
+func KeysOverlap(a, b string) bool {
+	return a == b || strings.HasPrefix(a, b+".") || strings.HasPrefix(b, a+".")
+}
+
+// ApplyTracked is Apply that appends a Write per changed key to prov,
+// attributed to source (usually a plugin id) and op. prov may be nil.
+func ApplyTracked(cfg Config, p ConfigPatch, source, op string, prov *Provenance) (Config, error) {
 	if cfg == nil {
 		cfg = Config{}
 	}
+
+	for _, key := range sortedKeys(p.Test) {
+		got, ok := Lookup(cfg, key)
+		if !ok {
+			return nil, errors.Errorf("test %q: key is not set", key)
+		}
+		if !jsonEqual(got, p.Test[key]) {
+			return nil, errors.Errorf("test %q: value differs", key)
+		}
+	}
+
+	var root any = cfg
+	write := func(key, action string, fn func(old any, exists bool) (any, bool, error)) error {
+		parts := splitDotted(key)
+		if len(parts) == 0 {
+			return errors.Errorf("empty dotted key")
+		}
+		prev, existed := getPath(root, parts)
+		var changed bool
+		next, err := setPath(root, parts, key, func(old any, exists bool) (any, error) {
+			v, ok, err := fn(old, exists)
+			changed = ok
+			return v, err
+		})
+		if err != nil {
+			return err
+		}
+		root = next
+		if prov != nil && changed {
+			value, _ := getPath(root, parts)
+			prov.Writes = append(prov.Writes, Write{
+				Key:      joinDotted(parts),
+				Action:   action,
+				Source:   source,
+				Op:       op,
+				Value:    deepCopy(value),
+				Previous: deepCopy(prev),
+				Existed:  existed,
+			})
+		}
+		return nil
+	}
+
 	for _, key := range p.Unset {
-		if err := unsetDotted(cfg, key); err != nil {
+		parts := splitDotted(key)
+		if len(parts) == 0 {
+			return nil, errors.Errorf("empty dotted key")
+		}
+		prev, existed := getPath(root, parts)
+		next, err := deletePath(root, parts, key)
+		if err != nil {
+			return nil, err
+		}
+		root = next
+		if prov != nil {
+			prov.Writes = append(prov.Writes, Write{
+				Key:      joinDotted(parts),
+				Action:   ActionUnset,
+				Source:   source,
+				Op:       op,
+				Previous: deepCopy(prev),
+				Existed:  existed,
+			})
+		}
+	}
+	for _, key := range sortedKeys(p.Set) {
+		value := p.Set[key]
+		if err := write(key, ActionSet, func(any, bool) (any, bool, error) { return value, true, nil }); err != nil {
 			return nil, err
 		}
 	}
-	for key, value := range p.Set {
-		if err := setDotted(cfg, key, value); err != nil {
+	for _, key := range sortedKeys(p.Replace) {
+		value := p.Replace[key]
+		err := write(key, ActionReplace, func(_ any, exists bool) (any, bool, error) {
+			if !exists {
+				return nil, false, errors.Errorf("cannot replace %q: key is not set", key)
+			}
+			return value, true, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range sortedKeys(p.Merge) {
+		value := p.Merge[key]
+		err := write(key, ActionMerge, func(old any, exists bool) (any, bool, error) {
+			src, ok := value.(map[string]any)
+			if !ok {
+				return nil, false, errors.Errorf("cannot merge %q: value is not an object", key)
+			}
+			if !exists || old == nil {
+				return deepCopy(src), true, nil
+			}
+			dst, ok := old.(map[string]any)
+			if !ok {
+				return nil, false, errors.Errorf("cannot merge %q: existing value is not an object", key)
+			}
+			return deepMerge(dst, src), true, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range sortedKeys(p.Append) {
+		value := p.Append[key]
+		err := write(key, ActionAppend, func(old any, exists bool) (any, bool, error) {
+			items, ok := value.([]any)
+			if !ok {
+				items = []any{value}
+			}
+			if !exists || old == nil {
+				return append([]any{}, items...), true, nil
+			}
+			list, ok := old.([]any)
+			if !ok {
+				return nil, false, errors.Errorf("cannot append to %q: existing value is not a list", key)
+			}
+			return append(list, items...), true, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range sortedKeys(p.SetDefault) {
+		value := p.SetDefault[key]
+		err := write(key, ActionSetDefault, func(old any, exists bool) (any, bool, error) {
+			if exists {
+				return old, false, nil
+			}
+			return value, true, nil
+		})
+		if err != nil {
 			return nil, err
 		}
 	}
 	return cfg, nil
 }
 
+// Merge combines two patches so that applying the result approximates applying
+// a then b: map ops let b win per key (set_default lets a win), merge values
+// are deep-merged, appends are concatenated and unsets are de-duplicated.
+// Since unsets apply first, whatever b unsets is taken out of a's writes, and
+// since merges and appends apply after sets, so is whatever b sets or replaces.
 func Merge(a, b ConfigPatch) ConfigPatch {
-	out := ConfigPatch{
-		Set:   map[string]any{},
-		Unset: []string{},
-	}
-	for k, v := range a.Set {
-		out.Set[k] = v
+	out := ConfigPatch{Unset: []string{}}
+	overwritten := append(sortedKeys(b.Set), sortedKeys(b.Replace)...)
+	aSet := withoutUnset(a.Set, b.Unset)
+	aReplace := withoutUnset(a.Replace, b.Unset)
+	aMerge := withoutUnset(withoutUnset(a.Merge, b.Unset), overwritten)
+	aAppend := withoutBelow(withoutUnset(a.Append, b.Unset), overwritten)
+	aSetDefault := withoutUnset(a.SetDefault, b.Unset)
+	out.Set = laterWins(aSet, b.Set)
+	out.Test = laterWins(a.Test, b.Test)
+	out.Replace = laterWins(aReplace, b.Replace)
+	out.SetDefault = laterWins(b.SetDefault, aSetDefault)
+	if len(aMerge)+len(b.Merge) > 0 {
+		out.Merge = map[string]any{}
+		for _, m := range []map[string]any{aMerge, b.Merge} {
+			for k, v := range m {
+				prev, okPrev := out.Merge[k].(map[string]any)
+				next, okNext := v.(map[string]any)
+				if okPrev && okNext {
+					out.Merge[k] = deepMerge(prev, next)
+					continue
+				}
+				out.Merge[k] = deepCopy(v)
+			}
+		}
 	}
-	for k, v := range b.Set {
-		out.Set[k] = v
+	if len(aAppend)+len(b.Append) > 0 {
+		out.Append = map[string]any{}
+		for _, m := range []map[string]any{aAppend, b.Append} {
+			for k, v := range m {
+				items, ok := v.([]any)
+				if !ok {
+					items = []any{v}
+				}
+				prev, _ := out.Append[k].([]any)
+				out.Append[k] = append(append([]any{}, prev...), items...)
+			}
+		}
 	}
 	seen := map[string]struct{}{}
 	for _, k := range append(append([]string{}, a.Unset...), b.Unset...) {
@@ -52,64 +283,312 @@ func Merge(a, b ConfigPatch) ConfigPatch {
 	return out
 }
 
-func setDotted(cfg Config, dotted string, value any) error {
-	parts := splitDotted(dotted)
-	if len(parts) == 0 {
-		return errors.Errorf("empty dotted key")
+// withoutUnset returns the writes in m less what unsetting keys afterwards
+// would remove: writes at or below an unset key are dropped, and an unset
+// below a written key is applied to a copy of the value.
+func withoutUnset(m map[string]any, unset []string) map[string]any {
+	if len(m) == 0 || len(unset) == 0 {
+		return m
 	}
-
-	current := cfg
-	for i := 0; i < len(parts)-1; i++ {
-		part := parts[i]
-		next, ok := current[part]
-		if !ok {
-			child := map[string]any{}
-			current[part] = child
-			current = child
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	for _, u := range unset {
+		up := splitDotted(u)
+		if len(up) == 0 {
 			continue
 		}
-		asMap, ok := next.(map[string]any)
-		if !ok {
-			return errors.Errorf("cannot set %q: path segment %q is not an object", dotted, part)
+		for k, v := range out {
+			kp := splitDotted(k)
+			switch {
+			case hasPrefix(kp, up):
+				delete(out, k)
+			case hasPrefix(up, kp):
+				if next, err := deletePath(deepCopy(v), up[len(kp):], u); err == nil {
+					out[k] = next
+				}
+			}
 		}
-		current = asMap
 	}
+	return out
+}
 
-	current[parts[len(parts)-1]] = value
-	return nil
+// withoutBelow returns the writes in m less those at or below one of keys.
+func withoutBelow(m map[string]any, keys []string) map[string]any {
+	if len(m) == 0 || len(keys) == 0 {
+		return m
+	}
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	for _, key := range keys {
+		kp := splitDotted(key)
+		for k := range out {
+			if len(kp) > 0 && hasPrefix(splitDotted(k), kp) {
+				delete(out, k)
+			}
+		}
+	}
+	return out
 }
 
-func unsetDotted(cfg Config, dotted string) error {
+func hasPrefix(parts, prefix []string) bool {
+	if len(prefix) > len(parts) {
+		return false
+	}
+	for i := range prefix {
+		if parts[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Lookup returns the value at a dotted key and whether it is present.
+func Lookup(cfg Config, dotted string) (any, bool) {
 	parts := splitDotted(dotted)
 	if len(parts) == 0 {
-		return errors.Errorf("empty dotted key")
+		return nil, false
 	}
+	return getPath(cfg, parts)
+}
 
-	current := cfg
-	for i := 0; i < len(parts)-1; i++ {
-		part := parts[i]
-		next, ok := current[part]
-		if !ok {
-			return nil
+func getPath(root any, parts []string) (any, bool) {
+	current := root
+	for _, part := range parts {
+		switch c := current.(type) {
+		case map[string]any:
+			next, ok := c[part]
+			if !ok {
+				return nil, false
+			}
+			current = next
+		case []any:
+			idx, err := strconv.Atoi(part)
+			if err != nil || idx < 0 || idx >= len(c) {
+				return nil, false
+			}
+			current = c[idx]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// setPath replaces the value at parts with fn(old, exists), creating missing
+// intermediate objects. It returns the (possibly new) container. In a list, "-"
+// addresses the position after the last element.
+func setPath(container any, parts []string, dotted string, fn func(old any, exists bool) (any, error)) (any, error) {
+	part := parts[0]
+	switch c := container.(type) {
+	case map[string]any:
+		child, exists := c[part]
+		if len(parts) == 1 {
+			v, err := fn(child, exists)
+			if err != nil {
+				return nil, err
+			}
+			c[part] = v
+			return c, nil
+		}
+		if !exists {
+			child = map[string]any{}
+		}
+		next, err := setPath(child, parts[1:], dotted, fn)
+		if err != nil {
+			return nil, err
+		}
+		c[part] = next
+		return c, nil
+	case []any:
+		idx := len(c)
+		if part != "-" {
+			var err error
+			idx, err = strconv.Atoi(part)
+			if err != nil || idx < 0 || idx > len(c) {
+				return nil, errors.Errorf("cannot set %q: invalid list index %q", dotted, part)
+			}
 		}
-		asMap, ok := next.(map[string]any)
+		var child any
+		exists := idx < len(c)
+		if exists {
+			child = c[idx]
+		}
+		var v any
+		var err error
+		if len(parts) == 1 {
+			v, err = fn(child, exists)
+		} else {
+			if !exists {
+				child = map[string]any{}
+			}
+			v, err = setPath(child, parts[1:], dotted, fn)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			c[idx] = v
+			return c, nil
+		}
+		return append(c, v), nil
+	default:
+		return nil, errors.Errorf("cannot set %q: path segment %q is not an object or list", dotted, part)
+	}
+}
+
+// deletePath removes the value at parts and returns the (possibly new)
+// container. Removing a list element shifts the later ones down, like RFC 6902
+// "remove". Missing keys are not an error.
+func deletePath(container any, parts []string, dotted string) (any, error) {
+	part := parts[0]
+	last := len(parts) == 1
+	switch c := container.(type) {
+	case map[string]any:
+		if last {
+			delete(c, part)
+			return c, nil
+		}
+		child, ok := c[part]
 		if !ok {
-			return errors.Errorf("cannot unset %q: path segment %q is not an object", dotted, part)
+			return c, nil
+		}
+		next, err := deletePath(child, parts[1:], dotted)
+		if err != nil {
+			return nil, err
+		}
+		c[part] = next
+		return c, nil
+	case []any:
+		idx, err := strconv.Atoi(part)
+		if err != nil || idx < 0 || idx >= len(c) {
+			return c, nil
+		}
+		if last {
+			out := make([]any, 0, len(c)-1)
+			return append(append(out, c[:idx]...), c[idx+1:]...), nil
+		}
+		next, err := deletePath(c[idx], parts[1:], dotted)
+		if err != nil {
+			return nil, err
 		}
-		current = asMap
+		c[idx] = next
+		return c, nil
+	default:
+		return nil, errors.Errorf("cannot unset %q: path segment %q is not an object", dotted, part)
 	}
-	delete(current, parts[len(parts)-1])
-	return nil
 }
 
+// splitDotted splits a dotted key, honoring "\." for literal dots and "\\" for
+// literal backslashes. Empty segments are dropped.
 func splitDotted(dotted string) []string {
-	raw := strings.Split(dotted, ".")
-	out := make([]string, 0, len(raw))
-	for _, p := range raw {
-		if p == "" {
-			continue
+	var out []string
+	var cur strings.Builder
+	escaped := false
+	for _, r := range dotted {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '.':
+			if cur.Len() > 0 {
+				out = append(out, cur.String())
+			}
+			cur.Reset()
+		default:
+			cur.WriteRune(r)
 		}
-		out = append(out, p)
+	}
+	if cur.Len() > 0 {
+		out = append(out, cur.String())
+	}
+	return out
+}
+
+func joinDotted(parts []string) string {
+	escaped := make([]string, len(parts))
+	for i, p := range parts {
+		p = strings.ReplaceAll(p, `\`, `\\`)
+		escaped[i] = strings.ReplaceAll(p, ".", `\.`)
+	}
+	return strings.Join(escaped, ".")
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func laterWins(a, b map[string]any) map[string]any {
+	if len(a)+len(b) == 0 {
+		return nil
+	}
+	out := make(map[string]any, len(a)+len(b))
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, v := range b {
+		out[k] = v
 	}
 	return out
 }
+
+// deepMerge merges src into a copy of dst; nested objects merge recursively and
+// everything else in src replaces the value in dst.
+func deepMerge(dst, src map[string]any) map[string]any {
+	out := deepCopy(dst).(map[string]any)
+	for k, v := range src {
+		if sm, ok := v.(map[string]any); ok {
+			if dm, ok := out[k].(map[string]any); ok {
+				out[k] = deepMerge(dm, sm)
+				continue
+			}
+		}
+		out[k] = deepCopy(v)
+	}
+	return out
+}
+
+// jsonEqual compares values the way they would compare on the wire, so that
+// int 1 and float64 1 are equal.
+func jsonEqual(a, b any) bool {
+	ab, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bb, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return string(ab) == string(bb)
+}
+
+// deepCopy snapshots maps and slices so that recorded values are not changed
+// by later writes into the same config tree.
+func deepCopy(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, vv := range t {
+			out[k] = deepCopy(vv)
+		}
+		return out
+	case []any:
+		out := make([]any, len(t))
+		for i, vv := range t {
+			out[i] = deepCopy(vv)
+		}
+		return out
+	default:
+		return v
+	}
+}
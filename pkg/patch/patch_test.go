@@ -37,3 +37,124 @@ func TestMerge_LaterWins(t *testing.T) {
 		t.Fatalf("expected 2, got %#v", out.Set["a.b"])
 	}
 }
+
+func TestApplyTracked_RecordsChain(t *testing.T) {
+	prov := &Provenance{}
+	cfg, err := ApplyTracked(Config{}, ConfigPatch{Set: map[string]any{"services.api.port": 8080}}, "base", "config.mutate", prov)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ApplyTracked(cfg, ConfigPatch{Set: map[string]any{"services.api.port": 8081}}, "local", "config.mutate", prov); err != nil {
+		t.Fatal(err)
+	}
+
+	chain := prov.Explain("services.api.port")
+	if len(chain) != 2 {
+		t.Fatalf("expected 2 writes, got %#v", chain)
+	}
+	if chain[1].Source != "local" || !chain[1].Existed || chain[1].Previous.(int) != 8080 {
+		t.Fatalf("unexpected second write: %#v", chain[1])
+	}
+	if len(prov.Explain("services.api")) != 2 || len(prov.Explain("services.web")) != 0 {
+		t.Fatalf("unexpected prefix matching")
+	}
+}
+
+func TestApply_RicherOps(t *testing.T) {
+	cfg := Config{
+		"services": map[string]any{"api": map[string]any{"port": 8080, "env": map[string]any{"A": "1"}}},
+		"hosts":    []any{"a"},
+	}
+	out, err := Apply(cfg, ConfigPatch{
+		Test:       map[string]any{"services.api.port": 8080},
+		Merge:      map[string]any{"services.api.env": map[string]any{"B": "2"}},
+		Append:     map[string]any{"hosts": []any{"b", "c"}},
+		SetDefault: map[string]any{"services.api.port": 9999, "services.api.host": "localhost"},
+		Set:        map[string]any{"hosts.0": "z", `domains.example\.com`: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := Lookup(out, "services.api.env.A"); v != "1" {
+		t.Fatalf("merge dropped existing key: %#v", v)
+	}
+	if v, _ := Lookup(out, "services.api.env.B"); v != "2" {
+		t.Fatalf("merge did not add key: %#v", v)
+	}
+	if v, _ := Lookup(out, "services.api.port"); v != 8080 {
+		t.Fatalf("set_default overwrote: %#v", v)
+	}
+	if v, _ := Lookup(out, "hosts.2"); v != "c" {
+		t.Fatalf("append: %#v", out["hosts"])
+	}
+	if v, _ := Lookup(out, "hosts.0"); v != "z" {
+		t.Fatalf("index set: %#v", out["hosts"])
+	}
+	if _, ok := out["domains"].(map[string]any)["example.com"]; !ok {
+		t.Fatalf("escaped dot: %#v", out["domains"])
+	}
+
+	if _, err := Apply(out, ConfigPatch{Test: map[string]any{"services.api.port": 1}}); err == nil {
+		t.Fatal("expected failing test op")
+	}
+	if _, err := Apply(out, ConfigPatch{Replace: map[string]any{"services.web.port": 1}}); err == nil {
+		t.Fatal("expected replace of missing key to fail")
+	}
+}
+
+func TestApply_UnsetRemovesListElement(t *testing.T) {
+	cfg := Config{"hosts": []any{"a", "b", "c"}, "nested": map[string]any{"l": []any{map[string]any{"x": 1}, "y"}}}
+	out, err := Apply(cfg, ConfigPatch{Unset: []string{"hosts.1", "nested.l.0.x", "hosts.9"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := out["hosts"].([]any)
+	if len(hosts) != 2 || hosts[0] != "a" || hosts[1] != "c" {
+		t.Fatalf("expected [a c], got %#v", hosts)
+	}
+	if v, ok := Lookup(out, "nested.l.0"); !ok || len(v.(map[string]any)) != 0 {
+		t.Fatalf("expected empty object, got %#v", v)
+	}
+
+	out, err = Apply(Config{"l": []any{map[string]any{"x": 1}}}, ConfigPatch{Unset: []string{"l.0"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := out["l"].([]any); len(l) != 0 {
+		t.Fatalf("expected empty list, got %#v", l)
+	}
+}
+
+func TestMerge_SetThenUnset(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b ConfigPatch
+	}{
+		{"same key", ConfigPatch{Set: map[string]any{"a.b": 1}}, ConfigPatch{Unset: []string{"a.b"}}},
+		{"child of unset", ConfigPatch{Set: map[string]any{"a.x.c": 1}, SetDefault: map[string]any{"a.d": 2}}, ConfigPatch{Unset: []string{"a"}}},
+		{"unset inside set", ConfigPatch{Set: map[string]any{"a": map[string]any{"b": 1, "c": 2}}}, ConfigPatch{Unset: []string{"a.b"}}},
+		{"unset then set", ConfigPatch{Unset: []string{"a.b"}}, ConfigPatch{Set: map[string]any{"a.b": 3}}},
+		{"append then unset", ConfigPatch{Append: map[string]any{"l": "x"}}, ConfigPatch{Unset: []string{"l"}, Append: map[string]any{"l": "y"}}},
+		{"merge then set", ConfigPatch{Merge: map[string]any{"a": map[string]any{"b": 1, "c": 2}}}, ConfigPatch{Set: map[string]any{"a.b": 3}}},
+		{"merge then replace", ConfigPatch{Merge: map[string]any{"a": map[string]any{"c": 2}}}, ConfigPatch{Replace: map[string]any{"a": map[string]any{"d": 4}}}},
+		{"append then set", ConfigPatch{Append: map[string]any{"l": "x"}}, ConfigPatch{Set: map[string]any{"l": []any{"y"}}}},
+		{"append then set element", ConfigPatch{Append: map[string]any{"l": "x"}}, ConfigPatch{Set: map[string]any{"l.0": "y"}}},
+	}
+	for _, tc := range cases {
+		base := func() Config { return Config{"a": map[string]any{"b": 0, "e": 5}, "l": []any{"w"}} }
+		seq, err := Apply(base(), tc.a)
+		if err == nil {
+			seq, err = Apply(seq, tc.b)
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		merged, err := Apply(base(), Merge(tc.a, tc.b))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if !jsonEqual(seq, merged) {
+			t.Fatalf("%s: sequential %#v, merged %#v", tc.name, seq, merged)
+		}
+	}
+}
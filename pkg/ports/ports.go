@@ -0,0 +1,246 @@
+// Package ports assigns named TCP ports to a repo instance and finds out who
+// holds a port. Assignments live in ports.json in the instance's state dir so a
+// name keeps its port across runs; plugins read them from config as
+// ports.<name>.
+package ports
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/go-go-golems/devctl/pkg/state"
+	"github.com/pkg/errors"
+)
+
+const Filename = "ports.json"
+
+// Assigned ports are picked from [rangeStart, rangeEnd) when a request has no
+// usable preference.
+const (
+	rangeStart = 20000
+	rangeEnd   = 40000
+)
+
+// Named instances shift preferred ports by a multiple of instanceStride, so
+// `web: 3000` becomes e.g. 3700 in a second worktree instead of a random port.
+const (
+	instanceStride = 100
+	instanceSlots  = 50
+)
+
+// Requests maps port names to a preferred port (0 for any).
+type Requests map[string]int
+
+// Add merges other into r; an existing non-zero preference wins.
+func (r Requests) Add(other Requests) {
+	for name, pref := range other {
+		if cur, ok := r[name]; !ok || cur == 0 {
+			r[name] = pref
+		}
+	}
+}
+
+type file struct {
+	Ports map[string]int `json:"ports"`
+}
+
+func Path(repoRoot, instance string) string {
+	return filepath.Join(state.Dir(repoRoot, instance), Filename)
+}
+
+// Offset is what a named instance adds to preferred ports: 0 for the default
+// instance, otherwise a stable multiple of 100 derived from the name.
+func Offset(instance string) int {
+	if instance == "" {
+		return 0
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(instance))
+	return instanceStride * (1 + int(h.Sum32()%instanceSlots))
+}
+
+// Load returns the persisted assignments (empty if none).
+func Load(repoRoot, instance string) (map[string]int, error) {
+	b, err := os.ReadFile(Path(repoRoot, instance))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]int{}, nil
+		}
+		return nil, errors.Wrap(err, "read ports")
+	}
+	var f file
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, errors.Wrapf(err, "parse %s", Filename)
+	}
+	if f.Ports == nil {
+		f.Ports = map[string]int{}
+	}
+	return f.Ports, nil
+}
+
+// Save writes assignments to the instance's ports.json.
+func Save(repoRoot, instance string, assigned map[string]int) error {
+	path := Path(repoRoot, instance)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return errors.Wrap(err, "mkdir state dir")
+	}
+	b, err := json.MarshalIndent(file{Ports: assigned}, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshal ports")
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0o644); err != nil {
+		return errors.Wrap(err, "write ports")
+	}
+	return errors.Wrap(os.Rename(tmp, path), "rename ports")
+}
+
+// Allocate returns a port for every requested name and saves new
+// assignments. Names that already have a port keep it, even if something else
+// holds it now (Conflicts reports that); new names get their preference
+// (shifted by the instance Offset) when free, else a free port from a range
+// seeded by the repo, instance and name.
+func Allocate(repoRoot, instance string, reqs Requests) (map[string]int, error) {
+	return allocate(repoRoot, instance, reqs, true)
+}
+
+// Preview is Allocate without saving: what a later Allocate would most likely
+// assign, for commands that must not change ports.json.
+func Preview(repoRoot, instance string, reqs Requests) (map[string]int, error) {
+	return allocate(repoRoot, instance, reqs, false)
+}
+
+func allocate(repoRoot, instance string, reqs Requests, save bool) (map[string]int, error) {
+	assigned, err := Load(repoRoot, instance)
+	if err != nil {
+		return nil, err
+	}
+	taken := map[int]bool{}
+	for _, p := range assigned {
+		taken[p] = true
+	}
+
+	names := make([]string, 0, len(reqs))
+	for name := range reqs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := make(map[string]int, len(reqs))
+	changed := false
+	for _, name := range names {
+		if p, ok := assigned[name]; ok {
+			out[name] = p
+			continue
+		}
+		preferred := reqs[name]
+		if preferred > 0 {
+			preferred += Offset(instance)
+		}
+		p, err := pick(repoRoot+"\x00"+instance, name, preferred, taken)
+		if err != nil {
+			return nil, err
+		}
+		taken[p] = true
+		assigned[name] = p
+		out[name] = p
+		changed = true
+	}
+	if changed && save {
+		if err := Save(repoRoot, instance, assigned); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// Release forgets the given names (all when empty) so the next Allocate picks
+// fresh ports.
+func Release(repoRoot, instance string, names []string) error {
+	assigned, err := Load(repoRoot, instance)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		assigned = map[string]int{}
+	}
+	for _, n := range names {
+		if _, ok := assigned[n]; !ok {
+			return errors.Errorf("no port assigned to %q", n)
+		}
+		delete(assigned, n)
+	}
+	return Save(repoRoot, instance, assigned)
+}
+
+func pick(seed, name string, preferred int, taken map[int]bool) (int, error) {
+	if preferred > 0 && preferred < 65536 && !taken[preferred] && free(preferred) {
+		return preferred, nil
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(seed + "\x00" + name))
+	span := rangeEnd - rangeStart
+	start := int(h.Sum32() % uint32(span))
+	for i := 0; i < span; i++ {
+		p := rangeStart + (start+i)%span
+		if !taken[p] && free(p) {
+			return p, nil
+		}
+	}
+	return 0, errors.Errorf("no free port for %q in %d-%d", name, rangeStart, rangeEnd-1)
+}
+
+// free reports whether port can be bound on all interfaces.
+func free(port int) bool {
+	l, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return false
+	}
+	_ = l.Close()
+	return true
+}
+
+// Claim is a port the caller is about to listen on.
+type Claim struct {
+	Port  int
+	Owner string // e.g. "ports.api" or "service web health"
+}
+
+// Conflict is a claimed port that is already in use.
+type Conflict struct {
+	Claim
+	Holder Holder
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("port %d (%s) is in use by %s", c.Port, c.Owner, c.Holder)
+}
+
+// Conflicts returns the claims whose port is being listened on.
+func Conflicts(claims []Claim) ([]Conflict, error) {
+	want := make([]int, 0, len(claims))
+	for _, c := range claims {
+		want = append(want, c.Port)
+	}
+	holders, err := Listeners(want)
+	procOK := err == nil
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		return nil, err
+	}
+	var out []Conflict
+	for _, c := range claims {
+		if h, ok := holders[c.Port]; ok {
+			out = append(out, Conflict{Claim: c, Holder: h})
+		} else if !procOK && !free(c.Port) {
+			// No /proc/net/tcp (not Linux): a failed bind is all we know.
+			out = append(out, Conflict{Claim: c})
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,152 @@
+package ports
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// freePort returns a port that was free a moment ago.
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	p := l.Addr().(*net.TCPAddr).Port
+	require.NoError(t, l.Close())
+	return p
+}
+
+func TestAllocate(t *testing.T) {
+	root := t.TempDir()
+	want := freePort(t)
+	held, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	defer func() { _ = held.Close() }()
+	busy := held.Addr().(*net.TCPAddr).Port
+
+	got, err := Allocate(root, "", Requests{"web": want, "api": busy, "any": 0})
+	require.NoError(t, err)
+	require.Equal(t, want, got["web"], "free preference is used")
+	require.NotEqual(t, busy, got["api"], "busy preference falls back to the range")
+	for _, name := range []string{"api", "any"} {
+		require.GreaterOrEqual(t, got[name], rangeStart)
+		require.Less(t, got[name], rangeEnd)
+	}
+	require.NotEqual(t, got["api"], got["any"])
+
+	saved, err := Load(root, "")
+	require.NoError(t, err)
+	require.Equal(t, got, saved)
+
+	// Assigned names keep their port even when it is busy now.
+	l, err := net.Listen("tcp", ":"+strconv.Itoa(got["web"]))
+	require.NoError(t, err)
+	defer func() { _ = l.Close() }()
+	again, err := Allocate(root, "", Requests{"web": 1234})
+	require.NoError(t, err)
+	require.Equal(t, got["web"], again["web"])
+}
+
+func TestAllocate_NamedInstanceShiftsPreference(t *testing.T) {
+	root := t.TempDir()
+	base := freePort(t)
+	shifted := base + Offset("pr-1")
+	if shifted >= 65536 || !free(shifted) {
+		t.Skip("shifted port is not usable")
+	}
+	got, err := Allocate(root, "pr-1", Requests{"web": base})
+	require.NoError(t, err)
+	require.Equal(t, shifted, got["web"])
+	_, err = os.Stat(Path(root, "pr-1"))
+	require.NoError(t, err)
+}
+
+func TestOffset(t *testing.T) {
+	require.Equal(t, 0, Offset(""))
+	for _, name := range []string{"pr-1", "feature-x", "a"} {
+		o := Offset(name)
+		require.Equal(t, o, Offset(name), "stable")
+		require.Zero(t, o%instanceStride)
+		require.GreaterOrEqual(t, o, instanceStride)
+		require.LessOrEqual(t, o, instanceStride*instanceSlots)
+	}
+	// Pinned so a hash change does not silently move every worktree's ports.
+	require.Equal(t, 3400, Offset("pr-1"))
+	require.Equal(t, 2700, Offset("pr-2"))
+}
+
+func TestPreview_DoesNotSave(t *testing.T) {
+	root := t.TempDir()
+	got, err := Preview(root, "", Requests{"web": 0})
+	require.NoError(t, err)
+	require.NotZero(t, got["web"])
+	_, err = os.Stat(Path(root, ""))
+	require.True(t, os.IsNotExist(err))
+
+	// Allocate then picks the same port for the same seed.
+	allocated, err := Allocate(root, "", Requests{"web": 0})
+	require.NoError(t, err)
+	require.Equal(t, got, allocated)
+}
+
+func TestPick(t *testing.T) {
+	free1 := freePort(t)
+	cases := []struct {
+		name      string
+		preferred int
+		taken     map[int]bool
+		exact     bool
+	}{
+		{"free preference", free1, nil, true},
+		{"taken by another name", free1, map[int]bool{free1: true}, false},
+		{"out of range", 70000, nil, false},
+		{"no preference", 0, nil, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p, err := pick("seed", "web", c.preferred, c.taken)
+			require.NoError(t, err)
+			if c.exact {
+				require.Equal(t, c.preferred, p)
+				return
+			}
+			require.GreaterOrEqual(t, p, rangeStart)
+			require.Less(t, p, rangeEnd)
+			require.False(t, c.taken[p])
+		})
+	}
+
+	a, _ := pick("seed", "web", 0, nil)
+	b, _ := pick("seed", "web", 0, nil)
+	require.Equal(t, a, b, "same seed and name pick the same port")
+}
+
+func TestRelease(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, Save(root, "", map[string]int{"web": 3000, "api": 3001}))
+	require.Error(t, Release(root, "", []string{"db"}))
+	require.NoError(t, Release(root, "", []string{"web"}))
+	got, err := Load(root, "")
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"api": 3001}, got)
+}
+
+func TestScanTCP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tcp")
+	// 0x1F90 = 8080 listening, 0x0BB8 = 3000 established, 0x1F91 = 8081 not wanted.
+	content := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 111 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:0BB8 0100007F:D431 01 00000000:00000000 00:00000000 00000000  1000        0 222 1 0000000000000000 20 4 30 10 -1
+   2: 00000000:1F91 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 333 1 0000000000000000 100 0 0 10 0
+   3: garbage
+`
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	inodes := map[string]int{}
+	require.NoError(t, scanTCP(path, map[int]bool{8080: true, 3000: true}, inodes))
+	require.Equal(t, map[string]int{"111": 8080}, inodes)
+
+	require.Error(t, scanTCP(filepath.Join(t.TempDir(), "missing"), nil, inodes))
+}
@@ -0,0 +1,120 @@
+package ports
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// tcpListen is the socket state of a listening socket in /proc/net/tcp.
+const tcpListen = "0A"
+
+// Holder is the process listening on a port. PID is 0 when the socket belongs
+// to a process we cannot inspect (another user, another network namespace).
+type Holder struct {
+	PID     int
+	Command string
+}
+
+func (h Holder) String() string {
+	if h.PID == 0 {
+		return "another process"
+	}
+	if h.Command == "" {
+		return fmt.Sprintf("pid %d", h.PID)
+	}
+	return fmt.Sprintf("pid %d (%s)", h.PID, h.Command)
+}
+
+// Listeners reads /proc/net/tcp{,6} and returns the holder of each listening
+// port in ports. It fails with a not-exist error where /proc is unavailable.
+func Listeners(ports []int) (map[int]Holder, error) {
+	want := map[int]bool{}
+	for _, p := range ports {
+		want[p] = true
+	}
+	inodes := map[string]int{} // socket inode -> port
+	found := false
+	for _, name := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		err := scanTCP(name, want, inodes)
+		if os.IsNotExist(errors.Cause(err)) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found = true
+	}
+	if !found {
+		return nil, errors.Wrap(os.ErrNotExist, "/proc/net/tcp")
+	}
+
+	out := map[int]Holder{}
+	for _, port := range inodes {
+		out[port] = Holder{}
+	}
+	if len(inodes) > 0 {
+		resolvePIDs(inodes, out)
+	}
+	return out, nil
+}
+
+func scanTCP(path string, want map[int]bool, inodes map[string]int) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "open %s", path)
+	}
+	defer func() { _ = f.Close() }()
+
+	sc := bufio.NewScanner(f)
+	sc.Scan() // header
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 10 || fields[3] != tcpListen {
+			continue
+		}
+		_, hexPort, ok := strings.Cut(fields[1], ":")
+		if !ok {
+			continue
+		}
+		port, err := strconv.ParseInt(hexPort, 16, 32)
+		if err != nil || !want[int(port)] {
+			continue
+		}
+		inodes[fields[9]] = int(port)
+	}
+	return errors.Wrapf(sc.Err(), "read %s", path)
+}
+
+// resolvePIDs maps socket inodes to processes via /proc/<pid>/fd.
+func resolvePIDs(inodes map[string]int, out map[int]Holder) {
+	procs, _ := os.ReadDir("/proc")
+	for _, p := range procs {
+		pid, err := strconv.Atoi(p.Name())
+		if err != nil {
+			continue
+		}
+		fdDir := filepath.Join("/proc", p.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			port, ok := inodes[strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")]
+			if !ok || out[port].PID != 0 {
+				continue
+			}
+			comm, _ := os.ReadFile(filepath.Join("/proc", p.Name(), "comm"))
+			out[port] = Holder{PID: pid, Command: strings.TrimSpace(string(comm))}
+		}
+	}
+}
@@ -46,6 +46,7 @@ type RequestContext struct {
 	Cwd        string `json:"cwd,omitempty"`
 	DeadlineMs int64  `json:"deadline_ms,omitempty"`
 	DryRun     bool   `json:"dry_run,omitempty"`
+	Instance   string `json:"instance,omitempty"`
 }
 
 type Request struct {
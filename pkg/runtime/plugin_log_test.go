@@ -0,0 +1,44 @@
+package runtime
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPluginLog_SanitizesID(t *testing.T) {
+	dir := t.TempDir()
+	for _, id := range []string{"../escape", "a/b", ".hidden", ""} {
+		l, err := openPluginLog(dir, id, 0, 0)
+		require.NoError(t, err)
+		l.WriteLine("hello")
+		require.NoError(t, l.Close())
+
+		files, err := PluginLogFiles(dir, id)
+		require.NoError(t, err)
+		require.Len(t, files, 1, id)
+		require.Equal(t, dir, filepath.Dir(files[0]))
+	}
+	require.Regexp(t, `^_\._escape~[0-9a-f]{8}$`, logFileID("../escape"))
+	require.Equal(t, "my-plugin.v2", logFileID("my-plugin.v2"))
+}
+
+func TestPluginLog_IDsSanitizingAlikeKeepSeparateFiles(t *testing.T) {
+	dir := t.TempDir()
+	ids := []string{"a/b", "a:b", "a_b"}
+	for _, id := range ids {
+		l, err := openPluginLog(dir, id, 0, 0)
+		require.NoError(t, err)
+		l.WriteLine(id)
+		require.NoError(t, l.Close())
+	}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		files, err := PluginLogFiles(dir, id)
+		require.NoError(t, err)
+		require.Len(t, files, 1, id)
+		require.False(t, seen[files[0]], id)
+		seen[files[0]] = true
+	}
+}
@@ -311,3 +311,26 @@ func TestRuntime_TelemetryStreamFixture(t *testing.T) {
 	}
 	require.Equal(t, []int{0, 1, 2}, got)
 }
+
+func TestPluginLog_RotatesAndPrunes(t *testing.T) {
+	dir := t.TempDir()
+
+	// A file for a plugin whose id shares our prefix must be left alone.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "p-mock-20260101-000000.000.log"), []byte("x\n"), 0o600))
+
+	l, err := openPluginLog(dir, "p", 10, 2)
+	require.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		l.WriteLine("some stderr line")
+		time.Sleep(2 * time.Millisecond)
+	}
+	require.NoError(t, l.Close())
+
+	files, err := PluginLogFiles(dir, "p")
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	others, err := PluginLogFiles(dir, "p-mock")
+	require.NoError(t, err)
+	require.Len(t, others, 1)
+}
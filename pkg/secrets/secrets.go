@@ -0,0 +1,146 @@
+// Package secrets resolves secret references such as "pass:dev/db" or
+// "file:.env.local#DB_PASSWORD" at launch time. Values are handed to the
+// service process only; callers must never persist them.
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-go-golems/devctl/pkg/dotenv"
+	"github.com/pkg/errors"
+)
+
+// Provider resolves the part of a reference after "<name>:".
+type Provider interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// ProviderFunc adapts a function to Provider.
+type ProviderFunc func(ctx context.Context, ref string) (string, error)
+
+func (f ProviderFunc) Resolve(ctx context.Context, ref string) (string, error) { return f(ctx, ref) }
+
+// Registry maps provider names to providers.
+type Registry struct {
+	providers map[string]Provider
+}
+
+// NewRegistry returns a registry with the built-in providers for repoRoot:
+//
+//	env:NAME            variable from devctl's own environment
+//	file:PATH#KEY       key from a dotenv file (PATH relative to the repo root)
+//	pass:NAME           first line of `pass show NAME`
+//	exec:COMMAND        stdout of `sh -c COMMAND`, run in the repo root
+//
+// commands adds named providers from .devctl.yaml: each runs `sh -c COMMAND`
+// with the reference as $1.
+func NewRegistry(repoRoot string, commands map[string]string) *Registry {
+	r := &Registry{providers: map[string]Provider{
+		"env": ProviderFunc(func(ctx context.Context, ref string) (string, error) {
+			v, ok := os.LookupEnv(ref)
+			if !ok {
+				return "", errors.Errorf("environment variable %s is not set", ref)
+			}
+			return v, nil
+		}),
+		"file": ProviderFunc(func(ctx context.Context, ref string) (string, error) {
+			path, key, ok := strings.Cut(ref, "#")
+			if !ok || key == "" {
+				return "", errors.New("expected file:PATH#KEY")
+			}
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(repoRoot, path)
+			}
+			env, err := dotenv.ReadFile(path)
+			if err != nil {
+				return "", err
+			}
+			v, ok := env[key]
+			if !ok {
+				return "", errors.Errorf("%s not found in %s", key, path)
+			}
+			return v, nil
+		}),
+		"pass": ProviderFunc(func(ctx context.Context, ref string) (string, error) {
+			out, err := run(ctx, repoRoot, "pass", "show", ref)
+			if err != nil {
+				return "", err
+			}
+			first, _, _ := strings.Cut(out, "\n")
+			return first, nil
+		}),
+		"exec": ProviderFunc(func(ctx context.Context, ref string) (string, error) {
+			return run(ctx, repoRoot, "sh", "-c", ref)
+		}),
+	}}
+	for name, command := range commands {
+		command := command
+		r.providers[name] = ProviderFunc(func(ctx context.Context, ref string) (string, error) {
+			return run(ctx, repoRoot, "sh", "-c", command, "devctl-secret", ref)
+		})
+	}
+	return r
+}
+
+// Register adds or replaces a provider.
+func (r *Registry) Register(name string, p Provider) {
+	r.providers[name] = p
+}
+
+// Resolve resolves a "<provider>:<ref>" reference.
+func (r *Registry) Resolve(ctx context.Context, ref string) (string, error) {
+	name, rest, ok := strings.Cut(ref, ":")
+	if !ok {
+		return "", errors.Errorf("secret reference %q: expected <provider>:<ref>", ref)
+	}
+	p, ok := r.providers[name]
+	if !ok {
+		return "", errors.Errorf("secret reference %q: unknown provider %q (have %s)", ref, name, strings.Join(r.names(), ", "))
+	}
+	v, err := p.Resolve(ctx, rest)
+	if err != nil {
+		return "", errors.Wrapf(err, "secret %s", ref)
+	}
+	return v, nil
+}
+
+// ResolveAll resolves every value of refs (env var -> reference).
+func (r *Registry) ResolveAll(ctx context.Context, refs map[string]string) (map[string]string, error) {
+	out := make(map[string]string, len(refs))
+	for k, ref := range refs {
+		v, err := r.Resolve(ctx, ref)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s", k)
+		}
+		out[k] = v
+	}
+	return out, nil
+}
+
+func (r *Registry) names() []string {
+	names := make([]string, 0, len(r.providers))
+	for n := range r.providers {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func run(ctx context.Context, dir string, name string, args ...string) (string, error) {
+	// #nosec G204 -- secret commands are configured in the repo spec.
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", errors.Wrapf(err, "%s: %s", name, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
@@ -0,0 +1,68 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_BuiltinProviders(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, ".env.local"), []byte("export DB_PASSWORD=\"s3cr\\\"et\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DEVCTL_TEST_SECRET", "from-env")
+	r := NewRegistry(root, nil)
+
+	cases := map[string]string{
+		"env:DEVCTL_TEST_SECRET":      "from-env",
+		"file:.env.local#DB_PASSWORD": `s3cr"et`,
+		"exec:printf 'line1\\n'; pwd": "line1\n" + root,
+	}
+	for ref, want := range cases {
+		got, err := r.Resolve(context.Background(), ref)
+		if err != nil {
+			t.Fatalf("%s: %v", ref, err)
+		}
+		if got != want {
+			t.Fatalf("%s: got %q, want %q", ref, got, want)
+		}
+	}
+}
+
+func TestRegistry_CommandProviderGetsRef(t *testing.T) {
+	r := NewRegistry(t.TempDir(), map[string]string{"vault": `echo "secret-for-$1"`})
+	got, err := r.ResolveAll(context.Background(), map[string]string{"DB_PASS": "vault:dev/db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["DB_PASS"] != "secret-for-dev/db" {
+		t.Fatalf("got %q", got["DB_PASS"])
+	}
+}
+
+func TestRegistry_Errors(t *testing.T) {
+	root := t.TempDir()
+	r := NewRegistry(root, map[string]string{"broken": "echo denied >&2; exit 1"})
+	cases := map[string]string{
+		"no-colon":              "expected <provider>:<ref>",
+		"nope:x":                `unknown provider "nope"`,
+		"env:DEVCTL_TEST_UNSET": "is not set",
+		"file:.env":             "expected file:PATH#KEY",
+		"file:missing.env#K":    "no such file",
+		"broken:x":              "denied",
+	}
+	for ref, want := range cases {
+		_, err := r.Resolve(context.Background(), ref)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: want error containing %q, got %v", ref, want, err)
+		}
+	}
+
+	_, err := r.ResolveAll(context.Background(), map[string]string{"API_KEY": "nope:x"})
+	if err == nil || !strings.HasPrefix(err.Error(), "API_KEY: ") {
+		t.Fatalf("ResolveAll should name the variable, got %v", err)
+	}
+}
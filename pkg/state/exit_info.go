@@ -18,6 +18,10 @@ type ExitInfo struct {
 	ExitCode *int   `json:"exit_code,omitempty"`
 	Signal   string `json:"signal,omitempty"`
 	Error    string `json:"error,omitempty"`
+	// OOMKilled is set when the kernel killed the service for exceeding
+	// MemoryLimit (bytes) in its cgroup.
+	OOMKilled   bool  `json:"oom_killed,omitempty"`
+	MemoryLimit int64 `json:"memory_limit,omitempty"`
 
 	StderrTail []string `json:"stderr_tail,omitempty"`
 	StdoutTail []string `json:"stdout_tail,omitempty"`
@@ -0,0 +1,67 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// InstanceEnvVar selects the instance when --instance is not given.
+const InstanceEnvVar = "DEVCTL_INSTANCE"
+
+// DefaultInstance is how the default instance ("") is shown and referenced.
+const DefaultInstance = "default"
+
+// InstanceName returns name for display, mapping "" to DefaultInstance.
+func InstanceName(name string) string {
+	if name == "" {
+		return DefaultInstance
+	}
+	return name
+}
+
+var instanceRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ValidateInstance checks that name is usable as a directory and in container
+// or database names.
+func ValidateInstance(name string) error {
+	if name == "" || instanceRe.MatchString(name) {
+		return nil
+	}
+	return errors.Errorf("invalid instance name %q (use letters, digits, '.', '_' and '-')", name)
+}
+
+// ResolveInstance picks the instance for repoRoot: explicit, then
+// $DEVCTL_INSTANCE, then the directory name of a linked git worktree. The main
+// checkout is the default instance ("").
+func ResolveInstance(repoRoot, explicit string) (string, error) {
+	name := explicit
+	if name == "" {
+		name = os.Getenv(InstanceEnvVar)
+	}
+	if name == "" && isLinkedWorktree(repoRoot) {
+		name = filepath.Base(repoRoot)
+	}
+	if name == DefaultInstance {
+		name = ""
+	}
+	if err := ValidateInstance(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// isLinkedWorktree reports whether repoRoot is a `git worktree add` checkout:
+// its .git is a file pointing into <main>/.git/worktrees/ (submodules point
+// into .git/modules/ instead).
+func isLinkedWorktree(repoRoot string) bool {
+	b, err := os.ReadFile(filepath.Join(repoRoot, ".git"))
+	if err != nil {
+		return false
+	}
+	gitdir, ok := strings.CutPrefix(strings.TrimSpace(string(b)), "gitdir:")
+	return ok && strings.Contains(filepath.ToSlash(gitdir), "/worktrees/")
+}
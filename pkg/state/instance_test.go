@@ -0,0 +1,74 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// worktree creates a checkout whose .git file holds gitdir.
+func worktree(t *testing.T, name, gitdir string) string {
+	root := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.Mkdir(root, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, ".git"), []byte("gitdir: "+gitdir+"\n"), 0o644))
+	return root
+}
+
+func TestIsLinkedWorktree(t *testing.T) {
+	main := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(main, ".git"), 0o755))
+
+	cases := []struct {
+		name string
+		root string
+		want bool
+	}{
+		{"main checkout", main, false},
+		{"no git", t.TempDir(), false},
+		{"linked worktree", worktree(t, "pr-1", "/src/app/.git/worktrees/pr-1"), true},
+		{"submodule", worktree(t, "lib", "../.git/modules/lib"), false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.want, isLinkedWorktree(c.root))
+		})
+	}
+}
+
+func TestResolveInstance(t *testing.T) {
+	plain := t.TempDir()
+	linked := worktree(t, "pr-1", "/src/app/.git/worktrees/pr-1")
+
+	cases := []struct {
+		name, root, explicit, env, want string
+	}{
+		{"main checkout", plain, "", "", ""},
+		{"linked worktree", linked, "", "", "pr-1"},
+		{"env wins over worktree", linked, "", "review", "review"},
+		{"explicit wins over env", linked, "mine", "review", "mine"},
+		{"default name", linked, DefaultInstance, "", ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Setenv(InstanceEnvVar, c.env)
+			got, err := ResolveInstance(c.root, c.explicit)
+			require.NoError(t, err)
+			require.Equal(t, c.want, got)
+		})
+	}
+
+	t.Setenv(InstanceEnvVar, "")
+	_, err := ResolveInstance(plain, "../escape")
+	require.Error(t, err)
+	_, err = ResolveInstance(worktree(t, "has space", "/src/app/.git/worktrees/x"), "")
+	require.Error(t, err)
+}
+
+func TestDir_NamespacesInstances(t *testing.T) {
+	root := "/repo"
+	require.Equal(t, filepath.Join(root, StateDirName), Dir(root, ""))
+	require.Equal(t, filepath.Join(root, StateDirName, InstancesDirName, "pr-1"), Dir(root, "pr-1"))
+	require.NotEqual(t, LogsDir(root, ""), LogsDir(root, "pr-1"))
+}
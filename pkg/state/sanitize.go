@@ -1,6 +1,7 @@
 package state
 
 import (
+	"net/url"
 	"strings"
 )
 
@@ -19,8 +20,8 @@ var sensitiveKeyPatterns = []string{
 	"PASSPHRASE",
 }
 
-// redactedValue is the placeholder for redacted values.
-const redactedValue = "[REDACTED]"
+// RedactedValue is the placeholder for redacted values.
+const RedactedValue = "[REDACTED]"
 
 // SanitizeEnv returns a copy of the environment map with sensitive values redacted.
 // Keys containing patterns like PASSWORD, SECRET, TOKEN, KEY, CREDENTIAL, etc.
@@ -33,14 +34,31 @@ func SanitizeEnv(env map[string]string) map[string]string {
 	result := make(map[string]string, len(env))
 	for k, v := range env {
 		if isSensitiveKey(k) {
-			result[k] = redactedValue
+			result[k] = RedactedValue
 		} else {
-			result[k] = v
+			result[k] = redactURLPassword(v)
 		}
 	}
 	return result
 }
 
+// redactURLPassword hides the password in values like postgres://u:pw@host/db.
+func redactURLPassword(v string) string {
+	if !strings.Contains(v, "://") || !strings.Contains(v, "@") {
+		return v
+	}
+	u, err := url.Parse(v)
+	if err != nil || u.User == nil {
+		return v
+	}
+	if _, ok := u.User.Password(); !ok {
+		return v
+	}
+	userinfo := u.User.String()
+	user, _, _ := strings.Cut(userinfo, ":")
+	return strings.Replace(v, userinfo+"@", user+":"+RedactedValue+"@", 1)
+}
+
 // isSensitiveKey checks if a key name indicates sensitive data.
 func isSensitiveKey(key string) bool {
 	upper := strings.ToUpper(key)
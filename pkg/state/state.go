@@ -10,6 +10,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/go-go-golems/devctl/pkg/proc"
 	"github.com/pkg/errors"
 )
 
@@ -17,16 +18,25 @@ const (
 	StateDirName  = ".devctl"
 	StateFilename = "state.json"
 	LogsDirName   = "logs"
+
+	PluginLogsDirName = "plugins"
+	InstancesDirName  = "instances"
 )
 
 type State struct {
-	RepoRoot  string          `json:"repo_root"`
-	CreatedAt time.Time       `json:"created_at"`
+	RepoRoot  string    `json:"repo_root"`
+	CreatedAt time.Time `json:"created_at"`
+	Profile   string    `json:"profile,omitempty"`
+	Instance  string    `json:"instance,omitempty"`
+	// Workspace is the workspace file when the services come from several
+	// repos (named <repo>.<service>).
+	Workspace string          `json:"workspace,omitempty"`
 	Services  []ServiceRecord `json:"services"`
 }
 
 type ServiceRecord struct {
 	Name      string            `json:"name"`
+	Kind      string            `json:"kind,omitempty"` // "job" for one-shot jobs
 	PID       int               `json:"pid"`
 	Command   []string          `json:"command"`
 	Cwd       string            `json:"cwd"`
@@ -34,7 +44,29 @@ type ServiceRecord struct {
 	StdoutLog string            `json:"stdout_log"`
 	StderrLog string            `json:"stderr_log"`
 	ExitInfo  string            `json:"exit_info,omitempty"`
-	StartedAt time.Time         `json:"started_at,omitempty"` // When the process was started
+	// CombinedLog is the NDJSON log of both streams with receive times
+	// (logs.combined); see logfiles.Line.
+	CombinedLog string `json:"combined_log,omitempty"`
+	// LogParsers are the logjs modules (absolute paths) for reading the logs.
+	LogParsers []string  `json:"log_parsers,omitempty"`
+	StartedAt  time.Time `json:"started_at,omitempty"` // When the process was started
+	// EnvFiles and SecretKeys name what was injected; values are never stored.
+	EnvFiles   []string `json:"env_files,omitempty"`
+	SecretKeys []string `json:"secret_keys,omitempty"`
+	// EnvPolicy, EnvAllow and EffectiveEnv describe the environment the
+	// process got, sanitized, with every env_file and secret value redacted.
+	EnvPolicy    string            `json:"env_policy,omitempty"`
+	EnvAllow     []string          `json:"env_allow,omitempty"`
+	EffectiveEnv map[string]string `json:"effective_env,omitempty"`
+
+	// Wrapper is set when PID is the __wrap-service process, which relays
+	// signals to the service's process group.
+	Wrapper bool `json:"wrapper,omitempty"`
+	// How to stop the service; see engine.ServiceSpec.
+	StopSignal    string   `json:"stop_signal,omitempty"`
+	StopTimeoutMs int64    `json:"stop_timeout_ms,omitempty"`
+	PreStop       *PreStop `json:"pre_stop,omitempty"`
+	PostStop      *Hook    `json:"post_stop,omitempty"`
 
 	// Health check configuration (if any)
 	HealthType    string `json:"health_type,omitempty"`    // "tcp"|"http"
@@ -42,16 +74,121 @@ type ServiceRecord struct {
 	HealthURL     string `json:"health_url,omitempty"`     // For HTTP checks
 }
 
-func StatePath(repoRoot string) string {
-	return filepath.Join(repoRoot, StateDirName, StateFilename)
+// PreStop mirrors engine.PreStop.
+type PreStop struct {
+	Command   []string `json:"command,omitempty"`
+	URL       string   `json:"url,omitempty"`
+	Method    string   `json:"method,omitempty"`
+	TimeoutMs int64    `json:"timeout_ms,omitempty"`
+}
+
+// Hook mirrors engine.Hook.
+type Hook struct {
+	Command   []string `json:"command"`
+	TimeoutMs int64    `json:"timeout_ms,omitempty"`
+}
+
+// SetService replaces the record with rec's name, or appends rec.
+func (s *State) SetService(rec ServiceRecord) {
+	for i := range s.Services {
+		if s.Services[i].Name == rec.Name {
+			s.Services[i] = rec
+			return
+		}
+	}
+	s.Services = append(s.Services, rec)
+}
+
+// LogPaths lists the log and exit info files of the recorded services; log
+// cleanup keeps the runs they belong to.
+func (s *State) LogPaths() []string {
+	if s == nil {
+		return nil
+	}
+	var out []string
+	for _, rec := range s.Services {
+		out = append(out, rec.StdoutLog, rec.StderrLog, rec.ExitInfo, rec.CombinedLog)
+	}
+	return out
+}
+
+// Job outcomes reported by ServiceRecord.JobStatus.
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+func (r ServiceRecord) IsJob() bool { return r.Kind == "job" }
+
+// JobStatus reports how a job is doing, with its exit info once it finished.
+// The exit info wins over the PID, which may have been reused since.
+func (r ServiceRecord) JobStatus() (string, *ExitInfo) {
+	ei, err := ReadExitInfo(r.ExitInfo)
+	if err != nil {
+		if r.Alive() {
+			return JobRunning, nil
+		}
+		return JobFailed, nil
+	}
+	if ei.ExitCode != nil && *ei.ExitCode == 0 {
+		return JobSucceeded, ei
+	}
+	return JobFailed, ei
+}
+
+// startSlack covers the one-second resolution of process start times.
+const startSlack = 2 * time.Second
+
+// Alive reports whether the record's process is still running. A live PID
+// whose process started after the record did has been reused.
+func (r ServiceRecord) Alive() bool {
+	if !ProcessAlive(r.PID) {
+		return false
+	}
+	if r.StartedAt.IsZero() {
+		return true
+	}
+	started, err := proc.GetProcessStartTime(r.PID)
+	if err != nil {
+		return true
+	}
+	return !started.After(r.StartedAt.Add(startSlack))
+}
+
+// Dir is the state directory of an instance: .devctl for the default instance
+// (""), .devctl/instances/<name> otherwise.
+func Dir(repoRoot, instance string) string {
+	if instance == "" {
+		return filepath.Join(repoRoot, StateDirName)
+	}
+	return filepath.Join(repoRoot, StateDirName, InstancesDirName, instance)
 }
 
-func LogsDir(repoRoot string) string {
-	return filepath.Join(repoRoot, StateDirName, LogsDirName)
+// UserDir is the per-user devctl state directory, $XDG_STATE_HOME/devctl
+// (~/.local/state/devctl by default). Unlike Dir it lives outside any repo.
+func UserDir() (string, error) {
+	base := os.Getenv("XDG_STATE_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", errors.Wrap(err, "locate home directory")
+		}
+		base = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(base, "devctl"), nil
 }
 
-func Load(repoRoot string) (*State, error) {
-	path := StatePath(repoRoot)
+func StatePath(repoRoot, instance string) string {
+	return filepath.Join(Dir(repoRoot, instance), StateFilename)
+}
+
+func LogsDir(repoRoot, instance string) string {
+	return filepath.Join(Dir(repoRoot, instance), LogsDirName)
+}
+
+func Load(repoRoot, instance string) (*State, error) {
+	path := StatePath(repoRoot, instance)
 	b, err := os.ReadFile(path)
 	if err != nil {
 		return nil, errors.Wrap(err, "read state")
@@ -63,11 +200,11 @@ func Load(repoRoot string) (*State, error) {
 	return &s, nil
 }
 
-func Save(repoRoot string, s *State) error {
+func Save(repoRoot, instance string, s *State) error {
 	if s == nil {
 		return errors.New("nil state")
 	}
-	dir := filepath.Dir(StatePath(repoRoot))
+	dir := Dir(repoRoot, instance)
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return errors.Wrap(err, "mkdir state dir")
 	}
@@ -75,14 +212,14 @@ func Save(repoRoot string, s *State) error {
 	if err != nil {
 		return errors.Wrap(err, "marshal state")
 	}
-	if err := os.WriteFile(StatePath(repoRoot), b, 0o644); err != nil {
+	if err := os.WriteFile(StatePath(repoRoot, instance), b, 0o600); err != nil {
 		return errors.Wrap(err, "write state")
 	}
 	return nil
 }
 
-func Remove(repoRoot string) error {
-	path := StatePath(repoRoot)
+func Remove(repoRoot, instance string) error {
+	path := StatePath(repoRoot, instance)
 	if err := os.Remove(path); err != nil {
 		if os.IsNotExist(err) {
 			return nil
@@ -128,3 +265,7 @@ func isZombie(pid int) bool {
 	}
 	return fields[0][0] == 'Z'
 }
+
+func PluginLogsDir(repoRoot, instance string) string {
+	return filepath.Join(LogsDir(repoRoot, instance), PluginLogsDirName)
+}
@@ -0,0 +1,55 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-go-golems/devctl/pkg/proc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceRecord_AliveDetectsPIDReuse(t *testing.T) {
+	started, err := proc.GetProcessStartTime(os.Getpid())
+	if err != nil {
+		t.Skip("no /proc start times")
+	}
+	require.True(t, ServiceRecord{PID: os.Getpid()}.Alive())
+	require.True(t, ServiceRecord{PID: os.Getpid(), StartedAt: started}.Alive())
+	require.False(t, ServiceRecord{PID: os.Getpid(), StartedAt: started.Add(-time.Hour)}.Alive(), "PID now belongs to a newer process")
+	require.False(t, ServiceRecord{PID: 0, StartedAt: time.Now()}.Alive())
+}
+
+func TestServiceRecord_JobStatus(t *testing.T) {
+	dir := t.TempDir()
+	zero, one := 0, 1
+	exit := func(name string, code *int) string {
+		path := filepath.Join(dir, name+".exit.json")
+		require.NoError(t, WriteExitInfo(path, ExitInfo{Service: name, ExitCode: code}))
+		return path
+	}
+	started, err := proc.GetProcessStartTime(os.Getpid())
+	if err != nil {
+		started = time.Now()
+	}
+
+	cases := []struct {
+		name string
+		rec  ServiceRecord
+		want string
+	}{
+		{"running", ServiceRecord{PID: os.Getpid(), StartedAt: started, ExitInfo: filepath.Join(dir, "none")}, JobRunning},
+		{"succeeded", ServiceRecord{PID: -1, ExitInfo: exit("ok", &zero)}, JobSucceeded},
+		{"failed", ServiceRecord{PID: -1, ExitInfo: exit("bad", &one)}, JobFailed},
+		{"gone without exit info", ServiceRecord{PID: -1, ExitInfo: filepath.Join(dir, "none")}, JobFailed},
+		// The job finished and its PID was handed to a live process.
+		{"reused pid", ServiceRecord{PID: os.Getpid(), StartedAt: started, ExitInfo: exit("reused", &zero)}, JobSucceeded},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, _ := c.rec.JobStatus()
+			require.Equal(t, c.want, got)
+		})
+	}
+}
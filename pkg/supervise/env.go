@@ -0,0 +1,96 @@
+package supervise
+
+import (
+	"strings"
+
+	"github.com/go-go-golems/devctl/pkg/engine"
+	"github.com/go-go-golems/devctl/pkg/state"
+	"github.com/pkg/errors"
+)
+
+// baseEnvKeys survive the "allowlist" and "clean" policies; without them most
+// toolchains cannot find binaries, the home directory or a temp dir.
+var baseEnvKeys = []string{"PATH", "HOME", "USER", "LOGNAME", "SHELL", "TMPDIR", "LANG", "LC_ALL", "TZ", "TERM"}
+
+// inheritedEnv filters environ (KEY=VALUE pairs) according to policy.
+func inheritedEnv(policy *engine.EnvPolicy, environ []string) ([]string, error) {
+	mode := engine.EnvInheritAll
+	if policy != nil && policy.Inherit != "" {
+		mode = policy.Inherit
+	}
+	var allow []string
+	switch mode {
+	case engine.EnvInheritAll:
+		return environ, nil
+	case engine.EnvInheritAllowlist:
+		allow = append(append(allow, baseEnvKeys...), policy.Allow...)
+	case engine.EnvInheritClean:
+		allow = baseEnvKeys
+	default:
+		return nil, errors.Errorf("unknown env_policy.inherit %q (want all, allowlist or clean)", mode)
+	}
+
+	out := make([]string, 0, len(allow))
+	for _, kv := range environ {
+		k, _, _ := strings.Cut(kv, "=")
+		if envAllowed(k, allow) {
+			out = append(out, kv)
+		}
+	}
+	return out, nil
+}
+
+func envAllowed(key string, allow []string) bool {
+	for _, a := range allow {
+		if strings.HasSuffix(a, "*") {
+			if strings.HasPrefix(key, strings.TrimSuffix(a, "*")) {
+				return true
+			}
+		} else if a == key {
+			return true
+		}
+	}
+	return false
+}
+
+// effectiveEnv is the final environment as recorded in state: sanitized, with
+// the values of hiddenKeys (env files and secrets) redacted.
+func effectiveEnv(environ []string, hiddenKeys []string) map[string]string {
+	env := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		k, v, _ := strings.Cut(kv, "=")
+		env[k] = v
+	}
+	env = state.SanitizeEnv(env)
+	for _, k := range hiddenKeys {
+		if _, ok := env[k]; ok {
+			env[k] = state.RedactedValue
+		}
+	}
+	return env
+}
+
+// hiddenKeys are the keys of hidden that svc.Env does not override.
+func hiddenKeys(hidden, specEnv map[string]string) []string {
+	keys := make([]string, 0, len(hidden))
+	for k := range hidden {
+		if _, ok := specEnv[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func policyName(policy *engine.EnvPolicy) string {
+	if policy == nil || policy.Inherit == "" {
+		return engine.EnvInheritAll
+	}
+	return policy.Inherit
+}
+
+func policyAllow(policy *engine.EnvPolicy) []string {
+	if policyName(policy) != engine.EnvInheritAllowlist {
+		return nil
+	}
+	return policy.Allow
+}
@@ -0,0 +1,117 @@
+package supervise
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/go-go-golems/devctl/pkg/engine"
+	"github.com/go-go-golems/devctl/pkg/state"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// Lifecycle hooks, as reported in HookResult.Hook.
+const (
+	HookPreStart  = "pre_start"
+	HookPostStart = "post_start"
+	HookPreStop   = "pre_stop"
+	HookPostStop  = "post_stop"
+)
+
+// HookResult describes a finished lifecycle hook.
+type HookResult struct {
+	Service  string
+	Hook     string
+	Duration time.Duration
+	Err      error
+}
+
+// reportHook hands r to Options.OnHook, or logs it.
+func (s *Supervisor) reportHook(r HookResult) {
+	if s.opts.OnHook != nil {
+		s.opts.OnHook(r)
+		return
+	}
+	if r.Err != nil {
+		log.Warn().Err(r.Err).Str("service", r.Service).Str("hook", r.Hook).Msg("hook failed")
+		return
+	}
+	log.Info().Str("service", r.Service).Str("hook", r.Hook).Dur("took", r.Duration).Msg("hook done")
+}
+
+// runHook runs one hook of service with its output appended to the logs.
+func (s *Supervisor) runHook(ctx context.Context, service, which string, h *engine.Hook, cwd string, env []string, stdoutLog, stderrLog string) error {
+	if h == nil {
+		return nil
+	}
+	start := time.Now()
+	err := runHookCommand(ctx, h.Command, h.TimeoutMs, 60*time.Second, cwd, env, stdoutLog, stderrLog)
+	if err != nil {
+		err = errors.Wrapf(err, "service %q %s", service, which)
+	}
+	s.reportHook(HookResult{Service: service, Hook: which, Duration: time.Since(start), Err: err})
+	return err
+}
+
+func runHookCommand(ctx context.Context, command []string, timeoutMs int64, def time.Duration, cwd string, env []string, stdoutLog, stderrLog string) error {
+	timeout := def
+	if timeoutMs > 0 {
+		timeout = time.Duration(timeoutMs) * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	stdout, err := os.OpenFile(stdoutLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return errors.Wrap(err, "open stdout log")
+	}
+	defer func() { _ = stdout.Close() }()
+	stderr, err := os.OpenFile(stderrLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return errors.Wrap(err, "open stderr log")
+	}
+	defer func() { _ = stderr.Close() }()
+
+	// #nosec G204 -- hook is configured in the repo spec.
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Dir = cwd
+	cmd.Env = env
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return errors.Errorf("timed out after %s", timeout)
+		}
+		return errors.Errorf("%v (output in %s)", err, stderrLog)
+	}
+	return nil
+}
+
+// plainEnv is devctl's environment, filtered by the service's recorded
+// env_policy, plus the record's env vars that were not redacted; hooks run
+// after start have no access to secrets.
+func plainEnv(rec state.ServiceRecord) []string {
+	env, err := inheritedEnv(&engine.EnvPolicy{Inherit: rec.EnvPolicy, Allow: rec.EnvAllow}, os.Environ())
+	if err != nil {
+		// Unknown policy in an old or edited record: inherit the least.
+		env, _ = inheritedEnv(&engine.EnvPolicy{Inherit: engine.EnvInheritClean}, os.Environ())
+	}
+	plain := make(map[string]string, len(rec.Env))
+	for k, v := range rec.Env {
+		if v != state.RedactedValue {
+			plain[k] = v
+		}
+	}
+	return mergeEnv(env, plain)
+}
+
+func checkHooks(svc engine.ServiceSpec) error {
+	for i, h := range []*engine.Hook{svc.PreStart, svc.PostStart, svc.PostStop} {
+		if h != nil && len(h.Command) == 0 {
+			return errors.Errorf("%s needs a command", []string{HookPreStart, HookPostStart, HookPostStop}[i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package supervise
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/devctl/pkg/engine"
+	"github.com/go-go-golems/devctl/pkg/limits"
+	"github.com/go-go-golems/devctl/pkg/state"
+	"github.com/pkg/errors"
+)
+
+// startOrder checks kinds, limits, hooks, stop settings and depends_on and returns the plan's services so
+// that each comes after its dependencies, otherwise in plan order.
+func startOrder(plan engine.LaunchPlan) ([]engine.ServiceSpec, error) {
+	byName := make(map[string]engine.ServiceSpec, len(plan.Services))
+	for _, svc := range plan.Services {
+		switch svc.Kind {
+		case "", engine.KindService, engine.KindJob:
+		default:
+			return nil, errors.Errorf("service %q: unknown kind %q (want service or job)", svc.Name, svc.Kind)
+		}
+		if err := checkHooks(svc); err != nil {
+			return nil, errors.Wrapf(err, "service %q", svc.Name)
+		}
+		if err := checkStop(svc); err != nil {
+			return nil, errors.Wrapf(err, "service %q", svc.Name)
+		}
+		if svc.Limits != nil {
+			if err := limits.Check(*svc.Limits); err != nil {
+				return nil, errors.Wrapf(err, "service %q", svc.Name)
+			}
+		}
+		byName[svc.Name] = svc
+	}
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	mark := map[string]int{}
+	out := make([]engine.ServiceSpec, 0, len(plan.Services))
+	var visit func(svc engine.ServiceSpec, path []string) error
+	visit = func(svc engine.ServiceSpec, path []string) error {
+		switch mark[svc.Name] {
+		case done:
+			return nil
+		case visiting:
+			return errors.Errorf("depends_on cycle: %s", strings.Join(append(path, svc.Name), " -> "))
+		}
+		mark[svc.Name] = visiting
+		for _, dep := range svc.DependsOn {
+			d, ok := byName[dep]
+			if !ok {
+				return errors.Errorf("service %q depends on unknown service %q", svc.Name, dep)
+			}
+			if err := visit(d, append(path, svc.Name)); err != nil {
+				return err
+			}
+		}
+		mark[svc.Name] = done
+		out = append(out, svc)
+		return nil
+	}
+	for _, svc := range plan.Services {
+		if err := visit(svc, nil); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// await blocks until l is usable by dependents: ready for a service, exited
+// successfully for a job, and its post_start hook done. Results are cached in
+// done so each is checked once.
+func (s *Supervisor) await(ctx context.Context, l launch, done map[string]error) error {
+	svc := l.spec
+	if err, ok := done[svc.Name]; ok {
+		return err
+	}
+	var err error
+	if svc.IsJob() {
+		jobCtx, cancel := context.WithTimeout(ctx, s.opts.JobTimeout)
+		err = waitJob(jobCtx, l.rec)
+		cancel()
+	} else if svc.Health != nil {
+		readyCtx, cancel := context.WithTimeout(ctx, s.opts.ReadyTimeout)
+		err = waitReady(readyCtx, svc)
+		cancel()
+	}
+	if err == nil {
+		err = s.runHook(ctx, svc.Name, HookPostStart, svc.PostStart, l.rec.Cwd, l.env, l.rec.StdoutLog, l.rec.StderrLog)
+	}
+	done[svc.Name] = err
+	return err
+}
+
+// RunJob starts a job and waits for it to finish. The record is returned also
+// when the job fails, so callers can keep its logs and exit info in state.
+func (s *Supervisor) RunJob(ctx context.Context, svc engine.ServiceSpec) (state.ServiceRecord, error) {
+	if !svc.IsJob() {
+		return state.ServiceRecord{}, errors.Errorf("%q is not a job", svc.Name)
+	}
+	if err := os.MkdirAll(state.LogsDir(s.opts.RepoRoot, s.opts.Instance), 0o755); err != nil {
+		return state.ServiceRecord{}, errors.Wrap(err, "mkdir logs dir")
+	}
+	rec, env, err := s.startService(ctx, svc)
+	if err != nil {
+		return state.ServiceRecord{}, err
+	}
+	return rec, s.await(ctx, launch{spec: svc, rec: rec, env: env}, map[string]error{})
+}
+
+// waitJob waits for the job's exit info and fails unless it exited 0.
+func waitJob(ctx context.Context, rec state.ServiceRecord) error {
+	t := time.NewTicker(100 * time.Millisecond)
+	defer t.Stop()
+	var goneSince time.Time
+	for {
+		if ei, err := state.ReadExitInfo(rec.ExitInfo); err == nil {
+			if ei.ExitCode != nil && *ei.ExitCode == 0 {
+				return nil
+			}
+			return errors.Errorf("job %q failed: %s%s", rec.Name, DescribeExit(ei), stderrHint(ei))
+		}
+		// The exit info is written just before the process goes away; give a
+		// little slack before concluding it never will be.
+		if !rec.Alive() {
+			if goneSince.IsZero() {
+				goneSince = time.Now()
+			} else if time.Since(goneSince) > time.Second {
+				return errors.Errorf("job %q exited without exit info", rec.Name)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "job %q did not finish", rec.Name)
+		case <-t.C:
+		}
+	}
+}
+
+// DescribeExit summarizes how a process ended ("exit 1", "signal: killed",
+// "killed: OOM (limit 2GiB)").
+func DescribeExit(ei *state.ExitInfo) string {
+	switch {
+	case ei.OOMKilled && ei.MemoryLimit > 0:
+		return "killed: OOM (limit " + limits.FormatBytes(ei.MemoryLimit) + ")"
+	case ei.OOMKilled:
+		return "killed: OOM"
+	case ei.Signal != "":
+		return "signal: " + ei.Signal
+	case ei.ExitCode != nil:
+		return fmt.Sprintf("exit %d", *ei.ExitCode)
+	case ei.Error != "":
+		return ei.Error
+	}
+	return "unknown exit"
+}
+
+func stderrHint(ei *state.ExitInfo) string {
+	if len(ei.StderrTail) == 0 {
+		return ""
+	}
+	return "\n  " + strings.Join(ei.StderrTail, "\n  ")
+}
@@ -0,0 +1,70 @@
+package supervise
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-go-golems/devctl/pkg/engine"
+	"github.com/go-go-golems/devctl/pkg/ports"
+	"github.com/pkg/errors"
+)
+
+// checkPorts fails before anything starts if an assigned port, or a port a
+// health check will probe, is already being listened on.
+func checkPorts(plan engine.LaunchPlan, named map[string]int) error {
+	conflicts, err := ports.Conflicts(portClaims(plan, named))
+	if err != nil {
+		return err
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	lines := make([]string, 0, len(conflicts))
+	for _, c := range conflicts {
+		lines = append(lines, "  "+c.String())
+	}
+	return errors.Errorf("ports already in use:\n%s", strings.Join(lines, "\n"))
+}
+
+func portClaims(plan engine.LaunchPlan, named map[string]int) []ports.Claim {
+	seen := map[int]bool{}
+	var claims []ports.Claim
+	add := func(port int, owner string) {
+		if port > 0 && !seen[port] {
+			seen[port] = true
+			claims = append(claims, ports.Claim{Port: port, Owner: owner})
+		}
+	}
+
+	names := make([]string, 0, len(named))
+	for n := range named {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		add(named[n], "ports."+n)
+	}
+	for _, svc := range plan.Services {
+		if svc.Health == nil {
+			continue
+		}
+		owner := fmt.Sprintf("service %s health check", svc.Name)
+		switch svc.Health.Type {
+		case "tcp":
+			if _, p, err := net.SplitHostPort(svc.Health.Address); err == nil {
+				port, _ := strconv.Atoi(p)
+				add(port, owner)
+			}
+		case "http":
+			if u, err := url.Parse(svc.Health.URL); err == nil {
+				port, _ := strconv.Atoi(u.Port())
+				add(port, owner)
+			}
+		}
+	}
+	return claims
+}
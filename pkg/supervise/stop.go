@@ -0,0 +1,152 @@
+package supervise
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-go-golems/devctl/pkg/engine"
+	"github.com/go-go-golems/devctl/pkg/state"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// stopSignals are the signals a service may ask to be stopped with; the
+// wrapper relays all of them.
+var stopSignals = map[string]syscall.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+}
+
+// StopSignals lists the signals the wrapper must relay.
+func StopSignals() []os.Signal {
+	out := make([]os.Signal, 0, len(stopSignals))
+	for _, sig := range stopSignals {
+		out = append(out, sig)
+	}
+	return out
+}
+
+// parseSignal accepts "SIGINT", "INT" or "int"; "" is SIGTERM.
+func parseSignal(name string) (syscall.Signal, error) {
+	if name == "" {
+		return syscall.SIGTERM, nil
+	}
+	n := strings.ToUpper(name)
+	if !strings.HasPrefix(n, "SIG") {
+		n = "SIG" + n
+	}
+	sig, ok := stopSignals[n]
+	if !ok {
+		return 0, errors.Errorf("unsupported stop_signal %q (SIGTERM, SIGINT, SIGQUIT, SIGHUP, SIGUSR1, SIGUSR2)", name)
+	}
+	return sig, nil
+}
+
+func checkStop(svc engine.ServiceSpec) error {
+	if _, err := parseSignal(svc.StopSignal); err != nil {
+		return err
+	}
+	if svc.StopTimeoutMs < 0 {
+		return errors.New("stop_timeout_ms must not be negative")
+	}
+	if ps := svc.PreStop; ps != nil && (len(ps.Command) == 0) == (ps.URL == "") {
+		return errors.New("pre_stop needs exactly one of command and url")
+	}
+	return nil
+}
+
+func setStop(rec *state.ServiceRecord, svc engine.ServiceSpec) {
+	rec.StopSignal = svc.StopSignal
+	rec.StopTimeoutMs = svc.StopTimeoutMs
+	if ps := svc.PreStop; ps != nil {
+		rec.PreStop = &state.PreStop{Command: ps.Command, URL: ps.URL, Method: ps.Method, TimeoutMs: ps.TimeoutMs}
+	}
+	if h := svc.PostStop; h != nil {
+		rec.PostStop = &state.Hook{Command: h.Command, TimeoutMs: h.TimeoutMs}
+	}
+}
+
+// stopService runs pre_stop and signals the service if it is still running;
+// post_stop runs either way, so a crashed service is cleaned up too.
+func (s *Supervisor) stopService(ctx context.Context, rec state.ServiceRecord) error {
+	if rec.PID > 0 && state.ProcessAlive(rec.PID) {
+		if err := s.terminateService(ctx, rec); err != nil {
+			return err
+		}
+	}
+	if h := rec.PostStop; h != nil && !s.skipHook(rec, HookPostStop) {
+		// A failing post_stop is reported; the service is stopped either way.
+		_ = s.runHook(ctx, rec.Name, HookPostStop, &engine.Hook{Command: h.Command, TimeoutMs: h.TimeoutMs}, rec.Cwd, plainEnv(rec), rec.StdoutLog, rec.StderrLog)
+	}
+	return nil
+}
+
+func (s *Supervisor) terminateService(ctx context.Context, rec state.ServiceRecord) error {
+	if rec.PreStop != nil && !s.skipHook(rec, HookPreStop) {
+		start := time.Now()
+		err := runPreStop(ctx, rec)
+		s.reportHook(HookResult{Service: rec.Name, Hook: HookPreStop, Duration: time.Since(start), Err: err})
+	}
+	sig, err := parseSignal(rec.StopSignal)
+	if err != nil {
+		log.Warn().Err(err).Str("service", rec.Name).Msg("using SIGTERM")
+		sig = syscall.SIGTERM
+	}
+	timeout := s.opts.ShutdownTimeout
+	if rec.StopTimeoutMs > 0 {
+		timeout = time.Duration(rec.StopTimeoutMs) * time.Millisecond
+	}
+	log.Debug().Str("service", rec.Name).Str("signal", sig.String()).Dur("timeout", timeout).Msg("stopping service")
+	if err := terminatePIDGroup(ctx, rec.PID, sig, timeout, rec.Wrapper); err != nil {
+		return errors.Wrapf(err, "stop %q", rec.Name)
+	}
+	return nil
+}
+
+func (s *Supervisor) skipHook(rec state.ServiceRecord, hook string) bool {
+	if s.opts.SkipStopHooks {
+		log.Warn().Str("service", rec.Name).Str("hook", hook).Msg("repo not trusted; skipping stop hook")
+	}
+	return s.opts.SkipStopHooks
+}
+
+// runPreStop runs the pre_stop command (output into the service's logs) or
+// sends its HTTP request.
+func runPreStop(ctx context.Context, rec state.ServiceRecord) error {
+	ps := rec.PreStop
+	if len(ps.Command) > 0 {
+		return errors.Wrap(runHookCommand(ctx, ps.Command, ps.TimeoutMs, 10*time.Second, rec.Cwd, plainEnv(rec), rec.StdoutLog, rec.StderrLog), "pre_stop")
+	}
+	timeout := 10 * time.Second
+	if ps.TimeoutMs > 0 {
+		timeout = time.Duration(ps.TimeoutMs) * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	method := ps.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(method), ps.URL, nil)
+	if err != nil {
+		return errors.Wrap(err, "pre_stop request")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "pre_stop request")
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return errors.Errorf("pre_stop %s %s: %s", req.Method, ps.URL, resp.Status)
+	}
+	return nil
+}
@@ -7,11 +7,16 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/go-go-golems/devctl/pkg/dotenv"
 	"github.com/go-go-golems/devctl/pkg/engine"
+	"github.com/go-go-golems/devctl/pkg/logfiles"
+	"github.com/go-go-golems/devctl/pkg/secrets"
 	"github.com/go-go-golems/devctl/pkg/state"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
@@ -19,9 +24,33 @@ import (
 
 type Options struct {
 	RepoRoot        string
+	Instance        string // state and logs go to state.Dir(RepoRoot, Instance)
 	ShutdownTimeout time.Duration
 	ReadyTimeout    time.Duration
-	WrapperExe      string
+	// JobTimeout bounds how long a job may run (default 10 minutes).
+	JobTimeout time.Duration
+	WrapperExe string
+	// Secrets resolves ServiceSpec.Secrets; defaults to the built-in providers.
+	Secrets *secrets.Registry
+	// EnvPolicy applies to services without their own; nil inherits everything.
+	EnvPolicy *engine.EnvPolicy
+	// Ports are the repo's named port assignments; like health check ports,
+	// they must be free before any service starts.
+	Ports map[string]int
+	// OnHook receives lifecycle hook results; by default they are logged.
+	OnHook func(HookResult)
+	// Logs sets log rotation for wrapped services; zero never rotates.
+	Logs logfiles.Policy
+	// SkipStopHooks stops services without their pre_stop and post_stop
+	// commands, for state whose repo is not trusted.
+	SkipStopHooks bool
+}
+
+// launch is a service started by Start that may not be ready yet.
+type launch struct {
+	spec engine.ServiceSpec
+	rec  state.ServiceRecord
+	env  []string
 }
 
 type Supervisor struct {
@@ -35,6 +64,12 @@ func New(opts Options) *Supervisor {
 	if opts.ReadyTimeout <= 0 {
 		opts.ReadyTimeout = 30 * time.Second
 	}
+	if opts.JobTimeout <= 0 {
+		opts.JobTimeout = 10 * time.Minute
+	}
+	if opts.Secrets == nil {
+		opts.Secrets = secrets.NewRegistry(opts.RepoRoot, nil)
+	}
 	return &Supervisor{opts: opts}
 }
 
@@ -42,33 +77,46 @@ func (s *Supervisor) Start(ctx context.Context, plan engine.LaunchPlan) (*state.
 	if s.opts.RepoRoot == "" {
 		return nil, errors.New("missing RepoRoot")
 	}
-	if err := os.MkdirAll(state.LogsDir(s.opts.RepoRoot), 0o755); err != nil {
+	if err := os.MkdirAll(state.LogsDir(s.opts.RepoRoot, s.opts.Instance), 0o755); err != nil {
 		return nil, errors.Wrap(err, "mkdir logs dir")
 	}
+	ordered, err := startOrder(plan)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPorts(plan, s.opts.Ports); err != nil {
+		return nil, err
+	}
 
 	st := &state.State{
 		RepoRoot:  s.opts.RepoRoot,
+		Instance:  s.opts.Instance,
 		CreatedAt: time.Now(),
 		Services:  []state.ServiceRecord{},
 	}
 
-	for _, svc := range plan.Services {
-		rec, err := s.startService(ctx, svc)
+	// Services start as soon as their dependencies are ready (jobs: have
+	// succeeded); whatever nobody depended on is awaited at the end.
+	launched := make(map[string]launch, len(ordered))
+	done := map[string]error{}
+	for _, svc := range ordered {
+		for _, dep := range svc.DependsOn {
+			if err := s.await(ctx, launched[dep], done); err != nil {
+				_ = s.Stop(context.Background(), st)
+				return nil, errors.Wrapf(err, "service %q dependency %q", svc.Name, dep)
+			}
+		}
+		rec, env, err := s.startService(ctx, svc)
 		if err != nil {
 			_ = s.Stop(context.Background(), st)
 			return nil, err
 		}
+		launched[svc.Name] = launch{spec: svc, rec: rec, env: env}
 		st.Services = append(st.Services, rec)
 	}
 
-	for _, svc := range plan.Services {
-		if svc.Health == nil {
-			continue
-		}
-		readyCtx, cancel := context.WithTimeout(ctx, s.opts.ReadyTimeout)
-		err := waitReady(readyCtx, svc)
-		cancel()
-		if err != nil {
+	for _, svc := range ordered {
+		if err := s.await(ctx, launched[svc.Name], done); err != nil {
 			_ = s.Stop(context.Background(), st)
 			return nil, err
 		}
@@ -77,28 +125,29 @@ func (s *Supervisor) Start(ctx context.Context, plan engine.LaunchPlan) (*state.
 	return st, nil
 }
 
+// Stop stops the services in reverse start order, so dependents go before
+// what they depend on. Each runs its pre_stop hook, gets its stop signal and
+// is killed after its stop timeout (default ShutdownTimeout).
 func (s *Supervisor) Stop(ctx context.Context, st *state.State) error {
 	if st == nil {
 		return nil
 	}
 	var lastErr error
-	for _, svc := range st.Services {
-		if svc.PID <= 0 {
-			continue
-		}
-		if err := terminatePIDGroup(ctx, svc.PID, s.opts.ShutdownTimeout); err != nil {
+	for i := len(st.Services) - 1; i >= 0; i-- {
+		if err := s.stopService(ctx, st.Services[i]); err != nil {
 			lastErr = err
 		}
 	}
 	return lastErr
 }
 
-func (s *Supervisor) startService(ctx context.Context, svc engine.ServiceSpec) (state.ServiceRecord, error) {
+// startService launches svc and returns its record and environment.
+func (s *Supervisor) startService(ctx context.Context, svc engine.ServiceSpec) (state.ServiceRecord, []string, error) {
 	if svc.Name == "" {
-		return state.ServiceRecord{}, errors.New("service name is required")
+		return state.ServiceRecord{}, nil, errors.New("service name is required")
 	}
 	if len(svc.Command) == 0 {
-		return state.ServiceRecord{}, errors.Errorf("service %q missing command", svc.Name)
+		return state.ServiceRecord{}, nil, errors.Errorf("service %q missing command", svc.Name)
 	}
 
 	cwd := s.opts.RepoRoot
@@ -110,58 +159,103 @@ func (s *Supervisor) startService(ctx context.Context, svc engine.ServiceSpec) (
 		}
 	}
 
-	ts := time.Now().Format("20060102-150405")
-	stdoutPath := filepath.Join(state.LogsDir(s.opts.RepoRoot), svc.Name+"-"+ts+".stdout.log")
-	stderrPath := filepath.Join(state.LogsDir(s.opts.RepoRoot), svc.Name+"-"+ts+".stderr.log")
-	exitInfoPath := filepath.Join(state.LogsDir(s.opts.RepoRoot), svc.Name+"-"+ts+".exit.json")
-	readyPath := filepath.Join(state.LogsDir(s.opts.RepoRoot), svc.Name+"-"+ts+".ready")
+	// Env files and secrets go into the process environment, never into argv
+	// or state; svc.Env is applied on top.
+	hidden, envFiles, secretKeys, err := s.hiddenEnv(ctx, svc)
+	if err != nil {
+		return state.ServiceRecord{}, nil, err
+	}
+	policy := svc.EnvPolicy
+	if policy == nil {
+		policy = s.opts.EnvPolicy
+	}
+	base, err := inheritedEnv(policy, os.Environ())
+	if err != nil {
+		return state.ServiceRecord{}, nil, errors.Wrapf(err, "service %q", svc.Name)
+	}
+	base = mergeEnv(base, hidden)
+	full := mergeEnv(base, svc.Env)
+
+	ts := logfiles.RunStamp(time.Now())
+	stdoutPath := filepath.Join(state.LogsDir(s.opts.RepoRoot, s.opts.Instance), svc.Name+"-"+ts+".stdout.log")
+	stderrPath := filepath.Join(state.LogsDir(s.opts.RepoRoot, s.opts.Instance), svc.Name+"-"+ts+".stderr.log")
+	exitInfoPath := filepath.Join(state.LogsDir(s.opts.RepoRoot, s.opts.Instance), svc.Name+"-"+ts+".exit.json")
+	readyPath := filepath.Join(state.LogsDir(s.opts.RepoRoot, s.opts.Instance), svc.Name+"-"+ts+".ready")
+	combinedPath := ""
+	if s.opts.Logs.Combined {
+		combinedPath = filepath.Join(state.LogsDir(s.opts.RepoRoot, s.opts.Instance), svc.Name+"-"+ts+".ndjson")
+	}
+
+	if err := s.runHook(ctx, svc.Name, HookPreStart, svc.PreStart, cwd, full, stdoutPath, stderrPath); err != nil {
+		return state.ServiceRecord{}, nil, err
+	}
 
 	if s.opts.WrapperExe == "" {
+		if svc.Limits != nil {
+			log.Warn().Str("service", svc.Name).Msg("limits need the service wrapper; not applied")
+		}
 		stdoutFile, err := os.OpenFile(stdoutPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
 		if err != nil {
-			return state.ServiceRecord{}, errors.Wrap(err, "open stdout log")
+			return state.ServiceRecord{}, nil, errors.Wrap(err, "open stdout log")
 		}
 		defer func() { _ = stdoutFile.Close() }()
 
 		stderrFile, err := os.OpenFile(stderrPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
 		if err != nil {
-			return state.ServiceRecord{}, errors.Wrap(err, "open stderr log")
+			return state.ServiceRecord{}, nil, errors.Wrap(err, "open stderr log")
 		}
 		defer func() { _ = stderrFile.Close() }()
 
 		// #nosec G204 -- command is configured in the repo spec.
 		cmd := exec.CommandContext(ctx, svc.Command[0], svc.Command[1:]...)
 		cmd.Dir = cwd
-		cmd.Env = mergeEnv(os.Environ(), svc.Env)
+		cmd.Env = full
 		cmd.Stdout = stdoutFile
 		cmd.Stderr = stderrFile
 		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 
 		if err := cmd.Start(); err != nil {
-			return state.ServiceRecord{}, errors.Wrap(err, "start service")
+			return state.ServiceRecord{}, nil, errors.Wrap(err, "start service")
 		}
 
 		pid := cmd.Process.Pid
 		startedAt := time.Now()
 		log.Info().Str("service", svc.Name).Int("pid", pid).Msg("service started")
-		go func() { _ = cmd.Wait() }()
+		go func() {
+			waitErr := cmd.Wait()
+			ei := exitInfoOf(svc.Name, pid, startedAt, cmd.ProcessState, waitErr)
+			if lines, err := state.TailLines(stderrPath, 25, 2<<20); err == nil {
+				ei.StderrTail = lines
+			}
+			_ = state.WriteExitInfo(exitInfoPath, ei)
+		}()
 
 		rec := state.ServiceRecord{
 			Name:      svc.Name,
+			Kind:      svc.Kind,
 			PID:       pid,
 			Command:   svc.Command,
 			Cwd:       cwd,
 			Env:       state.SanitizeEnv(svc.Env),
 			StdoutLog: stdoutPath,
 			StderrLog: stderrPath,
+			ExitInfo:  exitInfoPath,
 			StartedAt: startedAt,
+
+			EnvFiles:     envFiles,
+			SecretKeys:   secretKeys,
+			EnvPolicy:    policyName(policy),
+			EnvAllow:     policyAllow(policy),
+			EffectiveEnv: effectiveEnv(full, hiddenKeys(hidden, svc.Env)),
 		}
 		if svc.Health != nil {
 			rec.HealthType = svc.Health.Type
 			rec.HealthAddress = svc.Health.Address
 			rec.HealthURL = svc.Health.URL
 		}
-		return rec, nil
+		setStop(&rec, svc)
+		rec.LogParsers = s.logParsers(svc)
+		return rec, full, nil
 	}
 
 	args := []string{
@@ -176,17 +270,39 @@ func (s *Supervisor) startService(ctx context.Context, svc engine.ServiceSpec) (
 	for k, v := range svc.Env {
 		args = append(args, "--env", k+"="+v)
 	}
+	if l := svc.Limits; l != nil {
+		if l.Memory != "" {
+			args = append(args, "--memory-limit", l.Memory)
+		}
+		if l.CPU > 0 {
+			args = append(args, "--cpu-limit", strconv.FormatFloat(l.CPU, 'f', -1, 64))
+		}
+		if l.OpenFiles > 0 {
+			args = append(args, "--open-files", strconv.FormatUint(l.OpenFiles, 10))
+		}
+		if l.Nice != 0 {
+			args = append(args, "--nice", strconv.Itoa(l.Nice))
+		}
+	}
+	if combinedPath != "" {
+		args = append(args, "--combined-log", combinedPath)
+	}
+	if s.opts.Logs.MaxSize > 0 {
+		args = append(args,
+			"--log-max-size", strconv.FormatInt(s.opts.Logs.MaxSize, 10),
+			"--log-max-files", strconv.Itoa(s.opts.Logs.MaxFiles))
+	}
 	args = append(args, "--")
 	args = append(args, svc.Command...)
 
 	// #nosec G204 -- wrapper executable is configured in the repo spec.
 	cmd := exec.Command(s.opts.WrapperExe, args...)
 	cmd.Dir = s.opts.RepoRoot
-	cmd.Env = os.Environ()
+	cmd.Env = base
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 
 	if err := cmd.Start(); err != nil {
-		return state.ServiceRecord{}, errors.Wrap(err, "start wrapper")
+		return state.ServiceRecord{}, nil, errors.Wrap(err, "start wrapper")
 	}
 
 	pid := cmd.Process.Pid
@@ -198,14 +314,15 @@ func (s *Supervisor) startService(ctx context.Context, svc engine.ServiceSpec) (
 			break
 		}
 		if time.Now().After(deadline) {
-			_ = terminatePIDGroup(context.Background(), pid, 1*time.Second)
-			return state.ServiceRecord{}, errors.New("wrapper did not report child start")
+			_ = terminatePIDGroup(context.Background(), pid, syscall.SIGTERM, 1*time.Second, true)
+			return state.ServiceRecord{}, nil, errors.New("wrapper did not report child start")
 		}
 		time.Sleep(10 * time.Millisecond)
 	}
 
 	rec := state.ServiceRecord{
 		Name:      svc.Name,
+		Kind:      svc.Kind,
 		PID:       pid,
 		Command:   svc.Command,
 		Cwd:       cwd,
@@ -214,13 +331,80 @@ func (s *Supervisor) startService(ctx context.Context, svc engine.ServiceSpec) (
 		StderrLog: stderrPath,
 		ExitInfo:  exitInfoPath,
 		StartedAt: time.Now(),
+		Wrapper:   true,
+
+		CombinedLog: combinedPath,
+
+		EnvFiles:     envFiles,
+		SecretKeys:   secretKeys,
+		EnvPolicy:    policyName(policy),
+		EnvAllow:     policyAllow(policy),
+		EffectiveEnv: effectiveEnv(full, hiddenKeys(hidden, svc.Env)),
 	}
 	if svc.Health != nil {
 		rec.HealthType = svc.Health.Type
 		rec.HealthAddress = svc.Health.Address
 		rec.HealthURL = svc.Health.URL
 	}
-	return rec, nil
+	setStop(&rec, svc)
+	rec.LogParsers = s.logParsers(svc)
+	return rec, full, nil
+}
+
+// exitInfoOf records how a process started without the wrapper ended.
+func exitInfoOf(name string, pid int, startedAt time.Time, ps *os.ProcessState, waitErr error) state.ExitInfo {
+	ei := state.ExitInfo{Service: name, PID: pid, StartedAt: startedAt, ExitedAt: time.Now()}
+	if waitErr != nil {
+		ei.Error = waitErr.Error()
+	}
+	if ps != nil {
+		if ws, ok := ps.Sys().(syscall.WaitStatus); ok {
+			if ws.Signaled() {
+				ei.Signal = ws.Signal().String()
+			}
+			if ws.Exited() {
+				code := ws.ExitStatus()
+				ei.ExitCode = &code
+			}
+		}
+	}
+	return ei
+}
+
+// hiddenEnv loads svc.EnvFile (later files win) and resolves svc.Secrets.
+func (s *Supervisor) hiddenEnv(ctx context.Context, svc engine.ServiceSpec) (map[string]string, []string, []string, error) {
+	env := map[string]string{}
+	var loaded []string
+	for _, f := range svc.EnvFile {
+		path := f
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(s.opts.RepoRoot, path)
+		}
+		vals, err := dotenv.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(errors.Cause(err)) {
+				log.Warn().Str("service", svc.Name).Str("path", path).Msg("env_file not found, skipping")
+				continue
+			}
+			return nil, nil, nil, errors.Wrapf(err, "service %q env_file", svc.Name)
+		}
+		for k, v := range vals {
+			env[k] = v
+		}
+		loaded = append(loaded, path)
+	}
+
+	resolved, err := s.opts.Secrets.ResolveAll(ctx, svc.Secrets)
+	if err != nil {
+		return nil, nil, nil, errors.Wrapf(err, "service %q secrets", svc.Name)
+	}
+	keys := make([]string, 0, len(resolved))
+	for k, v := range resolved {
+		env[k] = v
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return env, loaded, keys, nil
 }
 
 func mergeEnv(base []string, extra map[string]string) []string {
@@ -303,48 +487,37 @@ func waitHTTP(ctx context.Context, url string) error {
 	}
 }
 
-func terminatePIDGroup(ctx context.Context, pid int, timeout time.Duration) error {
+// terminatePIDGroup sends sig, waits up to timeout for pid to exit and then
+// SIGKILLs its process group, also when ctx ends first. A wrapper gets sig on
+// its own and relays it, so the service sees it once.
+func terminatePIDGroup(ctx context.Context, pid int, sig syscall.Signal, timeout time.Duration, wrapper bool) error {
 	if pid <= 0 {
 		return nil
 	}
 	pgid, err := syscall.Getpgid(pid)
-	if err == nil {
-		_ = syscall.Kill(-pgid, syscall.SIGTERM)
+	if err == nil && !wrapper {
+		_ = syscall.Kill(-pgid, sig)
 	} else {
-		_ = syscall.Kill(pid, syscall.SIGTERM)
-	}
-
-	ctxDeadline, ok := ctx.Deadline()
-	if ok {
-		remaining := time.Until(ctxDeadline)
-		if remaining < timeout {
-			timeout = remaining
-		}
-	}
-
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	default:
+		_ = syscall.Kill(pid, sig)
 	}
 
 	deadline := time.Now().Add(timeout)
 	t := time.NewTicker(100 * time.Millisecond)
 	defer t.Stop()
 
-	for {
-		if !state.ProcessAlive(pid) {
-			return nil
-		}
-		if time.Now().After(deadline) {
-			break
-		}
+	var ctxErr error
+wait:
+	for state.ProcessAlive(pid) && time.Now().Before(deadline) {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			ctxErr = ctx.Err()
+			break wait
 		case <-t.C:
 		}
 	}
+	if !state.ProcessAlive(pid) {
+		return nil
+	}
 
 	if err == nil {
 		_ = syscall.Kill(-pgid, syscall.SIGKILL)
@@ -354,15 +527,26 @@ func terminatePIDGroup(ctx context.Context, pid int, timeout time.Duration) erro
 
 	killDeadline := time.Now().Add(2 * time.Second)
 	for state.ProcessAlive(pid) && time.Now().Before(killDeadline) {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-t.C:
-		}
+		time.Sleep(50 * time.Millisecond)
 	}
 
 	if state.ProcessAlive(pid) {
 		return errors.New("failed to stop service")
 	}
-	return nil
+	return ctxErr
+}
+
+// logParsers resolves the service's logjs modules against the repo root.
+func (s *Supervisor) logParsers(svc engine.ServiceSpec) []string {
+	if svc.Logs == nil {
+		return nil
+	}
+	out := make([]string, 0, len(svc.Logs.Parsers))
+	for _, p := range svc.Logs.Parsers {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(s.opts.RepoRoot, p)
+		}
+		out = append(out, p)
+	}
+	return out
 }
@@ -6,6 +6,8 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 
@@ -128,3 +130,260 @@ func TestSupervisor_PostReadyCrashIsObservable(t *testing.T) {
 	defer stopCancel()
 	_ = s.Stop(stopCtx, st)
 }
+
+func TestInheritedEnv_Policies(t *testing.T) {
+	environ := []string{"PATH=/bin", "HOME=/h", "DATABASE_URL=postgres://stray", "GOFLAGS=-mod=mod", "GOPATH=/go"}
+
+	all, err := inheritedEnv(nil, environ)
+	require.NoError(t, err)
+	require.Equal(t, environ, all)
+
+	clean, err := inheritedEnv(&engine.EnvPolicy{Inherit: engine.EnvInheritClean}, environ)
+	require.NoError(t, err)
+	require.Equal(t, []string{"PATH=/bin", "HOME=/h"}, clean)
+
+	allow, err := inheritedEnv(&engine.EnvPolicy{Inherit: engine.EnvInheritAllowlist, Allow: []string{"GO*"}}, environ)
+	require.NoError(t, err)
+	require.Equal(t, []string{"PATH=/bin", "HOME=/h", "GOFLAGS=-mod=mod", "GOPATH=/go"}, allow)
+
+	_, err = inheritedEnv(&engine.EnvPolicy{Inherit: "some"}, environ)
+	require.Error(t, err)
+}
+
+func TestPlainEnv_FollowsRecordedPolicy(t *testing.T) {
+	t.Setenv("DEVCTL_TEST_STRAY", "stray")
+	t.Setenv("GOFLAGS", "-mod=mod")
+	rec := state.ServiceRecord{Env: map[string]string{"APP_MODE": "dev", "DB_PASS": state.RedactedValue}}
+
+	has := func(env []string, kv string) bool {
+		for _, e := range env {
+			if e == kv {
+				return true
+			}
+		}
+		return false
+	}
+	all := plainEnv(rec)
+	require.True(t, has(all, "DEVCTL_TEST_STRAY=stray"))
+	require.True(t, has(all, "APP_MODE=dev"))
+	require.False(t, has(all, "DB_PASS="+state.RedactedValue))
+
+	rec.EnvPolicy, rec.EnvAllow = engine.EnvInheritAllowlist, []string{"GO*"}
+	allow := plainEnv(rec)
+	require.False(t, has(allow, "DEVCTL_TEST_STRAY=stray"))
+	require.True(t, has(allow, "GOFLAGS=-mod=mod"))
+	require.True(t, has(allow, "APP_MODE=dev"))
+
+	for _, policy := range []string{engine.EnvInheritClean, "bogus"} {
+		rec.EnvPolicy, rec.EnvAllow = policy, nil
+		clean := plainEnv(rec)
+		require.False(t, has(clean, "DEVCTL_TEST_STRAY=stray"), policy)
+		require.False(t, has(clean, "GOFLAGS=-mod=mod"), policy)
+		require.True(t, has(clean, "APP_MODE=dev"), policy)
+	}
+}
+
+func TestSupervisor_StateKeepsEnvFileValuesOut(t *testing.T) {
+	repoRoot, err := os.MkdirTemp("", "devctl-supervise-test-*")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(repoRoot) }()
+	require.NoError(t, os.WriteFile(filepath.Join(repoRoot, ".env.local"), []byte("DB_PASS=envfile-db-pass\nAPP_MODE=envfile-mode\nSHADOWED=envfile-shadowed\n"), 0o600))
+	t.Setenv("DEVCTL_TEST_SECRET_SRC", "provider-secret-value")
+	s := New(Options{RepoRoot: repoRoot, ReadyTimeout: time.Second, ShutdownTimeout: time.Second})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	st, err := s.Start(ctx, engine.LaunchPlan{Services: []engine.ServiceSpec{{
+		Name:    "app",
+		Command: []string{"sleep", "10"},
+		EnvFile: []string{".env.local"},
+		Env:     map[string]string{"SHADOWED": "from-spec"},
+		Secrets: map[string]string{"API_CRED": "env:DEVCTL_TEST_SECRET_SRC"},
+	}}})
+	require.NoError(t, err)
+	defer func() { _ = s.Stop(context.Background(), st) }()
+	require.NoError(t, state.Save(repoRoot, "", st))
+
+	b, err := os.ReadFile(state.StatePath(repoRoot, ""))
+	require.NoError(t, err)
+	for _, v := range []string{"envfile-db-pass", "envfile-mode", "envfile-shadowed", "provider-secret-value"} {
+		require.NotContains(t, string(b), v)
+	}
+	env := st.Services[0].EffectiveEnv
+	require.Equal(t, state.RedactedValue, env["APP_MODE"])
+	require.Equal(t, state.RedactedValue, env["API_CRED"])
+	require.Equal(t, "from-spec", env["SHADOWED"])
+}
+
+func TestStartOrder_DependsOn(t *testing.T) {
+	plan := engine.LaunchPlan{Services: []engine.ServiceSpec{
+		{Name: "api", DependsOn: []string{"migrate"}},
+		{Name: "web", DependsOn: []string{"api"}},
+		{Name: "migrate", Kind: engine.KindJob, DependsOn: []string{"db"}},
+		{Name: "db"},
+	}}
+	ordered, err := startOrder(plan)
+	require.NoError(t, err)
+	var names []string
+	for _, svc := range ordered {
+		names = append(names, svc.Name)
+	}
+	require.Equal(t, []string{"db", "migrate", "api", "web"}, names)
+
+	_, err = startOrder(engine.LaunchPlan{Services: []engine.ServiceSpec{{Name: "a", DependsOn: []string{"b"}}, {Name: "b", DependsOn: []string{"a"}}}})
+	require.ErrorContains(t, err, "cycle")
+	_, err = startOrder(engine.LaunchPlan{Services: []engine.ServiceSpec{{Name: "a", DependsOn: []string{"nope"}}}})
+	require.ErrorContains(t, err, "unknown service")
+}
+
+func TestSupervisor_FailedJobStopsStart(t *testing.T) {
+	repoRoot := t.TempDir()
+	s := New(Options{RepoRoot: repoRoot, ReadyTimeout: time.Second, ShutdownTimeout: time.Second})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	marker := filepath.Join(repoRoot, "api-started")
+	_, err := s.Start(ctx, engine.LaunchPlan{Services: []engine.ServiceSpec{
+		{Name: "migrate", Kind: engine.KindJob, Command: []string{"sh", "-c", "echo boom >&2; exit 3"}},
+		{Name: "api", DependsOn: []string{"migrate"}, Command: []string{"sh", "-c", "touch " + marker + "; sleep 10"}},
+	}})
+	require.ErrorContains(t, err, "exit 3")
+	require.ErrorContains(t, err, "boom")
+	_, statErr := os.Stat(marker)
+	require.True(t, os.IsNotExist(statErr), "api must not start after a failed job")
+
+	rec, err := s.RunJob(ctx, engine.ServiceSpec{Name: "seed", Kind: engine.KindJob, Command: []string{"true"}})
+	require.NoError(t, err)
+	status, _ := rec.JobStatus()
+	require.Equal(t, state.JobSucceeded, status)
+}
+
+func TestSupervisor_StopReverseOrderWithStopSignalAndPreStop(t *testing.T) {
+	repoRoot := t.TempDir()
+	s := New(Options{RepoRoot: repoRoot, ReadyTimeout: time.Second, ShutdownTimeout: 2 * time.Second})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	loop := func(sig, name string) []string {
+		return []string{"sh", "-c", `trap 'echo ` + name + ` >> order; exit 0' ` + sig + `; while :; do sleep 0.05; done`}
+	}
+	st, err := s.Start(ctx, engine.LaunchPlan{Services: []engine.ServiceSpec{
+		{Name: "db", Command: loop("INT", "db"), StopSignal: "SIGINT"},
+		{
+			Name:      "api",
+			DependsOn: []string{"db"},
+			Command:   loop("TERM", "api"),
+			PreStop:   &engine.PreStop{Command: []string{"sh", "-c", "echo pre_stop >> order"}},
+		},
+	}})
+	require.NoError(t, err)
+	time.Sleep(200 * time.Millisecond)
+
+	require.NoError(t, s.Stop(ctx, st))
+	b, err := os.ReadFile(filepath.Join(repoRoot, "order"))
+	require.NoError(t, err)
+	require.Equal(t, "pre_stop\napi\ndb\n", string(b))
+
+	_, err = startOrder(engine.LaunchPlan{Services: []engine.ServiceSpec{{Name: "a", StopSignal: "SIGWINCH"}}})
+	require.ErrorContains(t, err, "stop_signal")
+
+	// State from an untrusted repo is stopped without its hooks.
+	require.NoError(t, os.Remove(filepath.Join(repoRoot, "order")))
+	st, err = s.Start(ctx, engine.LaunchPlan{Services: []engine.ServiceSpec{{
+		Name:     "api",
+		Command:  loop("TERM", "api"),
+		PreStop:  &engine.PreStop{Command: []string{"sh", "-c", "echo pre_stop >> order"}},
+		PostStop: &engine.Hook{Command: []string{"sh", "-c", "echo post_stop >> order"}},
+	}}})
+	require.NoError(t, err)
+	time.Sleep(200 * time.Millisecond)
+	require.NoError(t, New(Options{RepoRoot: repoRoot, SkipStopHooks: true}).Stop(ctx, st))
+	b, err = os.ReadFile(filepath.Join(repoRoot, "order"))
+	require.NoError(t, err)
+	require.Equal(t, "api\n", string(b))
+}
+
+func TestSupervisor_LifecycleHooks(t *testing.T) {
+	repoRoot := t.TempDir()
+	var results []HookResult
+	s := New(Options{RepoRoot: repoRoot, ReadyTimeout: time.Second, ShutdownTimeout: time.Second, OnHook: func(r HookResult) {
+		results = append(results, r)
+	}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	hook := func(script string) *engine.Hook {
+		return &engine.Hook{Command: []string{"sh", "-c", script}}
+	}
+	st, err := s.Start(ctx, engine.LaunchPlan{Services: []engine.ServiceSpec{{
+		Name:      "app",
+		Command:   []string{"sh", "-c", "cat app.conf; sleep 10"},
+		Env:       map[string]string{"GREETING": "hello"},
+		PreStart:  hook("echo port=1234 > app.conf; echo generated config"),
+		PostStart: hook("echo registered $GREETING"),
+		PostStop:  hook("rm app.conf"),
+	}}})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		b, _ := os.ReadFile(st.Services[0].StdoutLog)
+		return strings.Contains(string(b), "port=1234")
+	}, 2*time.Second, 50*time.Millisecond)
+
+	require.NoError(t, s.Stop(ctx, st))
+	_, err = os.Stat(filepath.Join(repoRoot, "app.conf"))
+	require.True(t, os.IsNotExist(err), "post_stop should have removed app.conf")
+	b, err := os.ReadFile(st.Services[0].StdoutLog)
+	require.NoError(t, err)
+	require.Contains(t, string(b), "generated config")
+	require.Contains(t, string(b), "registered hello")
+
+	var hooks []string
+	for _, r := range results {
+		require.NoError(t, r.Err)
+		hooks = append(hooks, r.Hook)
+	}
+	require.Equal(t, []string{HookPreStart, HookPostStart, HookPostStop}, hooks)
+
+	_, err = s.Start(ctx, engine.LaunchPlan{Services: []engine.ServiceSpec{{
+		Name: "broken", Command: []string{"sleep", "10"}, PreStart: hook("exit 2"),
+	}}})
+	require.ErrorContains(t, err, "pre_start")
+}
+
+func TestSupervisor_PostStopRunsForDeadService(t *testing.T) {
+	repoRoot := t.TempDir()
+	var hooks []string
+	s := New(Options{RepoRoot: repoRoot, ReadyTimeout: time.Second, ShutdownTimeout: time.Second, OnHook: func(r HookResult) {
+		require.NoError(t, r.Err)
+		hooks = append(hooks, r.Hook)
+	}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	st, err := s.Start(ctx, engine.LaunchPlan{Services: []engine.ServiceSpec{{
+		Name:     "app",
+		Command:  []string{"sh", "-c", "mkdir scratch; sleep 10"},
+		PreStop:  &engine.PreStop{Command: []string{"touch", "pre-stop-ran"}},
+		PostStop: &engine.Hook{Command: []string{"rmdir", "scratch"}},
+	}}})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(repoRoot, "scratch"))
+		return err == nil
+	}, 2*time.Second, 50*time.Millisecond)
+
+	pid := st.Services[0].PID
+	require.NoError(t, syscall.Kill(-pid, syscall.SIGKILL))
+	require.Eventually(t, func() bool { return !state.ProcessAlive(pid) }, 2*time.Second, 20*time.Millisecond)
+
+	require.NoError(t, s.Stop(ctx, st))
+	_, err = os.Stat(filepath.Join(repoRoot, "scratch"))
+	require.True(t, os.IsNotExist(err), "post_stop should have removed scratch")
+	_, err = os.Stat(filepath.Join(repoRoot, "pre-stop-ran"))
+	require.True(t, os.IsNotExist(err), "pre_stop should not run for a dead service")
+	require.Equal(t, []string{HookPostStop}, hooks)
+}
@@ -0,0 +1,325 @@
+// Package trust pins plugins to what a developer reviewed. A per-user lock,
+// kept outside the repo under $XDG_STATE_HOME and keyed by repo root, records
+// per plugin id the command, args, env, workdir and SHA-256 of every repo file
+// the plugin would execute; a plugin whose fingerprint differs is untrusted.
+// The commands .devctl.yaml runs itself are pinned the same way.
+//
+// The lock is deliberately not a .devctl.lock in the repo: a committed lock
+// would let whoever wrote the repo pre-approve its own plugins.
+package trust
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-go-golems/devctl/pkg/config"
+	"github.com/go-go-golems/devctl/pkg/runtime"
+	"github.com/go-go-golems/devctl/pkg/state"
+	"github.com/pkg/errors"
+)
+
+const lockVersion = 2
+
+// AllowEnvVar, when true, behaves like --allow-untrusted-plugins.
+const AllowEnvVar = "DEVCTL_ALLOW_UNTRUSTED_PLUGINS"
+
+// AllowedByEnv reports whether AllowEnvVar is set to a true value.
+func AllowedByEnv() bool {
+	ok, _ := strconv.ParseBool(os.Getenv(AllowEnvVar))
+	return ok
+}
+
+// Entry is the fingerprint of one plugin.
+type Entry struct {
+	Command string            `json:"command"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	WorkDir string            `json:"workdir,omitempty"`
+	Files   map[string]string `json:"files,omitempty"` // repo-relative path -> sha256
+	// Config is the sha256 of the config sections a config entry covers.
+	Config string `json:"config,omitempty"`
+}
+
+// Lock is one repo's approvals.
+type Lock struct {
+	Version  int              `json:"version"`
+	RepoRoot string           `json:"repo_root"`
+	Plugins  map[string]Entry `json:"plugins"`
+}
+
+// Finding statuses.
+const (
+	StatusNew     = "new"
+	StatusChanged = "changed"
+)
+
+// Finding is a plugin that is not trusted yet.
+type Finding struct {
+	ID       string
+	Status   string
+	Entry    Entry
+	Previous *Entry
+}
+
+// Describe explains a finding in one line.
+func (f Finding) Describe() string {
+	if f.Status == StatusNew || f.Previous == nil {
+		return fmt.Sprintf("%s (new): %s", f.ID, f.Entry.summary())
+	}
+	var changes []string
+	if f.Previous.Command != f.Entry.Command || !reflect.DeepEqual(emptyNil(f.Previous.Args), emptyNil(f.Entry.Args)) {
+		changes = append(changes, "command line")
+	}
+	if !reflect.DeepEqual(emptyMap(f.Previous.Env), emptyMap(f.Entry.Env)) {
+		changes = append(changes, "env")
+	}
+	if f.Previous.WorkDir != f.Entry.WorkDir {
+		changes = append(changes, "workdir")
+	}
+	if f.Previous.Config != f.Entry.Config {
+		changes = append(changes, "services, steps or secret_providers")
+	}
+	for _, p := range unionKeys(f.Previous.Files, f.Entry.Files) {
+		if f.Previous.Files[p] != f.Entry.Files[p] {
+			changes = append(changes, p)
+		}
+	}
+	return fmt.Sprintf("%s (changed: %s): %s", f.ID, strings.Join(changes, ", "), f.Entry.summary())
+}
+
+func (e Entry) summary() string {
+	return strings.TrimSpace(e.Command + " " + strings.Join(e.Args, " "))
+}
+
+// UntrustedError is returned when plugins were neither trusted nor allowed.
+type UntrustedError struct {
+	Findings []Finding
+}
+
+func (e *UntrustedError) Error() string {
+	ids := make([]string, 0, len(e.Findings))
+	for _, f := range e.Findings {
+		ids = append(ids, f.ID+" ("+f.Status+")")
+	}
+	return fmt.Sprintf("untrusted plugins: %s; review them and run `devctl plugins trust`, or pass --allow-untrusted-plugins", strings.Join(ids, ", "))
+}
+
+// LockPath is where the approvals for the repo at repoRoot are kept:
+// $XDG_STATE_HOME/devctl/trust/<hash of repoRoot>.json. A repo cannot ship its
+// own approvals.
+func LockPath(repoRoot string) (string, error) {
+	dir, err := state.UserDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(repoRoot))
+	return filepath.Join(dir, "trust", hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+// Load reads the lock for repoRoot; a missing file is an empty lock.
+func Load(repoRoot string) (*Lock, error) {
+	empty := &Lock{Version: lockVersion, RepoRoot: repoRoot, Plugins: map[string]Entry{}}
+	path, err := LockPath(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return empty, nil
+		}
+		return nil, errors.Wrap(err, "read lock")
+	}
+	var l Lock
+	if err := json.Unmarshal(b, &l); err != nil {
+		return nil, errors.Wrapf(err, "parse %s", path)
+	}
+	// Older fingerprints lack fields; start over rather than mis-compare.
+	if l.Version != lockVersion || l.RepoRoot != repoRoot {
+		return empty, nil
+	}
+	if l.Plugins == nil {
+		l.Plugins = map[string]Entry{}
+	}
+	return &l, nil
+}
+
+// Save writes the lock for repoRoot atomically.
+func Save(repoRoot string, l *Lock) error {
+	l.Version = lockVersion
+	l.RepoRoot = repoRoot
+	path, err := LockPath(repoRoot)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return errors.Wrap(err, "mkdir trust dir")
+	}
+	b, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshal lock")
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0o600); err != nil {
+		return errors.Wrap(err, "write lock")
+	}
+	return errors.Wrap(os.Rename(tmp, path), "rename lock")
+}
+
+// Trust records the findings' current fingerprints.
+func (l *Lock) Trust(findings []Finding) {
+	for _, f := range findings {
+		l.Plugins[f.ID] = f.Entry
+	}
+}
+
+// Check fingerprints specs and returns the ones the lock does not match.
+func Check(repoRoot string, l *Lock, specs []runtime.PluginSpec) ([]Finding, error) {
+	var out []Finding
+	for _, spec := range specs {
+		e, err := Fingerprint(repoRoot, spec)
+		if err != nil {
+			return nil, err
+		}
+		if f := l.Compare(spec.ID, e); f != nil {
+			out = append(out, *f)
+		}
+	}
+	return out, nil
+}
+
+// Compare returns a finding when e does not match what the lock has for id.
+func (l *Lock) Compare(id string, e Entry) *Finding {
+	prev, ok := l.Plugins[id]
+	switch {
+	case !ok:
+		return &Finding{ID: id, Status: StatusNew, Entry: e}
+	case !equal(prev, e):
+		return &Finding{ID: id, Status: StatusChanged, Entry: e, Previous: &prev}
+	}
+	return nil
+}
+
+// Fingerprint hashes the plugin executable and every arg that names a file,
+// when those live under repoRoot, and records its env and workdir. System
+// interpreters (python3, bash) are recorded by name only.
+func Fingerprint(repoRoot string, spec runtime.PluginSpec) (Entry, error) {
+	e := Entry{Command: relTo(repoRoot, spec.Path), Args: spec.Args, Env: spec.Env, WorkDir: relTo(repoRoot, spec.WorkDir), Files: map[string]string{}}
+	candidates := []string{spec.Path}
+	for _, a := range spec.Args {
+		if !filepath.IsAbs(a) {
+			a = filepath.Join(spec.WorkDir, a)
+		}
+		candidates = append(candidates, a)
+	}
+	for _, c := range candidates {
+		if !filepath.IsAbs(c) || !within(repoRoot, c) {
+			continue
+		}
+		info, err := os.Stat(c)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		sum, err := hashFile(c)
+		if err != nil {
+			return Entry{}, errors.Wrapf(err, "plugin %q", spec.ID)
+		}
+		e.Files[relTo(repoRoot, c)] = sum
+	}
+	if len(e.Files) == 0 {
+		e.Files = nil
+	}
+	return e, nil
+}
+
+// FingerprintConfig pins the commands the config runs without a plugin: the
+// built-in services (with their hooks), build and prepare steps, and
+// secret_providers. ok is false when cfg declares none of them.
+func FingerprintConfig(repoRoot, cfgPath string, cfg *config.File) (e Entry, ok bool, err error) {
+	sections := struct {
+		Services        []config.Service
+		Build, Prepare  []config.Step
+		SecretProviders map[string]string
+	}{cfg.Services, cfg.Build, cfg.Prepare, cfg.SecretProviders}
+	if len(sections.Services)+len(sections.Build)+len(sections.Prepare)+len(sections.SecretProviders) == 0 {
+		return Entry{}, false, nil
+	}
+	b, err := json.Marshal(sections)
+	if err != nil {
+		return Entry{}, false, errors.Wrap(err, "marshal config commands")
+	}
+	sum := sha256.Sum256(b)
+	return Entry{Command: relTo(repoRoot, cfgPath), Config: hex.EncodeToString(sum[:])}, true, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func equal(a, b Entry) bool {
+	return a.Command == b.Command && reflect.DeepEqual(emptyNil(a.Args), emptyNil(b.Args)) &&
+		reflect.DeepEqual(emptyMap(a.Env), emptyMap(b.Env)) && a.WorkDir == b.WorkDir &&
+		reflect.DeepEqual(a.Files, b.Files) && a.Config == b.Config
+}
+
+func emptyMap(m map[string]string) map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+func emptyNil(s []string) []string {
+	if len(s) == 0 {
+		return nil
+	}
+	return s
+}
+
+func within(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func relTo(root, p string) string {
+	if filepath.IsAbs(p) && within(root, p) {
+		if rel, err := filepath.Rel(root, p); err == nil {
+			return rel
+		}
+	}
+	return p
+}
+
+func unionKeys(a, b map[string]string) []string {
+	seen := map[string]struct{}{}
+	for k := range a {
+		seen[k] = struct{}{}
+	}
+	for k := range b {
+		seen[k] = struct{}{}
+	}
+	out := make([]string, 0, len(seen))
+	for k := range seen {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
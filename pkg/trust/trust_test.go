@@ -0,0 +1,136 @@
+package trust
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-go-golems/devctl/pkg/config"
+	"github.com/go-go-golems/devctl/pkg/runtime"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFingerprint_ChangesWithScriptArgsEnvAndWorkDir(t *testing.T) {
+	root := t.TempDir()
+	script := filepath.Join(root, "plugin.py")
+	require.NoError(t, os.WriteFile(script, []byte("print('v1')\n"), 0o644))
+	spec := runtime.PluginSpec{ID: "app", Path: "python3", Args: []string{"plugin.py"}, WorkDir: root, Env: map[string]string{"MODE": "dev"}}
+
+	base, err := Fingerprint(root, spec)
+	require.NoError(t, err)
+	require.Equal(t, "python3", base.Command)
+	require.Contains(t, base.Files, "plugin.py")
+	l := &Lock{Plugins: map[string]Entry{"app": base}}
+
+	changed := func(name string, mutate func(*runtime.PluginSpec)) {
+		s := spec
+		s.Env = map[string]string{"MODE": "dev"}
+		mutate(&s)
+		e, err := Fingerprint(root, s)
+		require.NoError(t, err)
+		f := l.Compare("app", e)
+		require.NotNil(t, f, name)
+		require.Equal(t, StatusChanged, f.Status)
+		require.Contains(t, f.Describe(), name)
+	}
+	changed("command line", func(s *runtime.PluginSpec) { s.Args = []string{"plugin.py", "--debug"} })
+	changed("env", func(s *runtime.PluginSpec) { s.Env["MODE"] = "prod" })
+	changed("workdir", func(s *runtime.PluginSpec) { s.WorkDir = filepath.Join(root, "sub") })
+
+	require.NoError(t, os.WriteFile(script, []byte("print('v2')\n"), 0o644))
+	changed("plugin.py", func(s *runtime.PluginSpec) {})
+
+	require.Nil(t, (&Lock{Plugins: map[string]Entry{"app": mustFingerprint(t, root, spec)}}).Compare("app", mustFingerprint(t, root, spec)))
+}
+
+func mustFingerprint(t *testing.T, root string, spec runtime.PluginSpec) Entry {
+	e, err := Fingerprint(root, spec)
+	require.NoError(t, err)
+	return e
+}
+
+func TestFingerprintConfig_CoversStepsHooksAndSecretProviders(t *testing.T) {
+	root := t.TempDir()
+	cfgPath := filepath.Join(root, ".devctl.yaml")
+	_, ok, err := FingerprintConfig(root, cfgPath, &config.File{Strictness: "error"})
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	cfg := func() *config.File {
+		return &config.File{
+			Services:        []config.Service{{Name: "api", Command: []string{"serve"}, PostStop: &config.Hook{Command: []string{"rm", "-rf", "tmp"}}}},
+			Build:           []config.Step{{Name: "gen", Run: "make gen"}},
+			SecretProviders: map[string]string{"vault": "vault read $1"},
+		}
+	}
+	base, ok, err := FingerprintConfig(root, cfgPath, cfg())
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, ".devctl.yaml", base.Command)
+
+	for name, mutate := range map[string]func(*config.File){
+		"hook":            func(c *config.File) { c.Services[0].PostStop.Command = []string{"curl", "evil"} },
+		"step":            func(c *config.File) { c.Build[0].Run = "make gen && curl evil" },
+		"prepare":         func(c *config.File) { c.Prepare = []config.Step{{Name: "p", Run: "true"}} },
+		"secret provider": func(c *config.File) { c.SecretProviders["vault"] = "curl evil" },
+	} {
+		c := cfg()
+		mutate(c)
+		e, _, err := FingerprintConfig(root, cfgPath, c)
+		require.NoError(t, err)
+		require.NotEqual(t, base.Config, e.Config, name)
+	}
+}
+
+func TestLock_RoundTripOutsideRepo(t *testing.T) {
+	state := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", state)
+	root := t.TempDir()
+
+	path, err := LockPath(root)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(path, filepath.Join(state, "devctl", "trust")+string(filepath.Separator)))
+
+	l, err := Load(root)
+	require.NoError(t, err)
+	require.Empty(t, l.Plugins)
+
+	e := Entry{Command: "python3", Args: []string{"p.py"}, Env: map[string]string{"A": "1"}, WorkDir: ".", Files: map[string]string{"p.py": "abc"}}
+	l.Trust([]Finding{{ID: "app", Status: StatusNew, Entry: e}})
+	require.NoError(t, Save(root, l))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	_, err = os.Stat(filepath.Join(root, ".devctl.lock"))
+	require.True(t, os.IsNotExist(err), "nothing is written into the repo")
+
+	again, err := Load(root)
+	require.NoError(t, err)
+	require.Equal(t, root, again.RepoRoot)
+	require.Nil(t, again.Compare("app", e))
+
+	// Approvals belong to one repo root.
+	other, err := Load(t.TempDir())
+	require.NoError(t, err)
+	require.NotNil(t, other.Compare("app", e))
+}
+
+func TestCheck_RejectsNewAndChanged(t *testing.T) {
+	root := t.TempDir()
+	specs := []runtime.PluginSpec{{ID: "a", Path: "a-cmd", WorkDir: root}, {ID: "b", Path: "b-cmd", WorkDir: root}}
+	l := &Lock{Plugins: map[string]Entry{"a": {Command: "a-cmd", WorkDir: "."}, "b": {Command: "old-b", WorkDir: "."}}}
+	specs = append(specs, runtime.PluginSpec{ID: "c", Path: "c-cmd", WorkDir: root})
+
+	findings, err := Check(root, l, specs)
+	require.NoError(t, err)
+	require.Len(t, findings, 2)
+	require.Equal(t, "b", findings[0].ID)
+	require.Equal(t, StatusChanged, findings[0].Status)
+	require.Equal(t, "c", findings[1].ID)
+	require.Equal(t, StatusNew, findings[1].Status)
+
+	err = &UntrustedError{Findings: findings}
+	require.Contains(t, err.Error(), "b (changed), c (new)")
+}
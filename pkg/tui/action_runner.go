@@ -3,17 +3,21 @@ package tui
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"os"
 	"time"
 
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/go-go-golems/devctl/pkg/engine"
-	"github.com/go-go-golems/devctl/pkg/patch"
+	"github.com/go-go-golems/devctl/pkg/limits"
+	"github.com/go-go-golems/devctl/pkg/logfiles"
+	"github.com/go-go-golems/devctl/pkg/registry"
 	"github.com/go-go-golems/devctl/pkg/repository"
 	"github.com/go-go-golems/devctl/pkg/runtime"
 	"github.com/go-go-golems/devctl/pkg/state"
 	"github.com/go-go-golems/devctl/pkg/supervise"
+	"github.com/go-go-golems/devctl/pkg/workspace"
 	"github.com/pkg/errors"
 )
 
@@ -70,6 +74,8 @@ func RegisterUIActionRunner(tuiCtx context.Context, bus *Bus, opts RootOptions)
 			err = errors.New("stop action is not implemented")
 		case ActionUp:
 			err = runUp(ctx, opts, bus.Publisher, runID)
+		case ActionRunJob:
+			err = runJob(ctx, opts, bus.Publisher, runID, req.Service)
 		case ActionRestart:
 			if err2 := runDown(ctx, opts, bus.Publisher, runID); err2 != nil {
 				err = err2
@@ -106,6 +112,29 @@ func RegisterUIActionRunner(tuiCtx context.Context, bus *Bus, opts RootOptions)
 	})
 }
 
+func publishPipelineHookResult(pub message.Publisher, ev PipelineHookResult) error {
+	env, err := NewEnvelope(DomainTypePipelineHookResult, ev)
+	if err != nil {
+		return err
+	}
+	b, err := env.MarshalJSONBytes()
+	if err != nil {
+		return err
+	}
+	return pub.Publish(TopicDevctlEvents, message.NewMessage(watermill.NewUUID(), b))
+}
+
+// hookPublisher forwards supervise hook results as pipeline events.
+func hookPublisher(pub message.Publisher, runID string) func(supervise.HookResult) {
+	return func(r supervise.HookResult) {
+		ev := PipelineHookResult{RunID: runID, At: time.Now(), Service: r.Service, Hook: r.Hook, Ok: r.Err == nil, DurationMs: r.Duration.Milliseconds()}
+		if r.Err != nil {
+			ev.Error = r.Err.Error()
+		}
+		_ = publishPipelineHookResult(pub, ev)
+	}
+}
+
 func publishActionLog(pub message.Publisher, text string) error {
 	ev := ActionLog{At: time.Now(), Text: text}
 	env, err := NewEnvelope(DomainTypeActionLog, ev)
@@ -218,9 +247,11 @@ func publishPipelineLaunchPlan(pub message.Publisher, ev PipelineLaunchPlan) err
 func phasesForAction(kind ActionKind) []PipelinePhase {
 	switch kind {
 	case ActionDown:
-		return []PipelinePhase{PipelinePhaseStopSupervise, PipelinePhaseRemoveState}
+		return []PipelinePhase{PipelinePhaseStopSupervise, PipelinePhaseTeardown, PipelinePhaseRemoveState}
 	case ActionStop:
 		return []PipelinePhase{PipelinePhaseStopSupervise}
+	case ActionRunJob:
+		return []PipelinePhase{PipelinePhaseMutateConfig, PipelinePhaseLaunchPlan, PipelinePhaseSupervise, PipelinePhaseStateSave}
 	case ActionUp:
 		return []PipelinePhase{
 			PipelinePhaseMutateConfig,
@@ -230,10 +261,12 @@ func phasesForAction(kind ActionKind) []PipelinePhase {
 			PipelinePhaseLaunchPlan,
 			PipelinePhaseSupervise,
 			PipelinePhaseStateSave,
+			PipelinePhaseHealthCheck,
 		}
 	case ActionRestart:
 		return []PipelinePhase{
 			PipelinePhaseStopSupervise,
+			PipelinePhaseTeardown,
 			PipelinePhaseRemoveState,
 			PipelinePhaseMutateConfig,
 			PipelinePhaseBuild,
@@ -242,6 +275,7 @@ func phasesForAction(kind ActionKind) []PipelinePhase {
 			PipelinePhaseLaunchPlan,
 			PipelinePhaseSupervise,
 			PipelinePhaseStateSave,
+			PipelinePhaseHealthCheck,
 		}
 	default:
 		return []PipelinePhase{
@@ -252,6 +286,7 @@ func phasesForAction(kind ActionKind) []PipelinePhase {
 			PipelinePhaseLaunchPlan,
 			PipelinePhaseSupervise,
 			PipelinePhaseStateSave,
+			PipelinePhaseHealthCheck,
 		}
 	}
 }
@@ -269,7 +304,7 @@ func runDown(ctx context.Context, opts RootOptions, pub message.Publisher, runID
 
 	stopStart := time.Now()
 	_ = publishPipelinePhaseStarted(pub, PipelinePhaseStarted{RunID: runID, Phase: PipelinePhaseStopSupervise, At: stopStart})
-	if _, err := os.Stat(state.StatePath(opts.RepoRoot)); err != nil {
+	if _, err := os.Stat(state.StatePath(opts.RepoRoot, opts.Instance)); err != nil {
 		if os.IsNotExist(err) {
 			_ = publishPipelinePhaseFinished(pub, PipelinePhaseFinished{
 				RunID:      runID,
@@ -300,7 +335,7 @@ func runDown(ctx context.Context, opts RootOptions, pub message.Publisher, runID
 		return errors.Wrap(err, "stat state")
 	}
 
-	st, err := state.Load(opts.RepoRoot)
+	st, err := state.Load(opts.RepoRoot, opts.Instance)
 	if err != nil {
 		_ = publishPipelinePhaseFinished(pub, PipelinePhaseFinished{
 			RunID:      runID,
@@ -313,11 +348,10 @@ func runDown(ctx context.Context, opts RootOptions, pub message.Publisher, runID
 		return err
 	}
 	wrapperExe, _ := os.Executable()
-	sup := supervise.New(supervise.Options{RepoRoot: opts.RepoRoot, ShutdownTimeout: opts.Timeout, WrapperExe: wrapperExe})
+	trusted := workspace.StopHooksTrusted(st, repository.Options{RepoRoot: opts.RepoRoot, ConfigPath: opts.Config, Cwd: opts.RepoRoot, Profile: st.Profile, Instance: opts.Instance, AllowUntrusted: opts.AllowUntrusted})
+	sup := supervise.New(supervise.Options{RepoRoot: opts.RepoRoot, Instance: opts.Instance, ShutdownTimeout: opts.Timeout, WrapperExe: wrapperExe, OnHook: hookPublisher(pub, runID), SkipStopHooks: !trusted})
 
-	stopCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
-	defer cancel()
-	_ = sup.Stop(stopCtx, st)
+	_ = sup.Stop(ctx, st)
 	_ = publishPipelinePhaseFinished(pub, PipelinePhaseFinished{
 		RunID:      runID,
 		Phase:      PipelinePhaseStopSupervise,
@@ -326,9 +360,32 @@ func runDown(ctx context.Context, opts RootOptions, pub message.Publisher, runID
 		DurationMs: time.Since(stopStart).Milliseconds(),
 	})
 
+	tdStart := time.Now()
+	_ = publishPipelinePhaseStarted(pub, PipelinePhaseStarted{RunID: runID, Phase: PipelinePhaseTeardown, At: tdStart})
+	tdErr := runTeardown(ctx, opts, pub, st)
+	if tdErr != nil {
+		_ = publishPipelinePhaseFinished(pub, PipelinePhaseFinished{
+			RunID:      runID,
+			Phase:      PipelinePhaseTeardown,
+			At:         time.Now(),
+			Ok:         false,
+			DurationMs: time.Since(tdStart).Milliseconds(),
+			Error:      tdErr.Error(),
+		})
+	} else {
+		_ = publishPipelinePhaseFinished(pub, PipelinePhaseFinished{
+			RunID:      runID,
+			Phase:      PipelinePhaseTeardown,
+			At:         time.Now(),
+			Ok:         true,
+			DurationMs: time.Since(tdStart).Milliseconds(),
+		})
+	}
+
 	rmStart := time.Now()
 	_ = publishPipelinePhaseStarted(pub, PipelinePhaseStarted{RunID: runID, Phase: PipelinePhaseRemoveState, At: rmStart})
-	err = state.Remove(opts.RepoRoot)
+	_ = registry.Unregister(opts.RepoRoot, opts.Instance)
+	err = state.Remove(opts.RepoRoot, opts.Instance)
 	if err != nil {
 		_ = publishPipelinePhaseFinished(pub, PipelinePhaseFinished{
 			RunID:      runID,
@@ -347,6 +404,70 @@ func runDown(ctx context.Context, opts RootOptions, pub message.Publisher, runID
 		Ok:         true,
 		DurationMs: time.Since(rmStart).Milliseconds(),
 	})
+	return tdErr
+}
+
+// runTeardown starts the repo plugins and runs teardown.run for the services in
+// st. State is removed by the caller regardless of the outcome.
+func runTeardown(ctx context.Context, opts RootOptions, pub message.Publisher, st *state.State) error {
+	if st.Workspace != "" {
+		ws, err := workspace.Load(opts.RepoRoot)
+		if err != nil {
+			return err
+		}
+		return workspace.Teardown(ctx, ws, st, workspace.UpOptions{Instance: opts.Instance, Strict: opts.Strict, Timeout: opts.Timeout, AllowUntrusted: opts.AllowUntrusted, OnStderr: pluginStderrPublisher(pub)})
+	}
+	if opts.Profile == "" {
+		opts.Profile = st.Profile
+	}
+	repo, err := repository.Load(repository.Options{RepoRoot: opts.RepoRoot, ConfigPath: opts.Config, Cwd: opts.RepoRoot, DryRun: opts.DryRun, Profile: opts.Profile, Instance: opts.Instance, AllowUntrusted: opts.AllowUntrusted})
+	if err != nil {
+		return err
+	}
+	if len(repo.Specs) == 0 {
+		return nil
+	}
+	factory := runtime.NewFactory(runtime.FactoryOptions{
+		HandshakeTimeout: 2 * time.Second,
+		ShutdownTimeout:  3 * time.Second,
+		OnStderr:         pluginStderrPublisher(pub),
+	})
+	clients, err := repo.StartClients(ctx, factory)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_ = repository.CloseClients(closeCtx, clients)
+	}()
+
+	p := &engine.Pipeline{
+		Clients: clients,
+		Opts:    engine.Options{Strict: opts.Strict || repo.Config.Strictness == "error"},
+	}
+	if !p.Supports("teardown.run") {
+		return nil
+	}
+	opCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	conf, err := repo.MutateConfig(opCtx, p)
+	if err != nil {
+		return err
+	}
+	services := make([]string, 0, len(st.Services))
+	for _, svc := range st.Services {
+		services = append(services, svc.Name)
+	}
+	tr, err := p.Teardown(opCtx, conf, services)
+	if err != nil {
+		return err
+	}
+	for _, step := range tr.Steps {
+		if !step.Ok {
+			return errors.Errorf("teardown step failed: %s", step.Name)
+		}
+	}
 	return nil
 }
 
@@ -359,25 +480,29 @@ func runUp(ctx context.Context, opts RootOptions, pub message.Publisher, runID s
 	}
 
 	if !opts.DryRun {
-		if _, err := os.Stat(state.StatePath(opts.RepoRoot)); err == nil {
+		if _, err := os.Stat(state.StatePath(opts.RepoRoot, opts.Instance)); err == nil {
 			return errors.New("state exists; run down first")
 		}
 	}
+	if opts.Workspace {
+		return runWorkspaceUp(ctx, opts, pub, runID)
+	}
 
-	repo, err := repository.Load(repository.Options{RepoRoot: opts.RepoRoot, ConfigPath: opts.Config, Cwd: opts.RepoRoot, DryRun: opts.DryRun})
+	repo, err := repository.Load(repository.Options{RepoRoot: opts.RepoRoot, ConfigPath: opts.Config, Cwd: opts.RepoRoot, DryRun: opts.DryRun, Profile: opts.Profile, Instance: opts.Instance, AllocatePorts: !opts.DryRun, AllowUntrusted: opts.AllowUntrusted})
 	if err != nil {
 		return err
 	}
 	if !opts.Strict && repo.Config.Strictness == "error" {
 		opts.Strict = true
 	}
-	if len(repo.Specs) == 0 {
-		return errors.New("no plugins configured (add .devctl.yaml)")
+	if !repo.HasPlugins() {
+		return errors.New("no plugins or services configured (add .devctl.yaml)")
 	}
 
 	factory := runtime.NewFactory(runtime.FactoryOptions{
 		HandshakeTimeout: 2 * time.Second,
 		ShutdownTimeout:  3 * time.Second,
+		OnStderr:         pluginStderrPublisher(pub),
 	})
 
 	clients, err := repo.StartClients(ctx, factory)
@@ -393,15 +518,17 @@ func runUp(ctx context.Context, opts RootOptions, pub message.Publisher, runID s
 	p := &engine.Pipeline{
 		Clients: clients,
 		Opts: engine.Options{
-			Strict: opts.Strict,
-			DryRun: opts.DryRun,
+			Strict:   opts.Strict,
+			DryRun:   opts.DryRun,
+			RepoRoot: repo.Root,
+			Instance: repo.Instance,
 		},
 	}
 
 	mutateStart := time.Now()
 	_ = publishPipelinePhaseStarted(pub, PipelinePhaseStarted{RunID: runID, Phase: PipelinePhaseMutateConfig, At: mutateStart})
 	opCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
-	conf, err := p.MutateConfig(opCtx, patch.Config{})
+	conf, err := repo.MutateConfig(opCtx, p)
 	cancel()
 	if err != nil {
 		_ = publishPipelinePhaseFinished(pub, PipelinePhaseFinished{
@@ -428,6 +555,9 @@ func runUp(ctx context.Context, opts RootOptions, pub message.Publisher, runID s
 	br, err := p.Build(opCtx, conf, nil)
 	cancel()
 	if err != nil {
+		if len(br.Steps) > 0 {
+			_ = publishPipelineBuildResult(pub, PipelineBuildResult{RunID: runID, At: time.Now(), Steps: stepResultsFromEngine(br.Steps)})
+		}
 		_ = publishPipelinePhaseFinished(pub, PipelinePhaseFinished{
 			RunID:      runID,
 			Phase:      PipelinePhaseBuild,
@@ -458,6 +588,9 @@ func runUp(ctx context.Context, opts RootOptions, pub message.Publisher, runID s
 	pr, err := p.Prepare(opCtx, conf, nil)
 	cancel()
 	if err != nil {
+		if len(pr.Steps) > 0 {
+			_ = publishPipelinePrepareResult(pub, PipelinePrepareResult{RunID: runID, At: time.Now(), Steps: stepResultsFromEngine(pr.Steps)})
+		}
 		_ = publishPipelinePhaseFinished(pub, PipelinePhaseFinished{
 			RunID:      runID,
 			Phase:      PipelinePhasePrepare,
@@ -540,6 +673,7 @@ func runUp(ctx context.Context, opts RootOptions, pub message.Publisher, runID s
 		})
 		return err
 	}
+	plan = repo.FilterPlan(plan)
 	svcNames := make([]string, 0, len(plan.Services))
 	for _, svc := range plan.Services {
 		svcNames = append(svcNames, svc.Name)
@@ -563,8 +697,22 @@ func runUp(ctx context.Context, opts RootOptions, pub message.Publisher, runID s
 
 	supStart := time.Now()
 	_ = publishPipelinePhaseStarted(pub, PipelinePhaseStarted{RunID: runID, Phase: PipelinePhaseSupervise, At: supStart})
+	logPolicy, err := repo.LogPolicy()
+	if err != nil {
+		return err
+	}
 	wrapperExe, _ := os.Executable()
-	sup := supervise.New(supervise.Options{RepoRoot: opts.RepoRoot, ReadyTimeout: opts.Timeout, WrapperExe: wrapperExe})
+	sup := supervise.New(supervise.Options{
+		RepoRoot:     opts.RepoRoot,
+		Instance:     opts.Instance,
+		ReadyTimeout: opts.Timeout,
+		WrapperExe:   wrapperExe,
+		Secrets:      repo.Secrets(),
+		EnvPolicy:    repo.DefaultEnvPolicy(),
+		Ports:        repo.Ports,
+		OnHook:       hookPublisher(pub, runID),
+		Logs:         logPolicy,
+	})
 	st, err := sup.Start(ctx, plan)
 	if err != nil {
 		_ = publishPipelinePhaseFinished(pub, PipelinePhaseFinished{
@@ -585,9 +733,10 @@ func runUp(ctx context.Context, opts RootOptions, pub message.Publisher, runID s
 		DurationMs: time.Since(supStart).Milliseconds(),
 	})
 
+	st.Profile = repo.ProfileName
 	saveStart := time.Now()
 	_ = publishPipelinePhaseStarted(pub, PipelinePhaseStarted{RunID: runID, Phase: PipelinePhaseStateSave, At: saveStart})
-	if err := state.Save(opts.RepoRoot, st); err != nil {
+	if err := state.Save(opts.RepoRoot, opts.Instance, st); err != nil {
 		_ = publishPipelinePhaseFinished(pub, PipelinePhaseFinished{
 			RunID:      runID,
 			Phase:      PipelinePhaseStateSave,
@@ -599,6 +748,10 @@ func runUp(ctx context.Context, opts RootOptions, pub message.Publisher, runID s
 		_ = sup.Stop(context.Background(), st)
 		return err
 	}
+	if err := registry.Register(registry.Entry{RepoRoot: opts.RepoRoot, Instance: opts.Instance, ConfigPath: opts.Config, Profile: st.Profile, StartedAt: st.CreatedAt}); err != nil {
+		_ = publishActionLog(pub, "registry: "+err.Error())
+	}
+	collectLogs(opts, logPolicy, st, pub)
 	_ = publishPipelinePhaseFinished(pub, PipelinePhaseFinished{
 		RunID:      runID,
 		Phase:      PipelinePhaseStateSave,
@@ -606,6 +759,33 @@ func runUp(ctx context.Context, opts RootOptions, pub message.Publisher, runID s
 		Ok:         true,
 		DurationMs: time.Since(saveStart).Milliseconds(),
 	})
+
+	healthStart := time.Now()
+	_ = publishPipelinePhaseStarted(pub, PipelinePhaseStarted{RunID: runID, Phase: PipelinePhaseHealthCheck, At: healthStart})
+	opCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+	_, err = p.WaitHealthy(opCtx, conf, svcNames, 500*time.Millisecond)
+	cancel()
+	if err != nil {
+		_ = publishPipelinePhaseFinished(pub, PipelinePhaseFinished{
+			RunID:      runID,
+			Phase:      PipelinePhaseHealthCheck,
+			At:         time.Now(),
+			Ok:         false,
+			DurationMs: time.Since(healthStart).Milliseconds(),
+			Error:      err.Error(),
+		})
+		_ = sup.Stop(context.Background(), st)
+		_ = state.Remove(opts.RepoRoot, opts.Instance)
+		_ = registry.Unregister(opts.RepoRoot, opts.Instance)
+		return err
+	}
+	_ = publishPipelinePhaseFinished(pub, PipelinePhaseFinished{
+		RunID:      runID,
+		Phase:      PipelinePhaseHealthCheck,
+		At:         time.Now(),
+		Ok:         true,
+		DurationMs: time.Since(healthStart).Milliseconds(),
+	})
 	return nil
 }
 
@@ -620,3 +800,51 @@ func stepResultsFromEngine(in []engine.StepResult) []PipelineStepResult {
 	}
 	return out
 }
+
+// runWorkspaceUp starts every repo of the workspace in RepoRoot. Members run
+// their full pipelines; per-phase events are not published for them.
+func runWorkspaceUp(ctx context.Context, opts RootOptions, pub message.Publisher, runID string) error {
+	ws, err := workspace.Load(opts.RepoRoot)
+	if err != nil {
+		return err
+	}
+	wrapperExe, _ := os.Executable()
+	res, err := workspace.Up(ctx, ws, workspace.UpOptions{
+		Instance:       opts.Instance,
+		Strict:         opts.Strict,
+		DryRun:         opts.DryRun,
+		Timeout:        opts.Timeout,
+		WrapperExe:     wrapperExe,
+		AllowUntrusted: opts.AllowUntrusted,
+		OnStderr:       pluginStderrPublisher(pub),
+		OnHook:         hookPublisher(pub, runID),
+	})
+	if err != nil {
+		return err
+	}
+	if opts.DryRun {
+		return nil
+	}
+	st := res.State
+	if err := state.Save(opts.RepoRoot, opts.Instance, st); err != nil {
+		_ = supervise.New(supervise.Options{RepoRoot: opts.RepoRoot, Instance: opts.Instance}).Stop(context.Background(), st)
+		return err
+	}
+	if err := registry.Register(registry.Entry{RepoRoot: opts.RepoRoot, Instance: opts.Instance, ConfigPath: opts.Config, StartedAt: st.CreatedAt}); err != nil {
+		_ = publishActionLog(pub, "registry: "+err.Error())
+	}
+	collectLogs(opts, logfiles.DefaultPolicy(), st, pub)
+	return nil
+}
+
+// collectLogs applies log retention after up and reports it in the action log.
+func collectLogs(opts RootOptions, policy logfiles.Policy, st *state.State, pub message.Publisher) {
+	res, err := logfiles.GC(state.LogsDir(opts.RepoRoot, opts.Instance), policy, st.LogPaths(), false)
+	if err != nil {
+		_ = publishActionLog(pub, "logs gc: "+err.Error())
+		return
+	}
+	if len(res.Removed) > 0 {
+		_ = publishActionLog(pub, fmt.Sprintf("logs gc: removed %d old runs (%s)", len(res.Removed), limits.FormatBytes(res.Freed)))
+	}
+}
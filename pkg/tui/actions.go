@@ -16,6 +16,7 @@ const (
 	ActionDown    ActionKind = "down"
 	ActionRestart ActionKind = "restart"
 	ActionStop    ActionKind = "stop" // Stop a specific service
+	ActionRunJob  ActionKind = "run-job"
 )
 
 type ActionRequest struct {
@@ -96,6 +96,12 @@ func RegisterUIForwarder(bus *Bus, p *tea.Program) {
 				return errors.Wrap(err, "unmarshal stream ended payload")
 			}
 			p.Send(StreamEndedMsg{End: ev})
+		case UITypePluginStderr:
+			var ev PluginStderrLine
+			if err := json.Unmarshal(env.Payload, &ev); err != nil {
+				return errors.Wrap(err, "unmarshal plugin stderr payload")
+			}
+			p.Send(PluginStderrMsg{Line: ev})
 		}
 		return nil
 	})
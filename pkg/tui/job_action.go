@@ -0,0 +1,130 @@
+package tui
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/go-go-golems/devctl/pkg/engine"
+	"github.com/go-go-golems/devctl/pkg/repository"
+	"github.com/go-go-golems/devctl/pkg/runtime"
+	"github.com/go-go-golems/devctl/pkg/state"
+	"github.com/go-go-golems/devctl/pkg/supervise"
+	"github.com/pkg/errors"
+)
+
+// runJob re-runs one job from a fresh launch plan and replaces its record in
+// state, like `devctl job run`.
+func runJob(ctx context.Context, opts RootOptions, pub message.Publisher, runID string, name string) error {
+	if name == "" {
+		return errors.New("missing job name")
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	st, err := state.Load(opts.RepoRoot, opts.Instance)
+	if err != nil {
+		return err
+	}
+	if st.Workspace != "" {
+		return errors.New("re-running jobs of a workspace is not supported")
+	}
+	if opts.Profile == "" {
+		opts.Profile = st.Profile
+	}
+
+	finish := func(phase PipelinePhase, start time.Time, err error) {
+		ev := PipelinePhaseFinished{RunID: runID, Phase: phase, At: time.Now(), Ok: err == nil, DurationMs: time.Since(start).Milliseconds()}
+		if err != nil {
+			ev.Error = err.Error()
+		}
+		_ = publishPipelinePhaseFinished(pub, ev)
+	}
+
+	repo, err := repository.Load(repository.Options{RepoRoot: opts.RepoRoot, ConfigPath: opts.Config, Cwd: opts.RepoRoot, Profile: opts.Profile, Instance: opts.Instance, AllowUntrusted: opts.AllowUntrusted})
+	if err != nil {
+		return err
+	}
+	factory := runtime.NewFactory(runtime.FactoryOptions{
+		HandshakeTimeout: 2 * time.Second,
+		ShutdownTimeout:  3 * time.Second,
+		OnStderr:         pluginStderrPublisher(pub),
+	})
+	clients, err := repo.StartClients(ctx, factory)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_ = repository.CloseClients(closeCtx, clients)
+	}()
+	p := &engine.Pipeline{
+		Clients: clients,
+		Opts:    engine.Options{Strict: opts.Strict || repo.Config.Strictness == "error", RepoRoot: repo.Root, Instance: repo.Instance},
+	}
+
+	start := time.Now()
+	_ = publishPipelinePhaseStarted(pub, PipelinePhaseStarted{RunID: runID, Phase: PipelinePhaseMutateConfig, At: start})
+	opCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	conf, err := repo.MutateConfig(opCtx, p)
+	cancel()
+	finish(PipelinePhaseMutateConfig, start, err)
+	if err != nil {
+		return err
+	}
+
+	start = time.Now()
+	_ = publishPipelinePhaseStarted(pub, PipelinePhaseStarted{RunID: runID, Phase: PipelinePhaseLaunchPlan, At: start})
+	opCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+	plan, err := p.LaunchPlan(opCtx, conf)
+	cancel()
+	var spec *engine.ServiceSpec
+	if err == nil {
+		plan = repo.FilterPlan(plan)
+		for i := range plan.Services {
+			if plan.Services[i].Name == name {
+				spec = &plan.Services[i]
+			}
+		}
+		switch {
+		case spec == nil:
+			err = errors.Errorf("unknown job %q", name)
+		case !spec.IsJob():
+			err = errors.Errorf("%q is not a job", name)
+		}
+	}
+	finish(PipelinePhaseLaunchPlan, start, err)
+	if err != nil {
+		return err
+	}
+
+	start = time.Now()
+	_ = publishPipelinePhaseStarted(pub, PipelinePhaseStarted{RunID: runID, Phase: PipelinePhaseSupervise, At: start})
+	wrapperExe, _ := os.Executable()
+	sup := supervise.New(supervise.Options{
+		RepoRoot:     opts.RepoRoot,
+		Instance:     opts.Instance,
+		ReadyTimeout: opts.Timeout,
+		WrapperExe:   wrapperExe,
+		Secrets:      repo.Secrets(),
+		EnvPolicy:    repo.DefaultEnvPolicy(),
+		OnHook:       hookPublisher(pub, runID),
+	})
+	rec, jobErr := sup.RunJob(ctx, *spec)
+	finish(PipelinePhaseSupervise, start, jobErr)
+	if rec.Name == "" {
+		return jobErr
+	}
+
+	start = time.Now()
+	_ = publishPipelinePhaseStarted(pub, PipelinePhaseStarted{RunID: runID, Phase: PipelinePhaseStateSave, At: start})
+	st.SetService(rec)
+	err = state.Save(opts.RepoRoot, opts.Instance, st)
+	finish(PipelinePhaseStateSave, start, err)
+	if jobErr != nil {
+		return jobErr
+	}
+	return err
+}
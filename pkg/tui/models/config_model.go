@@ -0,0 +1,193 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/go-go-golems/devctl/pkg/patch"
+	"github.com/go-go-golems/devctl/pkg/tui"
+	"github.com/go-go-golems/devctl/pkg/tui/styles"
+	"github.com/go-go-golems/devctl/pkg/tui/widgets"
+)
+
+// configEntry is one leaf of the resolved config, flattened to a dotted key.
+type configEntry struct {
+	Key   string
+	Value string
+}
+
+// ConfigModel is the config inspector: the resolved config.mutate output as
+// dotted keys, with the chain of plugin writes for the selected key.
+type ConfigModel struct {
+	width  int
+	height int
+
+	entries  []configEntry
+	prov     *patch.Provenance
+	errText  string
+	selected int
+	offset   int
+}
+
+// NewConfigModel creates a new config inspector model.
+func NewConfigModel() ConfigModel {
+	return ConfigModel{prov: &patch.Provenance{}}
+}
+
+// WithSize sets the model dimensions.
+func (m ConfigModel) WithSize(width, height int) ConfigModel {
+	m.width, m.height = width, height
+	return m
+}
+
+// WithSnapshot updates the inspector from the state snapshot.
+func (m ConfigModel) WithSnapshot(s tui.StateSnapshot) ConfigModel {
+	m.entries = flattenConfig("", s.Config, nil)
+	sort.Slice(m.entries, func(i, j int) bool { return m.entries[i].Key < m.entries[j].Key })
+	m.prov = &patch.Provenance{Writes: s.ConfigWrites}
+	m.errText = s.ConfigError
+	if m.selected >= len(m.entries) {
+		m.selected = maxInt(0, len(m.entries)-1)
+	}
+	return m
+}
+
+// Update handles input events.
+func (m ConfigModel) Update(msg tea.Msg) (ConfigModel, tea.Cmd) {
+	switch v := msg.(type) {
+	case tea.KeyMsg:
+		switch v.String() {
+		case "up", "k":
+			if m.selected > 0 {
+				m.selected--
+			}
+			return m.clampOffset(), nil
+		case "down", "j":
+			if m.selected < len(m.entries)-1 {
+				m.selected++
+			}
+			return m.clampOffset(), nil
+		case "r":
+			return m, func() tea.Msg { return tui.PluginIntrospectionRefreshMsg{} }
+		case "esc":
+			return m, func() tea.Msg { return tui.NavigateBackMsg{} }
+		}
+	}
+	return m, nil
+}
+
+func (m ConfigModel) listHeight() int {
+	h := m.height/2 - 2
+	if h < 3 {
+		h = 3
+	}
+	return h
+}
+
+func (m ConfigModel) clampOffset() ConfigModel {
+	h := m.listHeight()
+	if m.selected < m.offset {
+		m.offset = m.selected
+	}
+	if m.selected >= m.offset+h {
+		m.offset = m.selected - h + 1
+	}
+	return m
+}
+
+// View renders the inspector.
+func (m ConfigModel) View() string {
+	theme := styles.DefaultTheme()
+
+	var sections []string
+	if m.errText != "" {
+		sections = append(sections, theme.StatusDead.Render(styles.IconError+" config.mutate: "+m.errText), "")
+	}
+	if len(m.entries) == 0 {
+		box := widgets.NewBox("Config").
+			WithContent(theme.TitleMuted.Render("No config keys (no plugin implements config.mutate, or introspection is pending).")).
+			WithSize(m.width, 3)
+		sections = append(sections, box.Render())
+		return lipgloss.JoinVertical(lipgloss.Left, sections...)
+	}
+
+	keyWidth := 0
+	for _, e := range m.entries {
+		if len(e.Key) > keyWidth {
+			keyWidth = len(e.Key)
+		}
+	}
+	if keyWidth > 40 {
+		keyWidth = 40
+	}
+
+	var lines []string
+	end := m.offset + m.listHeight()
+	if end > len(m.entries) {
+		end = len(m.entries)
+	}
+	for i := m.offset; i < end; i++ {
+		e := m.entries[i]
+		cursor := "  "
+		if i == m.selected {
+			cursor = theme.KeybindKey.Render("> ")
+		}
+		lines = append(lines, cursor+theme.Title.Render(fmt.Sprintf("%-*s", keyWidth, e.Key))+"  "+theme.TitleMuted.Render(e.Value))
+	}
+	list := widgets.NewBox(fmt.Sprintf("Config (%d keys)", len(m.entries))).
+		WithTitleRight("[↑/↓] select  [r] refresh").
+		WithContent(lipgloss.JoinVertical(lipgloss.Left, lines...)).
+		WithSize(m.width, len(lines)+2)
+	sections = append(sections, list.Render(), "")
+
+	sel := m.entries[m.selected]
+	var chain []string
+	for i, w := range m.prov.Explain(sel.Key) {
+		line := fmt.Sprintf("%d. %-5s %s by %s", i+1, w.Action, w.Key, w.Source)
+		if w.Action == "set" {
+			line += " = " + formatInspectorValue(w.Value)
+		}
+		if w.Existed {
+			line += "  (was " + formatInspectorValue(w.Previous) + ")"
+		}
+		chain = append(chain, " "+line)
+	}
+	if len(chain) == 0 {
+		chain = append(chain, theme.TitleMuted.Render(" (no recorded writes)"))
+	}
+	explain := widgets.NewBox("Writers: "+sel.Key).
+		WithContent(lipgloss.JoinVertical(lipgloss.Left, chain...)).
+		WithSize(m.width, len(chain)+2)
+	sections = append(sections, explain.Render())
+
+	return lipgloss.JoinVertical(lipgloss.Left, sections...)
+}
+
+func flattenConfig(prefix string, v any, out []configEntry) []configEntry {
+	if asMap, ok := v.(map[string]any); ok && (len(asMap) > 0 || prefix == "") {
+		for k, child := range asMap {
+			key := k
+			if prefix != "" {
+				key = prefix + "." + k
+			}
+			out = flattenConfig(key, child, out)
+		}
+		return out
+	}
+	if prefix == "" {
+		return out
+	}
+	return append(out, configEntry{Key: prefix, Value: formatInspectorValue(v)})
+}
+
+func formatInspectorValue(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return strings.TrimSpace(string(b))
+}
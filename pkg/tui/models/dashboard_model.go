@@ -3,12 +3,15 @@ package models
 import (
 	"fmt"
 	"os"
+	"sort"
 	"syscall"
 	"time"
 
 	"github.com/charmbracelet/lipgloss"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/go-go-golems/devctl/pkg/engine"
+	"github.com/go-go-golems/devctl/pkg/limits"
 	"github.com/go-go-golems/devctl/pkg/state"
 	"github.com/go-go-golems/devctl/pkg/tui"
 	"github.com/go-go-golems/devctl/pkg/tui/styles"
@@ -32,6 +35,8 @@ type DashboardModel struct {
 	confirmText   string
 
 	exitSummary map[string]string
+	// jobStatus holds state.JobRunning/JobSucceeded/JobFailed for jobs.
+	jobStatus map[string]string
 
 	// Recent events for preview
 	recentEvents []tui.EventLogEntry
@@ -68,8 +73,13 @@ func (m DashboardModel) WithSnapshot(s tui.StateSnapshot) DashboardModel {
 	m.last = &s
 	m.selected = clampInt(m.selected, 0, maxInt(0, len(m.serviceNames())-1))
 	m.exitSummary = map[string]string{}
+	m.jobStatus = map[string]string{}
 	if s.State != nil {
 		for _, svc := range s.State.Services {
+			if svc.IsJob() {
+				status, _ := svc.JobStatus()
+				m.jobStatus[svc.Name] = status
+			}
 			alive := false
 			if s.Alive != nil {
 				alive = s.Alive[svc.Name]
@@ -87,6 +97,13 @@ func (m DashboardModel) WithSnapshot(s tui.StateSnapshot) DashboardModel {
 			if err != nil {
 				continue
 			}
+			if ei.OOMKilled {
+				m.exitSummary[svc.Name] = "OOM"
+				if ei.MemoryLimit > 0 {
+					m.exitSummary[svc.Name] += " (limit " + limits.FormatBytes(ei.MemoryLimit) + ")"
+				}
+				continue
+			}
 			if ei.Signal != "" {
 				m.exitSummary[svc.Name] = "sig=" + ei.Signal
 				continue
@@ -172,6 +189,15 @@ func (m DashboardModel) Update(msg tea.Msg) (DashboardModel, tea.Cmd) {
 			m.confirmName = svc.Name
 			m.confirmPID = svc.PID
 			return m, nil
+		case "J":
+			svc := m.selectedService()
+			if svc == nil || !svc.IsJob() {
+				return m, func() tea.Msg {
+					return tui.EventLogAppendMsg{Entry: tui.EventLogEntry{At: time.Now(), Source: "ui", Level: tui.LogLevelWarn, Text: "rerun: selected service is not a job"}}
+				}
+			}
+			req := tui.ActionRequest{Kind: tui.ActionRunJob, Service: svc.Name}
+			return m, func() tea.Msg { return tui.ActionRequestMsg{Request: req} }
 		case "d":
 			m.confirmAction = true
 			m.confirmReq = tui.ActionRequest{Kind: tui.ActionDown}
@@ -230,6 +256,17 @@ func (m DashboardModel) View() string {
 				status = fmt.Sprintf("Dead (%s)", extra)
 			}
 		}
+		switch m.jobStatus[svc.Name] {
+		case state.JobRunning:
+			icon, status = styles.IconRunning, "Job running"
+		case state.JobSucceeded:
+			icon, status = styles.IconSuccess, "Succeeded"
+		case state.JobFailed:
+			icon, status = styles.IconError, "Failed"
+			if extra := m.exitSummary[svc.Name]; extra != "" {
+				status = fmt.Sprintf("Failed (%s)", extra)
+			}
+		}
 
 		// Health status
 		healthIcon := styles.IconUnknown
@@ -279,7 +316,7 @@ func (m DashboardModel) View() string {
 	}
 
 	servicesBox := widgets.NewBox(fmt.Sprintf("Services (%d)", len(services))).
-		WithTitleRight("[l] logs  [r] restart  [x] kill").
+		WithTitleRight("[l] logs  [r] restart  [J] rerun job  [x] kill").
 		WithContent(table.Render()).
 		WithSize(m.width, tableHeight)
 
@@ -301,6 +338,12 @@ func (m DashboardModel) View() string {
 	// Services box
 	sections = append(sections, servicesBox.Render())
 
+	// Plugin-provided facts (status.describe)
+	if s.Facts != nil || s.FactsError != "" {
+		sections = append(sections, "")
+		sections = append(sections, m.renderFacts(theme, s.Facts, s.FactsError))
+	}
+
 	// Recent events preview
 	if len(m.recentEvents) > 0 {
 		sections = append(sections, "")
@@ -574,6 +617,45 @@ func (m DashboardModel) renderPluginsSummary(theme styles.Theme, plugins []tui.P
 	return box.Render()
 }
 
+func (m DashboardModel) renderFacts(theme styles.Theme, facts *engine.StatusDescribeResult, errText string) string {
+	var lines []string
+	if errText != "" {
+		lines = append(lines, theme.StatusDead.Render(styles.IconError+" "+errText))
+	}
+	if facts != nil {
+		lines = append(lines, formatFacts("", facts.Environment)...)
+		names := make([]string, 0, len(facts.Services))
+		for name := range facts.Services {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			lines = append(lines, formatFacts(name+".", facts.Services[name])...)
+		}
+	}
+	if len(lines) == 0 {
+		lines = append(lines, theme.TitleMuted.Render("(no facts)"))
+	}
+
+	box := widgets.NewBox("Facts").
+		WithContent(lipgloss.JoinVertical(lipgloss.Left, lines...)).
+		WithSize(m.width, len(lines)+2)
+	return box.Render()
+}
+
+func formatFacts(prefix string, facts map[string]any) []string {
+	keys := make([]string, 0, len(facts))
+	for k := range facts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		lines = append(lines, fmt.Sprintf(" %-24s %v", prefix+k, facts[k]))
+	}
+	return lines
+}
+
 func (m DashboardModel) renderStreamsSummary(theme styles.Theme) string {
 	// Filter to show recent streams (running + last 3 ended)
 	var running, ended []streamSummary
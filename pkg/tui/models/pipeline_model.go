@@ -157,6 +157,7 @@ func (m PipelineModel) Update(msg tea.Msg) (PipelineModel, tea.Cmd) {
 				tui.PipelinePhaseLaunchPlan,
 				tui.PipelinePhaseSupervise,
 				tui.PipelinePhaseStateSave,
+				tui.PipelinePhaseHealthCheck,
 			}
 		}
 		return m, nil
@@ -35,12 +35,18 @@ type PluginModel struct {
 	plugins  []PluginInfo
 	selected int
 	expanded map[int]bool
+
+	// stderr holds the most recent stderr lines per plugin ID.
+	stderr    map[string][]string
+	maxStderr int
 }
 
 // NewPluginModel creates a new plugin list model.
 func NewPluginModel() PluginModel {
 	return PluginModel{
-		expanded: map[int]bool{},
+		expanded:  map[int]bool{},
+		stderr:    map[string][]string{},
+		maxStderr: 20,
 	}
 }
 
@@ -77,6 +83,24 @@ func (m PluginModel) WithPlugins(plugins []tui.PluginSummary) PluginModel {
 	return m
 }
 
+// WithStderr records a stderr line emitted by a plugin process.
+func (m PluginModel) WithStderr(line tui.PluginStderrLine) PluginModel {
+	if line.PluginID == "" {
+		return m
+	}
+	next := make(map[string][]string, len(m.stderr)+1)
+	for k, v := range m.stderr {
+		next[k] = v
+	}
+	lines := append(append([]string{}, next[line.PluginID]...), line.Line)
+	if m.maxStderr > 0 && len(lines) > m.maxStderr {
+		lines = lines[len(lines)-m.maxStderr:]
+	}
+	next[line.PluginID] = lines
+	m.stderr = next
+	return m
+}
+
 // Update handles input events.
 func (m PluginModel) Update(msg tea.Msg) (PluginModel, tea.Cmd) {
 	switch v := msg.(type) {
@@ -288,6 +312,26 @@ func (m PluginModel) renderPluginCard(index int, p PluginInfo, selected, expande
 		),
 	)
 
+	// Recent stderr
+	if lines := m.stderr[p.ID]; len(lines) > 0 {
+		const maxShown = 5
+		if len(lines) > maxShown {
+			lines = lines[len(lines)-maxShown:]
+		}
+		maxLineLen := m.width - 10
+		if maxLineLen < 20 {
+			maxLineLen = 20
+		}
+		contentLines = append(contentLines, "")
+		contentLines = append(contentLines, theme.TitleMuted.Render("Recent stderr:"))
+		for _, line := range lines {
+			if len(line) > maxLineLen {
+				line = line[:maxLineLen-3] + "..."
+			}
+			contentLines = append(contentLines, theme.TitleMuted.Render("  "+line))
+		}
+	}
+
 	// Build box
 	box := widgets.NewBox(p.ID).
 		WithContent(lipgloss.JoinVertical(lipgloss.Left, contentLines...)).
@@ -21,6 +21,7 @@ const (
 	ViewEvents    ViewID = "events"
 	ViewPipeline  ViewID = "pipeline"
 	ViewPlugins   ViewID = "plugins"
+	ViewConfig    ViewID = "config"
 	ViewStreams   ViewID = "streams"
 )
 
@@ -36,6 +37,7 @@ type RootModel struct {
 	events    EventLogModel
 	pipeline  PipelineModel
 	plugins   PluginModel
+	config    ConfigModel
 	streams   StreamsModel
 
 	publishAction               func(tui.ActionRequest) error
@@ -69,6 +71,7 @@ func NewRootModel(opts RootModelOptions) RootModel {
 		events:                      NewEventLogModel(),
 		pipeline:                    NewPipelineModel(),
 		plugins:                     NewPluginModel(),
+		config:                      NewConfigModel(),
 		streams:                     NewStreamsModel(),
 		publishAction:               opts.PublishAction,
 		publishStreamStart:          opts.PublishStreamStart,
@@ -116,6 +119,8 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			case ViewPipeline:
 				m.active = ViewPlugins
 			case ViewPlugins:
+				m.active = ViewConfig
+			case ViewConfig:
 				m.active = ViewStreams
 			case ViewStreams:
 				m.active = ViewDashboard
@@ -152,6 +157,10 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			var cmd tea.Cmd
 			m.plugins, cmd = m.plugins.Update(v)
 			return m, cmd
+		case ViewConfig:
+			var cmd tea.Cmd
+			m.config, cmd = m.config.Update(v)
+			return m, cmd
 		case ViewStreams:
 			var cmd tea.Cmd
 			m.streams, cmd = m.streams.Update(v)
@@ -161,6 +170,7 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.dashboard = m.dashboard.WithSnapshot(v.Snapshot)
 		m.service = m.service.WithSnapshot(v.Snapshot)
 		m.plugins = m.plugins.WithPlugins(v.Snapshot.Plugins)
+		m.config = m.config.WithSnapshot(v.Snapshot)
 		// Update system status for header
 		if v.Snapshot.Exists && v.Snapshot.State != nil {
 			m.startedAt = v.Snapshot.State.CreatedAt
@@ -329,6 +339,9 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				Text:   fmt.Sprintf("stream stop requested: %s", req.StreamKey),
 			}}
 		}
+	case tui.PluginStderrMsg:
+		m.plugins = m.plugins.WithStderr(v.Line)
+		return m, nil
 	case tui.PluginIntrospectionRefreshMsg:
 		if m.publishIntrospectionRefresh == nil {
 			m.events = m.events.Append(tui.EventLogEntry{
@@ -374,6 +387,10 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		var cmd tea.Cmd
 		m.plugins, cmd = m.plugins.Update(msg)
 		return m, cmd
+	case ViewConfig:
+		var cmd tea.Cmd
+		m.config, cmd = m.config.Update(msg)
+		return m, cmd
 	case ViewStreams:
 		var cmd tea.Cmd
 		m.streams, cmd = m.streams.Update(msg)
@@ -448,6 +465,8 @@ func (m RootModel) View() string {
 		content = m.pipeline.View()
 	case ViewPlugins:
 		content = m.plugins.View()
+	case ViewConfig:
+		content = m.config.View()
 	case ViewStreams:
 		content = m.streams.View()
 	case ViewDashboard:
@@ -487,6 +506,9 @@ func (m RootModel) View() string {
 			theme.KeybindKey.Render("Plugins")+":",
 			"  "+theme.TitleMuted.Render("↑/↓ select, enter expand, a expand all, A collapse all, r refresh, esc back"),
 			"",
+			theme.KeybindKey.Render("Config")+":",
+			"  "+theme.TitleMuted.Render("↑/↓ select key, r refresh, esc back"),
+			"",
 			theme.KeybindKey.Render("Streams")+":",
 			"  "+theme.TitleMuted.Render("n new (JSON), j/k select, ↑/↓ scroll, x stop, c clear, esc back"),
 		)
@@ -532,12 +554,15 @@ func (m RootModel) footerKeybinds() []widgets.Keybind {
 			{Key: "u", Label: "up"},
 			{Key: "d", Label: "down"},
 			{Key: "r", Label: "restart"},
+			{Key: "J", Label: "rerun job"},
 		}
 	case ViewService:
 		return []widgets.Keybind{
 			{Key: "tab", Label: "stream"},
 			{Key: "f", Label: "follow"},
 			{Key: "/", Label: "filter"},
+			{Key: "L", Label: "level"},
+			{Key: "[/]", Label: "run"},
 			{Key: "esc", Label: "back"},
 		}
 	case ViewEvents:
@@ -561,6 +586,12 @@ func (m RootModel) footerKeybinds() []widgets.Keybind {
 			{Key: "r", Label: "refresh"},
 			{Key: "esc", Label: "back"},
 		}
+	case ViewConfig:
+		return []widgets.Keybind{
+			{Key: "↑/↓", Label: "select"},
+			{Key: "r", Label: "refresh"},
+			{Key: "esc", Label: "back"},
+		}
 	case ViewStreams:
 		return []widgets.Keybind{
 			{Key: "n", Label: "new"},
@@ -595,6 +626,7 @@ func (m RootModel) applyChildSizes() RootModel {
 	m.events = m.events.WithSize(m.width, childHeight)
 	m.pipeline = m.pipeline.WithSize(m.width, childHeight)
 	m.plugins = m.plugins.WithSize(m.width, childHeight)
+	m.config = m.config.WithSize(m.width, childHeight)
 	m.streams = m.streams.WithSize(m.width, childHeight)
 	return m
 }
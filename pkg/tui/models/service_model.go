@@ -2,9 +2,13 @@ package models
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -12,6 +16,8 @@ import (
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/go-go-golems/devctl/pkg/limits"
+	"github.com/go-go-golems/devctl/pkg/logfiles"
 	"github.com/go-go-golems/devctl/pkg/state"
 	"github.com/go-go-golems/devctl/pkg/tui"
 	"github.com/go-go-golems/devctl/pkg/tui/styles"
@@ -23,6 +29,9 @@ type LogStream string
 const (
 	LogStdout LogStream = "stdout"
 	LogStderr LogStream = "stderr"
+	// LogCombined is both streams in arrival order, from the NDJSON log
+	// written with logs.combined.
+	LogCombined LogStream = "combined"
 )
 
 type logTickMsg struct{}
@@ -31,9 +40,68 @@ type logStreamState struct {
 	path      string
 	offset    int64
 	carry     string
-	lines     []string
+	lines     []logLine
 	lastErr   string
 	seenFirst bool
+	// ndjson lines are logfiles.Lines, shown as "time |" or "time !|".
+	ndjson bool
+	// parser is set when the service has logs.parsers.
+	parser *logfiles.Parser
+}
+
+// logLine is a displayed line; parsed lines have a level and show
+// "LEVEL message k=v".
+type logLine struct {
+	prefix string
+	level  string
+	text   string
+}
+
+func (l logLine) String() string {
+	if l.level == "" {
+		return l.prefix + l.text
+	}
+	return l.prefix + fmt.Sprintf("%-5s ", strings.ToUpper(l.level)) + l.text
+}
+
+func (s logStreamState) render(lines []string) []logLine {
+	out := make([]logLine, 0, len(lines))
+	for _, raw := range lines {
+		l := logfiles.Line{Text: raw}
+		prefix := ""
+		if s.ndjson {
+			if err := json.Unmarshal([]byte(raw), &l); err != nil {
+				out = append(out, logLine{text: raw})
+				continue
+			}
+			mark := " |"
+			if l.Stream == logfiles.Stderr {
+				mark = "!|"
+			}
+			prefix = l.Time.Local().Format("15:04:05.000") + mark + " "
+		}
+		parsed := []logfiles.Line{l}
+		if s.parser != nil {
+			parsed = s.parser.Parse(l)
+		}
+		for _, pl := range parsed {
+			if pl.Level == "" {
+				out = append(out, logLine{prefix: prefix, text: pl.Text})
+				continue
+			}
+			text := pl.Message
+			keys := make([]string, 0, len(pl.Fields))
+			for k := range pl.Fields {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				text += fmt.Sprintf(" %s=%v", k, pl.Fields[k])
+			}
+			out = append(out, logLine{prefix: prefix, level: pl.Level, text: text})
+		}
+	}
+	return out
 }
 
 type ServiceModel struct {
@@ -50,6 +118,14 @@ type ServiceModel struct {
 	searching bool
 	search    textinput.Model
 	filter    string
+	// minLevel hides parsed lines below it, and unparsed lines.
+	minLevel  string
+	parserErr string
+
+	// runs are the service's logged runs, newest first; runIdx > 0 shows
+	// runs[runIdx] instead of the files in the state.
+	runs   []logfiles.Run
+	runIdx int
 
 	exitInfo    *state.ExitInfo
 	exitInfoErr string
@@ -58,8 +134,9 @@ type ServiceModel struct {
 	maxLines  int
 	tickEvery time.Duration
 
-	stdout logStreamState
-	stderr logStreamState
+	stdout   logStreamState
+	stderr   logStreamState
+	combined logStreamState
 
 	vp viewport.Model
 }
@@ -103,8 +180,18 @@ func (m ServiceModel) WithService(name string) ServiceModel {
 	m.filter = ""
 	m.search.SetValue("")
 	m.search.Blur()
+	m.minLevel = ""
+	m.parserErr = ""
+	m.runs = nil
+	m.runIdx = 0
+	for _, s := range []logStreamState{m.stdout, m.stderr, m.combined} {
+		if s.parser != nil {
+			s.parser.Close()
+		}
+	}
 	m.stdout = logStreamState{}
 	m.stderr = logStreamState{}
+	m.combined = logStreamState{}
 	m.exitInfo = nil
 	m.exitInfoErr = ""
 	m = m.syncPathsFromSnapshot()
@@ -159,13 +246,26 @@ func (m ServiceModel) Update(msg tea.Msg) (ServiceModel, tea.Cmd) {
 			m = m.refreshViewportContent(true)
 			return m, nil
 		case "tab":
-			if m.active == LogStdout {
+			switch {
+			case m.active == LogStdout:
 				m.active = LogStderr
-			} else {
+			case m.active == LogStderr && m.combined.path != "":
+				m.active = LogCombined
+			default:
 				m.active = LogStdout
 			}
 			m = m.refreshViewportContent(true)
 			return m, nil
+		case "L":
+			if m.stdout.parser == nil {
+				return m, nil
+			}
+			m.minLevel = nextMinLevel(m.minLevel)
+			m = m.refreshViewportContent(true)
+			return m, nil
+		case "[", "]":
+			m = m.switchRun(v.String() == "[")
+			return m, nil
 		case "f":
 			m.follow = !m.follow
 			if m.follow {
@@ -229,11 +329,11 @@ func (m ServiceModel) View() string {
 	const processInfoHeight = 8 // PID, Command, Cwd, CPU/MEM, uptime, streams + border
 	const logBoxBorder = 3      // Top border + title + bottom border
 	exitBoxHeight := 0
-	if !alive {
+	if !alive || m.runIdx > 0 {
 		exitBoxHeight = m.exitInfoHeight()
 	}
 	errBoxHeight := 0
-	if errText := m.activeState().lastErr; errText != "" {
+	if m.errText() != "" {
 		errBoxHeight = 3 // border + content + border
 	}
 	searchHeight := 0
@@ -303,16 +403,34 @@ func (m ServiceModel) View() string {
 	// Build compact info lines
 	stdoutTab := "stdout"
 	stderrTab := "stderr"
-	if m.active == LogStdout {
+	combinedTab := ""
+	if m.combined.path != "" {
+		combinedTab = "/combined"
+	}
+	switch m.active {
+	case LogStdout:
 		stdoutTab = "[stdout]"
-	} else {
+	case LogStderr:
 		stderrTab = "[stderr]"
+	case LogCombined:
+		combinedTab = "/[combined]"
 	}
 
 	followText := "off"
 	if m.follow {
 		followText = "on"
 	}
+	runText := ""
+	if m.runIdx > 0 {
+		runText = fmt.Sprintf("  Run: %d (%s)", -m.runIdx, m.runs[m.runIdx].ID())
+	}
+	levelText := ""
+	if m.stdout.parser != nil {
+		levelText = "  Level: all"
+		if m.minLevel != "" {
+			levelText = "  Level: ≥" + m.minLevel
+		}
+	}
 
 	infoContent := lipgloss.JoinVertical(lipgloss.Left,
 		lipgloss.JoinHorizontal(lipgloss.Center,
@@ -335,8 +453,11 @@ func (m ServiceModel) View() string {
 			theme.TitleMuted.Render(stdoutTab),
 			theme.TitleMuted.Render("/"),
 			theme.TitleMuted.Render(stderrTab),
+			theme.TitleMuted.Render(combinedTab),
 			"  ",
 			theme.TitleMuted.Render("Follow: "+followText),
+			theme.TitleMuted.Render(levelText),
+			theme.TitleMuted.Render(runText),
 		),
 	)
 
@@ -365,13 +486,13 @@ func (m ServiceModel) View() string {
 	}
 
 	// Exit info for dead services (compact)
-	if !alive && exitBoxHeight > 0 {
+	if (!alive || m.runIdx > 0) && exitBoxHeight > 0 {
 		exitContent := m.renderCompactExitInfo(theme, exitBoxHeight-2) // -2 for border
 		sections = append(sections, exitContent)
 	}
 
 	// Log error if present
-	if errText := m.activeState().lastErr; errText != "" {
+	if errText := m.errText(); errText != "" {
 		// Truncate error text
 		if len(errText) > m.width-10 {
 			errText = errText[:m.width-13] + "..."
@@ -396,8 +517,12 @@ func (m ServiceModel) View() string {
 
 	// Log viewport in a box - uses remaining height
 	logTitle := fmt.Sprintf("Logs (%s)", m.active)
+	logKeys := "[↑/↓] scroll  [f] follow  [/] filter  [[/]] run"
+	if m.stdout.parser != nil {
+		logKeys += "  [L] level"
+	}
 	logBox := widgets.NewBox(logTitle).
-		WithTitleRight("[↑/↓] scroll  [f] follow  [/] filter").
+		WithTitleRight(logKeys).
 		WithContent(m.vp.View()).
 		WithSize(m.width, logViewportHeight)
 
@@ -437,7 +562,12 @@ func (m ServiceModel) renderCompactExitInfo(theme styles.Theme, maxLines int) st
 	// Exit status line with more info condensed
 	exitKind := "unknown"
 	exitIcon := styles.IconError
-	if ei.Signal != "" {
+	if ei.OOMKilled {
+		exitKind = "killed: OOM"
+		if ei.MemoryLimit > 0 {
+			exitKind += " (limit " + limits.FormatBytes(ei.MemoryLimit) + ")"
+		}
+	} else if ei.Signal != "" {
 		exitKind = "signal " + ei.Signal
 		exitIcon = styles.IconWarning
 	} else if ei.ExitCode != nil {
@@ -511,12 +641,12 @@ func (m ServiceModel) resizeViewport() ServiceModel {
 
 	_, alive, found := m.lookupService()
 	exitBoxHeight := 0
-	if found && !alive {
+	if found && (!alive || m.runIdx > 0) {
 		exitBoxHeight = m.exitInfoHeight()
 	}
 
 	errBoxHeight := 0
-	if errText := m.activeState().lastErr; errText != "" {
+	if m.errText() != "" {
 		errBoxHeight = 3
 	}
 
@@ -553,8 +683,11 @@ func (m ServiceModel) recalculateViewportHeight() ServiceModel {
 }
 
 func (m ServiceModel) activeState() *logStreamState {
-	if m.active == LogStderr {
+	switch m.active {
+	case LogStderr:
 		return &m.stderr
+	case LogCombined:
+		return &m.combined
 	}
 	return &m.stdout
 }
@@ -589,7 +722,16 @@ func (m ServiceModel) hasEnvVars() bool {
 	if !found || rec == nil {
 		return false
 	}
-	return len(rec.Env) > 0
+	return len(serviceEnv(rec)) > 0
+}
+
+// serviceEnv is the environment shown in the service view: the recorded
+// effective env (minus shell noise) or, for older state, the plan's env.
+func serviceEnv(rec *state.ServiceRecord) map[string]string {
+	if rec.EffectiveEnv == nil {
+		return rec.Env
+	}
+	return state.FilterEnvForDisplay(rec.EffectiveEnv, 0)
 }
 
 func (m ServiceModel) renderHealthInfo(theme styles.Theme) string {
@@ -655,17 +797,23 @@ func (m ServiceModel) renderHealthInfo(theme styles.Theme) string {
 }
 
 func (m ServiceModel) renderEnvVars(theme styles.Theme, rec *state.ServiceRecord) string {
-	if len(rec.Env) == 0 {
+	env := serviceEnv(rec)
+	if len(env) == 0 {
 		return ""
 	}
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
 
 	// Format env vars compactly
 	var parts []string
 	maxLen := m.width - 10
 	currentLen := 0
 
-	for k, v := range rec.Env {
-		pair := k + "=" + v
+	for _, k := range keys {
+		pair := k + "=" + env[k]
 		if len(pair) > 30 {
 			pair = pair[:27] + "..."
 		}
@@ -678,7 +826,11 @@ func (m ServiceModel) renderEnvVars(theme styles.Theme, rec *state.ServiceRecord
 
 	content := theme.TitleMuted.Render(strings.Join(parts, "  "))
 
-	box := widgets.NewBox(fmt.Sprintf("Environment (%d)", len(rec.Env))).
+	title := fmt.Sprintf("Environment (%d)", len(env))
+	if rec.EnvPolicy != "" {
+		title = fmt.Sprintf("Environment (%d, inherit: %s)", len(env), rec.EnvPolicy)
+	}
+	box := widgets.NewBox(title).
 		WithContent(content).
 		WithSize(m.width, 4)
 
@@ -706,12 +858,99 @@ func (m ServiceModel) syncPathsFromSnapshot() ServiceModel {
 	if !found || rec == nil {
 		return m
 	}
+	m.combined.ndjson = true
+	if m.runIdx > 0 {
+		return m.loadParsers(rec)
+	}
 	m.stdout.path = rec.StdoutLog
 	m.stderr.path = rec.StderrLog
+	m.combined.path = rec.CombinedLog
+	if m.combined.path == "" && m.active == LogCombined {
+		m.active = LogStdout
+	}
+	return m.loadParsers(rec)
+}
+
+func (m ServiceModel) loadParsers(rec *state.ServiceRecord) ServiceModel {
+	if len(rec.LogParsers) > 0 && m.stdout.parser == nil && m.parserErr == "" {
+		for _, s := range []*logStreamState{&m.stdout, &m.stderr, &m.combined} {
+			p, err := logfiles.LoadParser(context.Background(), rec.LogParsers)
+			if err != nil {
+				m.parserErr = err.Error()
+				break
+			}
+			s.parser = p
+		}
+	}
 	return m
 }
 
+// switchRun steps to an older or newer run of the service. Run 0 shows the
+// files in the state, so it follows restarts.
+func (m ServiceModel) switchRun(older bool) ServiceModel {
+	rec, _, found := m.lookupService()
+	if !found || rec == nil || rec.StdoutLog == "" {
+		return m
+	}
+	runs, err := logfiles.Runs(filepath.Dir(rec.StdoutLog))
+	if err != nil {
+		return m
+	}
+	m.runs = logfiles.ServiceRuns(runs, m.name)
+	idx := m.runIdx
+	if older {
+		idx++
+	} else {
+		idx--
+	}
+	if idx < 0 || idx >= len(m.runs) {
+		return m
+	}
+	m.runIdx = idx
+	if idx == 0 {
+		m = m.syncPathsFromSnapshot()
+		m = m.syncExitInfoFromSnapshot()
+	} else {
+		r := m.runs[idx]
+		m.stdout.path = r.Path("stdout.log")
+		m.stderr.path = r.Path("stderr.log")
+		m.combined.path = r.Path("ndjson")
+		if m.combined.path == "" && m.active == LogCombined {
+			m.active = LogStdout
+		}
+		m.exitInfo, m.exitInfoErr = nil, ""
+		if ei, err := state.ReadExitInfo(r.Path("exit.json")); err == nil {
+			m.exitInfo = ei
+		} else {
+			m.exitInfoErr = "no exit info recorded"
+		}
+	}
+	m = m.loadInitialTail()
+	return m.recalculateViewportHeight()
+}
+
+func (m ServiceModel) errText() string {
+	if e := m.activeState().lastErr; e != "" {
+		return e
+	}
+	return m.parserErr
+}
+
+// nextMinLevel cycles the level filter: all, debug, info, warn, error.
+func nextMinLevel(cur string) string {
+	cycle := []string{"", "debug", "info", "warn", "error"}
+	for i, l := range cycle {
+		if l == cur {
+			return cycle[(i+1)%len(cycle)]
+		}
+	}
+	return ""
+}
+
 func (m ServiceModel) syncExitInfoFromSnapshot() ServiceModel {
+	if m.runIdx > 0 {
+		return m
+	}
 	rec, alive, found := m.lookupService()
 	if !found || rec == nil {
 		m.exitInfo = nil
@@ -743,6 +982,9 @@ func (m ServiceModel) syncExitInfoFromSnapshot() ServiceModel {
 func (m ServiceModel) loadInitialTail() ServiceModel {
 	m.stdout = m.loadTailForStream(m.stdout)
 	m.stderr = m.loadTailForStream(m.stderr)
+	if m.combined.path != "" {
+		m.combined = m.loadTailForStream(m.combined)
+	}
 	m = m.refreshViewportContent(true)
 	return m
 }
@@ -764,7 +1006,7 @@ func (m ServiceModel) loadTailForStream(s logStreamState) logStreamState {
 		s.lastErr = err.Error()
 		return s
 	}
-	s.lines = lines
+	s.lines = s.render(lines)
 	s.offset = offset
 	return s
 }
@@ -772,6 +1014,9 @@ func (m ServiceModel) loadTailForStream(s logStreamState) logStreamState {
 func (m ServiceModel) tickReadAll() ServiceModel {
 	m.stdout = m.readNewBytes(m.stdout)
 	m.stderr = m.readNewBytes(m.stderr)
+	if m.combined.path != "" {
+		m.combined = m.readNewBytes(m.combined)
+	}
 	return m
 }
 
@@ -801,8 +1046,8 @@ func (m ServiceModel) readNewBytes(s logStreamState) logStreamState {
 	}
 	size := info.Size()
 	if size < s.offset {
+		// Rotated: the lines read so far stay, reading restarts on the new file.
 		s.offset = 0
-		s.lines = nil
 		s.carry = ""
 	}
 
@@ -833,9 +1078,9 @@ func (m ServiceModel) readNewBytes(s logStreamState) logStreamState {
 			parts = parts[:len(parts)-1]
 		}
 	}
-	s.lines = append(s.lines, parts...)
+	s.lines = append(s.lines, s.render(parts)...)
 	if m.maxLines > 0 && len(s.lines) > m.maxLines {
-		s.lines = append([]string{}, s.lines[len(s.lines)-m.maxLines:]...)
+		s.lines = append([]logLine{}, s.lines[len(s.lines)-m.maxLines:]...)
 	}
 	return s
 }
@@ -846,15 +1091,16 @@ func (m ServiceModel) refreshViewportContent(gotoBottom bool) ServiceModel {
 	if len(s.lines) == 0 {
 		content = "(no log lines yet)\n"
 	} else {
-		lines := s.lines
-		if m.filter != "" {
-			filtered := make([]string, 0, len(lines))
-			for _, line := range lines {
-				if strings.Contains(line, m.filter) {
-					filtered = append(filtered, line)
-				}
+		theme := styles.DefaultTheme()
+		lines := make([]string, 0, len(s.lines))
+		for _, line := range s.lines {
+			if m.minLevel != "" && logfiles.LevelRank(line.level) < logfiles.LevelRank(m.minLevel) {
+				continue
+			}
+			if m.filter != "" && !strings.Contains(line.String(), m.filter) {
+				continue
 			}
-			lines = filtered
+			lines = append(lines, renderLogLine(theme, line))
 		}
 		if len(lines) == 0 {
 			content = "(no matching lines)\n"
@@ -869,6 +1115,22 @@ func (m ServiceModel) refreshViewportContent(gotoBottom bool) ServiceModel {
 	return m
 }
 
+func renderLogLine(theme styles.Theme, l logLine) string {
+	if l.level == "" {
+		return l.String()
+	}
+	label := fmt.Sprintf("%-5s", strings.ToUpper(l.level))
+	switch l.level {
+	case "error", "fatal":
+		label = lipgloss.NewStyle().Foreground(theme.Error).Bold(true).Render(label)
+	case "warn":
+		label = lipgloss.NewStyle().Foreground(theme.Warning).Render(label)
+	case "debug", "trace":
+		label = lipgloss.NewStyle().Foreground(theme.Muted).Render(label)
+	}
+	return l.prefix + label + " " + l.text
+}
+
 func readTailLines(path string, tailLines int, maxBytes int64) ([]string, int64, error) {
 	if tailLines <= 0 {
 		tailLines = 200
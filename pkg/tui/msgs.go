@@ -88,3 +88,7 @@ type StreamEndedMsg struct {
 }
 
 type PluginIntrospectionRefreshMsg struct{}
+
+type PluginStderrMsg struct {
+	Line PluginStderrLine
+}
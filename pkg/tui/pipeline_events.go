@@ -16,8 +16,10 @@ const (
 	PipelinePhaseLaunchPlan   PipelinePhase = "launch_plan"
 	PipelinePhaseSupervise    PipelinePhase = "supervise"
 	PipelinePhaseStateSave    PipelinePhase = "state_save"
+	PipelinePhaseHealthCheck  PipelinePhase = "health_check"
 
 	PipelinePhaseStopSupervise PipelinePhase = "stop_supervise"
+	PipelinePhaseTeardown      PipelinePhase = "teardown"
 	PipelinePhaseRemoveState   PipelinePhase = "remove_state"
 )
 
@@ -109,3 +111,15 @@ type PipelineLaunchPlan struct {
 	At       time.Time `json:"at"`
 	Services []string  `json:"services,omitempty"`
 }
+
+// PipelineHookResult reports a service lifecycle hook (pre_start, post_start,
+// pre_stop, post_stop).
+type PipelineHookResult struct {
+	RunID      string    `json:"run_id"`
+	At         time.Time `json:"at"`
+	Service    string    `json:"service"`
+	Hook       string    `json:"hook"`
+	Ok         bool      `json:"ok"`
+	DurationMs int64     `json:"duration_ms,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
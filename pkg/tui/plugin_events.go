@@ -0,0 +1,37 @@
+package tui
+
+import (
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// PluginStderrLine is a single line a plugin process wrote to stderr.
+type PluginStderrLine struct {
+	PluginID string    `json:"plugin_id"`
+	At       time.Time `json:"at"`
+	Line     string    `json:"line"`
+}
+
+func publishPluginStderr(pub message.Publisher, ev PluginStderrLine) error {
+	env, err := NewEnvelope(DomainTypePluginStderr, ev)
+	if err != nil {
+		return err
+	}
+	b, err := env.MarshalJSONBytes()
+	if err != nil {
+		return err
+	}
+	return pub.Publish(TopicDevctlEvents, message.NewMessage(watermill.NewUUID(), b))
+}
+
+// pluginStderrPublisher adapts the bus to runtime.FactoryOptions.OnStderr.
+func pluginStderrPublisher(pub message.Publisher) func(pluginID string, line string) {
+	if pub == nil {
+		return nil
+	}
+	return func(pluginID string, line string) {
+		_ = publishPluginStderr(pub, PluginStderrLine{PluginID: pluginID, At: time.Now(), Line: line})
+	}
+}
@@ -8,4 +8,10 @@ type RootOptions struct {
 	Strict   bool
 	DryRun   bool
 	Timeout  time.Duration
+	Profile  string
+	Instance string
+	// Workspace makes up start devctl.workspace.yaml in RepoRoot.
+	Workspace bool
+
+	AllowUntrusted bool
 }
@@ -3,6 +3,8 @@ package tui
 import (
 	"time"
 
+	"github.com/go-go-golems/devctl/pkg/engine"
+	"github.com/go-go-golems/devctl/pkg/patch"
 	"github.com/go-go-golems/devctl/pkg/proc"
 	"github.com/go-go-golems/devctl/pkg/state"
 )
@@ -60,4 +62,9 @@ type StateSnapshot struct {
 	ProcessStats map[int]*proc.Stats           `json:"process_stats,omitempty"` // PID -> stats
 	Health       map[string]*HealthCheckResult `json:"health,omitempty"`        // service name -> health
 	Plugins      []PluginSummary               `json:"plugins,omitempty"`       // Plugin summaries
+	Facts        *engine.StatusDescribeResult  `json:"facts,omitempty"`         // status.describe output
+	FactsError   string                        `json:"facts_error,omitempty"`
+	Config       patch.Config                  `json:"config,omitempty"`        // config.mutate result
+	ConfigWrites []patch.Write                 `json:"config_writes,omitempty"` // provenance, oldest first
+	ConfigError  string                        `json:"config_error,omitempty"`
 }
@@ -15,6 +15,8 @@ import (
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/go-go-golems/devctl/pkg/config"
+	"github.com/go-go-golems/devctl/pkg/engine"
+	"github.com/go-go-golems/devctl/pkg/patch"
 	"github.com/go-go-golems/devctl/pkg/proc"
 	"github.com/go-go-golems/devctl/pkg/protocol"
 	"github.com/go-go-golems/devctl/pkg/repository"
@@ -33,6 +35,8 @@ type pluginIntrospection struct {
 
 type StateWatcher struct {
 	RepoRoot string
+	Profile  string
+	Instance string
 	Interval time.Duration
 	Pub      message.Publisher
 
@@ -43,6 +47,13 @@ type StateWatcher struct {
 	introspectCh chan struct{}
 	capsMu       sync.RWMutex
 	capsByID     map[string]pluginIntrospection
+
+	lastCreatedAt time.Time
+	facts         *engine.StatusDescribeResult
+	factsErr      string
+	config        patch.Config
+	configWrites  []patch.Write
+	configErr     string
 }
 
 func (w *StateWatcher) Run(ctx context.Context) error {
@@ -118,7 +129,7 @@ func (w *StateWatcher) runIntrospection(ctx context.Context) {
 		return
 	}
 
-	repo, err := repository.Load(repository.Options{RepoRoot: w.RepoRoot, ConfigPath: "", Cwd: w.RepoRoot})
+	repo, err := repository.Load(repository.Options{RepoRoot: w.RepoRoot, ConfigPath: "", Cwd: w.RepoRoot, Profile: w.Profile, Instance: w.Instance, SkipUntrusted: true})
 	if err != nil {
 		return
 	}
@@ -126,6 +137,7 @@ func (w *StateWatcher) runIntrospection(ctx context.Context) {
 	factory := runtime.NewFactory(runtime.FactoryOptions{
 		HandshakeTimeout: 2 * time.Second,
 		ShutdownTimeout:  2 * time.Second,
+		OnStderr:         pluginStderrPublisher(w.Pub),
 	})
 
 	for _, spec := range repo.Specs {
@@ -156,6 +168,89 @@ func (w *StateWatcher) runIntrospection(ctx context.Context) {
 			Handshake:  hs,
 		})
 	}
+
+	w.resolve(ctx, repo, factory)
+}
+
+// resolve folds config.mutate (with provenance) for the config inspector and,
+// when state exists and a plugin declared the op, refreshes status.describe facts.
+func (w *StateWatcher) resolve(ctx context.Context, repo *repository.Repository, factory *runtime.Factory) {
+	if len(repo.Specs) == 0 {
+		w.setConfig(nil, nil, "")
+		w.setFacts(nil, "")
+		return
+	}
+
+	clients, err := repo.StartClients(ctx, factory)
+	if err != nil {
+		w.setConfig(nil, nil, err.Error())
+		w.setFacts(nil, "")
+		return
+	}
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_ = repository.CloseClients(closeCtx, clients)
+	}()
+
+	prov := &patch.Provenance{}
+	p := &engine.Pipeline{
+		Clients:    clients,
+		Opts:       engine.Options{Strict: repo.Config.Strictness == "error"},
+		Provenance: prov,
+	}
+	opCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	conf, err := repo.MutateConfig(opCtx, p)
+	if err != nil {
+		w.setConfig(nil, prov.Writes, err.Error())
+		w.setFacts(nil, "")
+		return
+	}
+	w.setConfig(conf, prov.Writes, "")
+
+	st, err := state.Load(w.RepoRoot, w.Instance)
+	if err != nil || !p.Supports("status.describe") {
+		w.setFacts(nil, "")
+		return
+	}
+	services := make([]string, 0, len(st.Services))
+	for _, svc := range st.Services {
+		services = append(services, svc.Name)
+	}
+	res, err := p.StatusDescribe(opCtx, conf, services)
+	if err != nil {
+		w.setFacts(nil, err.Error())
+		return
+	}
+	w.setFacts(&res, "")
+}
+
+func (w *StateWatcher) setConfig(conf patch.Config, writes []patch.Write, errText string) {
+	w.capsMu.Lock()
+	defer w.capsMu.Unlock()
+	w.config = conf
+	w.configWrites = writes
+	w.configErr = errText
+}
+
+func (w *StateWatcher) currentConfig() (patch.Config, []patch.Write, string) {
+	w.capsMu.RLock()
+	defer w.capsMu.RUnlock()
+	return w.config, w.configWrites, w.configErr
+}
+
+func (w *StateWatcher) setFacts(facts *engine.StatusDescribeResult, errText string) {
+	w.capsMu.Lock()
+	defer w.capsMu.Unlock()
+	w.facts = facts
+	w.factsErr = errText
+}
+
+func (w *StateWatcher) currentFacts() (*engine.StatusDescribeResult, string) {
+	w.capsMu.RLock()
+	defer w.capsMu.RUnlock()
+	return w.facts, w.factsErr
 }
 
 func (w *StateWatcher) updateIntrospection(id string, info pluginIntrospection) {
@@ -169,7 +264,7 @@ func (w *StateWatcher) emitSnapshot(ctx context.Context) error {
 	// Always read plugins from config, regardless of state existence
 	plugins := w.readPlugins()
 
-	path := state.StatePath(w.RepoRoot)
+	path := state.StatePath(w.RepoRoot, w.Instance)
 	_, err := os.Stat(path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -182,7 +277,7 @@ func (w *StateWatcher) emitSnapshot(ctx context.Context) error {
 		return w.publishSnapshot(StateSnapshot{RepoRoot: w.RepoRoot, At: time.Now(), Exists: true, Error: errors.Wrap(err, "stat state").Error(), Plugins: plugins})
 	}
 
-	st, err := state.Load(w.RepoRoot)
+	st, err := state.Load(w.RepoRoot, w.Instance)
 	if err != nil {
 		w.lastAlive = nil
 		w.lastExists = true
@@ -198,7 +293,8 @@ func (w *StateWatcher) emitSnapshot(ctx context.Context) error {
 		for _, svc := range st.Services {
 			prev := w.lastAlive[svc.Name]
 			now := alive[svc.Name]
-			if prev && !now {
+			// A job that ends is not a crash; the dashboard shows its outcome.
+			if prev && !now && !svc.IsJob() {
 				if err := w.publishServiceExit(ServiceExitObserved{
 					Name:   svc.Name,
 					PID:    svc.PID,
@@ -214,6 +310,13 @@ func (w *StateWatcher) emitSnapshot(ctx context.Context) error {
 	w.lastAlive = alive
 	w.lastExists = true
 
+	// A new run means new facts; the introspection loop refreshes them.
+	if !st.CreatedAt.Equal(w.lastCreatedAt) {
+		w.lastCreatedAt = st.CreatedAt
+		w.requestIntrospection()
+	}
+	facts, factsErr := w.currentFacts()
+
 	// Read process stats for all alive processes
 	var pids []int
 	for _, svc := range st.Services {
@@ -241,16 +344,19 @@ func (w *StateWatcher) emitSnapshot(ctx context.Context) error {
 		ProcessStats: processStats,
 		Health:       health,
 		Plugins:      plugins,
+		Facts:        facts,
+		FactsError:   factsErr,
 	})
 }
 
 // readPlugins reads plugin info from the devctl config file.
 func (w *StateWatcher) readPlugins() []PluginSummary {
 	cfgPath := config.DefaultPath(w.RepoRoot)
-	cfg, err := config.LoadOptional(cfgPath)
-	if err != nil || cfg == nil {
+	layers, err := config.LoadLayered(cfgPath)
+	if err != nil {
 		return nil
 	}
+	cfg := layers.File
 
 	plugins := make([]PluginSummary, 0, len(cfg.Plugins))
 	for _, p := range cfg.Plugins {
@@ -423,6 +529,8 @@ func (w *StateWatcher) checkHTTP(url string) error {
 }
 
 func (w *StateWatcher) publishSnapshot(snap StateSnapshot) error {
+	// The resolved config is independent of whether services are running.
+	snap.Config, snap.ConfigWrites, snap.ConfigError = w.currentConfig()
 	env, err := NewEnvelope(DomainTypeStateSnapshot, snap)
 	if err != nil {
 		return err
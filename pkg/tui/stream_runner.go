@@ -46,6 +46,7 @@ func RegisterUIStreamRunner(tuiCtx context.Context, bus *Bus, opts RootOptions)
 		factory: runtime.NewFactory(runtime.FactoryOptions{
 			HandshakeTimeout: 2 * time.Second,
 			ShutdownTimeout:  3 * time.Second,
+			OnStderr:         pluginStderrPublisher(bus.Publisher),
 		}),
 		opts:   opts,
 		pub:    bus.Publisher,
@@ -95,7 +96,7 @@ func (m *streamManager) handleStart(req StreamStartRequest) error {
 		}
 	}()
 
-	repo, err := repository.Load(repository.Options{RepoRoot: m.opts.RepoRoot, ConfigPath: m.opts.Config, Cwd: m.opts.RepoRoot, DryRun: m.opts.DryRun})
+	repo, err := repository.Load(repository.Options{RepoRoot: m.opts.RepoRoot, ConfigPath: m.opts.Config, Cwd: m.opts.RepoRoot, DryRun: m.opts.DryRun, Profile: m.opts.Profile, Instance: m.opts.Instance, AllowUntrusted: m.opts.AllowUntrusted})
 	if err != nil {
 		_ = m.publishStreamEnded(StreamEnded{
 			StreamKey: streamKey(req.PluginID, req.Op, req.Input),
@@ -19,10 +19,13 @@ const (
 	DomainTypePipelinePrepareResult  = "pipeline.prepare.result"
 	DomainTypePipelineValidateResult = "pipeline.validate.result"
 	DomainTypePipelineLaunchPlan     = "pipeline.launch.plan"
+	DomainTypePipelineHookResult     = "pipeline.hook.result"
 
 	DomainTypeStreamStarted = "stream.started"
 	DomainTypeStreamEvent   = "stream.event"
 	DomainTypeStreamEnded   = "stream.ended"
+
+	DomainTypePluginStderr = "plugin.stderr"
 )
 
 const (
@@ -44,4 +47,6 @@ const (
 	UITypeStreamStarted      = "tui.stream.started"
 	UITypeStreamEvent        = "tui.stream.event"
 	UITypeStreamEnded        = "tui.stream.ended"
+
+	UITypePluginStderr = "tui.plugin.stderr"
 )
@@ -149,6 +149,15 @@ func RegisterDomainToUITransformer(bus *Bus) {
 			}
 			return publishUI(UITypePipelineLaunchPlan, ev)
 
+		case DomainTypePipelineHookResult:
+			var ev PipelineHookResult
+			if err := json.Unmarshal(env.Payload, &ev); err != nil {
+				return errors.Wrap(err, "unmarshal pipeline hook result")
+			}
+			if ev.Ok {
+				return publishEventText(ev.At, ev.Service, LogLevelInfo, fmt.Sprintf("hook %s: ok (%dms)", ev.Hook, ev.DurationMs))
+			}
+			return publishEventText(ev.At, ev.Service, LogLevelError, fmt.Sprintf("hook %s failed: %s", ev.Hook, ev.Error))
 		case DomainTypeStreamStarted:
 			var ev StreamStarted
 			if err := json.Unmarshal(env.Payload, &ev); err != nil {
@@ -183,6 +192,14 @@ func RegisterDomainToUITransformer(bus *Bus) {
 			}
 			return publishEventText(ev.At, "streams", level, text)
 
+		case DomainTypePluginStderr:
+			var ev PluginStderrLine
+			if err := json.Unmarshal(env.Payload, &ev); err != nil {
+				return errors.Wrap(err, "unmarshal plugin stderr")
+			}
+			// Like stream events, stderr can be chatty; keep it out of the global event log.
+			return publishUI(UITypePluginStderr, ev)
+
 		default:
 			return nil
 		}
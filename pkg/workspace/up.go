@@ -0,0 +1,420 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/devctl/pkg/engine"
+	"github.com/go-go-golems/devctl/pkg/patch"
+	"github.com/go-go-golems/devctl/pkg/repository"
+	"github.com/go-go-golems/devctl/pkg/runtime"
+	"github.com/go-go-golems/devctl/pkg/state"
+	"github.com/go-go-golems/devctl/pkg/supervise"
+	"github.com/go-go-golems/devctl/pkg/trust"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+type UpOptions struct {
+	Instance   string
+	Strict     bool
+	DryRun     bool
+	Timeout    time.Duration
+	WrapperExe string
+
+	SkipBuild    bool
+	SkipPrepare  bool
+	SkipValidate bool
+
+	AllowUntrusted bool
+	ConfirmTrust   func([]trust.Finding) (bool, error)
+	// OnStderr receives plugin stderr lines (e.g. for the TUI).
+	OnStderr func(pluginID, line string)
+	// OnHook receives service lifecycle hook results; see supervise.Options.
+	OnHook func(supervise.HookResult)
+}
+
+// RepoResult is what one member's pipeline produced.
+type RepoResult struct {
+	Config   patch.Config           `json:"config"`
+	Validate *engine.ValidateResult `json:"validate,omitempty"`
+	Plan     engine.LaunchPlan      `json:"plan"`
+}
+
+// UpResult is the outcome of Up. State is nil for dry runs.
+type UpResult struct {
+	Repos map[string]RepoResult `json:"repos"`
+	State *state.State          `json:"-"`
+}
+
+// Up runs every member's pipeline in dependency order and starts its services
+// before moving on, so a repo only starts once its dependencies are healthy.
+// Each member's initial config carries workspace.<key> from the workspace file
+// and repos.<name> for every member configured before it. On failure all
+// services started so far are stopped. The caller saves the returned state.
+func Up(ctx context.Context, ws *Workspace, opts UpOptions) (*UpResult, error) {
+	order, err := ws.Order()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+
+	res := &UpResult{Repos: map[string]RepoResult{}}
+	st := &state.State{
+		RepoRoot:  ws.Root,
+		Instance:  opts.Instance,
+		Workspace: Path(ws.Root),
+		CreatedAt: time.Now(),
+		Services:  []state.ServiceRecord{},
+	}
+	shared := map[string]any{}
+	planned := map[string]bool{}
+	fail := func(err error) (*UpResult, error) {
+		if len(st.Services) > 0 {
+			_ = supervise.New(supervise.Options{RepoRoot: ws.Root, Instance: opts.Instance}).Stop(context.Background(), st)
+		}
+		return nil, err
+	}
+
+	for _, r := range order {
+		log.Info().Str("repo", r.Name).Str("path", r.Path).Msg("workspace repo")
+		rr, sub, err := upRepo(ctx, ws, r, shared, planned, opts)
+		if sub != nil {
+			st.Services = append(st.Services, sub.Services...)
+		}
+		if err != nil {
+			return fail(errors.Wrapf(err, "repo %s", r.Name))
+		}
+		res.Repos[r.Name] = rr
+		shared[r.Name] = ownConfig(rr.Config)
+		for _, svc := range rr.Plan.Services {
+			planned[svc.Name] = true
+		}
+	}
+	if !opts.DryRun {
+		res.State = st
+	}
+	return res, nil
+}
+
+// upRepo runs one member. The returned state holds whatever was started, also
+// on error, so the caller can stop it.
+func upRepo(ctx context.Context, ws *Workspace, r Repo, shared map[string]any, planned map[string]bool, opts UpOptions) (RepoResult, *state.State, error) {
+	var rr RepoResult
+	repo, err := repository.Load(repository.Options{
+		RepoRoot:       r.Path,
+		ConfigPath:     r.Config,
+		Cwd:            r.Path,
+		DryRun:         opts.DryRun,
+		Profile:        r.Profile,
+		Instance:       opts.Instance,
+		AllocatePorts:  !opts.DryRun,
+		AllowUntrusted: opts.AllowUntrusted,
+		ConfirmTrust:   opts.ConfirmTrust,
+	})
+	if err != nil {
+		return rr, nil, err
+	}
+	if !repo.HasPlugins() {
+		return rr, nil, errors.New("no plugins or services configured")
+	}
+
+	factory := runtime.NewFactory(runtime.FactoryOptions{
+		HandshakeTimeout: 2 * time.Second,
+		ShutdownTimeout:  3 * time.Second,
+		OnStderr:         opts.OnStderr,
+	})
+	clients, err := repo.StartClients(ctx, factory)
+	if err != nil {
+		return rr, nil, err
+	}
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_ = repository.CloseClients(closeCtx, clients)
+	}()
+
+	p := &engine.Pipeline{
+		Clients: clients,
+		Opts: engine.Options{
+			Strict:   opts.Strict || repo.Config.Strictness == "error",
+			DryRun:   opts.DryRun,
+			RepoRoot: repo.Root,
+			Instance: repo.Instance,
+		},
+	}
+	conf, err := memberConfig(ctx, ws, repo, p, shared, opts.Timeout)
+	if err != nil {
+		return rr, nil, err
+	}
+	rr.Config = conf
+
+	var opCtx context.Context
+	var cancel context.CancelFunc
+	if !opts.SkipBuild {
+		opCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		_, err = p.Build(opCtx, conf, nil)
+		cancel()
+		if err != nil {
+			return rr, nil, err
+		}
+	}
+	if !opts.SkipPrepare {
+		opCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		_, err = p.Prepare(opCtx, conf, nil)
+		cancel()
+		if err != nil {
+			return rr, nil, err
+		}
+	}
+	if !opts.SkipValidate {
+		opCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		vr, err := p.Validate(opCtx, conf)
+		cancel()
+		if err != nil {
+			return rr, nil, err
+		}
+		rr.Validate = &vr
+		if !vr.Valid {
+			msgs := make([]string, 0, len(vr.Errors))
+			for _, e := range vr.Errors {
+				msgs = append(msgs, fmt.Sprintf("%s: %s", e.Code, e.Message))
+			}
+			return rr, nil, errors.Errorf("validation failed: %s", strings.Join(msgs, "; "))
+		}
+	}
+
+	opCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+	plan, err := p.LaunchPlan(opCtx, conf)
+	cancel()
+	if err != nil {
+		return rr, nil, err
+	}
+	plan = repo.FilterPlan(plan)
+	rr.Plan = prefixPlan(r, plan)
+	local, err := localPlan(r, rr.Plan, planned)
+	if err != nil {
+		return rr, nil, err
+	}
+	if opts.DryRun {
+		return rr, nil, nil
+	}
+
+	logPolicy, err := repo.LogPolicy()
+	if err != nil {
+		return rr, nil, err
+	}
+	sup := supervise.New(supervise.Options{
+		RepoRoot:     ws.Root,
+		Instance:     opts.Instance,
+		ReadyTimeout: opts.Timeout,
+		WrapperExe:   opts.WrapperExe,
+		Secrets:      repo.Secrets(),
+		EnvPolicy:    repo.DefaultEnvPolicy(),
+		Ports:        repo.Ports,
+		OnHook:       opts.OnHook,
+		Logs:         logPolicy,
+	})
+	st, err := sup.Start(ctx, local)
+	if err != nil {
+		return rr, nil, err
+	}
+
+	if p.Supports("health.check") {
+		names := make([]string, 0, len(plan.Services))
+		for _, svc := range plan.Services {
+			names = append(names, svc.Name)
+		}
+		opCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		_, err := p.WaitHealthy(opCtx, conf, names, 500*time.Millisecond)
+		cancel()
+		if err != nil {
+			return rr, st, err
+		}
+	}
+	return rr, st, nil
+}
+
+// memberConfig builds a member's config as up does: its initial config with
+// workspace.<key> and repos.<name> for the members in shared, mutated by its
+// plugins. Teardown rebuilds it the same way.
+func memberConfig(ctx context.Context, ws *Workspace, repo *repository.Repository, p *engine.Pipeline, shared map[string]any, timeout time.Duration) (patch.Config, error) {
+	initial, err := initialConfig(repo, ws.Config, shared)
+	if err != nil {
+		return nil, err
+	}
+	opCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return p.MutateConfig(opCtx, initial)
+}
+
+func initialConfig(repo *repository.Repository, wsConfig map[string]any, shared map[string]any) (patch.Config, error) {
+	cfg, err := repo.InitialConfig(nil)
+	if err != nil {
+		return nil, err
+	}
+	set := map[string]any{}
+	if len(wsConfig) > 0 {
+		set["workspace"] = wsConfig
+	}
+	if len(shared) > 0 {
+		set["repos"] = shared
+	}
+	if len(set) == 0 {
+		return cfg, nil
+	}
+	return patch.Apply(cfg, patch.ConfigPatch{SetDefault: set})
+}
+
+// ownConfig drops the shared namespaces from a member's config so repos.<name>
+// does not nest every earlier member again.
+func ownConfig(cfg patch.Config) patch.Config {
+	out := make(patch.Config, len(cfg))
+	for k, v := range cfg {
+		if k != "workspace" && k != "repos" {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// Teardown runs teardown.run in every member that had services in st, in
+// reverse dependency order, passing each repo its own service names. Every
+// member's config is rebuilt first, in up's order, so teardown sees the same
+// workspace.<key> and repos.<name> values that up did.
+func Teardown(ctx context.Context, ws *Workspace, st *state.State, opts UpOptions) error {
+	order, err := ws.Order()
+	if err != nil {
+		return err
+	}
+	byRepo := map[string][]string{}
+	for _, svc := range st.Services {
+		if repo, name, ok := SplitServiceName(svc.Name); ok {
+			byRepo[repo] = append(byRepo[repo], name)
+		}
+	}
+
+	members := make([]*member, len(order))
+	defer func() {
+		for _, m := range members {
+			if m != nil {
+				m.close()
+			}
+		}
+	}()
+	shared := map[string]any{}
+	var failed []string
+	for i, r := range order {
+		m, err := openMember(ctx, ws, r, shared, opts)
+		if err != nil {
+			if _, ok := byRepo[r.Name]; ok {
+				log.Error().Err(err).Str("repo", r.Name).Msg("workspace teardown failed")
+				failed = append(failed, r.Name)
+			}
+			continue
+		}
+		members[i] = m
+		shared[r.Name] = ownConfig(m.conf)
+	}
+	for i := len(order) - 1; i >= 0; i-- {
+		services, ok := byRepo[order[i].Name]
+		if !ok || members[i] == nil {
+			continue
+		}
+		if err := members[i].teardown(ctx, services, opts.Timeout); err != nil {
+			log.Error().Err(err).Str("repo", order[i].Name).Msg("workspace teardown failed")
+			failed = append(failed, order[i].Name)
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("teardown failed for: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// StopHooksTrusted reports whether the stop hooks recorded in st may run:
+// every repo the state came from (the one in opts, or each workspace member)
+// must pass repository.StopHooksTrusted.
+func StopHooksTrusted(st *state.State, opts repository.Options) bool {
+	if st.Workspace == "" {
+		return repository.StopHooksTrusted(opts)
+	}
+	ws, err := Load(opts.RepoRoot)
+	if err != nil {
+		return false
+	}
+	for _, r := range ws.Repos {
+		if !repository.StopHooksTrusted(repository.Options{RepoRoot: r.Path, ConfigPath: r.Config, Cwd: r.Path, Profile: r.Profile, Instance: opts.Instance, AllowUntrusted: opts.AllowUntrusted}) {
+			return false
+		}
+	}
+	return true
+}
+
+// member is a workspace repo opened for teardown, with its plugins running.
+type member struct {
+	p    *engine.Pipeline
+	conf patch.Config
+}
+
+// openMember loads r, starts its trusted plugins and rebuilds its config.
+func openMember(ctx context.Context, ws *Workspace, r Repo, shared map[string]any, opts UpOptions) (*member, error) {
+	repo, err := repository.Load(repository.Options{
+		RepoRoot:       r.Path,
+		ConfigPath:     r.Config,
+		Cwd:            r.Path,
+		Profile:        r.Profile,
+		Instance:       opts.Instance,
+		AllowUntrusted: opts.AllowUntrusted,
+		SkipUntrusted:  !opts.AllowUntrusted,
+	})
+	if err != nil {
+		return nil, err
+	}
+	factory := runtime.NewFactory(runtime.FactoryOptions{
+		HandshakeTimeout: 2 * time.Second,
+		ShutdownTimeout:  3 * time.Second,
+		OnStderr:         opts.OnStderr,
+	})
+	clients, err := repo.StartClients(ctx, factory)
+	if err != nil {
+		return nil, err
+	}
+	m := &member{p: &engine.Pipeline{
+		Clients: clients,
+		Opts:    engine.Options{Strict: opts.Strict || repo.Config.Strictness == "error", RepoRoot: repo.Root, Instance: repo.Instance},
+	}}
+	if m.conf, err = memberConfig(ctx, ws, repo, m.p, shared, opts.Timeout); err != nil {
+		m.close()
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *member) close() {
+	closeCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_ = repository.CloseClients(closeCtx, m.p.Clients)
+}
+
+func (m *member) teardown(ctx context.Context, services []string, timeout time.Duration) error {
+	if !m.p.Supports("teardown.run") {
+		return nil
+	}
+	opCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	tr, err := m.p.Teardown(opCtx, m.conf, services)
+	if err != nil {
+		return err
+	}
+	for _, step := range tr.Steps {
+		if !step.Ok {
+			return errors.Errorf("teardown step failed: %s", step.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+// Package workspace runs several repos, each with its own .devctl.yaml, as one
+// environment. A devctl.workspace.yaml lists the member repos and their
+// dependencies; `devctl up --workspace` runs every member's pipeline in
+// dependency order and supervises all services together under the workspace
+// root, named <repo>.<service>.
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/go-go-golems/devctl/pkg/engine"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const Filename = "devctl.workspace.yaml"
+
+// Repo is one member of a workspace.
+type Repo struct {
+	Name string `yaml:"name"`
+	// Path is the repo root, relative to the workspace file.
+	Path string `yaml:"path"`
+	// Config overrides the repo's .devctl.yaml path (relative to Path).
+	Config  string `yaml:"config,omitempty"`
+	Profile string `yaml:"profile,omitempty"`
+	// DependsOn names members whose services must be healthy before this
+	// repo's pipeline runs; their config is visible as repos.<name>.
+	DependsOn []string `yaml:"depends_on,omitempty"`
+}
+
+// File is the content of devctl.workspace.yaml.
+type File struct {
+	Repos []Repo `yaml:"repos"`
+	// Config is shared with every member as workspace.<key>.
+	Config map[string]any `yaml:"config,omitempty"`
+}
+
+// Workspace is a loaded workspace file with member paths made absolute.
+type Workspace struct {
+	Root string
+	File
+}
+
+var nameRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]*$`)
+
+func Path(root string) string {
+	return filepath.Join(root, Filename)
+}
+
+// Exists reports whether root contains a workspace file.
+func Exists(root string) bool {
+	_, err := os.Stat(Path(root))
+	return err == nil
+}
+
+// Load reads and validates root's workspace file.
+func Load(root string) (*Workspace, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(Path(root))
+	if err != nil {
+		return nil, errors.Wrap(err, "read workspace")
+	}
+	var f File
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return nil, errors.Wrapf(err, "parse %s", Filename)
+	}
+	if len(f.Repos) == 0 {
+		return nil, errors.Errorf("%s lists no repos", Filename)
+	}
+	seen := map[string]bool{}
+	for i := range f.Repos {
+		r := &f.Repos[i]
+		if !nameRe.MatchString(r.Name) {
+			return nil, errors.Errorf("workspace repo %d: invalid name %q (letters, digits, - and _)", i, r.Name)
+		}
+		if seen[r.Name] {
+			return nil, errors.Errorf("workspace repo %q listed twice", r.Name)
+		}
+		seen[r.Name] = true
+		if r.Path == "" {
+			return nil, errors.Errorf("workspace repo %q: missing path", r.Name)
+		}
+		if !filepath.IsAbs(r.Path) {
+			r.Path = filepath.Join(root, r.Path)
+		}
+		if r.Config != "" && !filepath.IsAbs(r.Config) {
+			r.Config = filepath.Join(r.Path, r.Config)
+		}
+	}
+	ws := &Workspace{Root: root, File: f}
+	if _, err := ws.Order(); err != nil {
+		return nil, err
+	}
+	return ws, nil
+}
+
+// Repo returns the member called name.
+func (w *Workspace) Repo(name string) (Repo, bool) {
+	for _, r := range w.Repos {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return Repo{}, false
+}
+
+// Order returns the members so that every repo comes after its dependencies,
+// otherwise keeping file order.
+func (w *Workspace) Order() ([]Repo, error) {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	mark := map[string]int{}
+	out := make([]Repo, 0, len(w.Repos))
+	var visit func(r Repo, path []string) error
+	visit = func(r Repo, path []string) error {
+		switch mark[r.Name] {
+		case done:
+			return nil
+		case visiting:
+			return errors.Errorf("workspace dependency cycle: %s", strings.Join(append(path, r.Name), " -> "))
+		}
+		mark[r.Name] = visiting
+		for _, dep := range r.DependsOn {
+			d, ok := w.Repo(dep)
+			if !ok {
+				return errors.Errorf("workspace repo %q depends on unknown repo %q", r.Name, dep)
+			}
+			if err := visit(d, append(path, r.Name)); err != nil {
+				return err
+			}
+		}
+		mark[r.Name] = done
+		out = append(out, r)
+		return nil
+	}
+	for _, r := range w.Repos {
+		if err := visit(r, nil); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// ServiceName is the workspace-wide name of a member's service.
+func ServiceName(repo, service string) string {
+	return repo + "." + service
+}
+
+// SplitServiceName is the inverse of ServiceName.
+func SplitServiceName(name string) (repo, service string, ok bool) {
+	return strings.Cut(name, ".")
+}
+
+// prefixPlan renames r's services and anchors their relative paths at r.Path
+// so they can be supervised from the workspace root. Dependencies that are
+// already qualified (<repo>.<service>) are kept as they are.
+func prefixPlan(r Repo, plan engine.LaunchPlan) engine.LaunchPlan {
+	out := engine.LaunchPlan{Services: make([]engine.ServiceSpec, 0, len(plan.Services))}
+	for _, svc := range plan.Services {
+		svc.Name = ServiceName(r.Name, svc.Name)
+		if len(svc.DependsOn) > 0 {
+			deps := make([]string, len(svc.DependsOn))
+			for i, d := range svc.DependsOn {
+				if _, _, qualified := SplitServiceName(d); !qualified {
+					d = ServiceName(r.Name, d)
+				}
+				deps[i] = d
+			}
+			svc.DependsOn = deps
+		}
+		switch {
+		case svc.Cwd == "":
+			svc.Cwd = r.Path
+		case !filepath.IsAbs(svc.Cwd):
+			svc.Cwd = filepath.Join(r.Path, svc.Cwd)
+		}
+		if len(svc.EnvFile) > 0 {
+			files := make([]string, len(svc.EnvFile))
+			for i, f := range svc.EnvFile {
+				if !filepath.IsAbs(f) {
+					f = filepath.Join(r.Path, f)
+				}
+				files[i] = f
+			}
+			svc.EnvFile = files
+		}
+		if svc.Logs != nil {
+			logs := *svc.Logs
+			logs.Parsers = make([]string, len(svc.Logs.Parsers))
+			for i, f := range svc.Logs.Parsers {
+				if !filepath.IsAbs(f) {
+					f = filepath.Join(r.Path, f)
+				}
+				logs.Parsers[i] = f
+			}
+			svc.Logs = &logs
+		}
+		out.Services = append(out.Services, svc)
+	}
+	return out
+}
+
+// localPlan drops dependencies on other members' services from r's prefixed
+// plan before it is supervised: those members ran first, so their services
+// are already up. planned holds the services of the members before r.
+func localPlan(r Repo, plan engine.LaunchPlan, planned map[string]bool) (engine.LaunchPlan, error) {
+	out := engine.LaunchPlan{Services: make([]engine.ServiceSpec, 0, len(plan.Services))}
+	for _, svc := range plan.Services {
+		var deps []string
+		for _, d := range svc.DependsOn {
+			if repo, _, _ := SplitServiceName(d); repo == r.Name {
+				deps = append(deps, d)
+				continue
+			}
+			if !planned[d] {
+				return engine.LaunchPlan{}, errors.Errorf("service %q depends on %q, which is not started before repo %s (check the repo's depends_on)", svc.Name, d, r.Name)
+			}
+		}
+		svc.DependsOn = deps
+		out.Services = append(out.Services, svc)
+	}
+	return out, nil
+}
@@ -0,0 +1,121 @@
+package workspace
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-go-golems/devctl/pkg/engine"
+	"github.com/go-go-golems/devctl/pkg/patch"
+	"github.com/go-go-golems/devctl/pkg/repository"
+)
+
+func writeWorkspace(t *testing.T, content string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(Path(dir), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestLoadOrdersByDependencies(t *testing.T) {
+	dir := writeWorkspace(t, `
+repos:
+  - name: web
+    path: ../web
+    depends_on: [api]
+  - name: api
+    path: ../api
+    depends_on: [db]
+  - name: db
+    path: /srv/db
+  - name: docs
+    path: docs
+`)
+	ws, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order, err := ws.Order()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, r := range order {
+		names = append(names, r.Name)
+	}
+	if got := strings.Join(names, ","); got != "db,api,web,docs" {
+		t.Fatalf("order = %s", got)
+	}
+	if r, _ := ws.Repo("docs"); r.Path != filepath.Join(dir, "docs") {
+		t.Fatalf("docs path = %s", r.Path)
+	}
+
+	cycle := writeWorkspace(t, `
+repos:
+  - {name: a, path: a, depends_on: [b]}
+  - {name: b, path: b, depends_on: [a]}
+`)
+	if _, err := Load(cycle); err == nil || !strings.Contains(err.Error(), "a -> b -> a") {
+		t.Fatalf("expected cycle error, got %v", err)
+	}
+}
+
+func TestPrefixPlan(t *testing.T) {
+	r := Repo{Name: "api", Path: "/src/api"}
+	plan := prefixPlan(r, engine.LaunchPlan{Services: []engine.ServiceSpec{
+		{Name: "web", Command: []string{"true"}, EnvFile: []string{".env"}},
+		{Name: "worker", Cwd: "worker", Command: []string{"true"}, DependsOn: []string{"web", "db.postgres"}},
+	}})
+	web, worker := plan.Services[0], plan.Services[1]
+	if web.Name != "api.web" || web.Cwd != "/src/api" || web.EnvFile[0] != "/src/api/.env" {
+		t.Fatalf("web = %+v", web)
+	}
+	if worker.Name != "api.worker" || worker.Cwd != "/src/api/worker" {
+		t.Fatalf("worker = %+v", worker)
+	}
+	if got := strings.Join(worker.DependsOn, ","); got != "api.web,db.postgres" {
+		t.Fatalf("worker deps = %s", got)
+	}
+}
+
+func TestLocalPlan(t *testing.T) {
+	r := Repo{Name: "api", Path: "/src/api"}
+	plan := engine.LaunchPlan{Services: []engine.ServiceSpec{
+		{Name: "api.web", DependsOn: []string{"api.migrate", "db.postgres"}},
+	}}
+	local, err := localPlan(r, plan, map[string]bool{"db.postgres": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(local.Services[0].DependsOn, ","); got != "api.migrate" {
+		t.Fatalf("local deps = %s", got)
+	}
+	if len(plan.Services[0].DependsOn) != 2 {
+		t.Fatal("plan was modified")
+	}
+
+	_, err = localPlan(r, plan, map[string]bool{})
+	if err == nil || !strings.Contains(err.Error(), `"db.postgres"`) {
+		t.Fatalf("expected unknown dependency error, got %v", err)
+	}
+}
+
+func TestMemberConfig_AddsSharedNamespaces(t *testing.T) {
+	ws := &Workspace{File: File{Config: map[string]any{"tenant": "acme"}}}
+	repo := &repository.Repository{Ports: map[string]int{"web": 3000}}
+	shared := map[string]any{"db": patch.Config{"ports": map[string]any{"db": 5432}}}
+	conf, err := memberConfig(context.Background(), ws, repo, &engine.Pipeline{}, shared, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]any{"workspace.tenant": "acme", "repos.db.ports.db": 5432, "ports.web": 3000} {
+		if got, ok := patch.Lookup(conf, path); !ok || got != want {
+			t.Fatalf("%s = %v, want %v (config %v)", path, got, want, conf)
+		}
+	}
+}